@@ -0,0 +1,32 @@
+package bus_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mudler/go-pluggable"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bus Suite")
+}
+
+// newPlugin writes a plugin running the given shell script in a temporary
+// directory.
+func newPlugin(name, script string) pluggable.Plugin {
+	executable := filepath.Join(GinkgoT().TempDir(), name)
+	ExpectWithOffset(1, os.WriteFile(executable, []byte("#!/bin/sh\n"+script+"\n"), 0755)).To(Succeed())
+	return pluggable.Plugin{Name: name, Executable: executable}
+}
+
+// newManager returns a manager with the given plugins, listening to every
+// event of the bus.
+func newManager(plugins ...pluggable.Plugin) *pluggable.Manager {
+	m := pluggable.NewManager(nil)
+	m.Plugins = plugins
+	return m
+}
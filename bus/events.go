@@ -1,6 +1,9 @@
 package bus
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/mudler/go-pluggable"
 )
 
@@ -33,6 +36,13 @@ const (
 
 	EventAfterReset  pluggable.EventType = "agent.reset.after"
 	EventBeforeReset pluggable.EventType = "agent.reset.before"
+
+	// Kcrypt events, with a KcryptPayload. Plugins can veto the operation in
+	// the "before" events by returning an error, see PublishWithVeto.
+	EventKcryptBeforeEncrypt pluggable.EventType = "kcrypt.encrypt.before"
+	EventKcryptAfterEncrypt  pluggable.EventType = "kcrypt.encrypt.after"
+	EventKcryptBeforeUnlock  pluggable.EventType = "kcrypt.unlock.before"
+	EventKcryptAfterUnlock   pluggable.EventType = "kcrypt.unlock.after"
 )
 
 type InstallPayload struct {
@@ -65,6 +75,18 @@ type VersionImagePayload struct {
 	Version string `json:"version"`
 }
 
+// KcryptPayload describes the partition of a kcrypt event.
+type KcryptPayload struct {
+	Label  string `json:"label"`
+	Device string `json:"device,omitempty"`
+	UUID   string `json:"uuid,omitempty"`
+	// Method is how the partition is encrypted or unlocked, e.g. "tpm",
+	// "remote" or "passphrase"
+	Method string `json:"method,omitempty"`
+	// Error is set in the "after" events when the operation failed
+	Error string `json:"error,omitempty"`
+}
+
 // AllEvents is a convenience list of all the events streamed from the bus.
 var AllEvents = []pluggable.EventType{
 	EventBootstrap,
@@ -78,6 +100,11 @@ var AllEvents = []pluggable.EventType{
 	EventRecoveryStop,
 	EventAvailableReleases,
 	EventVersionImage,
+	EventKcryptBeforeEncrypt,
+	EventKcryptAfterEncrypt,
+	EventKcryptBeforeUnlock,
+	EventKcryptAfterUnlock,
+	EventHandshake,
 }
 
 // IsEventDefined checks wether an event is defined in the bus.
@@ -107,3 +134,25 @@ func IsEventDefined(i interface{}) bool {
 func EventError(err error) pluggable.EventResponse {
 	return pluggable.EventResponse{Error: err.Error()}
 }
+
+// PublishWithVeto publishes the event like PublishWithMetrics, and returns the
+// errors of the plugins that failed or returned an error, so the caller can
+// abort the operation the event is about.
+func PublishWithVeto(manager *pluggable.Manager, event pluggable.EventType, obj interface{}) error {
+	var vetoes []error
+	err := publish(manager, nil, event, obj, func(p pluggable.Plugin, e pluggable.Event) (pluggable.EventResponse, error) {
+		resp, err := p.Run(e)
+		if err != nil {
+			vetoes = append(vetoes, fmt.Errorf("plugin %s: %w", p.Name, err))
+		} else if resp.Errored() {
+			vetoes = append(vetoes, fmt.Errorf("plugin %s: %s", p.Name, resp.Error))
+		}
+		return resp, err
+	})
+	if len(vetoes) == 0 {
+		// the event could not be created
+		return err
+	}
+
+	return errors.Join(vetoes...)
+}
@@ -0,0 +1,55 @@
+package bus_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/bus"
+	"github.com/mudler/go-pluggable"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PublishWithVeto", func() {
+	var ran string
+
+	BeforeEach(func() {
+		ran = filepath.Join(GinkgoT().TempDir(), "ran")
+	})
+
+	// plugin answers with the given response after recording it ran
+	plugin := func(name, response string) pluggable.Plugin {
+		return newPlugin(name, "echo "+name+" >> "+ran+"\necho '"+response+"'")
+	}
+
+	It("succeeds when no plugin vetoes", func() {
+		m := newManager(plugin("first", `{"data": "ok"}`), plugin("second", `{}`))
+		Expect(bus.PublishWithVeto(m, bus.EventKcryptBeforeEncrypt, bus.KcryptPayload{Label: "COS_PERSISTENT"})).To(Succeed())
+		Expect(os.ReadFile(ran)).To(BeEquivalentTo("first\nsecond\n"))
+	})
+
+	It("returns the error of the plugin vetoing, after running all of them", func() {
+		m := newManager(
+			plugin("first", `{"data": "ok"}`),
+			plugin("vetoing", `{"error": "TPM not ready"}`),
+			plugin("last", `{}`),
+		)
+		results := map[string]pluggable.EventResponse{}
+		m.Response(bus.EventKcryptBeforeEncrypt, func(p *pluggable.Plugin, r *pluggable.EventResponse) {
+			results[p.Name] = *r
+		})
+
+		err := bus.PublishWithVeto(m, bus.EventKcryptBeforeEncrypt, bus.KcryptPayload{Label: "COS_PERSISTENT"})
+		Expect(err).To(MatchError("plugin vetoing: TPM not ready"))
+		Expect(os.ReadFile(ran)).To(BeEquivalentTo("first\nvetoing\nlast\n"))
+		Expect(results).To(HaveLen(3))
+		Expect(results["vetoing"].Error).To(Equal("TPM not ready"))
+	})
+
+	It("counts plugins failing to run as vetoes", func() {
+		m := newManager(newPlugin("broken", "exit 1"), plugin("fine", `{}`))
+		err := bus.PublishWithVeto(m, bus.EventKcryptBeforeUnlock, bus.KcryptPayload{Label: "COS_PERSISTENT"})
+		Expect(err).To(MatchError(ContainSubstring("plugin broken")))
+		Expect(err).ToNot(MatchError(ContainSubstring("plugin fine")))
+	})
+})
@@ -0,0 +1,149 @@
+package bus
+
+import (
+	"encoding/json"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"github.com/mudler/go-pluggable"
+)
+
+// ProtocolVersion is the major version of the event payloads sent to the
+// plugins. It's increased when a payload changes in an incompatible way.
+const ProtocolVersion = 2
+
+// EventHandshake is issued to learn the protocol version and capabilities of
+// the plugins, with a HandshakePayload. Plugins answer with a HandshakePayload
+// as the response data, see HandshakeResponse.
+const EventHandshake pluggable.EventType = "bus.handshake"
+
+// Capabilities a plugin can announce in the handshake.
+const (
+	// CapabilityVeto means the plugin may fail the "before" events to abort
+	// the operation, see PublishWithVeto
+	CapabilityVeto = "veto"
+	// CapabilityPayloadFile means the plugin reads the payload from the event
+	// File when it's too big to be passed inline
+	CapabilityPayloadFile = "payload-file"
+)
+
+// Capabilities are the capabilities supported by the SDK, sent in the
+// handshake.
+var Capabilities = []string{CapabilityVeto, CapabilityPayloadFile}
+
+// HandshakePayload is the payload of EventHandshake and the data of the
+// plugins response.
+type HandshakePayload struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+}
+
+// PluginInfo is what a plugin answered to the handshake.
+type PluginInfo struct {
+	Name            string
+	ProtocolVersion int
+	Capabilities    []string
+	// Legacy is true for plugins that don't answer the handshake. They are
+	// assumed to be built for the previous protocol version.
+	Legacy bool
+}
+
+// Compatible returns whether the SDK can talk to the plugin, either because
+// it uses the current protocol version or the previous one, whose payloads are
+// translated.
+func (pi PluginInfo) Compatible() bool {
+	return pi.ProtocolVersion == ProtocolVersion || pi.ProtocolVersion == ProtocolVersion-1
+}
+
+// Has returns whether the plugin announced the capability.
+func (pi PluginInfo) Has(capability string) bool {
+	for _, c := range pi.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// HandshakeResponse is the response plugins built with the SDK give to
+// EventHandshake, announcing the given capabilities.
+func HandshakeResponse(capabilities ...string) pluggable.EventResponse {
+	data, _ := json.Marshal(HandshakePayload{ProtocolVersion: ProtocolVersion, Capabilities: capabilities})
+	return pluggable.EventResponse{Data: string(data)}
+}
+
+// Handshake sends EventHandshake to every plugin of the manager and returns
+// what each one answered, by plugin name. A compatibility warning is logged
+// for the plugins answering with a different protocol version. Plugins that
+// don't understand the handshake are expected while they are rebuilt with a
+// newer SDK, so they are only logged at debug level.
+func Handshake(manager *pluggable.Manager, logger *types.KairosLogger) map[string]PluginInfo {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("bus", "info", false)
+		logger = &newLogger
+	}
+	result := map[string]PluginInfo{}
+
+	ev, err := pluggable.NewEvent(EventHandshake, HandshakePayload{ProtocolVersion: ProtocolVersion, Capabilities: Capabilities})
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to create the handshake event")
+		return result
+	}
+	for _, p := range manager.Plugins {
+		info := PluginInfo{Name: p.Name, ProtocolVersion: ProtocolVersion - 1, Legacy: true}
+		resp, err := p.Run(*ev)
+		answer := HandshakePayload{}
+		if err == nil && !resp.Errored() && json.Unmarshal([]byte(resp.Data), &answer) == nil && answer.ProtocolVersion > 0 {
+			info = PluginInfo{Name: p.Name, ProtocolVersion: answer.ProtocolVersion, Capabilities: answer.Capabilities}
+		}
+		result[p.Name] = info
+
+		switch {
+		case info.Legacy:
+			logger.Logger.Debug().Str("plugin", p.Name).Int("protocol", ProtocolVersion).Msg("Plugin doesn't support the handshake, assuming it was built for the previous protocol version. Its payloads will be translated, consider rebuilding it with a newer SDK")
+		case !info.Compatible():
+			logger.Logger.Warn().Str("plugin", p.Name).Int("plugin_protocol", info.ProtocolVersion).Int("protocol", ProtocolVersion).Msg("Plugin uses an incompatible protocol version, it might not understand the event payloads")
+		case info.ProtocolVersion != ProtocolVersion:
+			logger.Logger.Warn().Str("plugin", p.Name).Int("plugin_protocol", info.ProtocolVersion).Int("protocol", ProtocolVersion).Msg("Plugin uses the previous protocol version, its payloads will be translated")
+		default:
+			logger.Logger.Debug().Str("plugin", p.Name).Strs("capabilities", info.Capabilities).Msg("Plugin handshake")
+		}
+	}
+
+	return result
+}
+
+// PayloadTranslator converts a payload to the shape expected by plugins
+// built for the previous protocol version.
+type PayloadTranslator func(obj interface{}) (interface{}, error)
+
+// PayloadTranslators are the translators for the events whose payload changed
+// in the current protocol version. The payloads of other events are sent
+// unchanged.
+var PayloadTranslators = map[pluggable.EventType]PayloadTranslator{}
+
+// PublishCompatible publishes the event like PublishWithMetrics, translating
+// the payload with PayloadTranslators for the plugins that use the previous
+// protocol version according to the Handshake result. Plugins missing from
+// plugins are assumed to use the current version.
+func PublishCompatible(manager *pluggable.Manager, plugins map[string]PluginInfo, metrics *Metrics, event pluggable.EventType, obj interface{}) error {
+	translate, ok := PayloadTranslators[event]
+	if !ok {
+		return PublishWithMetrics(manager, metrics, event, obj)
+	}
+
+	previous, err := translate(obj)
+	if err != nil {
+		return err
+	}
+	previousEv, err := pluggable.NewEvent(event, previous)
+	if err != nil {
+		return err
+	}
+
+	return publish(manager, metrics, event, obj, func(p pluggable.Plugin, e pluggable.Event) (pluggable.EventResponse, error) {
+		if info, ok := plugins[p.Name]; ok && info.ProtocolVersion == ProtocolVersion-1 {
+			return p.Run(*previousEv)
+		}
+		return p.Run(e)
+	})
+}
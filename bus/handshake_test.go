@@ -0,0 +1,124 @@
+package bus_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/bus"
+	"github.com/kairos-io/kairos-sdk/types"
+	"github.com/mudler/go-pluggable"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// handshakePlugin answers the handshake with the given protocol version and
+// capabilities. Other events are saved to events/<name>.json.
+func handshakePlugin(events, name string, version int, capabilities ...string) pluggable.Plugin {
+	data, err := json.Marshal(bus.HandshakePayload{ProtocolVersion: version, Capabilities: capabilities})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	response, err := json.Marshal(pluggable.EventResponse{Data: string(data)})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return newPlugin(name, fmt.Sprintf(`if [ "$1" = "%s" ]; then echo '%s'; exit 0; fi
+cat > %s; echo '{}'`, bus.EventHandshake, response, filepath.Join(events, name+".json")))
+}
+
+// logLines returns the level and plugin of each line logged.
+func logLines(b *bytes.Buffer) []string {
+	result := []string{}
+	for _, l := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		line := struct {
+			Level  string `json:"level"`
+			Plugin string `json:"plugin"`
+		}{}
+		ExpectWithOffset(1, json.Unmarshal([]byte(l), &line)).To(Succeed())
+		result = append(result, line.Level+" "+line.Plugin)
+	}
+	return result
+}
+
+var _ = Describe("Handshake", func() {
+	var buf *bytes.Buffer
+	var logger types.KairosLogger
+	var events string
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		logger = types.NewBufferLogger(buf)
+		events = GinkgoT().TempDir()
+	})
+
+	// payload returns the payload of the event the plugin received
+	payload := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(events, name+".json"))
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ev := pluggable.Event{}
+		ExpectWithOffset(1, json.Unmarshal(data, &ev)).To(Succeed())
+		return ev.Data
+	}
+
+	It("returns what each plugin answered", func() {
+		m := newManager(
+			handshakePlugin(events, "current", bus.ProtocolVersion, bus.CapabilityVeto),
+			handshakePlugin(events, "previous", bus.ProtocolVersion-1),
+			handshakePlugin(events, "future", bus.ProtocolVersion+1),
+			newPlugin("legacy", `echo '{}'`),
+			newPlugin("broken", "exit 1"),
+		)
+
+		plugins := bus.Handshake(m, &logger)
+		Expect(plugins).To(Equal(map[string]bus.PluginInfo{
+			"current":  {Name: "current", ProtocolVersion: bus.ProtocolVersion, Capabilities: []string{bus.CapabilityVeto}},
+			"previous": {Name: "previous", ProtocolVersion: bus.ProtocolVersion - 1},
+			"future":   {Name: "future", ProtocolVersion: bus.ProtocolVersion + 1},
+			"legacy":   {Name: "legacy", ProtocolVersion: bus.ProtocolVersion - 1, Legacy: true},
+			"broken":   {Name: "broken", ProtocolVersion: bus.ProtocolVersion - 1, Legacy: true},
+		}))
+
+		Expect(plugins["current"].Has(bus.CapabilityVeto)).To(BeTrue())
+		Expect(plugins["current"].Has(bus.CapabilityPayloadFile)).To(BeFalse())
+		Expect(plugins["previous"].Compatible()).To(BeTrue())
+		Expect(plugins["legacy"].Compatible()).To(BeTrue())
+		Expect(plugins["future"].Compatible()).To(BeFalse())
+	})
+
+	It("only warns about the plugins answering with another version", func() {
+		m := newManager(
+			handshakePlugin(events, "current", bus.ProtocolVersion),
+			handshakePlugin(events, "previous", bus.ProtocolVersion-1),
+			handshakePlugin(events, "future", bus.ProtocolVersion+1),
+			newPlugin("legacy", `echo '{}'`),
+		)
+
+		bus.Handshake(m, &logger)
+		Expect(logLines(buf)).To(Equal([]string{
+			"debug current",
+			"warn previous",
+			"warn future",
+			"debug legacy",
+		}))
+	})
+
+	It("translates the payloads for the plugins using the previous version", func() {
+		m := newManager(
+			handshakePlugin(events, "current", bus.ProtocolVersion),
+			handshakePlugin(events, "previous", bus.ProtocolVersion-1),
+		)
+		plugins := bus.Handshake(m, &logger)
+
+		bus.PayloadTranslators[bus.EventInstall] = func(obj interface{}) (interface{}, error) {
+			return map[string]string{"cfg": obj.(bus.EventPayload).Config}, nil
+		}
+		DeferCleanup(func() { delete(bus.PayloadTranslators, bus.EventInstall) })
+
+		Expect(bus.PublishCompatible(m, plugins, nil, bus.EventInstall, bus.EventPayload{Config: "c"})).To(Succeed())
+		Expect(payload("current")).To(Equal(`{"config":"c"}`))
+		Expect(payload("previous")).To(Equal(`{"cfg":"c"}`))
+
+		Expect(bus.PublishCompatible(m, plugins, nil, bus.EventBoot, bus.EventPayload{Config: "c"})).To(Succeed())
+		Expect(payload("previous")).To(Equal(`{"config":"c"}`))
+	})
+})
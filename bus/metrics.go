@@ -0,0 +1,190 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"github.com/mudler/go-pluggable"
+)
+
+// DurationBuckets are the upper bounds of the histogram buckets used to
+// record plugin execution times. Runs slower than the last bucket are only
+// counted in Calls.
+var DurationBuckets = []time.Duration{
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	30 * time.Second,
+	2 * time.Minute,
+}
+
+// MetricsExporter receives every plugin run recorded by Metrics. It allows
+// exporting the metrics to other systems, e.g. the kairos-agent metrics
+// endpoint.
+type MetricsExporter interface {
+	ObservePluginRun(plugin string, event pluggable.EventType, duration time.Duration, failed bool)
+}
+
+// PluginMetrics holds the metrics of a plugin for a given event.
+type PluginMetrics struct {
+	Plugin   string
+	Event    pluggable.EventType
+	Calls    uint64
+	Failures uint64
+	Total    time.Duration
+	Max      time.Duration
+	// Buckets counts the runs that took at most the matching DurationBuckets
+	// value. Buckets are not cumulative.
+	Buckets []uint64
+}
+
+// Average returns the average execution time.
+func (pm PluginMetrics) Average() time.Duration {
+	if pm.Calls == 0 {
+		return 0
+	}
+	return pm.Total / time.Duration(pm.Calls)
+}
+
+type metricsKey struct {
+	plugin string
+	event  pluggable.EventType
+}
+
+// Metrics records the execution time and failures of the plugins for each
+// event. It is safe for concurrent use.
+type Metrics struct {
+	// Logger, if set, logs every plugin run at debug level
+	Logger *types.KairosLogger
+	// Exporters are called for every plugin run
+	Exporters []MetricsExporter
+
+	mu   sync.Mutex
+	data map[metricsKey]*PluginMetrics
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics(exporters ...MetricsExporter) *Metrics {
+	return &Metrics{
+		Exporters: exporters,
+		data:      map[metricsKey]*PluginMetrics{},
+	}
+}
+
+// ObservePluginRun records a plugin run. Metrics implements MetricsExporter so
+// it can be chained with other Metrics.
+func (m *Metrics) ObservePluginRun(plugin string, event pluggable.EventType, duration time.Duration, failed bool) {
+	m.mu.Lock()
+	if m.data == nil {
+		m.data = map[metricsKey]*PluginMetrics{}
+	}
+	key := metricsKey{plugin: plugin, event: event}
+	pm, ok := m.data[key]
+	if !ok {
+		pm = &PluginMetrics{Plugin: plugin, Event: event, Buckets: make([]uint64, len(DurationBuckets))}
+		m.data[key] = pm
+	}
+	pm.Calls++
+	if failed {
+		pm.Failures++
+	}
+	pm.Total += duration
+	if duration > pm.Max {
+		pm.Max = duration
+	}
+	for i, b := range DurationBuckets {
+		if duration <= b {
+			pm.Buckets[i]++
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if m.Logger != nil {
+		m.Logger.Logger.Debug().Str("plugin", plugin).Str("event", string(event)).Dur("duration", duration).Bool("failed", failed).Msg("Plugin run")
+	}
+	for _, e := range m.Exporters {
+		e.ObservePluginRun(plugin, event, duration, failed)
+	}
+}
+
+// Get returns the metrics of the given plugin and event. The second value is
+// false if the plugin never ran for that event.
+func (m *Metrics) Get(plugin string, event pluggable.EventType) (PluginMetrics, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pm, ok := m.data[metricsKey{plugin: plugin, event: event}]
+	if !ok {
+		return PluginMetrics{}, false
+	}
+	return pm.copy(), true
+}
+
+// Snapshot returns a copy of all the recorded metrics, sorted by plugin and
+// event.
+func (m *Metrics) Snapshot() []PluginMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]PluginMetrics, 0, len(m.data))
+	for _, pm := range m.data {
+		result = append(result, pm.copy())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Plugin != result[j].Plugin {
+			return result[i].Plugin < result[j].Plugin
+		}
+		return result[i].Event < result[j].Event
+	})
+
+	return result
+}
+
+func (pm *PluginMetrics) copy() PluginMetrics {
+	c := *pm
+	c.Buckets = append([]uint64{}, pm.Buckets...)
+	return c
+}
+
+// PublishWithMetrics publishes the event to every plugin of the manager,
+// recording how long each plugin took and whether it failed. The plugin
+// results are emitted on the manager bus like Publish does, so the listeners
+// registered with Response keep working. The errors of the plugins that could
+// not be run are joined in the returned error, the errors plugins answer with
+// are only emitted in their results.
+func PublishWithMetrics(manager *pluggable.Manager, metrics *Metrics, event pluggable.EventType, obj interface{}) error {
+	return publish(manager, metrics, event, obj, pluggable.Plugin.Run)
+}
+
+// publish runs the event on every plugin of the manager with the given run
+// function, returning the run errors joined.
+func publish(manager *pluggable.Manager, metrics *Metrics, event pluggable.EventType, obj interface{}, run func(pluggable.Plugin, pluggable.Event) (pluggable.EventResponse, error)) error {
+	ev, err := pluggable.NewEvent(event, obj)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, p := range manager.Plugins {
+		start := time.Now()
+		resp, err := run(p, *ev)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name, err))
+			if !resp.Errored() {
+				resp.Error = err.Error()
+			}
+		}
+		if metrics != nil {
+			metrics.ObservePluginRun(p.Name, event, time.Since(start), resp.Errored())
+		}
+		manager.Bus.Emit(string(ev.ResponseEventName("results")), &p, &resp)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package bus_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/bus"
+	"github.com/mudler/go-pluggable"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type run struct {
+	plugin   string
+	event    pluggable.EventType
+	duration time.Duration
+	failed   bool
+}
+
+type fakeExporter struct {
+	mu   sync.Mutex
+	runs []run
+}
+
+func (e *fakeExporter) ObservePluginRun(plugin string, event pluggable.EventType, duration time.Duration, failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runs = append(e.runs, run{plugin, event, duration, failed})
+}
+
+var _ = Describe("Metrics", func() {
+	It("records the calls, failures and times of each plugin and event", func() {
+		m := bus.NewMetrics()
+		m.ObservePluginRun("foo", bus.EventBoot, 200*time.Millisecond, false)
+		m.ObservePluginRun("foo", bus.EventBoot, 600*time.Millisecond, true)
+		m.ObservePluginRun("foo", bus.EventInstall, time.Second, false)
+
+		pm, ok := m.Get("foo", bus.EventBoot)
+		Expect(ok).To(BeTrue())
+		Expect(pm.Calls).To(BeEquivalentTo(2))
+		Expect(pm.Failures).To(BeEquivalentTo(1))
+		Expect(pm.Total).To(Equal(800 * time.Millisecond))
+		Expect(pm.Max).To(Equal(600 * time.Millisecond))
+		Expect(pm.Average()).To(Equal(400 * time.Millisecond))
+
+		_, ok = m.Get("foo", bus.EventRecovery)
+		Expect(ok).To(BeFalse())
+		_, ok = m.Get("bar", bus.EventBoot)
+		Expect(ok).To(BeFalse())
+		Expect(bus.PluginMetrics{}.Average()).To(BeZero())
+	})
+
+	It("counts each run in the first bucket that fits it", func() {
+		m := &bus.Metrics{}
+		for _, d := range []time.Duration{
+			50 * time.Millisecond,
+			100 * time.Millisecond,
+			101 * time.Millisecond,
+			time.Second,
+			10 * time.Second,
+			2 * time.Minute,
+			time.Hour,
+		} {
+			m.ObservePluginRun("foo", bus.EventBoot, d, false)
+		}
+
+		pm, ok := m.Get("foo", bus.EventBoot)
+		Expect(ok).To(BeTrue())
+		Expect(pm.Buckets).To(HaveLen(len(bus.DurationBuckets)))
+		// 100ms, 500ms, 1s, 5s, 30s and 2m, the hour long run is only counted
+		// in the calls
+		Expect(pm.Buckets).To(Equal([]uint64{2, 1, 1, 0, 1, 1}))
+		Expect(pm.Calls).To(BeEquivalentTo(7))
+	})
+
+	It("returns copies sorted by plugin and event", func() {
+		m := bus.NewMetrics()
+		m.ObservePluginRun("foo", bus.EventInstall, time.Millisecond, false)
+		m.ObservePluginRun("bar", bus.EventInstall, time.Millisecond, false)
+		m.ObservePluginRun("foo", bus.EventBoot, time.Millisecond, false)
+
+		snapshot := m.Snapshot()
+		Expect(snapshot).To(HaveLen(3))
+		Expect([]string{snapshot[0].Plugin, snapshot[1].Plugin, snapshot[2].Plugin}).To(Equal([]string{"bar", "foo", "foo"}))
+		Expect([]pluggable.EventType{snapshot[1].Event, snapshot[2].Event}).To(Equal([]pluggable.EventType{bus.EventBoot, bus.EventInstall}))
+
+		snapshot[0].Buckets[0] = 100
+		pm, _ := m.Get("bar", bus.EventInstall)
+		Expect(pm.Buckets[0]).To(BeEquivalentTo(1))
+	})
+
+	It("forwards the runs to the exporters", func() {
+		exporter := &fakeExporter{}
+		chained := bus.NewMetrics()
+		m := bus.NewMetrics(exporter, chained)
+		m.ObservePluginRun("foo", bus.EventBoot, time.Second, true)
+
+		Expect(exporter.runs).To(Equal([]run{{"foo", bus.EventBoot, time.Second, true}}))
+		pm, ok := chained.Get("foo", bus.EventBoot)
+		Expect(ok).To(BeTrue())
+		Expect(pm.Failures).To(BeEquivalentTo(1))
+	})
+
+	It("is safe for concurrent use", func() {
+		m := bus.NewMetrics()
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.ObservePluginRun("foo", bus.EventBoot, time.Millisecond, false)
+				m.Snapshot()
+			}()
+		}
+		wg.Wait()
+		pm, _ := m.Get("foo", bus.EventBoot)
+		Expect(pm.Calls).To(BeEquivalentTo(50))
+	})
+
+	It("records the plugin runs of PublishWithMetrics", func() {
+		m := newManager(
+			newPlugin("ok", `echo '{"data": "done"}'`),
+			newPlugin("failing", `echo '{"error": "no"}'`),
+		)
+		metrics := bus.NewMetrics()
+		Expect(bus.PublishWithMetrics(m, metrics, bus.EventBoot, bus.EventPayload{})).To(Succeed())
+
+		pm, ok := metrics.Get("ok", bus.EventBoot)
+		Expect(ok).To(BeTrue())
+		Expect(pm.Calls).To(BeEquivalentTo(1))
+		Expect(pm.Failures).To(BeZero())
+		pm, ok = metrics.Get("failing", bus.EventBoot)
+		Expect(ok).To(BeTrue())
+		Expect(pm.Failures).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,171 @@
+package bus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mudler/go-pluggable"
+)
+
+// DefaultPluginCgroup is the cgroup v2 directory under which the plugin runs
+// are limited, if no CgroupParent is set.
+const DefaultPluginCgroup = "/sys/fs/cgroup/kairos-plugins"
+
+// Same threshold go-pluggable uses to pass the event data in a file instead
+// of stdin.
+const maxMessageSize = 1 << 13
+
+// Sandbox restricts what plugins can do when they are run with Run or
+// PublishSandboxed. The zero value runs plugins like go-pluggable does.
+type Sandbox struct {
+	// User runs the plugins as the given user name or uid, with its primary
+	// group and no supplementary groups.
+	User string
+	// Env lists the environment variables passed to the plugins, either as
+	// names taken from the current environment or as NAME=value pairs. The
+	// rest of the environment is removed. The whole environment is passed if
+	// nil.
+	Env []string
+	// MemoryMax limits the memory of each plugin run, in bytes (cgroup v2
+	// memory.max).
+	MemoryMax int64
+	// CPUMax limits the CPU time of each plugin run, in the cgroup v2 cpu.max
+	// format, e.g. "50000 100000" for half a CPU.
+	CPUMax string
+	// CgroupParent is the cgroup v2 directory where a cgroup is created for
+	// each plugin run. Defaults to DefaultPluginCgroup.
+	CgroupParent string
+	// ReadOnlyPaths are mounted read-only in a private mount namespace for the
+	// plugins. It needs the unshare and setpriv commands from util-linux.
+	ReadOnlyPaths []string
+	// Timeout kills the plugin if a run takes longer, failing with
+	// ErrPluginTimeout. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// ErrPluginTimeout is returned when a plugin doesn't answer within the
+// Sandbox Timeout.
+var ErrPluginTimeout = errors.New("plugin timed out")
+
+// Run runs the event on the plugin within the sandbox and returns the plugin
+// response.
+func (s *Sandbox) Run(p pluggable.Plugin, e pluggable.Event) (pluggable.EventResponse, error) {
+	r := pluggable.EventResponse{}
+	if s == nil {
+		return p.Run(e)
+	}
+
+	ev := &e
+	if len(e.Data) > maxMessageSize {
+		file, err := s.dataFile(e.Data)
+		if err != nil {
+			return r, err
+		}
+		defer os.Remove(file)
+		ev = e.Copy()
+		ev.Data = ""
+		ev.File = file
+	}
+
+	k, err := ev.JSON()
+	if err != nil {
+		return r, fmt.Errorf("while marshalling event: %w", err)
+	}
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, p.Executable, string(e.Name))
+	// Don't wait forever for children of the plugin holding its output
+	cmd.WaitDelay = time.Second
+	cleanup, err := s.confine(cmd, p.Name)
+	if err != nil {
+		return r, fmt.Errorf("while sandboxing plugin %s: %w", p.Name, err)
+	}
+	defer cleanup()
+
+	cmd.Stdin = bytes.NewBufferString(k)
+	cmd.Env = s.environ()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		r.Error = fmt.Sprintf("plugin %s timed out after %s", p.Name, s.Timeout)
+		return r, fmt.Errorf("%w: %s after %s", ErrPluginTimeout, p.Name, s.Timeout)
+	}
+	if err != nil {
+		r.Error = "error while executing plugin: " + err.Error() + stderr.String()
+		return r, fmt.Errorf("while executing plugin: %w: %s", err, stderr.String())
+	}
+
+	if err := json.Unmarshal(out, &r); err != nil {
+		r.Error = err.Error()
+		return r, fmt.Errorf("while unmarshalling response: %w", err)
+	}
+
+	return r, nil
+}
+
+// environ returns the environment of the plugins.
+func (s *Sandbox) environ() []string {
+	if s.Env == nil {
+		return os.Environ()
+	}
+
+	env := []string{}
+	for _, e := range s.Env {
+		if strings.Contains(e, "=") {
+			env = append(env, e)
+			continue
+		}
+		if v, ok := os.LookupEnv(e); ok {
+			env = append(env, fmt.Sprintf("%s=%s", e, v))
+		}
+	}
+
+	return env
+}
+
+// dataFile writes the event data to a temporary file only readable by the
+// sandbox user.
+func (s *Sandbox) dataFile(data string) (string, error) {
+	f, err := os.CreateTemp("", "pluggable")
+	if err != nil {
+		return "", fmt.Errorf("while creating temporary file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("while writing to temporary file: %w", err)
+	}
+	if s.User != "" {
+		uid, gid, err := lookupUser(s.User)
+		if err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+		if err := f.Chown(uid, gid); err != nil {
+			os.Remove(f.Name())
+			return "", fmt.Errorf("while changing the temporary file owner: %w", err)
+		}
+	}
+
+	return f.Name(), nil
+}
+
+// PublishSandboxed is like PublishWithMetrics, but every plugin runs within
+// the given sandbox. Metrics can be nil.
+func PublishSandboxed(manager *pluggable.Manager, sandbox *Sandbox, metrics *Metrics, event pluggable.EventType, obj interface{}) error {
+	return publish(manager, metrics, event, obj, sandbox.Run)
+}
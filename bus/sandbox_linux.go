@@ -0,0 +1,154 @@
+package bus
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountScript bind mounts the paths given as arguments read-only, then runs
+// the remaining arguments. The first argument is the number of paths.
+const mountScript = `n=$1; shift
+while [ "$n" -gt 0 ]; do
+  mount --bind "$1" "$1" && mount -o remount,bind,ro "$1" || exit 1
+  n=$((n-1)); shift
+done
+exec "$@"`
+
+// isCgroup2 checks the directory is in a cgroup v2 hierarchy. It's a variable
+// so tests can create cgroups in regular directories.
+var isCgroup2 = func(dir string) (bool, error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(dir, &fs); err != nil {
+		return false, err
+	}
+	return fs.Type == unix.CGROUP2_SUPER_MAGIC, nil
+}
+
+// confine applies the sandbox to the command. The returned function must be
+// called once the command is done.
+func (s *Sandbox) confine(cmd *exec.Cmd, name string) (func(), error) {
+	cleanup := func() {}
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	var uid, gid int
+	if s.User != "" {
+		var err error
+		if uid, gid, err = lookupUser(s.User); err != nil {
+			return cleanup, err
+		}
+	}
+
+	if len(s.ReadOnlyPaths) > 0 {
+		unshare, err := exec.LookPath("unshare")
+		if err != nil {
+			return cleanup, fmt.Errorf("read-only paths need unshare: %w", err)
+		}
+		args := []string{unshare, "--mount", "--propagation", "private", "--", "/bin/sh", "-c", mountScript, "sh", strconv.Itoa(len(s.ReadOnlyPaths))}
+		args = append(args, s.ReadOnlyPaths...)
+		if s.User != "" {
+			// Privileges are dropped after mounting
+			setpriv, err := exec.LookPath("setpriv")
+			if err != nil {
+				return cleanup, fmt.Errorf("read-only paths need setpriv to change the user: %w", err)
+			}
+			args = append(args, setpriv, "--reuid", strconv.Itoa(uid), "--regid", strconv.Itoa(gid), "--clear-groups", "--")
+		}
+		cmd.Args = append(args, cmd.Args...)
+		cmd.Args[len(args)] = cmd.Path
+		cmd.Path = unshare
+	} else if s.User != "" {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}}
+	}
+
+	if s.MemoryMax > 0 || s.CPUMax != "" {
+		cgroup, err := s.cgroup(name)
+		if err != nil {
+			return cleanup, err
+		}
+		dir, err := os.Open(cgroup)
+		if err != nil {
+			os.Remove(cgroup)
+			return cleanup, err
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+		cleanup = func() {
+			dir.Close()
+			os.Remove(cgroup)
+		}
+	}
+
+	return cleanup, nil
+}
+
+// cgroup creates a cgroup for a plugin run with the sandbox limits.
+func (s *Sandbox) cgroup(name string) (string, error) {
+	parent := s.CgroupParent
+	if parent == "" {
+		parent = DefaultPluginCgroup
+	}
+	ok, err := isCgroup2(filepath.Dir(parent))
+	if err != nil {
+		return "", fmt.Errorf("checking cgroup %s: %w", parent, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not in a cgroup v2 hierarchy", parent)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("creating cgroup %s: %w", parent, err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644); err != nil {
+		return "", fmt.Errorf("enabling the memory and cpu controllers in %s: %w", parent, err)
+	}
+
+	cgroup, err := os.MkdirTemp(parent, filepath.Base(name)+"-")
+	if err != nil {
+		return "", fmt.Errorf("creating cgroup: %w", err)
+	}
+	limits := map[string]string{}
+	if s.MemoryMax > 0 {
+		limits["memory.max"] = strconv.FormatInt(s.MemoryMax, 10)
+	}
+	if s.CPUMax != "" {
+		limits["cpu.max"] = s.CPUMax
+	}
+	for file, value := range limits {
+		if err := os.WriteFile(filepath.Join(cgroup, file), []byte(value), 0644); err != nil {
+			os.Remove(cgroup)
+			return "", fmt.Errorf("setting %s: %w", file, err)
+		}
+	}
+
+	return cgroup, nil
+}
+
+// lookupUser returns the uid and primary gid of the given user name or uid.
+func lookupUser(name string) (int, int, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, convErr := strconv.Atoi(name); convErr != nil {
+			return 0, 0, err
+		}
+		if u, err = user.LookupId(name); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uid, gid, nil
+}
@@ -0,0 +1,78 @@
+package bus
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sandbox cgroups", func() {
+	var parent string
+
+	BeforeEach(func() {
+		parent = filepath.Join(GinkgoT().TempDir(), "kairos-plugins")
+		realIsCgroup2 := isCgroup2
+		isCgroup2 = func(string) (bool, error) { return true, nil }
+		DeferCleanup(func() { isCgroup2 = realIsCgroup2 })
+	})
+
+	It("creates a cgroup for the run with the limits", func() {
+		s := &Sandbox{CgroupParent: parent, MemoryMax: 64 << 20, CPUMax: "50000 100000"}
+		cgroup, err := s.cgroup("/usr/lib/kairos/agent-provider-foo")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(filepath.Dir(cgroup)).To(Equal(parent))
+		Expect(filepath.Base(cgroup)).To(HavePrefix("agent-provider-foo-"))
+		Expect(os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))).To(BeEquivalentTo("+memory +cpu"))
+		Expect(os.ReadFile(filepath.Join(cgroup, "memory.max"))).To(BeEquivalentTo("67108864"))
+		Expect(os.ReadFile(filepath.Join(cgroup, "cpu.max"))).To(BeEquivalentTo("50000 100000"))
+	})
+
+	It("only sets the given limits", func() {
+		s := &Sandbox{CgroupParent: parent, CPUMax: "max 100000"}
+		cgroup, err := s.cgroup("foo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filepath.Join(cgroup, "memory.max")).ToNot(BeAnExistingFile())
+		Expect(os.ReadFile(filepath.Join(cgroup, "cpu.max"))).To(BeEquivalentTo("max 100000"))
+	})
+
+	It("refuses parents outside a cgroup v2 hierarchy", func() {
+		isCgroup2 = func(string) (bool, error) { return false, nil }
+		_, err := (&Sandbox{CgroupParent: parent, MemoryMax: 1 << 20}).cgroup("foo")
+		Expect(err).To(MatchError(ContainSubstring("is not in a cgroup v2 hierarchy")))
+		Expect(parent).ToNot(BeADirectory())
+	})
+
+	It("runs the command in the cgroup and removes it when done", func() {
+		s := &Sandbox{CgroupParent: parent, MemoryMax: 1 << 20}
+		cmd := exec.Command("true")
+		cleanup, err := s.confine(cmd, "foo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmd.SysProcAttr.UseCgroupFD).To(BeTrue())
+		Expect(cmd.SysProcAttr.CgroupFD).To(BeNumerically(">", 0))
+		entries, err := os.ReadDir(parent)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+
+		// cgroupfs directories are removed with their control files, regular
+		// ones need to be emptied first
+		Expect(os.Remove(filepath.Join(parent, entries[1].Name(), "memory.max"))).To(Succeed())
+		cleanup()
+		entries, err = os.ReadDir(parent)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("cgroup.subtree_control"))
+	})
+
+	It("doesn't create cgroups without limits", func() {
+		cmd := exec.Command("true")
+		cleanup, err := (&Sandbox{CgroupParent: parent}).confine(cmd, "foo")
+		Expect(err).ToNot(HaveOccurred())
+		defer cleanup()
+		Expect(cmd.SysProcAttr.UseCgroupFD).To(BeFalse())
+		Expect(parent).ToNot(BeADirectory())
+	})
+})
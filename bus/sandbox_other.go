@@ -0,0 +1,21 @@
+//go:build !linux
+
+package bus
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errSandboxUnsupported = errors.New("plugin sandboxing is only supported on Linux")
+
+func (s *Sandbox) confine(_ *exec.Cmd, _ string) (func(), error) {
+	if s.User != "" || s.MemoryMax > 0 || s.CPUMax != "" || len(s.ReadOnlyPaths) > 0 {
+		return func() {}, errSandboxUnsupported
+	}
+	return func() {}, nil
+}
+
+func lookupUser(_ string) (int, int, error) {
+	return 0, 0, errSandboxUnsupported
+}
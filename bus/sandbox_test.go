@@ -0,0 +1,86 @@
+package bus_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/bus"
+	"github.com/mudler/go-pluggable"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sandbox", func() {
+	Describe("Env", func() {
+		envPlugin := func() pluggable.Plugin {
+			return newPlugin("env", `echo "{\"data\": \"$(env | grep -E '^(KAIROS_KEEP|KAIROS_DROP|KAIROS_SET|KAIROS_MISSING)=' | sort | tr '\n' ' ')\"}"`)
+		}
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("KAIROS_KEEP", "keep")
+			GinkgoT().Setenv("KAIROS_DROP", "drop")
+		})
+
+		It("passes the whole environment by default", func() {
+			resp, err := (&bus.Sandbox{}).Run(envPlugin(), pluggable.Event{Name: bus.EventBoot})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Data).To(Equal("KAIROS_DROP=drop KAIROS_KEEP=keep "))
+		})
+
+		It("only passes the listed variables", func() {
+			s := &bus.Sandbox{Env: []string{"KAIROS_KEEP", "KAIROS_MISSING", "KAIROS_SET=value"}}
+			resp, err := s.Run(envPlugin(), pluggable.Event{Name: bus.EventBoot})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Data).To(Equal("KAIROS_KEEP=keep KAIROS_SET=value "))
+		})
+
+		It("passes an empty environment with an empty list", func() {
+			resp, err := (&bus.Sandbox{Env: []string{}}).Run(envPlugin(), pluggable.Event{Name: bus.EventBoot})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Data).To(BeEmpty())
+		})
+	})
+
+	Describe("Timeout", func() {
+		It("kills plugins running longer than the timeout", func() {
+			slow := newPlugin("slow", "exec sleep 10")
+			fast := newPlugin("fast", `echo '{"data": "done"}'`)
+			sandbox := &bus.Sandbox{Timeout: 200 * time.Millisecond}
+
+			start := time.Now()
+			resp, err := sandbox.Run(slow, pluggable.Event{Name: bus.EventBoot})
+			Expect(errors.Is(err, bus.ErrPluginTimeout)).To(BeTrue())
+			Expect(resp.Errored()).To(BeTrue())
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+
+			resp, err = sandbox.Run(fast, pluggable.Event{Name: bus.EventBoot})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Data).To(Equal("done"))
+		})
+
+		It("returns the timeouts from PublishSandboxed", func() {
+			m := newManager(newPlugin("slow", "exec sleep 10"), newPlugin("fast", `echo '{"data": "done"}'`))
+			results := map[string]pluggable.EventResponse{}
+			m.Response(bus.EventBoot, func(p *pluggable.Plugin, r *pluggable.EventResponse) {
+				results[p.Name] = *r
+			})
+
+			metrics := bus.NewMetrics()
+			err := bus.PublishSandboxed(m, &bus.Sandbox{Timeout: 200 * time.Millisecond}, metrics, bus.EventBoot, bus.EventPayload{})
+			Expect(errors.Is(err, bus.ErrPluginTimeout)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("plugin slow")))
+			Expect(err).ToNot(MatchError(ContainSubstring("plugin fast")))
+
+			Expect(results["slow"].Errored()).To(BeTrue())
+			Expect(results["fast"].Data).To(Equal("done"))
+			pm, ok := metrics.Get("slow", bus.EventBoot)
+			Expect(ok).To(BeTrue())
+			Expect(pm.Failures).To(BeEquivalentTo(1))
+		})
+
+		It("doesn't fail when every plugin answers in time", func() {
+			m := newManager(newPlugin("fast", `echo '{"data": "done"}'`))
+			Expect(bus.PublishSandboxed(m, &bus.Sandbox{Timeout: 5 * time.Second}, nil, bus.EventBoot, bus.EventPayload{})).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CanonicalString returns the YAML representation of the Config in a stable
+// form: keys are sorted at every level, indentation is always 2 spaces and
+// sources are listed once, in the order they were merged. Two Configs with the
+// same sources and values always render to the same string, which makes it
+// suitable to persist merged configs and detect changes by comparing them.
+func (c *Config) CanonicalString() (string, error) {
+	var b bytes.Buffer
+	b.WriteString(DefaultHeader + "\n\n")
+
+	if sources := uniqueSources(c.Sources); len(sources) > 0 {
+		b.WriteString("# Sources:\n")
+		for _, s := range sources {
+			fmt.Fprintf(&b, "# - %s\n", s)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(c.Values) == 0 {
+		return b.String(), nil
+	}
+
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(canonicalValue(map[string]interface{}(c.Values))); err != nil {
+		return "", fmt.Errorf("marshalling the config to a string: %s", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("marshalling the config to a string: %s", err)
+	}
+
+	return b.String(), nil
+}
+
+// WriteCanonical writes the CanonicalString of the Config to the given path,
+// only if the content differs from the one already in the file. It returns
+// whether the file was written. The file is written like with WriteFile.
+func (c *Config) WriteCanonical(path string) (bool, error) {
+	s, err := c.CanonicalString()
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.ReadFile(path)
+	if err == nil && string(current) == s {
+		return false, nil
+	}
+
+	if err := writeFileAtomic(path, []byte(s)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// canonicalValue converts the maps with non string keys (as produced by some
+// YAML decoders) to maps with string keys, so that they are sorted the same
+// way as the rest when marshalled.
+func canonicalValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			result[k] = canonicalValue(val)
+		}
+		return result
+	case ConfigValues:
+		return canonicalValue(map[string]interface{}(t))
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			result[fmt.Sprint(k)] = canonicalValue(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, val := range t {
+			result[i] = canonicalValue(val)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func uniqueSources(sources []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, s := range sources {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
@@ -3,13 +3,16 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 	"unicode"
@@ -38,29 +41,84 @@ type ConfigValues map[string]interface{}
 type Config struct {
 	Sources []string
 	Values  ConfigValues
+	// provenance are the values set by each source, in merge order. Only
+	// tracked after RecordProvenance
+	provenance []ProvenanceEntry
+	// directives applies the merge directives of the keys merged with
+	// MergeConfig, see the MergeDirectives option
+	directives bool
 }
 
 // MergeConfigURL looks for the "config_url" key and if it's found
 // it downloads the remote config and merges it with the current one.
 // If the remote config also has config_url defined, it is also fetched
 // recursively until a remote config no longer defines a config_url.
+// Chains pointing back to a URL already fetched fail with ErrConfigURLCycle,
+// and those longer than DefaultMaxConfigURLDepth with ErrConfigURLDepth.
 // NOTE: The "config_url" value of the final result is the value of the last
 // config file in the chain because we replace values when we merge.
 func (c *Config) MergeConfigURL() error {
+	return c.MergeConfigURLContext(context.Background(), nil)
+}
+
+// MergeConfigURLContext is like MergeConfigURL but stops fetching when the
+// context is done. If onTiming is not nil, it's called with the time it took
+// to fetch each remote config.
+func (c *Config) MergeConfigURLContext(ctx context.Context, onTiming func(SourceTiming)) error {
+	return c.mergeConfigURL(ctx, defaultFetcher(onTiming))
+}
+
+// MergeConfigURLWithOptions is like MergeConfigURLContext but the remote
+// configs are fetched with the given proxy, TLS, auth and retry settings.
+func (c *Config) MergeConfigURLWithOptions(ctx context.Context, remote RemoteOptions) error {
+	f, err := remote.fetcher(nil)
+	if err != nil {
+		return err
+	}
+
+	return c.mergeConfigURL(ctx, f)
+}
+
+func (c *Config) mergeConfigURL(ctx context.Context, f *remoteFetcher) error {
+	return c.mergeConfigURLChain(ctx, f, nil)
+}
+
+// mergeConfigURLChain fetches the config_url chain, where chain are the URLs
+// already fetched to get to c. It fails with ErrConfigURLCycle if a URL
+// points back to one of them, or ErrConfigURLDepth if the chain is longer
+// than the max depth.
+func (c *Config) mergeConfigURLChain(ctx context.Context, f *remoteFetcher, chain []string) error {
 	// If there is no config_url, just return (do nothing)
 	configURL := c.ConfigURL()
 	if configURL == "" {
 		return nil
 	}
 
-	// fetch the remote config
-	remoteConfig, err := fetchRemoteConfig(configURL)
+	chain = append(chain, configURL)
+	if slices.Contains(chain[:len(chain)-1], configURL) {
+		return fmt.Errorf("%w: %s", ErrConfigURLCycle, strings.Join(chain, " -> "))
+	}
+	if len(chain) > f.maxDepth {
+		return fmt.Errorf("%w: more than %d configs in %s", ErrConfigURLDepth, f.maxDepth, strings.Join(chain, " -> "))
+	}
+
+	// fetch the remote config, the headers are only sent to the host of the
+	// first one
+	host := ""
+	if u, err := url.Parse(chain[0]); err == nil {
+		host = u.Host
+	}
+	remoteConfig, err := f.fetchRemoteConfig(ctx, configURL, host)
 	if err != nil {
 		return err
 	}
+	remoteConfig.directives = c.directives
+	if c.provenance != nil {
+		remoteConfig.RecordProvenance()
+	}
 
 	// recursively fetch remote configs
-	if err := remoteConfig.MergeConfigURL(); err != nil {
+	if err := remoteConfig.mergeConfigURLChain(ctx, f, chain); err != nil {
 		return err
 	}
 
@@ -84,6 +142,14 @@ func (c *Config) valuesCopy() (ConfigValues, error) {
 func (c *Config) MergeConfig(newConfig *Config) error {
 	var err error
 
+	// Check before copying, the copy would not stop on recursive values
+	if err := checkLimits(c.Values); err != nil {
+		return err
+	}
+	if err := checkLimits(newConfig.Values); err != nil {
+		return fmt.Errorf("merging %s: %w", strings.Join(newConfig.Sources, ", "), err)
+	}
+
 	aMap, err := c.valuesCopy()
 	if err != nil {
 		return err
@@ -104,13 +170,16 @@ func (c *Config) MergeConfig(newConfig *Config) error {
 	// }
 
 	// deep merge the two maps
-	mergedValues, err := DeepMerge(aMap, bMap)
+	mergedValues, err := deepMerge(aMap, bMap, c.directives)
 	if err != nil {
 		return err
 	}
-	finalConfig := Config{}
+	finalConfig := Config{directives: c.directives}
 	finalConfig.Sources = append(c.Sources, newConfig.Sources...)
 	finalConfig.Values = mergedValues.(ConfigValues)
+	if c.provenance != nil {
+		finalConfig.provenance = append(c.provenance, newConfig.provenanceEntriesWith(c.directives)...)
+	}
 
 	*c = finalConfig
 
@@ -157,18 +226,35 @@ func mergeSlices(sliceA, sliceB []interface{}) ([]interface{}, error) {
 	return sliceA, nil
 }
 
-func deepMergeMaps(a, b ConfigValues) (ConfigValues, error) {
-	// go through all items in b and merge them to a
-	for k, v := range b {
+func deepMergeMaps(a, b ConfigValues, directives bool) (ConfigValues, error) {
+	// go through all items in b and merge them to a, applying the merge
+	// directives of the keys if enabled
+	for _, key := range mergeOrder(b, directives) {
+		k, directive := key, mergeDefault
+		if directives {
+			k, directive = parseMergeDirective(key)
+		}
+		v := b[key]
+		switch directive {
+		case mergeDelete:
+			delete(a, k)
+			continue
+		case mergeReplace:
+			a[k] = stripDirectives(v)
+			continue
+		}
+
 		current, ok := a[k]
 		if ok {
 			// when the key is already set, we don't know what type it has, so we deep merge them in case they are maps
 			// or slices
-			res, err := DeepMerge(current, v)
+			res, err := deepMerge(current, v, directives)
 			if err != nil {
 				return a, err
 			}
 			a[k] = res
+		} else if directives {
+			a[k] = stripDirectives(v)
 		} else {
 			a[k] = v
 		}
@@ -179,8 +265,39 @@ func deepMergeMaps(a, b ConfigValues) (ConfigValues, error) {
 
 // DeepMerge takes two data structures and merges them together deeply. The results can vary depending on how the
 // arguments are passed since structure B will always overwrite what's on A.
+// It fails with a *DepthLimitError or *NodeLimitError if any of them goes over MaxConfigDepth or MaxConfigNodes.
 func DeepMerge(a, b interface{}) (interface{}, error) {
+	if err := checkLimits(a); err != nil {
+		return nil, err
+	}
+	if err := checkLimits(b); err != nil {
+		return nil, err
+	}
+
+	return deepMerge(a, b, false)
+}
+
+// DeepMergeWithDirectives is like DeepMerge, but the keys of B ending with
+// ReplaceSuffix or DeleteSuffix replace or delete the value on A instead of
+// being merged with it.
+func DeepMergeWithDirectives(a, b interface{}) (interface{}, error) {
+	if err := checkLimits(a); err != nil {
+		return nil, err
+	}
+	if err := checkLimits(b); err != nil {
+		return nil, err
+	}
+
+	return deepMerge(a, b, true)
+}
+
+// deepMerge merges b into a, applying the merge directives of the keys of b
+// if directives is true.
+func deepMerge(a, b interface{}, directives bool) (interface{}, error) {
 	if a == nil && b != nil {
+		if directives {
+			return stripDirectives(b), nil
+		}
 		return b, nil
 	}
 
@@ -203,11 +320,14 @@ func DeepMerge(a, b interface{}) (interface{}, error) {
 	}
 
 	if typeA.Kind() == reflect.Slice {
+		if directives {
+			b = stripDirectives(b)
+		}
 		return mergeSlices(a.([]interface{}), b.([]interface{}))
 	}
 
 	if typeA.Kind() == reflect.Map {
-		return deepMergeMaps(a.(ConfigValues), b.(ConfigValues))
+		return deepMergeMaps(a.(ConfigValues), b.(ConfigValues), directives)
 	}
 
 	// for any other type, b should take precedence
@@ -250,30 +370,10 @@ func (cs Configs) Merge() (*Config, error) {
 	return result, nil
 }
 
+// Scan collects and merges the configs from all the sources defined in the
+// Options.
 func Scan(o *Options, filter func(d []byte) ([]byte, error)) (*Config, error) {
-	configs := Configs{}
-
-	configs = append(configs, parseFiles(o.ScanDir, o.NoLogs)...)
-	configs = append(configs, parseReaders(o.Readers, o.NoLogs)...)
-
-	if o.MergeBootCMDLine {
-		cConfig, err := ParseCmdLine(o.BootCMDLineFile, filter)
-		o.SoftErr("parsing cmdline", err)
-		if err == nil { // best-effort
-			configs = append(configs, cConfig)
-		}
-	}
-
-	mergedConfig, err := configs.Merge()
-	if err != nil {
-		return mergedConfig, err
-	}
-
-	if o.Overwrites != "" {
-		yaml.Unmarshal([]byte(o.Overwrites), &mergedConfig.Values) //nolint:errcheck
-	}
-
-	return mergedConfig, nil
+	return ScanContext(context.Background(), o, filter)
 }
 
 func allFiles(dir []string) []string {
@@ -286,80 +386,99 @@ func allFiles(dir []string) []string {
 	return files
 }
 
-// parseFiles returns a list of Configs parsed from files.
-func parseFiles(dir []string, nologs bool) Configs {
-	result := Configs{}
-	files := allFiles(dir)
-	for _, f := range files {
-		if fileSize(f) > 1.0 {
-			if !nologs {
-				fmt.Printf("warning: skipping %s. too big (>1MB)\n", f)
-			}
-			continue
+// parseFile returns the Config parsed from the given file or nil if the file
+// should be skipped (too big, wrong extension, no valid header etc).
+// Files without a .yaml or .yml extension are only considered when
+// SniffContent is enabled, in which case they need a valid header and have
+// to parse as a YAML map.
+func parseFile(f string, o *Options) *Config {
+	nologs := o.NoLogs
+	if fileSize(f) > 1.0 {
+		if !nologs {
+			fmt.Printf("warning: skipping %s. too big (>1MB)\n", f)
 		}
-		if filepath.Ext(f) == ".yml" || filepath.Ext(f) == ".yaml" {
-			b, err := os.ReadFile(f)
-			if err != nil {
-				if !nologs {
-					fmt.Printf("warning: skipping %s. %s\n", f, err.Error())
-				}
-				continue
-			}
+		return nil
+	}
+	encrypted := isEncryptedConfig(f)
+	hasYAMLExtension := filepath.Ext(f) == ".yml" || filepath.Ext(f) == ".yaml" || encrypted
+	if !hasYAMLExtension && !o.SniffContent {
+		if !nologs {
+			fmt.Printf("warning: skipping %s (extension).\n", f)
+		}
+		return nil
+	}
 
-			if !HasValidHeader(string(b)) {
-				if !nologs {
-					fmt.Printf("warning: skipping %s because it has no valid header\n", f)
-				}
-				continue
-			}
+	b, err := os.ReadFile(f)
+	if err != nil {
+		if !nologs {
+			fmt.Printf("warning: skipping %s. %s\n", f, err.Error())
+		}
+		return nil
+	}
 
-			var newConfig Config
-			err = yaml.Unmarshal(b, &newConfig.Values)
-			if err != nil && !nologs {
-				fmt.Printf("warning: failed to parse config:\n%s\n", err.Error())
-			}
-			newConfig.Sources = []string{f}
+	if encrypted {
+		if b, err = o.decrypt(f, b); err != nil {
+			o.SoftErr(fmt.Sprintf("skipping %s", f), err)
+			return nil
+		}
+	}
 
-			result = append(result, &newConfig)
-		} else {
+	if !HasValidHeader(string(b)) {
+		if !nologs {
+			fmt.Printf("warning: skipping %s because it has no valid header\n", f)
+		}
+		return nil
+	}
+
+	var newConfig Config
+	err = parseYAML(b, &newConfig.Values)
+	if err != nil {
+		if !hasYAMLExtension {
 			if !nologs {
-				fmt.Printf("warning: skipping %s (extension).\n", f)
+				fmt.Printf("warning: skipping %s. not a yaml file: %s\n", f, err.Error())
+			}
+			return nil
+		}
+		if !nologs {
+			if encrypted {
+				// the error may quote the plain config
+				fmt.Printf("warning: failed to parse the decrypted config %s\n", f)
+			} else {
+				fmt.Printf("warning: failed to parse config:\n%s\n", err.Error())
 			}
 		}
 	}
+	newConfig.Sources = []string{f}
 
-	return result
+	return &newConfig
 }
 
-// parseReaders returns a list of Configs parsed from Reader interfaces
+// parseReader returns the Config parsed from the given Reader or nil if it
+// could not be read or parsed.
 // We assume as this has been passed explicitly to the collector that the
 // checks for it being a config is already done, so no header checks here.
-func parseReaders(readers []io.Reader, nologs bool) Configs {
-	result := Configs{}
-	for _, R := range readers {
-		var newConfig Config
-		read, err := io.ReadAll(R)
-		if err != nil {
-			if !nologs {
-				fmt.Printf("Error reading config: %s", err.Error())
-			}
-			continue
+func parseReader(r io.Reader, nologs bool) *Config {
+	var newConfig Config
+	read, err := io.ReadAll(r)
+	if err != nil {
+		if !nologs {
+			fmt.Printf("Error reading config: %s", err.Error())
 		}
-		err = yaml.Unmarshal(read, &newConfig.Values)
+		return nil
+	}
+	err = parseYAML(read, &newConfig.Values)
+	if err != nil {
+		err = json.Unmarshal(read, &newConfig.Values)
 		if err != nil {
-			err = json.Unmarshal(read, &newConfig.Values)
-			if err != nil {
-				if !nologs {
-					fmt.Printf("Error unmarshalling config(error: %s): %s", err.Error(), string(read))
-				}
-				continue
+			if !nologs {
+				fmt.Printf("Error unmarshalling config(error: %s): %s", err.Error(), string(read))
 			}
+			return nil
 		}
-		newConfig.Sources = []string{"reader"}
-		result = append(result, &newConfig)
 	}
+	newConfig.Sources = []string{"reader"}
 
-	return result
+	return &newConfig
 }
 
 func fileSize(f string) float64 {
@@ -432,13 +551,25 @@ func (c Config) ConfigURL() string {
 	return ""
 }
 
-func fetchRemoteConfig(url string) (*Config, error) {
+func (f *remoteFetcher) fetchRemoteConfig(ctx context.Context, url, host string) (*Config, error) {
 	var body []byte
 	result := &Config{}
 
+	start := time.Now()
 	err := retry.Do(
 		func() error {
-			resp, err := http.Get(url)
+			ctx := ctx
+			if f.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, f.timeout)
+				defer cancel()
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			f.setHeaders(req, host)
+			resp, err := f.client.Do(req)
 			if err != nil {
 				return err
 			}
@@ -453,8 +584,11 @@ func fetchRemoteConfig(url string) (*Config, error) {
 			}
 
 			return nil
-		}, retry.Delay(time.Second), retry.Attempts(3),
+		}, retry.Delay(f.delay), retry.Attempts(f.attempts), retry.Context(ctx),
 	)
+	if f.onTiming != nil {
+		f.onTiming(SourceTiming{Source: url, Duration: time.Since(start), Err: err})
+	}
 
 	if err != nil {
 		// TODO: improve logging
@@ -473,7 +607,7 @@ func fetchRemoteConfig(url string) (*Config, error) {
 		return result, nil
 	}
 
-	if err := yaml.Unmarshal(body, &result.Values); err != nil {
+	if err := parseYAML(body, &result.Values); err != nil {
 		return result, fmt.Errorf("could not unmarshal remote config to an object: %w", err)
 	}
 
@@ -2,15 +2,31 @@ package collector_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/disk"
+	"github.com/diskfs/go-diskfs/filesystem"
 	. "github.com/kairos-io/kairos-sdk/collector"
+	"github.com/kairos-io/kairos-sdk/schema"
+	"github.com/kairos-io/kairos-sdk/types"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
 )
 
@@ -1146,6 +1162,1192 @@ local_key_2: local_value_2
 		})
 	})
 
+	Describe("ScanStream", func() {
+		var tmpDir string
+		var err error
+
+		BeforeEach(func() {
+			tmpDir, err = os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+
+			for i := 1; i <= 3; i++ {
+				err = os.WriteFile(path.Join(tmpDir, fmt.Sprintf("local_config_%d.yaml", i)),
+					[]byte(fmt.Sprintf("#cloud-config\nlocal_key_%d: local_value_%d\n", i, i)), os.ModePerm)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			err = os.WriteFile(path.Join(tmpDir, "no_header.yaml"), []byte("foo: bar\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("yields every valid config in order", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), Readers(strings.NewReader("reader_key: reader_value")))).To(Succeed())
+
+			sources := []string{}
+			for c, err := range ScanStream(context.Background(), o, FilterKeysTest) {
+				Expect(err).ToNot(HaveOccurred())
+				sources = append(sources, c.Sources...)
+			}
+
+			Expect(sources).To(Equal([]string{
+				path.Join(tmpDir, "local_config_1.yaml"),
+				path.Join(tmpDir, "local_config_2.yaml"),
+				path.Join(tmpDir, "local_config_3.yaml"),
+				"reader",
+			}))
+		})
+
+		It("stops when the consumer breaks", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir))).To(Succeed())
+
+			count := 0
+			for range ScanStream(context.Background(), o, FilterKeysTest) {
+				count++
+				break
+			}
+			Expect(count).To(Equal(1))
+		})
+
+		It("returns the context error when cancelled", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir))).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := ScanContext(ctx, o, FilterKeysTest)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("merges the same result as Scan", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir))).To(Succeed())
+
+			c, err := ScanContext(context.Background(), o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values).To(HaveLen(3))
+			Expect(c.Values["local_key_2"]).To(Equal("local_value_2"))
+		})
+	})
+
+	Describe("Remote fetches", func() {
+		var tmpDir string
+		var server *httptest.Server
+		var delay time.Duration
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+
+			delay = 300 * time.Millisecond
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+				_, _ = fmt.Fprintf(w, "#cloud-config\nremote: %s\n", strings.TrimPrefix(r.URL.Path, "/"))
+			}))
+
+			for i := 1; i <= 2; i++ {
+				err = os.WriteFile(path.Join(tmpDir, fmt.Sprintf("local_config_%d.yaml", i)),
+					[]byte(fmt.Sprintf("#cloud-config\nconfig_url: %s/remote_%d\n", server.URL, i)), os.ModePerm)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("fetches concurrently, merges in order and reports the timings", func() {
+			var mu sync.Mutex
+			timings := map[string]time.Duration{}
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), MaxConcurrentFetches(2), WithSourceTimings(func(t SourceTiming) {
+				mu.Lock()
+				defer mu.Unlock()
+				Expect(t.Err).ToNot(HaveOccurred())
+				timings[t.Source] = t.Duration
+			}))).To(Succeed())
+
+			start := time.Now()
+			c, err := ScanContext(context.Background(), o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", 2*delay))
+			Expect(c.Values["remote"]).To(Equal("remote_2"))
+			Expect(timings).To(HaveLen(2))
+			Expect(timings[server.URL+"/remote_1"]).To(BeNumerically(">=", delay))
+		})
+
+		It("rejects invalid concurrency values", func() {
+			o := &Options{}
+			Expect(o.Apply(MaxConcurrentFetches(0))).ToNot(Succeed())
+		})
+
+		It("stops when the scan deadline expires", func() {
+			delay = 5 * time.Second
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), WithTimeout(200*time.Millisecond))).To(Succeed())
+
+			start := time.Now()
+			_, err := ScanContext(context.Background(), o, FilterKeysTest)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Describe("Content sniffing", func() {
+		var tmpDir string
+		var err error
+
+		BeforeEach(func() {
+			tmpDir, err = os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = os.WriteFile(path.Join(tmpDir, "mdm-config"), []byte("#cloud-config\nfrom_mdm: true\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+			err = os.WriteFile(path.Join(tmpDir, "script.sh"), []byte("#!/bin/sh\necho hi\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+			err = os.WriteFile(path.Join(tmpDir, "broken"), []byte("#cloud-config\n\tfoo: [bar\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("skips files without extension by default", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values).ToNot(HaveKey("from_mdm"))
+		})
+
+		It("accepts valid configs without extension when enabled", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, SniffContent, Directories(tmpDir))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values).To(HaveKeyWithValue("from_mdm", true))
+			Expect(c.Sources).To(Equal([]string{path.Join(tmpDir, "mdm-config")}))
+		})
+	})
+
+	Describe("Environment expansion", func() {
+		var tmpDir string
+		var err error
+
+		BeforeEach(func() {
+			tmpDir, err = os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+
+			GinkgoT().Setenv("KAIROS_TEST_CLUSTER", "prod")
+			GinkgoT().Setenv("KAIROS_TEST_TOKEN", "secret")
+
+			err = os.WriteFile(path.Join(tmpDir, "config.yaml"), []byte(`#cloud-config
+hostname: node-${KAIROS_TEST_CLUSTER}
+${KAIROS_TEST_CLUSTER}: key
+token: ${KAIROS_TEST_TOKEN}
+unset: ${KAIROS_TEST_UNSET}
+escaped: $${KAIROS_TEST_CLUSTER}
+stages:
+  boot:
+  - commands:
+    - echo ${KAIROS_TEST_CLUSTER}
+`), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("does not expand variables by default", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["hostname"]).To(Equal("node-${KAIROS_TEST_CLUSTER}"))
+		})
+
+		It("expands only the allowed variables in string values", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), ExpandEnv("KAIROS_TEST_CLUSTER", "KAIROS_TEST_UNSET"))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["hostname"]).To(Equal("node-prod"))
+			Expect(c.Values).To(HaveKey("${KAIROS_TEST_CLUSTER}"))
+			Expect(c.Values["token"]).To(Equal("${KAIROS_TEST_TOKEN}"))
+			Expect(c.Values["unset"]).To(Equal("${KAIROS_TEST_UNSET}"))
+			Expect(c.Values["escaped"]).To(Equal("${KAIROS_TEST_CLUSTER}"))
+			s, err := c.String()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(ContainSubstring("- echo prod"))
+		})
+
+		It("expands every variable when asked to", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), ExpandAllEnv)).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["token"]).To(Equal("secret"))
+		})
+
+		It("requires an allowlist", func() {
+			o := &Options{}
+			Expect(o.Apply(ExpandEnv())).ToNot(Succeed())
+		})
+	})
+
+	Describe("Limits", func() {
+		nested := func(depth int) ConfigValues {
+			v := ConfigValues{"leaf": "value"}
+			for i := 0; i < depth; i++ {
+				v = ConfigValues{"nested": v}
+			}
+			return v
+		}
+
+		It("fails to merge values nested deeper than the limit", func() {
+			_, err := DeepMerge(ConfigValues{}, nested(MaxConfigDepth))
+			var depthErr *DepthLimitError
+			Expect(errors.As(err, &depthErr)).To(BeTrue(), fmt.Sprint(err))
+			Expect(depthErr.Max).To(Equal(MaxConfigDepth))
+
+			_, err = DeepMerge(ConfigValues{}, nested(MaxConfigDepth-1))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("fails to merge recursive values", func() {
+			recursive := ConfigValues{}
+			recursive["self"] = recursive
+
+			c := &Config{Values: ConfigValues{"a": 1}}
+			err := c.MergeConfig(&Config{Sources: []string{"recursive"}, Values: recursive})
+			var depthErr *DepthLimitError
+			Expect(errors.As(err, &depthErr)).To(BeTrue(), fmt.Sprint(err))
+			Expect(err.Error()).To(ContainSubstring("recursive"))
+		})
+
+		It("fails to merge more values than the limit", func() {
+			original := MaxConfigNodes
+			MaxConfigNodes = 10
+			DeferCleanup(func() { MaxConfigNodes = original })
+
+			list := []interface{}{}
+			for i := 0; i < 10; i++ {
+				list = append(list, i)
+			}
+			_, err := DeepMerge(ConfigValues{}, ConfigValues{"list": list})
+			var nodeErr *NodeLimitError
+			Expect(errors.As(err, &nodeErr)).To(BeTrue(), fmt.Sprint(err))
+		})
+
+		It("skips configs whose aliases expand over the limits", func() {
+			original := MaxConfigNodes
+			MaxConfigNodes = 1000
+			DeferCleanup(func() { MaxConfigNodes = original })
+
+			bomb := "#cloud-config\na: &a [x, x, x, x, x, x, x, x, x, x]\nb: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]\nc: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]\n"
+			c, err := ScanContext(context.Background(), &Options{NoLogs: true, Readers: []io.Reader{strings.NewReader(bomb)}}, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources).To(BeEmpty())
+
+			small := "#cloud-config\na: &a [x, x]\nb: [*a, *a]\n"
+			c, err = ScanContext(context.Background(), &Options{NoLogs: true, Readers: []io.Reader{strings.NewReader(small)}}, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["b"]).To(HaveLen(2))
+		})
+
+		It("skips configs with recursive aliases", func() {
+			recursive := "#cloud-config\na: &a\n  b: *a\n"
+			c, err := ScanContext(context.Background(), &Options{NoLogs: true, Readers: []io.Reader{strings.NewReader(recursive)}}, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources).To(BeEmpty())
+		})
+	})
+
+	Describe("Schema defaults", func() {
+		var tmpDir string
+		var err error
+
+		BeforeEach(func() {
+			tmpDir, err = os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("fills the values missing in the merged config", func() {
+			err = os.WriteFile(path.Join(tmpDir, "config.yaml"), []byte("#cloud-config\np2p:\n  role: master\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), WithSchemaDefaults(schema.RootSchema{}))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			s, err := c.String()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(ContainSubstring("role: master"))
+			Expect(s).To(ContainSubstring("disable_dht: true"))
+		})
+
+		It("doesn't add the blocks missing in the merged config", func() {
+			err = os.WriteFile(path.Join(tmpDir, "config.yaml"), []byte("#cloud-config\nhostname: foo\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), WithSchemaDefaults(schema.RootSchema{}))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values).ToNot(HaveKey("p2p"))
+			Expect(c.Values["hostname"]).To(Equal("foo"))
+		})
+	})
+
+	Describe("Seed data", func() {
+		var tmpDir string
+
+		// seedImage creates a FAT32 image with the given files
+		seedImage := func(label string, files map[string]string) string {
+			image := path.Join(tmpDir, label+".img")
+			d, err := diskfs.Create(image, 40*1024*1024, diskfs.Raw, diskfs.SectorSizeDefault)
+			Expect(err).ToNot(HaveOccurred())
+			fs, err := d.CreateFilesystem(disk.FilesystemSpec{Partition: 0, FSType: filesystem.TypeFat32, VolumeLabel: label})
+			Expect(err).ToNot(HaveOccurred())
+			for name, content := range files {
+				Expect(fs.Mkdir(path.Dir(name))).To(Succeed())
+				f, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = f.Write([]byte(content))
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(d.Close()).To(Succeed())
+			return image
+		}
+
+		BeforeEach(func() {
+			tmpDir = GinkgoT().TempDir()
+		})
+
+		It("merges NoCloud user-data and meta-data", func() {
+			image := seedImage("cidata", map[string]string{
+				"/user-data": "#cloud-config\noptions:\n  foo: seed\n",
+				"/meta-data": "instance-id: node1\nlocal-hostname: node1\n",
+			})
+			err := os.WriteFile(path.Join(tmpDir, "local.yaml"), []byte("#cloud-config\noptions:\n  foo: local\n  bar: local\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), WithSeedDevices(image))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["hostname"]).To(Equal("node1"))
+			Expect(c.Values["options"]).To(HaveKeyWithValue("foo", "seed"))
+			Expect(c.Values["options"]).To(HaveKeyWithValue("bar", "local"))
+		})
+
+		It("merges OpenStack config drive user data", func() {
+			image := seedImage("config-2", map[string]string{
+				"/openstack/latest/user_data":      "#cloud-config\noptions:\n  foo: openstack\n",
+				"/openstack/latest/meta_data.json": `{"uuid": "1234", "hostname": "node2"}`,
+			})
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, WithSeedDevices(image))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["hostname"]).To(Equal("node2"))
+			Expect(c.Values["options"]).To(HaveKeyWithValue("foo", "openstack"))
+		})
+
+		It("skips user data that is not a config", func() {
+			image := seedImage("cidata", map[string]string{
+				"/user-data": "#!/bin/sh\necho hi\n",
+			})
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, WithSeedDevices(image))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values).To(BeEmpty())
+		})
+	})
+
+	Describe("Immutable sections", func() {
+		var configDir, baseline string
+
+		BeforeEach(func() {
+			configDir = GinkgoT().TempDir()
+			baseline = path.Join(configDir, ".baseline.yaml")
+			Expect(os.WriteFile(path.Join(configDir, "00_install.yaml"), []byte(`#cloud-config
+immutable: [install, users]
+install:
+  device: /dev/sda
+users:
+- name: kairos
+`), os.ModePerm)).To(Succeed())
+		})
+
+		scan := func(opts ...Option) (*Config, error) {
+			o := &Options{}
+			Expect(o.Apply(append([]Option{NoLogs, Directories(configDir), WithBaseline(baseline)}, opts...)...)).To(Succeed())
+			return Scan(o, FilterKeysTest)
+		}
+
+		It("doesn't enforce anything until the baseline is written", func() {
+			Expect(os.WriteFile(path.Join(configDir, "10_media.yaml"), []byte("#cloud-config\ninstall:\n  device: /dev/vda\n"), os.ModePerm)).To(Succeed())
+			c, err := scan()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["install"]).To(HaveKeyWithValue("device", "/dev/vda"))
+		})
+
+		When("the baseline exists", func() {
+			BeforeEach(func() {
+				c, err := scan()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.ImmutableSections()).To(Equal([]string{"install", "users"}))
+				Expect(c.WriteBaseline(baseline)).To(Succeed())
+				Expect(os.WriteFile(path.Join(configDir, "10_media.yaml"), []byte(`#cloud-config
+immutable: []
+install:
+  device: /dev/vda
+hostname: changed
+`), os.ModePerm)).To(Succeed())
+			})
+
+			It("keeps the baseline sections and allows the other changes", func() {
+				c, err := scan()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.Values["install"]).To(HaveKeyWithValue("device", "/dev/sda"))
+				Expect(c.ImmutableSections()).To(Equal([]string{"install", "users"}))
+				Expect(c.Values["hostname"]).To(Equal("changed"))
+				Expect(c.Sources).ToNot(ContainElement(baseline))
+			})
+
+			It("fails when strict", func() {
+				_, err := scan(StrictImmutable)
+				Expect(err).To(MatchError(ContainSubstring(`section "install" is immutable`)))
+			})
+
+			It("reports the baseline as the source of the restored sections", func() {
+				c, err := scan(TrackProvenance)
+				Expect(err).ToNot(HaveOccurred())
+				e, err := c.Explain("install.device")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(e.Source).To(Equal("baseline:" + baseline))
+			})
+		})
+
+		It("checks the sections once the defaults are applied and the environment expanded", func() {
+			Expect(os.WriteFile(path.Join(configDir, "00_install.yaml"), []byte(`#cloud-config
+immutable: [install, users]
+install:
+  device: ${KAIROS_TEST_DEVICE}
+`), os.ModePerm)).To(Succeed())
+			GinkgoT().Setenv("KAIROS_TEST_DEVICE", "/dev/sda")
+			withDefaults := func(o *Options) error {
+				o.Defaults = map[string]interface{}{"users": []interface{}{map[string]interface{}{"name": "kairos"}}}
+				return nil
+			}
+
+			c, err := scan(withDefaults, ExpandEnv("KAIROS_TEST_DEVICE"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.WriteBaseline(baseline)).To(Succeed())
+
+			c, err = scan(withDefaults, ExpandEnv("KAIROS_TEST_DEVICE"), StrictImmutable)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["install"]).To(HaveKeyWithValue("device", "/dev/sda"))
+
+			GinkgoT().Setenv("KAIROS_TEST_DEVICE", "/dev/vda")
+			_, err = scan(withDefaults, ExpandEnv("KAIROS_TEST_DEVICE"), StrictImmutable)
+			Expect(err).To(MatchError(ContainSubstring(`section "install" is immutable`)))
+		})
+
+		It("fails to write a baseline without immutable sections", func() {
+			c := &Config{Values: ConfigValues{"hostname": "node"}}
+			Expect(c.WriteBaseline(baseline)).To(MatchError("the config has no immutable sections"))
+		})
+	})
+
+	Describe("Provenance", func() {
+		It("explains which source set each key", func() {
+			tmpDir := GinkgoT().TempDir()
+			first := path.Join(tmpDir, "01_first.yaml")
+			second := path.Join(tmpDir, "02_second.yaml")
+			Expect(os.WriteFile(first, []byte("#cloud-config\ninstall:\n  device: /dev/sda\n  auto: true\n"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(second, []byte("#cloud-config\ninstall:\n  device: /dev/vda\n"), os.ModePerm)).To(Succeed())
+
+			o := &Options{}
+			err := o.Apply(NoLogs, TrackProvenance, Directories(tmpDir), Overwrites("name: overwritten\n"))
+			Expect(err).ToNot(HaveOccurred())
+			o.Defaults = map[string]interface{}{"install": map[string]interface{}{"poweroff": false}}
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+
+			e, err := c.Explain("install.device")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Value).To(Equal("/dev/vda"))
+			Expect(e.Source).To(Equal(second))
+			Expect(e.Chain).To(Equal([]ProvenanceEntry{
+				{Key: "install.device", Value: "/dev/sda", Source: first},
+				{Key: "install.device", Value: "/dev/vda", Source: second},
+			}))
+
+			e, err = c.Explain("install")
+			Expect(err).ToNot(HaveOccurred())
+			sources := []string{}
+			for _, p := range e.Chain {
+				sources = append(sources, p.Key+"="+p.Source)
+			}
+			Expect(sources).To(Equal([]string{
+				"install.auto=" + first,
+				"install.device=" + first,
+				"install.device=" + second,
+				"install.poweroff=defaults",
+			}))
+
+			e, err = c.Explain("name")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Source).To(Equal("overwrites"))
+
+			_, err = c.Explain("p2p")
+			Expect(err).To(MatchError("no source sets p2p"))
+		})
+
+		It("fails when the provenance is not tracked", func() {
+			c := &Config{Values: ConfigValues{"name": "Mario"}}
+			_, err := c.Explain("name")
+			Expect(err).To(HaveOccurred())
+
+			c.RecordProvenance()
+			Expect(c.MergeConfig(&Config{Sources: []string{"luigi.yaml"}, Values: ConfigValues{"name": "Luigi"}})).To(Succeed())
+			e, err := c.Explain("name")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Source).To(Equal("luigi.yaml"))
+			Expect(e.Chain).To(HaveLen(2))
+		})
+	})
+
+	Describe("Encrypted configs", func() {
+		var configDir, secrets string
+
+		BeforeEach(func() {
+			configDir = GinkgoT().TempDir()
+			secrets = path.Join(configDir, "90_secrets.yaml.enc")
+			Expect(os.WriteFile(path.Join(configDir, "00_base.yaml"), []byte("#cloud-config\nhostname: base\n"), os.ModePerm)).To(Succeed())
+		})
+
+		scan := func(opts ...Option) *Config {
+			o := &Options{}
+			Expect(o.Apply(append([]Option{NoLogs, Directories(configDir)}, opts...)...)).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			return c
+		}
+
+		It("decrypts age files with the identity", func() {
+			Expect(os.WriteFile(secrets, []byte("age-encryption.org/v1\n-> X25519 ...\n"), os.ModePerm)).To(Succeed())
+			runner := &types.FakeRunner{Output: []byte("#cloud-config\nhostname: secret\n")}
+
+			c := scan(WithDecrypters(&AgeDecrypter{IdentityFile: "/run/key.txt", Runner: runner}))
+			Expect(c.Values["hostname"]).To(Equal("secret"))
+			Expect(c.Sources).To(ContainElement(secrets))
+			Expect(runner.Cmds()).To(Equal([][]string{{"age", "--decrypt", "--identity", "/run/key.txt", secrets}}))
+		})
+
+		It("decrypts SOPS files", func() {
+			Expect(os.WriteFile(secrets, []byte("hostname: ENC[AES256_GCM,data:...]\nsops:\n  mac: ENC[...]\n"), os.ModePerm)).To(Succeed())
+			age := &types.FakeRunner{}
+			sops := &types.FakeRunner{Output: []byte("#cloud-config\nhostname: secret\n")}
+
+			c := scan(WithDecrypters(&AgeDecrypter{Runner: age}, &SOPSDecrypter{Runner: sops}))
+			Expect(c.Values["hostname"]).To(Equal("secret"))
+			Expect(age.Cmds()).To(BeEmpty())
+			Expect(sops.Cmds()).To(HaveLen(1))
+			Expect(sops.Cmds()[0][0]).To(Equal("sops"))
+		})
+
+		It("only reads the plain config from the standard output", func() {
+			bin := GinkgoT().TempDir()
+			script := "#!/bin/sh\nif [ \"$FAIL\" = 1 ]; then echo 'no identity matched' >&2; exit 1; fi\n" +
+				"echo 'warning: insecure identity file' >&2\nprintf '#cloud-config\\nhostname: secret\\n'\n"
+			Expect(os.WriteFile(path.Join(bin, "age"), []byte(script), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			Expect(os.WriteFile(secrets, []byte("age-encryption.org/v1\n"), os.ModePerm)).To(Succeed())
+
+			d := &AgeDecrypter{IdentityFile: "/run/key.txt"}
+			plain, err := d.Decrypt(secrets)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(plain)).To(Equal("#cloud-config\nhostname: secret\n"))
+			Expect(scan(WithDecrypters(d)).Values["hostname"]).To(Equal("secret"))
+
+			GinkgoT().Setenv("FAIL", "1")
+			_, err = d.Decrypt(secrets)
+			Expect(err).To(MatchError(ContainSubstring("no identity matched")))
+		})
+
+		It("skips the encrypted files that can't be decrypted", func() {
+			Expect(os.WriteFile(secrets, []byte("age-encryption.org/v1\n"), os.ModePerm)).To(Succeed())
+			Expect(scan().Values["hostname"]).To(Equal("base"))
+
+			runner := &types.FakeRunner{Err: errors.New("no identity matched any of the recipients")}
+			c := scan(WithDecrypters(&AgeDecrypter{Runner: runner}))
+			Expect(c.Values["hostname"]).To(Equal("base"))
+			Expect(c.Sources).ToNot(ContainElement(secrets))
+		})
+	})
+
+	Describe("Schema validation", func() {
+		var configDir string
+
+		BeforeEach(func() {
+			configDir = GinkgoT().TempDir()
+			Expect(os.WriteFile(path.Join(configDir, "00_base.yaml"), []byte("#cloud-config\nusers:\n- name: kairos\n  passwd: kairos\ninstall:\n  device: /dev/sda\n"), os.ModePerm)).To(Succeed())
+		})
+
+		scan := func() (*Config, error) {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), WithSchemaValidation(schema.RootSchema{}))).To(Succeed())
+			return Scan(o, FilterKeysTest)
+		}
+
+		It("accepts a valid config", func() {
+			c, err := scan()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["install"]).To(HaveKeyWithValue("device", "/dev/sda"))
+		})
+
+		It("reports the invalid values and the sources setting them", func() {
+			site := path.Join(configDir, "10_site.yaml")
+			Expect(os.WriteFile(site, []byte("#cloud-config\ninstall:\n  device: sda\n"), os.ModePerm)).To(Succeed())
+
+			_, err := scan()
+			var schemaErr *SchemaError
+			Expect(errors.As(err, &schemaErr)).To(BeTrue())
+			Expect(schemaErr.Violations).To(ContainElement(SatisfyAll(
+				HaveField("Key", "install.device"),
+				HaveField("Source", site),
+				HaveField("Message", ContainSubstring("does not match pattern")),
+			)))
+			Expect(err.Error()).To(ContainSubstring("install.device (from " + site + ")"))
+		})
+	})
+
+	Describe("Merge directives", func() {
+		var base ConfigValues
+
+		BeforeEach(func() {
+			base = ConfigValues{
+				"users": []interface{}{"kairos"},
+				"k3s":   map[string]interface{}{"enabled": true},
+				"install": ConfigValues{
+					"device":       "/dev/sda",
+					"grub_options": map[string]interface{}{"extra_cmdline": "console=tty1"},
+				},
+			}
+		})
+
+		It("replaces the inherited value with key!", func() {
+			merged, err := DeepMergeWithDirectives(base, ConfigValues{"users!": []interface{}{"admin"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(HaveKeyWithValue("users", []interface{}{"admin"}))
+			Expect(merged).ToNot(HaveKey("users!"))
+		})
+
+		It("deletes the inherited value with key-", func() {
+			merged, err := DeepMergeWithDirectives(base, ConfigValues{"k3s-": nil})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).ToNot(HaveKey("k3s"))
+			Expect(merged).ToNot(HaveKey("k3s-"))
+		})
+
+		It("applies the directives of nested keys", func() {
+			merged, err := DeepMergeWithDirectives(base, ConfigValues{"install": ConfigValues{"grub_options-": nil, "device": "/dev/vda"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(HaveKeyWithValue("install", ConfigValues{"device": "/dev/vda"}))
+		})
+
+		It("deletes before setting the same key", func() {
+			merged, err := DeepMergeWithDirectives(base, ConfigValues{"users-": nil, "users": []interface{}{"admin"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(HaveKeyWithValue("users", []interface{}{"admin"}))
+		})
+
+		It("keeps the keys ending in an escaped suffix", func() {
+			base["k3s"] = ConfigValues{"args": ConfigValues{"kubelet-arg-": "a", "force!": true}}
+			merged, err := DeepMergeWithDirectives(base, ConfigValues{"k3s": ConfigValues{"args": ConfigValues{"kubelet-arg--": "b", "new!!": true}}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(HaveKeyWithValue("k3s", ConfigValues{
+				"args": ConfigValues{"kubelet-arg-": "b", "force!": true, "new!": true},
+			}))
+
+			merged, err = DeepMergeWithDirectives(ConfigValues{}, ConfigValues{"--": 1, "name--": 2, "!": 3})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(Equal(ConfigValues{"-": 1, "name-": 2, "!": 3}))
+		})
+
+		It("strips the directives when there is nothing to merge with", func() {
+			merged, err := DeepMergeWithDirectives(ConfigValues{}, ConfigValues{"p2p!": map[string]interface{}{"auto-": nil, "network_token": "x"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(Equal(ConfigValues{"p2p": map[string]interface{}{"network_token": "x"}}))
+		})
+
+		It("applies the directives across config files", func() {
+			configDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(path.Join(configDir, "00_base.yaml"), []byte("#cloud-config\nusers:\n- name: kairos\nhostname: base\n"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(path.Join(configDir, "10_site.yaml"), []byte("#cloud-config\nusers!:\n- name: admin\nhostname-:\n"), os.ModePerm)).To(Succeed())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), MergeDirectives, TrackProvenance)).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["users"]).To(Equal([]interface{}{ConfigValues{"name": "admin"}}))
+			Expect(c.Values).ToNot(HaveKey("hostname"))
+
+			e, err := c.Explain("users")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Source).To(Equal(path.Join(configDir, "10_site.yaml")))
+		})
+
+		It("merges the keys as they are without the option", func() {
+			keys := ConfigValues{"users!": []interface{}{"admin"}, "k3s-": true, "kubelet-arg--": "a", "force!!": true}
+			merged, err := DeepMerge(base, keys)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(HaveKeyWithValue("users", []interface{}{"kairos"}))
+			Expect(merged).To(HaveKeyWithValue("k3s", map[string]interface{}{"enabled": true}))
+			for k, v := range keys {
+				Expect(merged).To(HaveKeyWithValue(k, v))
+			}
+
+			configDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(path.Join(configDir, "00_base.yaml"), []byte("#cloud-config\nhostname: base\n"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(path.Join(configDir, "10_site.yaml"), []byte("#cloud-config\nhostname-: site\nstages:\n  boot:\n  - name: x\n    environment:\n      A--: b\n"), os.ModePerm)).To(Succeed())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), TrackProvenance)).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values).To(HaveKeyWithValue("hostname", "base"))
+			Expect(c.Values).To(HaveKeyWithValue("hostname-", "site"))
+			Expect(c.String()).To(ContainSubstring("A--: b"))
+
+			e, err := c.Explain("hostname-")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Source).To(Equal(path.Join(configDir, "10_site.yaml")))
+		})
+	})
+
+	Describe("config_url chains", func() {
+		var srv *httptest.Server
+		var fetched []string
+
+		BeforeEach(func() {
+			fetched = nil
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fetched = append(fetched, r.URL.Path)
+				next := map[string]string{"/a": "/b", "/b": "/a", "/1": "/2", "/2": "/3", "/3": ""}[r.URL.Path]
+				if next == "" {
+					fmt.Fprint(w, "#cloud-config\nname: last\n")
+					return
+				}
+				fmt.Fprintf(w, "#cloud-config\nconfig_url: %s%s\n", srv.URL, next)
+			}))
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		It("fails with ErrConfigURLCycle when a config points back to the chain", func() {
+			c := &Config{Values: ConfigValues{"config_url": srv.URL + "/a"}}
+			err := c.MergeConfigURL()
+			Expect(err).To(MatchError(ErrConfigURLCycle))
+			Expect(err.Error()).To(ContainSubstring(srv.URL + "/a -> " + srv.URL + "/b -> " + srv.URL + "/a"))
+			Expect(fetched).To(Equal([]string{"/a", "/b"}))
+		})
+
+		It("fails with ErrConfigURLDepth when the chain is too long", func() {
+			configDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(path.Join(configDir, "config.yaml"), []byte("#cloud-config\nconfig_url: "+srv.URL+"/1\n"), os.ModePerm)).To(Succeed())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), WithMaxConfigURLDepth(2))).To(Succeed())
+			_, err := Scan(o, FilterKeysTest)
+			Expect(err).To(MatchError(ErrConfigURLDepth))
+
+			o = &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), WithMaxConfigURLDepth(3))).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["name"]).To(Equal("last"))
+		})
+	})
+
+	Describe("Remote options", func() {
+		writeConfig := func(dir, content string) {
+			Expect(os.WriteFile(path.Join(dir, "config.yaml"), []byte(content), os.ModePerm)).To(Succeed())
+		}
+
+		It("verifies the server with a custom CA, authenticates and retries", func() {
+			tries := 0
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tries++
+				if tries == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, "#cloud-config\noptions:\n  remote: true\n")
+			}))
+			defer srv.Close()
+			tmpDir := GinkgoT().TempDir()
+			ca := path.Join(tmpDir, "ca.pem")
+			Expect(os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644)).To(Succeed())
+			configDir := path.Join(tmpDir, "oem")
+			Expect(os.Mkdir(configDir, 0755)).To(Succeed())
+			writeConfig(configDir, "#cloud-config\nconfig_url: "+srv.URL+"\n")
+
+			o := &Options{}
+			err := o.Apply(NoLogs, Directories(configDir), WithCACertFile(ca), WithBearerToken("secret"), WithFetchRetries(2, 10*time.Millisecond))
+			Expect(err).ToNot(HaveOccurred())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tries).To(Equal(2))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"remote": true}))
+		})
+
+		It("retries right away with no delay", func() {
+			tries := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tries++
+				if tries < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprint(w, "#cloud-config\noptions:\n  remote: true\n")
+			}))
+			defer srv.Close()
+			configDir := GinkgoT().TempDir()
+			writeConfig(configDir, "#cloud-config\nconfig_url: "+srv.URL+"\n")
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), WithFetchRetries(3, 0))).To(Succeed())
+			start := time.Now()
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", DefaultFetchDelay))
+			Expect(tries).To(Equal(3))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"remote": true}))
+		})
+
+		It("only sends the headers to the host of the first config_url", func() {
+			var otherAuth []string
+			other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				otherAuth = append(otherAuth, r.Header.Get("Authorization"))
+				fmt.Fprint(w, "#cloud-config\noptions:\n  other: true\n")
+			}))
+			defer other.Close()
+			var firstAuth []string
+			first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				firstAuth = append(firstAuth, r.Header.Get("Authorization"))
+				if r.URL.Path == "/1" {
+					fmt.Fprintf(w, "#cloud-config\nconfig_url: http://%s/2\n", r.Host)
+					return
+				}
+				fmt.Fprintf(w, "#cloud-config\nconfig_url: %s\noptions:\n  first: true\n", other.URL)
+			}))
+			defer first.Close()
+			configDir := GinkgoT().TempDir()
+			writeConfig(configDir, "#cloud-config\nconfig_url: "+first.URL+"/1\n")
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), WithBearerToken("secret"))).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"first": true, "other": true}))
+			Expect(firstAuth).To(Equal([]string{"Bearer secret", "Bearer secret"}))
+			Expect(otherAuth).To(Equal([]string{""}))
+		})
+
+		It("fetches through the given proxy", func() {
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Host).To(Equal("config.example.invalid"))
+				fmt.Fprint(w, "#cloud-config\noptions:\n  proxied: true\n")
+			}))
+			defer proxy.Close()
+			configDir := GinkgoT().TempDir()
+			writeConfig(configDir, "#cloud-config\nconfig_url: http://config.example.invalid/config.yaml\n")
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(configDir), WithProxy(proxy.URL))).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"proxied": true}))
+		})
+
+		It("fails with a CA bundle without certificates", func() {
+			bundle := path.Join(GinkgoT().TempDir(), "ca.pem")
+			Expect(os.WriteFile(bundle, []byte("not a certificate"), 0644)).To(Succeed())
+			o := &Options{}
+			Expect(o.Apply(WithCACertFile(bundle))).To(MatchError(ContainSubstring("no certificates found")))
+		})
+	})
+
+	Describe("Datasources", func() {
+		It("reads the EC2 user data with a session token and fetches its config_url", func() {
+			remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "#cloud-config\noptions:\n  remote: true\n")
+			}))
+			defer remote.Close()
+			imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+					fmt.Fprint(w, "token")
+				case r.URL.Path == "/latest/user-data" && r.Header.Get("X-aws-ec2-metadata-token") == "token":
+					fmt.Fprintf(w, "#cloud-config\nconfig_url: %s\noptions:\n  ec2: true\n", remote.URL)
+				default:
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer imds.Close()
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, WithDatasources(&EC2Datasource{Endpoint: imds.URL}))).To(Succeed())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources).To(Equal([]string{"datasource:ec2", remote.URL}))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"ec2": true, "remote": true}))
+		})
+
+		It("decodes the Azure and VMware user data", func() {
+			azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("Metadata")).To(Equal("true"))
+				fmt.Fprint(w, base64.StdEncoding.EncodeToString([]byte("#cloud-config\noptions:\n  azure: true\n")))
+			}))
+			defer azure.Close()
+			var gz bytes.Buffer
+			w := gzip.NewWriter(&gz)
+			_, err := w.Write([]byte("#cloud-config\noptions:\n  vmware: true\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			runner := &types.FakeRunner{SideEffect: func(command string, args ...string) ([]byte, error) {
+				switch args[0] {
+				case "info-get guestinfo.userdata":
+					return []byte(base64.StdEncoding.EncodeToString(gz.Bytes()) + "\n"), nil
+				case "info-get guestinfo.userdata.encoding":
+					return []byte("gzip+base64\n"), nil
+				}
+				return nil, errors.New("no value found")
+			}}
+
+			o := &Options{}
+			err = o.Apply(NoLogs, WithDatasources(&VMwareDatasource{Runner: runner}, &AzureDatasource{Endpoint: azure.URL}))
+			Expect(err).ToNot(HaveOccurred())
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources).To(Equal([]string{"datasource:vmware", "datasource:azure"}))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"azure": true, "vmware": true}))
+		})
+
+		It("reads only the standard output of vmware-rpctool, within the timeout", func() {
+			bin := GinkgoT().TempDir()
+			script := `#!/bin/sh
+echo "rpctool: noise" >&2
+case "$1" in
+"info-get guestinfo.userdata") printf '#cloud-config\noptions:\n  vmware: true\n' ;;
+*) exit 1 ;;
+esac
+`
+			Expect(os.WriteFile(path.Join(bin, "vmware-rpctool"), []byte(script), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+			data, err := (&VMwareDatasource{}).Read(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("#cloud-config\noptions:\n  vmware: true"))
+
+			Expect(os.WriteFile(path.Join(bin, "vmware-rpctool"), []byte("#!/bin/sh\nexec sleep 5\n"), 0755)).To(Succeed())
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			data, err = (&VMwareDatasource{}).Read(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(data).To(BeNil())
+			Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		})
+
+		It("skips the datasources of other platforms", func() {
+			slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Second)
+			}))
+			defer slow.Close()
+
+			o := &Options{}
+			err := o.Apply(NoLogs, WithDatasourceTimeout(100*time.Millisecond), WithDatasources(
+				&GCEDatasource{Endpoint: slow.URL},
+				&VMwareDatasource{Runner: &types.FakeRunner{Err: errors.New("not found")}},
+			))
+			Expect(err).ToNot(HaveOccurred())
+			start := time.Now()
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(c.Sources).To(BeEmpty())
+		})
+	})
+
+	Describe("Platform sources", func() {
+		var tmpDir string
+
+		// oemStrings returns a raw SMBIOS type 11 structure
+		oemStrings := func(strs ...string) []byte {
+			raw := []byte{11, 5, 0, 0, byte(len(strs))}
+			for _, s := range strs {
+				raw = append(append(raw, s...), 0)
+			}
+			return append(raw, 0)
+		}
+
+		BeforeEach(func() {
+			tmpDir = GinkgoT().TempDir()
+		})
+
+		It("reads configs from systemd credentials", func() {
+			serviceDir := path.Join(tmpDir, "service")
+			systemDir := path.Join(tmpDir, "system")
+			Expect(os.MkdirAll(serviceDir, os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(systemDir, os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(path.Join(serviceDir, "kairos.config"), []byte("#cloud-config\noptions:\n  foo: service\n"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(path.Join(systemDir, "kairos.config"), []byte("#cloud-config\noptions:\n  foo: system\n"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(path.Join(systemDir, "other"), []byte("#cloud-config\noptions:\n  bar: other\n"), os.ModePerm)).To(Succeed())
+
+			o := &Options{CredentialDirs: []string{serviceDir, systemDir}}
+			Expect(o.Apply(NoLogs, WithCredentials())).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources).To(Equal([]string{"credential:kairos.config"}))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"foo": "service"}))
+		})
+
+		It("reads configs from SMBIOS OEM strings with the prefix", func() {
+			entry := path.Join(tmpDir, "11-0")
+			Expect(os.MkdirAll(entry, os.ModePerm)).To(Succeed())
+			config := base64.StdEncoding.EncodeToString([]byte("#cloud-config\noptions:\n  foo: smbios\n"))
+			err := os.WriteFile(path.Join(entry, "raw"), oemStrings("io.systemd.credential:foo=bar", "io.kairos.config:"+config), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+
+			o := &Options{DMIEntriesDir: tmpDir}
+			Expect(o.Apply(NoLogs, WithOEMStrings(""))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources).To(Equal([]string{"smbios:oem-string"}))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"foo": "smbios"}))
+		})
+
+		It("doesn't read platform sources by default", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs)).To(Succeed())
+			Expect(o.CredentialNames).To(BeEmpty())
+			Expect(o.OEMStringPrefix).To(BeEmpty())
+		})
+	})
+
+	Describe("Final overrides", func() {
+		var tmpDir, overridesDir, cmdLinePath string
+		var err error
+
+		BeforeEach(func() {
+			tmpDir, err = os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+			overridesDir = path.Join(tmpDir, "99_overrides.d")
+			Expect(os.Mkdir(overridesDir, os.ModePerm)).To(Succeed())
+
+			err = os.WriteFile(path.Join(tmpDir, "local_config.yaml"), []byte("#cloud-config\noptions:\n  foo: local\n  bar: local\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+			err = os.WriteFile(path.Join(overridesDir, "override.yaml"), []byte("#cloud-config\noptions:\n  foo: override\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+			cmdLinePath = path.Join(tmpDir, "cmdline")
+			err = os.WriteFile(cmdLinePath, []byte("options.foo=cmdline"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("wins over the cmdline when enabled", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), MergeBootLine, WithBootCMDLineFile(cmdLinePath),
+				WithFinalOverrides(overridesDir))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTestMerge)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"foo": "override", "bar": "local"}))
+			Expect(c.Sources).To(Equal([]string{
+				path.Join(tmpDir, "local_config.yaml"),
+				"cmdline",
+				path.Join(overridesDir, "override.yaml"),
+			}))
+		})
+
+		It("replaces lists instead of merging them", func() {
+			err = os.WriteFile(path.Join(tmpDir, "users.yaml"), []byte("#cloud-config\nusers:\n- name: kairos\n- name: admin\nntp:\n- pool.ntp.org\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+			err = os.WriteFile(path.Join(overridesDir, "users.yaml"), []byte("#cloud-config\nusers:\n- name: kairos\n  passwd: override\nntp:\n- ntp.local\noptions:\n  bar: override\n"), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), WithFinalOverrides(overridesDir))).To(Succeed())
+			c, err := Scan(o, FilterKeysTestMerge)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["users"]).To(Equal([]interface{}{ConfigValues{"name": "kairos", "passwd": "override"}}))
+			Expect(c.Values["ntp"]).To(Equal([]interface{}{"ntp.local"}))
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"foo": "override", "bar": "override"}))
+		})
+
+		It("is merged as a regular directory when disabled", func() {
+			o := &Options{}
+			Expect(o.Apply(NoLogs, Directories(tmpDir), MergeBootLine, WithBootCMDLineFile(cmdLinePath))).To(Succeed())
+
+			c, err := Scan(o, FilterKeysTestMerge)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Values["options"]).To(Equal(ConfigValues{"foo": "cmdline", "bar": "local"}))
+		})
+
+		It("defaults to the reserved directory", func() {
+			o := &Options{}
+			Expect(o.Apply(WithFinalOverrides())).To(Succeed())
+			Expect(o.OverridesDirs).To(Equal([]string{DefaultOverridesDir}))
+		})
+	})
+
 	Describe("String", func() {
 		var conf *Config
 		BeforeEach(func() {
@@ -1164,6 +2366,151 @@ name: Mario
 		})
 	})
 
+	Describe("CanonicalString", func() {
+		It("renders the same string no matter the key order", func() {
+			a := &Config{Sources: []string{"a.yaml", "b.yaml", "a.yaml"}}
+			err := yaml.Unmarshal([]byte(`zeta: 1
+alpha:
+    nested_b: true
+    nested_a: [one, two]
+users:
+- name: kairos
+  passwd: kairos
+`), &a.Values)
+			Expect(err).ToNot(HaveOccurred())
+
+			b := &Config{Sources: []string{"a.yaml", "b.yaml"}}
+			err = yaml.Unmarshal([]byte(`users:
+- passwd: kairos
+  name: kairos
+alpha:
+  nested_a:
+  - one
+  - two
+  nested_b: true
+zeta: 1
+`), &b.Values)
+			Expect(err).ToNot(HaveOccurred())
+
+			sa, err := a.CanonicalString()
+			Expect(err).ToNot(HaveOccurred())
+			sb, err := b.CanonicalString()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sa).To(Equal(sb))
+			Expect(sa).To(Equal(`#cloud-config
+
+# Sources:
+# - a.yaml
+# - b.yaml
+
+alpha:
+  nested_a:
+    - one
+    - two
+  nested_b: true
+users:
+  - name: kairos
+    passwd: kairos
+zeta: 1
+`), sa)
+		})
+
+		It("only writes the file when the content changes", func() {
+			tmpDir, err := os.MkdirTemp("", "canonical")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			f := filepath.Join(tmpDir, "config.yaml")
+
+			conf := &Config{Values: ConfigValues{"name": "Mario"}}
+			changed, err := conf.WriteCanonical(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+
+			changed, err = conf.WriteCanonical(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeFalse())
+
+			conf.Values["name"] = "Luigi"
+			changed, err = conf.WriteCanonical(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			content, err := os.ReadFile(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("#cloud-config\n\nname: Luigi\n"))
+		})
+	})
+
+	Describe("WriteFile", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			tmpDir = GinkgoT().TempDir()
+		})
+
+		It("writes the canonical config only readable by its owner", func() {
+			f := filepath.Join(tmpDir, "oem", "90_custom.yaml")
+			conf := &Config{Values: ConfigValues{"name": "Mario"}}
+			Expect(conf.WriteFile(f)).To(Succeed())
+
+			content, err := os.ReadFile(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("#cloud-config\n\nname: Mario\n"))
+			info, err := os.Stat(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("replaces the file without leaving temporary files behind", func() {
+			f := filepath.Join(tmpDir, "90_custom.yaml")
+			Expect(os.WriteFile(f, []byte("old"), 0644)).To(Succeed())
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					conf := &Config{Values: ConfigValues{"writer": i}}
+					Expect(conf.WriteFile(f)).To(Succeed())
+				}(i)
+			}
+			wg.Wait()
+
+			content, err := os.ReadFile(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(MatchRegexp("^#cloud-config\n\nwriter: [0-9]\n$"))
+			entries, err := os.ReadDir(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+	})
+
+	Describe("MarshalZerologObject", func() {
+		It("logs the config with the sensitive values redacted", func() {
+			conf := &Config{Sources: []string{"/oem/90_custom.yaml"}}
+			err := yaml.Unmarshal([]byte(`users:
+- name: kairos
+  passwd: kairos
+p2p:
+  network_token: abcdef
+k3s:
+  enabled: true
+`), &conf.Values)
+			Expect(err).ToNot(HaveOccurred())
+
+			var buf bytes.Buffer
+			logger := zerolog.New(&buf)
+			logger.Info().Object("config", conf).Msg("merged")
+			Expect(buf.String()).To(ContainSubstring(`"sources":["/oem/90_custom.yaml"]`))
+			Expect(buf.String()).To(ContainSubstring(`"passwd":"REDACTED"`))
+			Expect(buf.String()).To(ContainSubstring(`"network_token":"REDACTED"`))
+			Expect(buf.String()).To(ContainSubstring(`"k3s":{"enabled":true}`))
+			Expect(buf.String()).ToNot(ContainSubstring("abcdef"))
+			// The config itself is not modified
+			Expect(conf.Values["p2p"]).To(HaveKeyWithValue("network_token", "abcdef"))
+		})
+	})
+
 	Describe("Query", func() {
 		var tmpDir string
 		var err error
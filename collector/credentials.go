@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCredentialName is the systemd credential read by WithCredentials
+// when no name is given.
+const DefaultCredentialName = "kairos.config"
+
+// DefaultOEMStringPrefix is the prefix of the SMBIOS OEM strings read by
+// WithOEMStrings when no prefix is given. The rest of the string is the
+// base64 encoded config, e.g. with qemu:
+// -smbios type=11,value=io.kairos.config:I2Nsb3VkLWNvbmZpZwo=
+const DefaultOEMStringPrefix = "io.kairos.config:"
+
+// DefaultDMIEntriesDir is where the kernel exposes the SMBIOS tables.
+const DefaultDMIEntriesDir = "/sys/firmware/dmi/entries"
+
+// smbiosOEMStrings is the SMBIOS structure type holding the OEM strings.
+const smbiosOEMStrings = 11
+
+// defaultCredentialDirs are the directories systemd passes credentials in:
+// the one of the running service and the system ones, imported from SMBIOS,
+// qemu fw_cfg or the kernel cmdline.
+func defaultCredentialDirs() []string {
+	dirs := []string{}
+	if d := os.Getenv("CREDENTIALS_DIRECTORY"); d != "" {
+		dirs = append(dirs, d)
+	}
+	return append(dirs, "/run/credentials/@system", "/run/credentials/@initrd")
+}
+
+// credentialConfigs returns the configs in the systemd credentials. Each
+// credential is read from the first directory that has it.
+func (o *Options) credentialConfigs() []*Config {
+	result := []*Config{}
+	for _, name := range o.CredentialNames {
+		for _, dir := range o.CredentialDirs {
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			if c := o.parseSource(b, "credential:"+name); c != nil {
+				result = append(result, c)
+			}
+			break
+		}
+	}
+
+	return result
+}
+
+// oemStringConfigs returns the configs in the SMBIOS OEM strings with the
+// OEMStringPrefix.
+func (o *Options) oemStringConfigs() []*Config {
+	result := []*Config{}
+	entries, err := filepath.Glob(filepath.Join(o.DMIEntriesDir, fmt.Sprintf("%d-*", smbiosOEMStrings), "raw"))
+	if err != nil {
+		return result
+	}
+
+	for _, entry := range entries {
+		raw, err := os.ReadFile(entry)
+		if err != nil {
+			o.SoftErr(fmt.Sprintf("reading %s", entry), err)
+			continue
+		}
+		for _, s := range parseOEMStrings(raw) {
+			value, found := strings.CutPrefix(s, o.OEMStringPrefix)
+			if !found {
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				o.SoftErr("decoding OEM string config", err)
+				continue
+			}
+			if c := o.parseSource(b, "smbios:oem-string"); c != nil {
+				result = append(result, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// parseOEMStrings returns the strings of a raw SMBIOS type 11 structure: a
+// formatted area whose second byte is its length, followed by the
+// null-terminated strings, ending with an empty one.
+func parseOEMStrings(raw []byte) []string {
+	if len(raw) < 5 || raw[0] != smbiosOEMStrings || int(raw[1]) > len(raw) {
+		return nil
+	}
+
+	result := []string{}
+	for _, s := range bytes.Split(raw[raw[1]:], []byte{0}) {
+		if len(s) == 0 {
+			break
+		}
+		result = append(result, string(s))
+	}
+
+	return result
+}
+
+// parseSource parses the config of a source, which needs a valid header like
+// config files.
+func (o *Options) parseSource(b []byte, source string) *Config {
+	if !HasValidHeader(string(b)) {
+		o.SoftErr(fmt.Sprintf("skipping %s", source), fmt.Errorf("no valid header"))
+		return nil
+	}
+
+	c := &Config{Sources: []string{source}}
+	if err := parseYAML(b, &c.Values); err != nil {
+		o.SoftErr(fmt.Sprintf("parsing %s", source), err)
+		return nil
+	}
+
+	return c
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// DefaultDatasourceTimeout is how long each datasource is given to answer
+// when Options.DatasourceTimeout is not set. Metadata services answer
+// quickly when they exist, and scans on other platforms must not hang.
+const DefaultDatasourceTimeout = 2 * time.Second
+
+// Datasource reads the user data of the platform the system runs on, like a
+// hypervisor or a cloud provider metadata service. Read returns nil data,
+// and no error, when there is no user data or it's not running on the
+// platform.
+type Datasource interface {
+	Name() string
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// Default metadata endpoints of the cloud datasources.
+const (
+	DefaultEC2Endpoint   = "http://169.254.169.254"
+	DefaultGCEEndpoint   = "http://metadata.google.internal"
+	DefaultAzureEndpoint = "http://169.254.169.254"
+)
+
+// DefaultDatasources returns all the datasources, for WithDatasources.
+func DefaultDatasources() []Datasource {
+	return []Datasource{&VMwareDatasource{}, &EC2Datasource{}, &GCEDatasource{}, &AzureDatasource{}}
+}
+
+// datasourceConfig reads the config of a datasource, which needs a valid
+// header like config files.
+func (o *Options) datasourceConfig(ctx context.Context, ds Datasource) *Config {
+	timeout := o.DatasourceTimeout
+	if timeout <= 0 {
+		timeout = DefaultDatasourceTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b, err := ds.Read(ctx)
+	if err != nil {
+		o.SoftErr(fmt.Sprintf("reading datasource %s", ds.Name()), err)
+		return nil
+	}
+	if len(b) == 0 {
+		return nil
+	}
+
+	return o.parseSource(b, "datasource:"+ds.Name())
+}
+
+// EC2Datasource reads the user data from the AWS EC2 instance metadata
+// service, using a session token (IMDSv2).
+type EC2Datasource struct {
+	// Endpoint defaults to DefaultEC2Endpoint
+	Endpoint string
+}
+
+func (d *EC2Datasource) Name() string { return "ec2" }
+
+func (d *EC2Datasource) Read(ctx context.Context) ([]byte, error) {
+	endpoint := valueOr(d.Endpoint, DefaultEC2Endpoint)
+	token, err := metadataGet(ctx, http.MethodPut, endpoint+"/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	return metadataGet(ctx, http.MethodGet, endpoint+"/latest/user-data", map[string]string{
+		"X-aws-ec2-metadata-token": string(token),
+	})
+}
+
+// GCEDatasource reads the user-data attribute from the Google Compute Engine
+// metadata server.
+type GCEDatasource struct {
+	// Endpoint defaults to DefaultGCEEndpoint
+	Endpoint string
+}
+
+func (d *GCEDatasource) Name() string { return "gce" }
+
+func (d *GCEDatasource) Read(ctx context.Context) ([]byte, error) {
+	endpoint := valueOr(d.Endpoint, DefaultGCEEndpoint)
+	return metadataGet(ctx, http.MethodGet, endpoint+"/computeMetadata/v1/instance/attributes/user-data", map[string]string{
+		"Metadata-Flavor": "Google",
+	})
+}
+
+// AzureDatasource reads the user data from the Azure instance metadata
+// service.
+type AzureDatasource struct {
+	// Endpoint defaults to DefaultAzureEndpoint
+	Endpoint string
+}
+
+func (d *AzureDatasource) Name() string { return "azure" }
+
+func (d *AzureDatasource) Read(ctx context.Context) ([]byte, error) {
+	endpoint := valueOr(d.Endpoint, DefaultAzureEndpoint)
+	b, err := metadataGet(ctx, http.MethodGet, endpoint+"/metadata/instance/compute/userData?api-version=2021-01-01&format=text", map[string]string{
+		"Metadata": "true",
+	})
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	// The user data is always base64 encoded
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+}
+
+// VMwareDatasource reads the guestinfo.userdata key set in the VM
+// configuration, with vmware-rpctool. The guestinfo.userdata.encoding key
+// can be base64 or gzip+base64.
+type VMwareDatasource struct {
+	// Runner runs the command instead, it's meant for tests. It gets the
+	// user data as output, so it must not log it.
+	Runner types.Runner
+}
+
+func (d *VMwareDatasource) Name() string { return "vmware" }
+
+func (d *VMwareDatasource) Read(ctx context.Context) ([]byte, error) {
+	get := func(key string) (string, bool) {
+		if ctx.Err() != nil {
+			return "", false
+		}
+		// Only the standard output is the value. Nothing is logged, as it can
+		// hold secrets.
+		cmd := exec.CommandContext(ctx, "vmware-rpctool", "info-get guestinfo."+key)
+		var out []byte
+		var err error
+		if d.Runner != nil {
+			out, err = d.Runner.RunCmd(cmd)
+		} else {
+			out, err = cmd.Output()
+		}
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimSpace(string(out)), true
+	}
+
+	data, found := get("userdata")
+	if !found || data == "" {
+		return nil, ctx.Err()
+	}
+	encoding, _ := get("userdata.encoding")
+
+	return decodeGuestinfo(data, encoding)
+}
+
+func decodeGuestinfo(data, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(data), nil
+	case "base64", "b64":
+		return base64.StdEncoding.DecodeString(data)
+	case "gzip+base64", "gz+b64":
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	return nil, fmt.Errorf("unknown guestinfo encoding %q", encoding)
+}
+
+// metadataGet requests a metadata service. It returns no data and no error
+// when the service is not reachable or has no such entry, as that's the case
+// on other platforms.
+func metadataGet(ctx context.Context, method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Unreachable or too slow, so not this platform
+		return nil, nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status from %s: %d", url, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func valueOr(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
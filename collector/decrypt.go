@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"gopkg.in/yaml.v3"
+)
+
+// EncryptedExt is the suffix of the encrypted config files, e.g.
+// 90_secrets.yaml.enc. They are only merged when a Decrypter can decrypt them.
+const EncryptedExt = ".enc"
+
+// Decrypter decrypts encrypted config files, see WithDecrypters.
+type Decrypter interface {
+	// CanDecrypt returns true if the encrypted content is in a format the
+	// Decrypter knows
+	CanDecrypt(data []byte) bool
+	// Decrypt returns the plain config in the given file
+	Decrypt(path string) ([]byte, error)
+}
+
+// AgeDecrypter decrypts age encrypted files, binary or armored, with the age
+// command and the given identity file.
+type AgeDecrypter struct {
+	IdentityFile string
+	// Runner runs the command instead, it's meant for tests. It gets the
+	// plain config as output, so it must not log it.
+	Runner types.Runner
+}
+
+func (d *AgeDecrypter) CanDecrypt(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("age-encryption.org/")) ||
+		bytes.HasPrefix(data, []byte("-----BEGIN AGE ENCRYPTED FILE-----"))
+}
+
+func (d *AgeDecrypter) Decrypt(path string) ([]byte, error) {
+	return runDecrypt(d.Runner, exec.Command("age", "--decrypt", "--identity", d.IdentityFile, path))
+}
+
+// SOPSDecrypter decrypts SOPS encrypted YAML files with the sops command. The
+// keys are found by sops as usual, e.g. in the cloud KMS or with
+// $SOPS_AGE_KEY_FILE, unless AgeKeyFile is set.
+type SOPSDecrypter struct {
+	AgeKeyFile string
+	// Runner runs the command instead, it's meant for tests. It gets the
+	// plain config as output, so it must not log it.
+	Runner types.Runner
+}
+
+func (d *SOPSDecrypter) CanDecrypt(data []byte) bool {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	metadata, ok := doc["sops"].(map[string]interface{})
+	return ok && metadata["mac"] != nil
+}
+
+func (d *SOPSDecrypter) Decrypt(path string) ([]byte, error) {
+	cmd := exec.Command("sops", "--decrypt", "--input-type", "yaml", "--output-type", "yaml", path)
+	if d.AgeKeyFile != "" {
+		cmd.Env = append(os.Environ(), "SOPS_AGE_KEY_FILE="+d.AgeKeyFile)
+	}
+	return runDecrypt(d.Runner, cmd)
+}
+
+// runDecrypt runs the decrypt command returning its standard output only, the
+// standard error is only used in the error. Nothing is logged, as the output
+// is the plain config.
+func runDecrypt(r types.Runner, cmd *exec.Cmd) ([]byte, error) {
+	if r != nil {
+		return r.RunCmd(cmd)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// isEncryptedConfig returns true for the .yaml.enc and .yml.enc files
+func isEncryptedConfig(f string) bool {
+	return strings.HasSuffix(f, ".yaml"+EncryptedExt) || strings.HasSuffix(f, ".yml"+EncryptedExt)
+}
+
+// decrypt returns the plain content of the encrypted file, decrypted with the
+// first of the Decrypters that knows its format.
+func (o *Options) decrypt(f string, data []byte) ([]byte, error) {
+	if len(o.Decrypters) == 0 {
+		return nil, fmt.Errorf("no decrypter configured")
+	}
+	for _, d := range o.Decrypters {
+		if !d.CanDecrypt(data) {
+			continue
+		}
+		plain, err := d.Decrypt(f)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting: %w", err)
+		}
+		return plain, nil
+	}
+
+	return nil, fmt.Errorf("unknown encryption format")
+}
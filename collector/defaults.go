@@ -0,0 +1,25 @@
+package collector
+
+// applyDefaults sets the defaults missing in values. Nested defaults are only
+// applied to the maps already present in values.
+func applyDefaults(values map[string]interface{}, defaults map[string]interface{}) {
+	for k, d := range defaults {
+		current, ok := values[k]
+		nested, isMap := d.(map[string]interface{})
+		if !ok {
+			if !isMap {
+				values[k] = d
+			}
+			continue
+		}
+		if !isMap {
+			continue
+		}
+		switch t := current.(type) {
+		case ConfigValues:
+			applyDefaults(t, nested)
+		case map[string]interface{}:
+			applyDefaults(t, nested)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package collector
+
+import "sort"
+
+// Merge directives are suffixes of the keys that change how their value is
+// merged with the one of the configs merged before, e.g.:
+//
+//	users!:      # replace the inherited users instead of appending to them
+//	- name: admin
+//	k3s-:        # drop the inherited k3s block
+//
+// The directives are only applied with the MergeDirectives option, or with
+// DeepMergeWithDirectives, otherwise the keys are merged as they are. Once
+// enabled, the suffix is not part of the merged key and the directives apply
+// to the keys at any level, so a key really ending in a suffix is written
+// with the suffix doubled, e.g. "kubelet-arg--" sets "kubelet-arg-".
+const (
+	ReplaceSuffix = "!"
+	DeleteSuffix  = "-"
+)
+
+type mergeDirective int
+
+const (
+	mergeDefault mergeDirective = iota
+	mergeDelete
+	mergeReplace
+)
+
+// parseMergeDirective returns the key without its directive suffix, and the
+// directive. A doubled suffix is an escaped one, the key is returned with a
+// single suffix and no directive.
+func parseMergeDirective(key string) (string, mergeDirective) {
+	if len(key) < 2 {
+		return key, mergeDefault
+	}
+	suffix := key[len(key)-1:]
+	if (suffix == ReplaceSuffix || suffix == DeleteSuffix) && key[len(key)-2:len(key)-1] == suffix {
+		return key[:len(key)-1], mergeDefault
+	}
+	switch suffix {
+	case ReplaceSuffix:
+		return key[:len(key)-1], mergeReplace
+	case DeleteSuffix:
+		return key[:len(key)-1], mergeDelete
+	}
+	return key, mergeDefault
+}
+
+// directiveOrder returns the keys with deletions first and replacements
+// next, so e.g. "users-" and "users" in the same config drop the inherited
+// users and then set the new ones.
+func directiveOrder(values ConfigValues) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		_, di := parseMergeDirective(keys[i])
+		_, dj := parseMergeDirective(keys[j])
+		if di != dj {
+			return di != mergeDefault && (dj == mergeDefault || di < dj)
+		}
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// mergeOrder returns the keys of values in the order they are merged: the
+// directiveOrder if the directives are enabled, any order otherwise.
+func mergeOrder(values ConfigValues, directives bool) []string {
+	if directives {
+		return directiveOrder(values)
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// stripDirectives returns the value with the directives applied as if there
+// was nothing to merge it with: deleted keys are dropped and the suffixes of
+// the rest are removed.
+func stripDirectives(v interface{}) interface{} {
+	switch t := v.(type) {
+	case ConfigValues:
+		return ConfigValues(stripMapDirectives(t))
+	case map[string]interface{}:
+		return stripMapDirectives(t)
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, val := range t {
+			result[i] = stripDirectives(val)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func stripMapDirectives(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for _, k := range directiveOrder(m) {
+		name, directive := parseMergeDirective(k)
+		if directive == mergeDelete {
+			delete(result, name)
+			continue
+		}
+		result[name] = stripDirectives(m[k])
+	}
+
+	return result
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"os"
+	"regexp"
+)
+
+// envPattern matches ${VAR} references and the $${ escape sequence.
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${VAR} references in the string values of v with the
+// value of the environment variables, if they are allowed by the Options and
+// set. Other references are left untouched. "$${" is replaced with a literal
+// "${". Map keys are never expanded.
+func (o *Options) expandEnv(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return envPattern.ReplaceAllStringFunc(t, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			name := match[2 : len(match)-1]
+			if !o.envAllowed(name) {
+				return match
+			}
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			return match
+		})
+	case ConfigValues:
+		return ConfigValues(o.expandEnv(map[string]interface{}(t)).(map[string]interface{}))
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = o.expandEnv(val)
+		}
+		return t
+	case map[interface{}]interface{}:
+		for k, val := range t {
+			t[k] = o.expandEnv(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = o.expandEnv(val)
+		}
+		return t
+	}
+
+	return v
+}
+
+func (o *Options) envAllowed(name string) bool {
+	if len(o.ExpandEnvAllowlist) == 0 {
+		return true
+	}
+	for _, n := range o.ExpandEnvAllowlist {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// ImmutableKey is the directive listing the top level sections that can't
+// change once the baseline is persisted, e.g. "immutable: [install, users]".
+const ImmutableKey = "immutable"
+
+// DefaultBaselineFile is where WithBaseline looks for the baseline when no
+// path is given.
+const DefaultBaselineFile = "/oem/.baseline.yaml"
+
+// ImmutableSections returns the sections listed in the immutable directive,
+// sorted and without duplicates.
+func (c *Config) ImmutableSections() []string {
+	list, ok := c.Values[ImmutableKey].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, s := range list {
+		name, ok := s.(string)
+		if !ok || name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// WriteBaseline persists the immutable sections of the Config, and the
+// directive itself, to the given path. Once it exists, scans using it with
+// WithBaseline keep these sections as they are now.
+func (c *Config) WriteBaseline(path string) error {
+	sections := c.ImmutableSections()
+	if len(sections) == 0 {
+		return errors.New("the config has no immutable sections")
+	}
+
+	baseline := &Config{Values: ConfigValues{ImmutableKey: c.Values[ImmutableKey]}}
+	for _, s := range sections {
+		if v, ok := c.Values[s]; ok {
+			baseline.Values[s] = v
+		}
+	}
+
+	data, err := baseline.CanonicalString()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, []byte(data))
+}
+
+// readBaseline returns the baseline in the BaselineFile, or nil if there is
+// none yet.
+func (o *Options) readBaseline() (*Config, error) {
+	b, err := os.ReadFile(o.BaselineFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{Sources: []string{"baseline:" + o.BaselineFile}}
+	if err := parseYAML(b, &c.Values); err != nil {
+		return nil, fmt.Errorf("parsing the baseline %s: %w", o.BaselineFile, err)
+	}
+
+	return c, nil
+}
+
+// enforceImmutable restores the immutable sections of the baseline that the
+// merged config changed. Changes are reported as warnings, or returned as an
+// error if StrictImmutable is set. The directive is immutable as well, so it
+// can't be dropped by later sources.
+func (o *Options) enforceImmutable(merged *Config) error {
+	baseline, err := o.readBaseline()
+	if err != nil || baseline == nil {
+		return err
+	}
+
+	if merged.Values == nil {
+		merged.Values = ConfigValues{}
+	}
+	restored := map[string]interface{}{}
+	for _, s := range append([]string{ImmutableKey}, baseline.ImmutableSections()...) {
+		want, wantOK := baseline.Values[s]
+		got, gotOK := merged.Values[s]
+		if wantOK == gotOK && reflect.DeepEqual(canonicalValue(want), canonicalValue(got)) {
+			continue
+		}
+
+		err := fmt.Errorf("section %q is immutable and differs from the baseline %s", s, o.BaselineFile)
+		if o.StrictImmutable {
+			return err
+		}
+		o.SoftErr("keeping the baseline", err)
+		if wantOK {
+			merged.Values[s] = want
+			restored[s] = want
+		} else {
+			delete(merged.Values, s)
+		}
+	}
+
+	if o.TrackProvenance && len(restored) > 0 {
+		merged.provenance = append(merged.provenance, topLevelEntries(restored, baseline.Sources[0])...)
+	}
+
+	return nil
+}
+
+// isBaselineFile returns true if the given file is the BaselineFile, which
+// is not merged as a config.
+func (o *Options) isBaselineFile(f string) bool {
+	return o.BaselineFile != "" && filepath.Clean(f) == filepath.Clean(o.BaselineFile)
+}
@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxConfigDepth is the deepest nesting of maps and lists allowed in a config.
+var MaxConfigDepth = 64
+
+// MaxConfigNodes is the most values a config can have, once its YAML aliases
+// are expanded.
+var MaxConfigNodes = 100000
+
+// DepthLimitError is returned when a config is nested deeper than
+// MaxConfigDepth, which also stops recursive values.
+type DepthLimitError struct {
+	Max int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("config is nested deeper than %d levels", e.Max)
+}
+
+// NodeLimitError is returned when a config has more than MaxConfigNodes
+// values, e.g. because of YAML aliases expanding to huge structures.
+type NodeLimitError struct {
+	Max int
+}
+
+func (e *NodeLimitError) Error() string {
+	return fmt.Sprintf("config has more than %d values", e.Max)
+}
+
+// checkLimits walks the values and fails if they go over MaxConfigDepth or
+// MaxConfigNodes.
+func checkLimits(v interface{}) error {
+	nodes := 0
+	return walkLimits(reflect.ValueOf(v), 0, &nodes)
+}
+
+func walkLimits(v reflect.Value, depth int, nodes *int) error {
+	*nodes++
+	if *nodes > MaxConfigNodes {
+		return &NodeLimitError{Max: MaxConfigNodes}
+	}
+
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Map && v.Kind() != reflect.Slice {
+		return nil
+	}
+	if depth >= MaxConfigDepth {
+		return &DepthLimitError{Max: MaxConfigDepth}
+	}
+
+	if v.Kind() == reflect.Map {
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := walkLimits(iter.Value(), depth+1, nodes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := walkLimits(v.Index(i), depth+1, nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseYAML unmarshals the YAML document like yaml.Unmarshal, but fails
+// before decoding it if expanding its aliases goes over MaxConfigDepth or
+// MaxConfigNodes.
+func parseYAML(b []byte, out interface{}) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		// Empty document
+		return nil
+	}
+
+	l := yamlLimits{sizes: map[*yaml.Node][2]int{}, expanding: map[*yaml.Node]bool{}}
+	if _, _, err := l.size(&doc, 0); err != nil {
+		return err
+	}
+
+	return doc.Decode(out)
+}
+
+// yamlLimits computes the number of values and the nesting of YAML nodes with
+// their aliases expanded, caching them for the anchored nodes.
+type yamlLimits struct {
+	sizes     map[*yaml.Node][2]int
+	expanding map[*yaml.Node]bool
+}
+
+// size returns the number of values of the node and how many levels of maps
+// and lists it has. The document node is at depth 0, so the values of the
+// config are at the same depth as in checkLimits.
+func (l yamlLimits) size(n *yaml.Node, depth int) (int, int, error) {
+	if n.Kind == yaml.AliasNode {
+		if l.expanding[n.Alias] {
+			return 0, 0, fmt.Errorf("anchor '%s' value contains itself", n.Value)
+		}
+		cached, ok := l.sizes[n.Alias]
+		if !ok {
+			l.expanding[n.Alias] = true
+			size, height, err := l.size(n.Alias, depth)
+			delete(l.expanding, n.Alias)
+			if err != nil {
+				return 0, 0, err
+			}
+			cached = [2]int{size, height}
+			l.sizes[n.Alias] = cached
+		}
+		if depth+cached[1]-1 > MaxConfigDepth {
+			return 0, 0, &DepthLimitError{Max: MaxConfigDepth}
+		}
+		return cached[0], cached[1], nil
+	}
+
+	container := n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode
+	if container && depth > MaxConfigDepth {
+		return 0, 0, &DepthLimitError{Max: MaxConfigDepth}
+	}
+
+	total, height := 1, 0
+	for _, c := range n.Content {
+		size, h, err := l.size(c, depth+1)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += size
+		if total > MaxConfigNodes {
+			return 0, 0, &NodeLimitError{Max: MaxConfigNodes}
+		}
+		height = max(height, h)
+	}
+	if container {
+		height++
+	}
+	return total, height, nil
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"regexp"
+
+	"github.com/rs/zerolog"
+)
+
+// RedactedValue replaces the values of sensitive keys when logging configs.
+const RedactedValue = "REDACTED"
+
+// sensitiveKey matches the keys whose values are redacted when logging
+// configs (e.g. passwd, network_token, private_key).
+var sensitiveKey = regexp.MustCompile(`(?i)(passw|token|secret|private|credential)`)
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler so configs can be
+// logged as structured fields with Object(). Values of sensitive keys, like
+// user passwords or tokens, are redacted.
+func (c Config) MarshalZerologObject(e *zerolog.Event) {
+	e.Strs("sources", c.Sources)
+	e.Interface("values", redact(map[string]interface{}(c.Values)))
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			if sensitiveKey.MatchString(k) {
+				result[k] = RedactedValue
+				continue
+			}
+			result[k] = redact(val)
+		}
+		return result
+	case ConfigValues:
+		return redact(map[string]interface{}(t))
+	case map[interface{}]interface{}:
+		return redact(canonicalValue(t))
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, val := range t {
+			result[i] = redact(val)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -3,6 +3,11 @@ package collector
 import (
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/schema"
 )
 
 type Options struct {
@@ -13,8 +18,84 @@ type Options struct {
 	StrictValidation bool
 	Readers          []io.Reader
 	Overwrites       string
+	// FinalOverrides enables the OverridesDirs. Configs found in them are
+	// applied last, so their values win over any other source, including
+	// config_url and the cmdline. Their lists and scalars replace the existing
+	// values instead of being merged with them, only maps are merged.
+	FinalOverrides bool
+	OverridesDirs  []string
+	// SniffContent makes the scan consider files without a .yaml/.yml
+	// extension, as long as they have a valid header and are valid YAML.
+	SniffContent bool
+	// Timeout is the deadline for the whole scan, including the remote
+	// config_url fetches. Zero means no deadline.
+	Timeout time.Duration
+	// MaxConcurrentFetches is the number of configs whose config_url chains
+	// are fetched at the same time. Values lower than 1 fetch one at a time.
+	MaxConcurrentFetches int
+	// OnSourceTiming, if set, is called with the time it took to fetch each
+	// remote config.
+	OnSourceTiming func(SourceTiming)
+	// ExpandEnv enables the expansion of ${VAR} references in the string
+	// values of the merged config. Only the variables in ExpandEnvAllowlist
+	// are expanded, or all of them if it's empty.
+	ExpandEnv          bool
+	ExpandEnvAllowlist []string
+	// Defaults are merged into the final config, filling only the keys it
+	// doesn't define. See WithSchemaDefaults.
+	Defaults map[string]interface{}
+	// SeedLabels are the filesystem labels of the partitions read as NoCloud
+	// or OpenStack config drive seed data. See WithSeedPartitions.
+	SeedLabels []string
+	// SeedDevices are devices or disk images read as seed data, like the
+	// partitions found with SeedLabels.
+	SeedDevices []string
+	// CredentialNames are the systemd credentials read as configs from the
+	// CredentialDirs. See WithCredentials.
+	CredentialNames []string
+	CredentialDirs  []string
+	// OEMStringPrefix enables reading configs from the SMBIOS OEM strings
+	// with this prefix, found in DMIEntriesDir. See WithOEMStrings.
+	OEMStringPrefix string
+	DMIEntriesDir   string
+	// Datasources are read after the platform sources, each one given up to
+	// DatasourceTimeout. See WithDatasources.
+	Datasources       []Datasource
+	DatasourceTimeout time.Duration
+	// Remote configures the config_url fetches, e.g. with WithProxy
+	Remote RemoteOptions
+	// TrackProvenance records which source sets each key of the merged
+	// config, see Config.Explain.
+	TrackProvenance bool
+	// MergeDirectives applies the merge directives of the keys, see
+	// ReplaceSuffix and DeleteSuffix. Keys are merged as they are otherwise.
+	MergeDirectives bool
+	// BaselineFile, once it exists, keeps the sections in its immutable
+	// directive from being changed by any source. See WithBaseline.
+	BaselineFile string
+	// StrictImmutable fails the scan when a source changes an immutable
+	// section, instead of warning and keeping the baseline.
+	StrictImmutable bool
+	// SchemaType, if set, is the schema the merged config is validated
+	// against, see WithSchemaValidation.
+	SchemaType interface{}
+	// Decrypters decrypt the .yaml.enc files, which are skipped otherwise.
+	// See WithDecrypters.
+	Decrypters []Decrypter
+}
+
+// SourceTiming reports how long it took to fetch a remote config, and the
+// error if the fetch failed.
+type SourceTiming struct {
+	Source   string
+	Duration time.Duration
+	Err      error
 }
 
+// DefaultOverridesDir is the reserved directory used by WithFinalOverrides
+// when no directory is given.
+const DefaultOverridesDir = "/oem/99_overrides.d"
+
 type Option func(o *Options) error
 
 var NoLogs Option = func(o *Options) error {
@@ -41,6 +122,27 @@ func (o *Options) Apply(opts ...Option) error {
 	return nil
 }
 
+// TrackProvenance records which source sets each key of the merged config,
+// so it can be queried with Config.Explain.
+var TrackProvenance Option = func(o *Options) error {
+	o.TrackProvenance = true
+	return nil
+}
+
+// MergeDirectives makes the keys ending with ReplaceSuffix or DeleteSuffix
+// replace or delete the value of the configs merged before, instead of being
+// merged with it.
+var MergeDirectives Option = func(o *Options) error {
+	o.MergeDirectives = true
+	return nil
+}
+
+// SniffContent enables content sniffing for files without a YAML extension.
+var SniffContent Option = func(o *Options) error {
+	o.SniffContent = true
+	return nil
+}
+
 var MergeBootLine = func(o *Options) error {
 	o.MergeBootCMDLine = true
 	return nil
@@ -80,3 +182,223 @@ func Overwrites(m string) Option {
 		return nil
 	}
 }
+
+// WithFinalOverrides enables the final overrides layer using the given
+// directories, or DefaultOverridesDir if none is passed. Files in these
+// directories are not merged as part of the regular ScanDir, their values
+// replace the merged ones instead.
+func WithFinalOverrides(d ...string) Option {
+	return func(o *Options) error {
+		o.FinalOverrides = true
+		o.OverridesDirs = d
+		if len(d) == 0 {
+			o.OverridesDirs = []string{DefaultOverridesDir}
+		}
+		return nil
+	}
+}
+
+// WithTimeout sets a deadline for the whole scan.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		o.Timeout = d
+		return nil
+	}
+}
+
+// MaxConcurrentFetches sets how many config_url chains are fetched at the
+// same time. Configs are still merged in the same order.
+func MaxConcurrentFetches(n int) Option {
+	return func(o *Options) error {
+		if n < 1 {
+			return fmt.Errorf("invalid number of concurrent fetches: %d", n)
+		}
+		o.MaxConcurrentFetches = n
+		return nil
+	}
+}
+
+// WithSourceTimings sets a function called with the time it took to fetch
+// each remote config.
+func WithSourceTimings(f func(SourceTiming)) Option {
+	return func(o *Options) error {
+		o.OnSourceTiming = f
+		return nil
+	}
+}
+
+// ExpandEnv enables the expansion of the given environment variables in the
+// string values of the merged config, e.g. "${HOSTNAME_PREFIX}-node".
+// References to other or unset variables are kept as they are.
+func ExpandEnv(vars ...string) Option {
+	return func(o *Options) error {
+		if len(vars) == 0 {
+			return fmt.Errorf("no environment variables to expand, use ExpandAllEnv to expand all of them")
+		}
+		o.ExpandEnv = true
+		o.ExpandEnvAllowlist = vars
+		return nil
+	}
+}
+
+// ExpandAllEnv enables the expansion of every environment variable in the
+// string values of the merged config. Use with care: shell commands in stages
+// can also contain ${VAR} references, meant to be expanded when they run.
+var ExpandAllEnv Option = func(o *Options) error {
+	o.ExpandEnv = true
+	o.ExpandEnvAllowlist = nil
+	return nil
+}
+
+// WithSchemaDefaults fills the merged config with the defaults declared in
+// the given schema type, usually schema.RootSchema{}. Values defined by any
+// source are kept. Defaults of nested blocks are only applied when the block
+// is present, so e.g. the p2p defaults don't enable p2p.
+func WithSchemaDefaults(schemaType interface{}) Option {
+	return func(o *Options) error {
+		defaults, err := schema.Defaults(schemaType)
+		if err != nil {
+			return fmt.Errorf("reading schema defaults: %w", err)
+		}
+		o.Defaults = defaults
+		return nil
+	}
+}
+
+// WithSchemaValidation validates the merged config against the given schema
+// type, usually schema.RootSchema{}. The scan fails with a *SchemaError that
+// lists the invalid values and the sources setting them, so it also tracks
+// the provenance like TrackProvenance.
+func WithSchemaValidation(schemaType interface{}) Option {
+	return func(o *Options) error {
+		o.SchemaType = schemaType
+		o.TrackProvenance = true
+		return nil
+	}
+}
+
+// WithDecrypters merges the encrypted config files, ending in .yaml.enc,
+// decrypting them with the first of the given decrypters that knows their
+// format.
+func WithDecrypters(d ...Decrypter) Option {
+	return func(o *Options) error {
+		o.Decrypters = append(o.Decrypters, d...)
+		return nil
+	}
+}
+
+// WithAgeIdentity decrypts the age and SOPS encrypted config files with the
+// given age identity file.
+func WithAgeIdentity(path string) Option {
+	return WithDecrypters(&AgeDecrypter{IdentityFile: path}, &SOPSDecrypter{AgeKeyFile: path})
+}
+
+// WithSeedPartitions reads the user-data and meta-data of the NoCloud or
+// OpenStack config drive partitions with the given filesystem labels, or
+// DefaultSeedLabels if none is given. The partitions are read without
+// mounting them. Only the hostname is taken from the meta-data.
+func WithSeedPartitions(labels ...string) Option {
+	return func(o *Options) error {
+		if len(labels) == 0 {
+			labels = DefaultSeedLabels
+		}
+		o.SeedLabels = labels
+		return nil
+	}
+}
+
+// WithSeedDevices reads the given devices or disk images as seed data, like
+// WithSeedPartitions does with the partitions it finds.
+func WithSeedDevices(devices ...string) Option {
+	return func(o *Options) error {
+		o.SeedDevices = append(o.SeedDevices, devices...)
+		return nil
+	}
+}
+
+// WithCredentials reads the given systemd credentials as configs, or
+// DefaultCredentialName if none is given. They are looked up in
+// $CREDENTIALS_DIRECTORY and the system credentials directories, unless
+// CredentialDirs is set.
+func WithCredentials(names ...string) Option {
+	return func(o *Options) error {
+		if len(names) == 0 {
+			names = []string{DefaultCredentialName}
+		}
+		o.CredentialNames = names
+		if len(o.CredentialDirs) == 0 {
+			o.CredentialDirs = defaultCredentialDirs()
+		}
+		return nil
+	}
+}
+
+// WithOEMStrings reads configs from the SMBIOS OEM strings (type 11) that
+// start with the given prefix, or DefaultOEMStringPrefix if it's empty. The
+// rest of the string must be the base64 encoded config.
+func WithOEMStrings(prefix string) Option {
+	return func(o *Options) error {
+		if prefix == "" {
+			prefix = DefaultOEMStringPrefix
+		}
+		o.OEMStringPrefix = prefix
+		if o.DMIEntriesDir == "" {
+			o.DMIEntriesDir = DefaultDMIEntriesDir
+		}
+		return nil
+	}
+}
+
+// WithDatasources reads the configs in the user data of the given
+// datasources, e.g. DefaultDatasources(). Their config_url is fetched like
+// the one of config files.
+func WithDatasources(ds ...Datasource) Option {
+	return func(o *Options) error {
+		o.Datasources = append(o.Datasources, ds...)
+		return nil
+	}
+}
+
+// WithDatasourceTimeout sets how long each datasource is given to answer,
+// instead of DefaultDatasourceTimeout.
+func WithDatasourceTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		o.DatasourceTimeout = d
+		return nil
+	}
+}
+
+// WithBaseline enforces the immutable sections of the baseline in the given
+// file, or DefaultBaselineFile if it's empty. Nothing is enforced until the
+// baseline is written with Config.WriteBaseline, usually on first boot.
+func WithBaseline(path string) Option {
+	return func(o *Options) error {
+		if path == "" {
+			path = DefaultBaselineFile
+		}
+		o.BaselineFile = path
+		return nil
+	}
+}
+
+// StrictImmutable makes the scan fail when a source changes an immutable
+// section of the baseline.
+var StrictImmutable Option = func(o *Options) error {
+	o.StrictImmutable = true
+	return nil
+}
+
+// isOverrideFile returns true if the given file is inside one of the
+// OverridesDirs and the final overrides layer is enabled.
+func (o *Options) isOverrideFile(f string) bool {
+	if !o.FinalOverrides {
+		return false
+	}
+	for _, d := range o.OverridesDirs {
+		rel, err := filepath.Rel(filepath.Clean(d), filepath.Clean(f))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProvenanceEntry is a value set by a source for a key of the config. Keys
+// are the dotted paths of the values, e.g. "install.device". Lists are not
+// walked: the whole list is the value.
+type ProvenanceEntry struct {
+	Key    string
+	Value  interface{}
+	Source string
+}
+
+// Explanation tells where the value of a key of a merged config came from.
+type Explanation struct {
+	Key string
+	// Value is the final value of the key
+	Value interface{}
+	// Chain are the values set for the key, for the keys under it or for the
+	// ones above it as a whole, in the order they were merged
+	Chain []ProvenanceEntry
+	// Source is the source of the last value set, the one that won
+	Source string
+}
+
+// RecordProvenance starts tracking which source sets each key of the config,
+// so it can be queried with Explain. The current values are recorded as set
+// by the config Sources. The values of the configs merged afterwards with
+// MergeConfig are recorded too.
+func (c *Config) RecordProvenance() {
+	if c.provenance != nil {
+		return
+	}
+	c.provenance = c.provenanceEntries()
+}
+
+// provenanceEntries returns the recorded provenance, or the values of the
+// config as set by its Sources if it's not tracked.
+func (c *Config) provenanceEntries() []ProvenanceEntry {
+	return c.provenanceEntriesWith(c.directives)
+}
+
+// provenanceEntriesWith is like provenanceEntries, reporting the keys without
+// their merge directive if directives is true.
+func (c *Config) provenanceEntriesWith(directives bool) []ProvenanceEntry {
+	if c.provenance != nil {
+		return c.provenance
+	}
+
+	return leafEntries(map[string]interface{}(c.Values), "", strings.Join(c.Sources, ", "), directives)
+}
+
+// recordDefaults records the defaults that were applied: the ones no source
+// set but present in the values.
+func (c *Config) recordDefaults(defaults map[string]interface{}) {
+	set := map[string]bool{}
+	for _, p := range c.provenance {
+		set[p.Key] = true
+	}
+	for _, d := range leafEntries(defaults, "", "defaults", false) {
+		if _, found := lookupKey(c.Values, d.Key); found && !set[d.Key] {
+			c.provenance = append(c.provenance, d)
+		}
+	}
+}
+
+// Explain returns the values set for the given key, e.g. "install.device",
+// and the source that won. The provenance must have been recorded, e.g. with
+// the TrackProvenance option when scanning.
+func (c *Config) Explain(key string) (Explanation, error) {
+	if c.provenance == nil {
+		return Explanation{}, errors.New("the provenance of the config is not tracked")
+	}
+
+	e := Explanation{Key: key}
+	for _, p := range c.provenance {
+		if p.Key == key || strings.HasPrefix(p.Key, key+".") || strings.HasPrefix(key, p.Key+".") {
+			e.Chain = append(e.Chain, p)
+		}
+	}
+	if len(e.Chain) == 0 {
+		return e, fmt.Errorf("no source sets %s", key)
+	}
+	e.Source = e.Chain[len(e.Chain)-1].Source
+	e.Value, _ = lookupKey(c.Values, key)
+
+	return e, nil
+}
+
+// leafEntries returns the values that are not maps, with their dotted keys
+// sorted. If directives is true, the keys are reported without their merge
+// directive.
+func leafEntries(values map[string]interface{}, prefix string, source string, directives bool) []ProvenanceEntry {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []ProvenanceEntry{}
+	for _, k := range keys {
+		// Report the merged key, without its merge directive
+		name := k
+		if directives {
+			name, _ = parseMergeDirective(k)
+		}
+		key := prefix + name
+		if m, ok := asStringMap(values[k]); ok && len(m) > 0 {
+			result = append(result, leafEntries(m, key+".", source, directives)...)
+			continue
+		}
+		result = append(result, ProvenanceEntry{Key: key, Value: values[k], Source: source})
+	}
+
+	return result
+}
+
+// topLevelEntries returns the top level keys with their whole values, for the
+// sources that replace them instead of being merged.
+func topLevelEntries(values map[string]interface{}, source string) []ProvenanceEntry {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []ProvenanceEntry{}
+	for _, k := range keys {
+		result = append(result, ProvenanceEntry{Key: k, Value: values[k], Source: source})
+	}
+
+	return result
+}
+
+// lookupKey returns the value of a dotted key
+func lookupKey(values ConfigValues, key string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(values)
+	for _, k := range strings.Split(key, ".") {
+		m, ok := asStringMap(current)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func asStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return t, true
+	case ConfigValues:
+		return t, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			result[fmt.Sprint(k)] = val
+		}
+		return result, true
+	}
+
+	return nil, false
+}
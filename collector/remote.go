@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Defaults of the config_url fetches.
+const (
+	DefaultFetchAttempts = 3
+	DefaultFetchDelay    = time.Second
+	// DefaultMaxConfigURLDepth is the most remote configs fetched following
+	// the config_url of a single source.
+	DefaultMaxConfigURLDepth = 10
+)
+
+// ErrConfigURLCycle is returned when a config_url points back to a config
+// already fetched in the same chain.
+var ErrConfigURLCycle = errors.New("config_url cycle")
+
+// ErrConfigURLDepth is returned when a config_url chain is longer than the
+// max depth.
+var ErrConfigURLDepth = errors.New("config_url chain too deep")
+
+// RemoteOptions configures how the config_url configs are fetched. The zero
+// value fetches them like http.DefaultClient, honoring the proxy environment
+// variables, with DefaultFetchAttempts and DefaultFetchDelay.
+type RemoteOptions struct {
+	// ProxyURL is used instead of the HTTP_PROXY and HTTPS_PROXY variables
+	ProxyURL string
+	// CACerts replaces the system CAs when verifying the servers
+	CACerts            *x509.CertPool
+	InsecureSkipVerify bool
+	// Headers are sent with the requests to the host of the first config_url,
+	// e.g. Authorization. They are not sent to other hosts in the chain.
+	Headers map[string]string
+	// Attempts and Delay are the number of tries of each fetch and the time
+	// between them. A zero Delay is DefaultFetchDelay, unless set with
+	// WithFetchRetries.
+	Attempts int
+	Delay    time.Duration
+	// delaySet is true when Delay was set with WithFetchRetries, so zero
+	// retries right away
+	delaySet bool
+	// Timeout limits each try, zero means no limit besides the scan one
+	Timeout time.Duration
+	// MaxDepth is the most remote configs fetched following the config_url
+	// of a source, DefaultMaxConfigURLDepth if zero
+	MaxDepth int
+}
+
+// remoteFetcher fetches the config_url configs with the RemoteOptions.
+type remoteFetcher struct {
+	client   *http.Client
+	headers  map[string]string
+	attempts uint
+	delay    time.Duration
+	timeout  time.Duration
+	maxDepth int
+	onTiming func(SourceTiming)
+}
+
+func defaultFetcher(onTiming func(SourceTiming)) *remoteFetcher {
+	f, _ := RemoteOptions{}.fetcher(onTiming)
+	return f
+}
+
+func (r RemoteOptions) fetcher(onTiming func(SourceTiming)) (*remoteFetcher, error) {
+	f := &remoteFetcher{
+		client:   http.DefaultClient,
+		headers:  r.Headers,
+		attempts: DefaultFetchAttempts,
+		delay:    DefaultFetchDelay,
+		timeout:  r.Timeout,
+		maxDepth: DefaultMaxConfigURLDepth,
+		onTiming: onTiming,
+	}
+	if r.Attempts > 0 {
+		f.attempts = uint(r.Attempts)
+	}
+	if r.Delay > 0 || r.delaySet {
+		f.delay = r.Delay
+	}
+	if r.MaxDepth > 0 {
+		f.maxDepth = r.MaxDepth
+	}
+
+	if r.ProxyURL == "" && r.CACerts == nil && !r.InsecureSkipVerify {
+		return f, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if r.ProxyURL != "" {
+		proxy, err := url.Parse(r.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %s: %w", r.ProxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if r.CACerts != nil || r.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:            r.CACerts,
+			InsecureSkipVerify: r.InsecureSkipVerify, //nolint:gosec // explicitly requested
+		}
+	}
+	f.client = &http.Client{Transport: transport}
+
+	return f, nil
+}
+
+// setHeaders sets the headers on the request if it's for the given host, the
+// one of the first config_url in the chain.
+func (f *remoteFetcher) setHeaders(req *http.Request, host string) {
+	if req.URL.Host != host {
+		return
+	}
+	for k, v := range f.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// WithProxy fetches the remote configs through the given proxy URL, instead
+// of the one in the HTTP_PROXY and HTTPS_PROXY environment variables.
+func WithProxy(proxyURL string) Option {
+	return func(o *Options) error {
+		if _, err := url.Parse(proxyURL); err != nil {
+			return fmt.Errorf("invalid proxy URL %s: %w", proxyURL, err)
+		}
+		o.Remote.ProxyURL = proxyURL
+		return nil
+	}
+}
+
+// WithCACertFile verifies the servers of the remote configs with the CAs in
+// the given PEM bundle, instead of the system ones.
+func WithCACertFile(path string) Option {
+	return func(o *Options) error {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading CA bundle: %w", err)
+		}
+		if o.Remote.CACerts == nil {
+			o.Remote.CACerts = x509.NewCertPool()
+		}
+		if !o.Remote.CACerts.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", path)
+		}
+		return nil
+	}
+}
+
+// InsecureSkipVerify doesn't verify the certificates of the servers of the
+// remote configs. Only meant for testing environments.
+var InsecureSkipVerify Option = func(o *Options) error {
+	o.Remote.InsecureSkipVerify = true
+	return nil
+}
+
+// WithHeader sends the given header when fetching the remote configs from the
+// host of the first config_url.
+func WithHeader(name, value string) Option {
+	return func(o *Options) error {
+		if o.Remote.Headers == nil {
+			o.Remote.Headers = map[string]string{}
+		}
+		o.Remote.Headers[name] = value
+		return nil
+	}
+}
+
+// WithBearerToken authenticates the remote config fetches with the given
+// token.
+func WithBearerToken(token string) Option {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithBasicAuth authenticates the remote config fetches with the given user
+// and password.
+func WithBasicAuth(user, password string) Option {
+	return WithHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+}
+
+// WithFetchRetries sets how many times each remote config is tried and the
+// time between tries, zero to retry right away.
+func WithFetchRetries(attempts int, delay time.Duration) Option {
+	return func(o *Options) error {
+		if attempts < 1 {
+			return fmt.Errorf("invalid number of fetch attempts: %d", attempts)
+		}
+		o.Remote.Attempts = attempts
+		o.Remote.Delay = delay
+		o.Remote.delaySet = true
+		return nil
+	}
+}
+
+// WithFetchTimeout limits each try of the remote config fetches.
+func WithFetchTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		o.Remote.Timeout = d
+		return nil
+	}
+}
+
+// WithMaxConfigURLDepth sets the most remote configs fetched following the
+// config_url of a source, instead of DefaultMaxConfigURLDepth.
+func WithMaxConfigURLDepth(n int) Option {
+	return func(o *Options) error {
+		if n < 1 {
+			return fmt.Errorf("invalid config_url max depth: %d", n)
+		}
+		o.Remote.MaxDepth = n
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/kairos-io/kairos-sdk/ghw"
+	"github.com/kairos-io/kairos-sdk/types"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSeedLabels are the filesystem labels of the NoCloud (cidata) and
+// OpenStack config drive (config-2) seed partitions.
+var DefaultSeedLabels = []string{"cidata", "CIDATA", "config-2"}
+
+// seedDevices returns the SeedDevices and the partitions found with the
+// SeedLabels.
+func (o *Options) seedDevices() []string {
+	devices := append([]string{}, o.SeedDevices...)
+	if len(o.SeedLabels) == 0 {
+		return devices
+	}
+
+	logger := types.NewNullLogger()
+	paths := ghw.NewPaths("")
+	for _, label := range o.SeedLabels {
+		p, err := ghw.FindPartition(paths, ghw.Selector{Label: label}, &logger)
+		var ambiguous *ghw.AmbiguousError
+		switch {
+		case err == nil:
+			devices = append(devices, p.Path)
+		case errors.As(err, &ambiguous):
+			for _, p := range ambiguous.Partitions {
+				devices = append(devices, p.Path)
+			}
+		}
+	}
+
+	return devices
+}
+
+// parseSeed reads the seed data of a NoCloud or OpenStack config drive device
+// or image, without mounting it. The meta-data is returned first, so the
+// user-data wins over it when merged.
+func parseSeed(device string) ([]*Config, error) {
+	d, err := diskfs.Open(device, diskfs.WithOpenMode(diskfs.ReadOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	fs, err := d.GetFilesystem(0)
+	if err != nil {
+		return nil, fmt.Errorf("reading the filesystem of %s: %w", device, err)
+	}
+
+	result := []*Config{}
+	if userData, err := readSeedFile(fs, "/user-data"); err == nil {
+		// NoCloud: meta-data is YAML, e.g. "local-hostname: node1"
+		if metaData, err := readSeedFile(fs, "/meta-data"); err == nil {
+			meta := map[string]interface{}{}
+			if err := yaml.Unmarshal(metaData, &meta); err != nil {
+				return nil, fmt.Errorf("parsing the meta-data of %s: %w", device, err)
+			}
+			result = appendMetaData(result, device, meta["local-hostname"])
+		}
+		return appendUserData(result, device, userData)
+	}
+
+	if userData, err := readSeedFile(fs, "/openstack/latest/user_data"); err == nil {
+		// OpenStack: meta_data.json is JSON, e.g. {"hostname": "node1"}
+		if metaData, err := readSeedFile(fs, "/openstack/latest/meta_data.json"); err == nil {
+			meta := map[string]interface{}{}
+			if err := json.Unmarshal(metaData, &meta); err != nil {
+				return nil, fmt.Errorf("parsing the meta_data.json of %s: %w", device, err)
+			}
+			result = appendMetaData(result, device, meta["hostname"])
+		}
+		return appendUserData(result, device, userData)
+	}
+
+	return nil, fmt.Errorf("no NoCloud or OpenStack user data found in %s", device)
+}
+
+func readSeedFile(fs filesystem.FileSystem, path string) ([]byte, error) {
+	f, err := fs.OpenFile(path, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func appendMetaData(configs []*Config, device string, hostname interface{}) []*Config {
+	if h, ok := hostname.(string); ok && h != "" {
+		configs = append(configs, &Config{
+			Sources: []string{device + ":meta-data"},
+			Values:  ConfigValues{"hostname": h},
+		})
+	}
+	return configs
+}
+
+// appendUserData adds the user data if it's a config. Other user data, like
+// scripts, is not supported.
+func appendUserData(configs []*Config, device string, userData []byte) ([]*Config, error) {
+	if !HasValidHeader(string(userData)) {
+		return configs, nil
+	}
+
+	c := &Config{Sources: []string{device + ":user-data"}}
+	if err := parseYAML(userData, &c.Values); err != nil {
+		return nil, fmt.Errorf("parsing the user-data of %s: %w", device, err)
+	}
+
+	return append(configs, c), nil
+}
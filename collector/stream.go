@@ -0,0 +1,328 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScanStream returns an iterator over the configs found in the sources defined
+// in the Options, in the same order Scan merges them (files, readers, seed
+// data, systemd credentials, SMBIOS OEM strings, datasources, cmdline).
+// Files are read and parsed one at a time, only when the next config is
+// requested, so callers can process big config directories without holding
+// every parsed config in memory.
+// Files in the final overrides directories are not yielded, see ScanContext.
+// If the context is cancelled, the iterator yields the context error and stops.
+func ScanStream(ctx context.Context, o *Options, filter func(d []byte) ([]byte, error)) iter.Seq2[*Config, error] {
+	return func(yield func(*Config, error) bool) {
+		for _, f := range allFiles(o.ScanDir) {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if o.isOverrideFile(f) || o.isBaselineFile(f) {
+				continue
+			}
+			c := parseFile(f, o)
+			if c == nil {
+				continue
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+
+		for _, r := range o.Readers {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			c := parseReader(r, o.NoLogs)
+			if c == nil {
+				continue
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+
+		for _, d := range o.seedDevices() {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			configs, err := parseSeed(d)
+			o.SoftErr(fmt.Sprintf("reading seed data from %s", d), err)
+			for _, c := range configs {
+				if !yield(c, nil) {
+					return
+				}
+			}
+		}
+
+		platformConfigs := o.credentialConfigs()
+		if o.OEMStringPrefix != "" {
+			platformConfigs = append(platformConfigs, o.oemStringConfigs()...)
+		}
+		for _, c := range platformConfigs {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+
+		for _, ds := range o.Datasources {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			c := o.datasourceConfig(ctx, ds)
+			if c == nil {
+				continue
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+
+		if o.MergeBootCMDLine {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			cConfig, err := ParseCmdLine(o.BootCMDLineFile, filter)
+			o.SoftErr("parsing cmdline", err)
+			if err == nil { // best-effort
+				yield(cConfig, nil)
+			}
+		}
+	}
+}
+
+// ScanContext is like Scan but stops when the given context is cancelled or
+// the Options Timeout expires.
+// When the final overrides layer is enabled, the configs in the OverridesDirs
+// are merged at the very end.
+// Configs are merged as soon as they are parsed and their config_url fetched,
+// so only the merged result and the configs being fetched are kept in memory.
+// Up to MaxConcurrentFetches config_url chains are fetched at the same time,
+// but configs are always merged in the scan order.
+// Environment variables are expanded once merged, if enabled, so config_url
+// values are fetched as they are. The immutable sections are checked last.
+func ScanContext(ctx context.Context, o *Options, filter func(d []byte) ([]byte, error)) (*Config, error) {
+	mergedConfig := &Config{directives: o.MergeDirectives}
+	if o.TrackProvenance {
+		mergedConfig.RecordProvenance()
+	}
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	var onTiming func(SourceTiming)
+	if o.OnSourceTiming != nil {
+		var mu sync.Mutex
+		onTiming = func(t SourceTiming) {
+			mu.Lock()
+			defer mu.Unlock()
+			o.OnSourceTiming(t)
+		}
+	}
+
+	fetcher, err := o.Remote.fetcher(onTiming)
+	if err != nil {
+		return mergedConfig, err
+	}
+
+	workers := o.MaxConcurrentFetches
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+
+	type fetch struct {
+		config *Config
+		done   chan error
+	}
+	queue := []*fetch{}
+	// Make sure no fetch is left running when returning early
+	defer func() {
+		for _, f := range queue {
+			<-f.done
+		}
+	}()
+
+	// merge merges the fetched configs at the head of the queue. If wait is
+	// true, it waits for the fetches to finish.
+	merge := func(wait bool) error {
+		for len(queue) > 0 {
+			var err error
+			if wait {
+				err = <-queue[0].done
+			} else {
+				select {
+				case err = <-queue[0].done:
+				default:
+					return nil
+				}
+			}
+			c := queue[0].config
+			queue = queue[1:]
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := mergedConfig.MergeConfig(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for c, err := range ScanStream(ctx, o, filter) {
+		if err != nil {
+			return mergedConfig, err
+		}
+
+		c.directives = o.MergeDirectives
+		if o.TrackProvenance {
+			c.RecordProvenance()
+		}
+		f := &fetch{config: c, done: make(chan error, 1)}
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			f.done <- f.config.mergeConfigURL(ctx, fetcher)
+		}()
+		queue = append(queue, f)
+
+		if err := merge(false); err != nil {
+			return mergedConfig, err
+		}
+	}
+
+	if err := merge(true); err != nil {
+		return mergedConfig, err
+	}
+
+	if o.Overwrites != "" {
+		yaml.Unmarshal([]byte(o.Overwrites), &mergedConfig.Values) //nolint:errcheck
+		if o.TrackProvenance {
+			// Overwrites replace the top level keys, they are not merged
+			overwrites := map[string]interface{}{}
+			yaml.Unmarshal([]byte(o.Overwrites), &overwrites) //nolint:errcheck
+			mergedConfig.provenance = append(mergedConfig.provenance, topLevelEntries(overwrites, "overwrites")...)
+		}
+	}
+
+	if o.FinalOverrides {
+		// Overrides are applied as they are, config_url in them is not fetched
+		// otherwise the remote config could win over the local overrides.
+		for _, f := range allFiles(o.OverridesDirs) {
+			if err := ctx.Err(); err != nil {
+				return mergedConfig, err
+			}
+			c := parseFile(f, o)
+			if c == nil {
+				continue
+			}
+			if err := mergedConfig.override(c); err != nil {
+				return mergedConfig, err
+			}
+		}
+	}
+
+	if len(o.Defaults) > 0 {
+		if mergedConfig.Values == nil {
+			mergedConfig.Values = ConfigValues{}
+		}
+		applyDefaults(mergedConfig.Values, o.Defaults)
+		if o.TrackProvenance {
+			mergedConfig.recordDefaults(o.Defaults)
+		}
+	}
+
+	if o.ExpandEnv && mergedConfig.Values != nil {
+		mergedConfig.Values = o.expandEnv(mergedConfig.Values).(ConfigValues)
+	}
+
+	// The immutable sections are checked once the values are final, the
+	// baseline is written from them
+	if o.BaselineFile != "" {
+		if err := o.enforceImmutable(mergedConfig); err != nil {
+			return mergedConfig, err
+		}
+	}
+
+	if o.SchemaType != nil {
+		if err := o.validateSchema(mergedConfig); err != nil {
+			return mergedConfig, err
+		}
+	}
+
+	return mergedConfig, nil
+}
+
+// override applies the values of the given config over the ones of c: maps
+// are merged key by key, any other value replaces the existing one. Lists are
+// not merged, so an override can remove items.
+func (c *Config) override(o *Config) error {
+	if err := checkLimits(o.Values); err != nil {
+		return fmt.Errorf("merging %s: %w", strings.Join(o.Sources, ", "), err)
+	}
+	values, err := c.valuesCopy()
+	if err != nil {
+		return err
+	}
+	overrides, err := o.valuesCopy()
+	if err != nil {
+		return err
+	}
+	if values == nil {
+		values = ConfigValues{}
+	}
+	overrideValues(values, overrides)
+
+	c.Values = values
+	if c.provenance != nil {
+		c.provenance = append(c.provenance, o.provenanceEntries()...)
+	}
+	c.Sources = append(c.Sources, o.Sources...)
+
+	return nil
+}
+
+func overrideValues(values, overrides map[string]interface{}) {
+	for k, v := range overrides {
+		if om, ok := valuesMap(v); ok {
+			if m, ok := valuesMap(values[k]); ok {
+				overrideValues(m, om)
+				continue
+			}
+		}
+		values[k] = v
+	}
+}
+
+// valuesMap returns the value as a map if it's one.
+func valuesMap(v interface{}) (map[string]interface{}, bool) {
+	switch t := v.(type) {
+	case ConfigValues:
+		return t, true
+	case map[string]interface{}:
+		return t, true
+	}
+	return nil, false
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/schema"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SchemaViolation is a value of the merged config that doesn't match the
+// schema, with the source that set it.
+type SchemaViolation struct {
+	// Key is the dotted path of the value, e.g. "install.device" or
+	// "users.0.name"
+	Key     string
+	Message string
+	// Source is empty when no source sets the value, e.g. for required keys
+	Source string
+}
+
+func (v SchemaViolation) String() string {
+	key := v.Key
+	if key == "" {
+		key = "config"
+	}
+	if v.Source == "" {
+		return fmt.Sprintf("%s: %s", key, v.Message)
+	}
+	return fmt.Sprintf("%s (from %s): %s", key, v.Source, v.Message)
+}
+
+// SchemaError is returned by the scan when the merged config doesn't match
+// the schema given with WithSchemaValidation.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		lines = append(lines, v.String())
+	}
+	return fmt.Sprintf("the config doesn't match the schema:\n- %s", strings.Join(lines, "\n- "))
+}
+
+// validateSchema checks the merged config against the SchemaType. The
+// provenance of the config must be tracked to report the sources.
+func (o *Options) validateSchema(c *Config) error {
+	s, err := c.String()
+	if err != nil {
+		return err
+	}
+	kc, err := schema.NewConfigFromYAML(s, o.SchemaType)
+	if err != nil {
+		return fmt.Errorf("parsing the merged config: %w", err)
+	}
+	if kc.IsValid() {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(kc.ValidationError, &validationErr) {
+		return fmt.Errorf("validating the merged config: %w", kc.ValidationError)
+	}
+
+	result := &SchemaError{}
+	for _, leaf := range validationLeaves(validationErr) {
+		v := SchemaViolation{
+			Key:     strings.ReplaceAll(strings.TrimPrefix(leaf.InstanceLocation, "/"), "/", "."),
+			Message: leaf.Message,
+		}
+		if e, err := c.Explain(v.Key); err == nil && v.Key != "" {
+			v.Source = e.Source
+		}
+		result.Violations = append(result.Violations, v)
+	}
+
+	return result
+}
+
+// validationLeaves returns the errors without causes, the ones that point at
+// the actual values.
+func validationLeaves(e *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(e.Causes) == 0 {
+		return []*jsonschema.ValidationError{e}
+	}
+
+	result := []*jsonschema.ValidationError{}
+	for _, c := range e.Causes {
+		result = append(result, validationLeaves(c)...)
+	}
+	return result
+}
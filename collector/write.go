@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes the CanonicalString of the Config to path, so that readers
+// and concurrent writers never see a partial file:
+//   - writers of the same directory are serialized with an advisory lock
+//     (flock) on the directory, which other components can take too
+//   - the content is written to an unnamed (O_TMPFILE) or hidden temporary
+//     file in the same directory, synced, and renamed over path
+//
+// The file is created with 0600 permissions, as configs usually hold secrets.
+func (c *Config) WriteFile(path string) error {
+	s, err := c.CanonicalString()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, []byte(s))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	unlock, err := lockDir(dir)
+	if err != nil {
+		return fmt.Errorf("locking %s: %w", dir, err)
+	}
+	defer unlock()
+
+	f, commit, err := createTemp(dir)
+	if err != nil {
+		return fmt.Errorf("creating a temporary file in %s: %w", dir, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		_ = commit("")
+		return err
+	}
+	// The mode of new files is subject to the umask, and CreateTemp's ones
+	// are 0600 already, but make sure
+	if err := f.Chmod(0600); err != nil {
+		_ = commit("")
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = commit("")
+		return err
+	}
+	if err := commit(path); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return syncDir(dir)
+}
+
+// createTempFile is the portable createTemp: a hidden file in dir, renamed
+// over the target on commit. Committing to "" removes it.
+func createTempFile(dir string) (*os.File, func(target string) error, error) {
+	f, err := os.CreateTemp(dir, ".config-*.tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commit := func(target string) error {
+		if target == "" {
+			return os.Remove(f.Name())
+		}
+		if err := os.Rename(f.Name(), target); err != nil {
+			_ = os.Remove(f.Name())
+			return err
+		}
+		return nil
+	}
+
+	return f, commit, nil
+}
+
+// syncDir makes the rename durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
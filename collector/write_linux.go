@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockDir takes an exclusive flock on dir, released by the returned function.
+func lockDir(dir string) (func(), error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(d.Fd()), unix.LOCK_EX); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = unix.Flock(int(d.Fd()), unix.LOCK_UN)
+		d.Close()
+	}, nil
+}
+
+// procFDPath is the path of the open files, used to link the unnamed ones.
+var procFDPath = "/proc/self/fd/%d"
+
+// createTemp returns an unnamed file in dir, which is only linked into the
+// directory on commit, so nothing is left behind if the writer dies. It
+// falls back to createTempFile on filesystems without O_TMPFILE support, and
+// on commit when it can't be linked, e.g. without /proc.
+func createTemp(dir string) (*os.File, func(target string) error, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0600)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EISDIR) || errors.Is(err, unix.EINVAL) {
+		return createTempFile(dir)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	f := os.NewFile(uintptr(fd), dir)
+
+	commit := func(target string) error {
+		if target == "" {
+			return nil
+		}
+		// linkat can't replace the target, so link to a temporary name first
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.%d.tmp", filepath.Base(target), os.Getpid()))
+		_ = os.Remove(tmp)
+		err := unix.Linkat(unix.AT_FDCWD, fmt.Sprintf(procFDPath, f.Fd()), unix.AT_FDCWD, tmp, unix.AT_SYMLINK_FOLLOW)
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.EOPNOTSUPP) {
+			return copyToTempFile(f, dir, target)
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, target); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+
+	return f, commit, nil
+}
+
+// copyToTempFile commits the content of the unnamed file f to target through
+// a createTempFile.
+func copyToTempFile(f *os.File, dir, target string) error {
+	t, commit, err := createTempFile(dir)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = commit("")
+		return err
+	}
+	if _, err := io.Copy(t, f); err != nil {
+		_ = commit("")
+		return err
+	}
+	if err := t.Sync(); err != nil {
+		_ = commit("")
+		return err
+	}
+
+	return commit(target)
+}
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("createTemp", func() {
+	It("falls back to a named temporary file when the unnamed one can't be linked", func() {
+		realProcFDPath := procFDPath
+		procFDPath = "/nonexistent/fd/%d"
+		DeferCleanup(func() { procFDPath = realProcFDPath })
+
+		dir := GinkgoT().TempDir()
+		f := filepath.Join(dir, "90_custom.yaml")
+		Expect(os.WriteFile(f, []byte("old"), 0644)).To(Succeed())
+		conf := &Config{Values: ConfigValues{"name": "Mario"}}
+		Expect(conf.WriteFile(f)).To(Succeed())
+
+		content, err := os.ReadFile(f)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("#cloud-config\n\nname: Mario\n"))
+		info, err := os.Stat(f)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		entries, err := os.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+})
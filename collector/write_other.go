@@ -0,0 +1,14 @@
+//go:build !linux
+
+package collector
+
+import "os"
+
+// lockDir is a no-op, advisory locks are only taken on Linux.
+func lockDir(_ string) (func(), error) {
+	return func() {}, nil
+}
+
+func createTemp(dir string) (*os.File, func(target string) error, error) {
+	return createTempFile(dir)
+}
@@ -0,0 +1,51 @@
+package ghw
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// udevCache keeps the udev database entries read during a scan, as each
+// partition is looked up several times (UUID, label, type...). It's safe for
+// concurrent use.
+type udevCache struct {
+	mu      sync.Mutex
+	entries map[string]udevEntry
+}
+
+type udevEntry struct {
+	info map[string]string
+	err  error
+}
+
+// withCache returns a copy of the paths that caches the udev database reads.
+// It's meant to be used for a single scan, so changes in the devices are seen
+// by the next one.
+func (p *Paths) withCache() *Paths {
+	if p.udev != nil {
+		return p
+	}
+	c := *p
+	c.udev = &udevCache{entries: map[string]udevEntry{}}
+	return &c
+}
+
+// udevInfo returns the cached entry of the device, or reads it with read.
+func (c *udevCache) udevInfo(disk, partition string, read func() (map[string]string, error)) (map[string]string, error) {
+	if c == nil {
+		return read()
+	}
+	key := filepath.Join(disk, partition)
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return e.info, e.err
+	}
+
+	info, err := read()
+	c.mu.Lock()
+	c.entries[key] = udevEntry{info: info, err: err}
+	c.mu.Unlock()
+	return info, err
+}
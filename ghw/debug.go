@@ -0,0 +1,63 @@
+package ghw
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// SkippedDevice is a block device GetDisks ignored.
+type SkippedDevice struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// DebugReport describes a disk discovery, to compare how it behaves in
+// different environments, e.g. the initramfs and the booted system.
+type DebugReport struct {
+	Paths Paths `json:"paths"`
+	// GHWChroot is the value of GHW_CHROOT, which overrides the Paths prefix
+	GHWChroot  string          `json:"ghw_chroot,omitempty"`
+	Disks      []string        `json:"disks"`
+	Partitions int             `json:"partitions"`
+	Skipped    []SkippedDevice `json:"skipped,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// String returns the report as a single line of JSON, with the fields always
+// in the same order.
+func (r DebugReport) String() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// Debug scans the disks like GetDisks and reports the effective Paths, the
+// devices found and the ones skipped, with the reason.
+func Debug(paths *Paths, logger *types.KairosLogger) DebugReport {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+	report := DebugReport{
+		Paths:     *paths,
+		GHWChroot: os.Getenv("GHW_CHROOT"),
+		Disks:     []string{},
+	}
+
+	disks, skipped, err := scanDisks(paths, logger)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	for _, d := range disks {
+		report.Disks = append(report.Disks, d.Name)
+		report.Partitions += len(d.Partitions)
+	}
+	report.Skipped = skipped
+	logger.Logger.Debug().Str("report", report.String()).Msg("Disk discovery")
+
+	return report
+}
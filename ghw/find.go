@@ -0,0 +1,150 @@
+package ghw
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// Selector identifies a partition by any combination of its filesystem label,
+// filesystem UUID, mountpoint and name. A partition matches when all the
+// fields set match.
+type Selector struct {
+	Label string
+	// UUID is compared case-insensitively, as FAT UUIDs are shown in either
+	// case
+	UUID       string
+	MountPoint string
+	// Name is the device name (e.g. "sda1") or path (e.g. "/dev/sda1" or
+	// "/dev/mapper/luks-xxx")
+	Name string
+	// Retries is how many times to refresh udev with UdevRefresh and look
+	// again when no partition matches, for devices that were just created.
+	// FindPartition waits RetryBackoff before the first retry and twice as
+	// long before each of the next ones
+	Retries int
+}
+
+// String returns the fields set of the selector, e.g. "label=COS_STATE".
+func (s Selector) String() string {
+	fields := []string{}
+	for _, f := range []struct{ key, value string }{
+		{"label", s.Label},
+		{"uuid", s.UUID},
+		{"mountpoint", s.MountPoint},
+		{"name", s.Name},
+	} {
+		if f.value != "" {
+			fields = append(fields, fmt.Sprintf("%s=%s", f.key, f.value))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func (s Selector) empty() bool {
+	return s.Label == "" && s.UUID == "" && s.MountPoint == "" && s.Name == ""
+}
+
+func (s Selector) matches(p *types.Partition) bool {
+	if s.Label != "" && p.FilesystemLabel != s.Label {
+		return false
+	}
+	if s.UUID != "" && !strings.EqualFold(p.UUID, s.UUID) {
+		return false
+	}
+	if s.MountPoint != "" && (p.MountPoint == "" || filepath.Clean(p.MountPoint) != filepath.Clean(s.MountPoint)) {
+		return false
+	}
+	if s.Name != "" && p.Name != s.Name && p.Path != s.Name && filepath.Base(p.Path) != s.Name {
+		return false
+	}
+	return true
+}
+
+// RetryBackoff is how long FindPartition waits before refreshing udev for the
+// first retry, doubled on every retry after that.
+var RetryBackoff = 500 * time.Millisecond
+
+// NotFoundError is returned by FindPartition when no partition matches.
+type NotFoundError struct {
+	Selector Selector
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no partition found with %s", e.Selector)
+}
+
+// AmbiguousError is returned by FindPartition when several partitions match.
+type AmbiguousError struct {
+	Selector   Selector
+	Partitions types.PartitionList
+}
+
+func (e *AmbiguousError) Error() string {
+	names := make([]string, 0, len(e.Partitions))
+	for _, p := range e.Partitions {
+		names = append(names, p.Path)
+	}
+	return fmt.Sprintf("%d partitions found with %s: %s", len(e.Partitions), e.Selector, strings.Join(names, ", "))
+}
+
+// FindPartition returns the only partition matching the selector, or a
+// *NotFoundError or *AmbiguousError. Device-mapper devices are preferred over
+// the partitions backing them, so a LUKS partition and the open filesystem
+// inside sharing a label is not ambiguous.
+func FindPartition(paths *Paths, sel Selector, logger *types.KairosLogger) (*types.Partition, error) {
+	if sel.empty() {
+		return nil, fmt.Errorf("empty partition selector")
+	}
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+
+	backoff := RetryBackoff
+	for i := 0; ; i++ {
+		found := matchingPartitions(paths, sel, logger)
+		switch {
+		case len(found) == 1:
+			return found[0], nil
+		case len(found) > 1:
+			return nil, &AmbiguousError{Selector: sel, Partitions: found}
+		case i >= sel.Retries:
+			return nil, &NotFoundError{Selector: sel}
+		}
+
+		logger.Logger.Debug().Str("selector", sel.String()).Int("attempt", i+1).Dur("backoff", backoff).Msg("No partition found, refreshing udev")
+		time.Sleep(backoff)
+		backoff *= 2
+		if err := UdevRefresh(); err != nil {
+			return nil, fmt.Errorf("%w (refreshing udev failed: %s)", &NotFoundError{Selector: sel}, err)
+		}
+	}
+}
+
+func matchingPartitions(paths *Paths, sel Selector, logger *types.KairosLogger) types.PartitionList {
+	found := types.PartitionList{}
+	mapped := map[string]bool{}
+	for _, p := range MapperPartitions(paths, logger) {
+		if sel.matches(p) {
+			found = append(found, p)
+			mapped[p.Path] = true
+		}
+	}
+
+	for _, d := range GetDisks(paths, logger) {
+		if strings.HasPrefix(d.Name, "dm-") || d.VolumeGroup {
+			continue
+		}
+		for _, p := range d.Partitions {
+			if sel.matches(p) && (p.MappedBy == "" || !mapped[p.MappedBy]) {
+				found = append(found, p)
+			}
+		}
+	}
+
+	return found
+}
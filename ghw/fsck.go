@@ -0,0 +1,229 @@
+package ghw
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// ErrFsckUnsupported is returned by NeedsFsck for filesystems whose state
+// can't be probed.
+var ErrFsckUnsupported = errors.New("filesystem state probe not supported")
+
+// ext2/3/4 superblock, little endian, 1024 bytes into the device
+const (
+	extSuperblockOffset = 1024
+	extMagic            = 0xEF53
+	// s_state bits
+	extValidFS = 0x1
+	extErrorFS = 0x2
+	// s_feature_incompat bit set while the journal has to be replayed
+	extIncompatRecover = 0x4
+)
+
+// xfs superblock and log, big endian. The log is made of 512-byte basic
+// blocks whose first word is the log cycle they were written in, except for
+// the record headers, which start with a magic number.
+const (
+	xfsMagic           = 0x58465342 // XFSB
+	xfsBasicBlock      = 512
+	xfsLogHeaderMagic  = 0xFEEDBABE
+	xfsLogCycleSize    = 32 * 1024
+	xfsLogUnmountTrans = 0x20
+	// xfsMaxRecordBlocks is how far back from the log head a record header is
+	// looked for: the biggest log buffer is 256KiB
+	xfsMaxRecordBlocks = 256 * 1024 / xfsBasicBlock
+)
+
+// AddFilesystemState fills the NeedsFsck of the partitions that are not
+// mounted. Mounted filesystems are always dirty, so they are skipped, as well
+// as the ones whose state can't be read.
+func AddFilesystemState(partitions types.PartitionList, logger *types.KairosLogger) {
+	for _, p := range partitions {
+		if p.MountPoint != "" || p.Path == "" {
+			continue
+		}
+		dirty, err := NeedsFsck(p.Path, p.FS)
+		if errors.Is(err, ErrFsckUnsupported) {
+			continue
+		}
+		if err != nil {
+			logger.Logger.Warn().Str("partition", p.Name).Str("fs", p.FS).Err(err).Msg("failed to read filesystem state")
+			continue
+		}
+		logger.Logger.Trace().Str("partition", p.Name).Bool("needsFsck", dirty).Msg("Got filesystem state")
+		p.NeedsFsck = dirty
+	}
+}
+
+// NeedsFsck reads the superblock of the unmounted filesystem in device and
+// returns whether it's dirty: an ext filesystem with errors, not cleanly
+// unmounted or with a journal to recover, or an xfs filesystem whose log
+// doesn't end with an unmount record. Only ext2/3/4 and xfs are supported.
+func NeedsFsck(device string, fs string) (bool, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(fs) {
+	case "ext2", "ext3", "ext4":
+		return extNeedsFsck(f)
+	case "xfs":
+		return xfsNeedsFsck(f)
+	}
+
+	return false, fmt.Errorf("%w: %s", ErrFsckUnsupported, fs)
+}
+
+func extNeedsFsck(r io.ReaderAt) (bool, error) {
+	sb := make([]byte, 0x64)
+	if _, err := r.ReadAt(sb, extSuperblockOffset); err != nil {
+		return false, fmt.Errorf("reading the ext superblock: %w", err)
+	}
+	if binary.LittleEndian.Uint16(sb[0x38:]) != extMagic {
+		return false, errors.New("no ext superblock found")
+	}
+
+	state := binary.LittleEndian.Uint16(sb[0x3A:])
+	incompat := binary.LittleEndian.Uint32(sb[0x60:])
+
+	return state&extValidFS == 0 || state&extErrorFS != 0 || incompat&extIncompatRecover != 0, nil
+}
+
+func xfsNeedsFsck(r io.ReaderAt) (bool, error) {
+	sb := make([]byte, 128)
+	if _, err := r.ReadAt(sb, 0); err != nil {
+		return false, fmt.Errorf("reading the xfs superblock: %w", err)
+	}
+	if binary.BigEndian.Uint32(sb) != xfsMagic {
+		return false, errors.New("no xfs superblock found")
+	}
+
+	blockSize := uint64(binary.BigEndian.Uint32(sb[4:]))
+	logStart := binary.BigEndian.Uint64(sb[48:])
+	agBlocks := uint64(binary.BigEndian.Uint32(sb[84:]))
+	logBlocks := uint64(binary.BigEndian.Uint32(sb[96:]))
+	agBlockLog := sb[124]
+	if logStart == 0 {
+		return false, fmt.Errorf("%w: xfs with an external log", ErrFsckUnsupported)
+	}
+
+	// logStart is an allocation group number and a block within it
+	ag, agBlock := logStart>>agBlockLog, logStart&(1<<agBlockLog-1)
+	log := xfsLog{
+		r:      r,
+		offset: int64((ag*agBlocks + agBlock) * blockSize),
+		blocks: logBlocks * blockSize / xfsBasicBlock,
+	}
+
+	head, err := log.head()
+	if err != nil {
+		return false, err
+	}
+	clean, err := log.unmounted(head)
+	if err != nil {
+		return false, err
+	}
+
+	return !clean, nil
+}
+
+// xfsLog reads the internal log of an xfs filesystem, in basic blocks.
+type xfsLog struct {
+	r      io.ReaderAt
+	offset int64
+	blocks uint64
+}
+
+func (l xfsLog) read(block uint64, b []byte) error {
+	_, err := l.r.ReadAt(b, l.offset+int64(block*xfsBasicBlock))
+	if err != nil {
+		return fmt.Errorf("reading the xfs log: %w", err)
+	}
+	return nil
+}
+
+func (l xfsLog) cycle(block uint64) (uint32, error) {
+	b := make([]byte, 8)
+	if err := l.read(block, b); err != nil {
+		return 0, err
+	}
+	// Record headers have the cycle in their second word
+	if binary.BigEndian.Uint32(b) == xfsLogHeaderMagic {
+		return binary.BigEndian.Uint32(b[4:]), nil
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// head returns the first block after the last record written. The log is
+// written in a circle, so the blocks before the head have the current cycle
+// and the ones after it the previous one.
+func (l xfsLog) head() (uint64, error) {
+	if l.blocks == 0 {
+		return 0, errors.New("empty xfs log")
+	}
+	first, err := l.cycle(0)
+	if err != nil {
+		return 0, err
+	}
+	last, err := l.cycle(l.blocks - 1)
+	if err != nil {
+		return 0, err
+	}
+	if first == last {
+		return l.blocks, nil
+	}
+
+	lo, hi := uint64(0), l.blocks-1
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		c, err := l.cycle(mid)
+		if err != nil {
+			return 0, err
+		}
+		if c == first {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return hi, nil
+}
+
+// unmounted returns whether the last record before head is an unmount
+// record: a single operation with the unmount flag.
+func (l xfsLog) unmounted(head uint64) (bool, error) {
+	header := make([]byte, 324)
+	for i := uint64(1); i <= xfsMaxRecordBlocks && i <= head; i++ {
+		block := head - i
+		if err := l.read(block, header); err != nil {
+			return false, err
+		}
+		if binary.BigEndian.Uint32(header) != xfsLogHeaderMagic {
+			continue
+		}
+
+		if binary.BigEndian.Uint32(header[40:]) != 1 {
+			return false, nil
+		}
+		headerBlocks := uint64(1)
+		if version, size := binary.BigEndian.Uint32(header[8:]), binary.BigEndian.Uint32(header[320:]); version == 2 && size > xfsLogCycleSize {
+			headerBlocks = (uint64(size) + xfsLogCycleSize - 1) / xfsLogCycleSize
+		}
+		op := make([]byte, 12)
+		if err := l.read(block+headerBlocks, op); err != nil {
+			return false, err
+		}
+		return op[9]&xfsLogUnmountTrans != 0, nil
+	}
+
+	return false, errors.New("no xfs log record found")
+}
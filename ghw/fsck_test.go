@@ -0,0 +1,105 @@
+package ghw_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/ghw"
+	"github.com/kairos-io/kairos-sdk/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// extImage writes the fields of an ext4 superblock NeedsFsck reads
+func extImage(path string, state uint16, incompat uint32) {
+	b := make([]byte, 4096)
+	sb := b[1024:]
+	binary.LittleEndian.PutUint16(sb[0x38:], 0xEF53)
+	binary.LittleEndian.PutUint16(sb[0x3A:], state)
+	binary.LittleEndian.PutUint32(sb[0x60:], incompat)
+	Expect(os.WriteFile(path, b, 0644)).To(Succeed())
+}
+
+// xfsImage writes an xfs superblock with a 128 basic blocks internal log at
+// 2MiB, holding a single record of the given operations written in cycle 1
+func xfsImage(path string, ops uint32, opFlags byte) {
+	const logOffset = 2 * 1024 * 1024
+	b := make([]byte, logOffset+16*4096)
+	binary.BigEndian.PutUint32(b[0:], 0x58465342)
+	binary.BigEndian.PutUint32(b[4:], 4096)
+	binary.BigEndian.PutUint64(b[48:], 512)
+	binary.BigEndian.PutUint32(b[84:], 1024)
+	binary.BigEndian.PutUint32(b[96:], 16)
+	b[124] = 10
+
+	log := b[logOffset:]
+	binary.BigEndian.PutUint32(log[0:], 0xFEEDBABE)
+	binary.BigEndian.PutUint32(log[4:], 1)
+	binary.BigEndian.PutUint32(log[8:], 2)
+	binary.BigEndian.PutUint32(log[40:], ops)
+	binary.BigEndian.PutUint32(log[320:], 32*1024)
+	for block := 1; block <= int(ops); block++ {
+		binary.BigEndian.PutUint32(log[block*512:], 1)
+	}
+	log[512+9] = opFlags
+	Expect(os.WriteFile(path, b, 0644)).To(Succeed())
+}
+
+var _ = Describe("NeedsFsck", func() {
+	var image string
+
+	BeforeEach(func() {
+		image = filepath.Join(GinkgoT().TempDir(), "fs.img")
+	})
+
+	DescribeTable("ext filesystems",
+		func(state uint16, incompat uint32, dirty bool) {
+			extImage(image, state, incompat)
+			needsFsck, err := ghw.NeedsFsck(image, "ext4")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(needsFsck).To(Equal(dirty))
+		},
+		Entry("clean", uint16(0x1), uint32(0x240), false),
+		Entry("not cleanly unmounted", uint16(0x0), uint32(0x240), true),
+		Entry("with errors", uint16(0x3), uint32(0x240), true),
+		Entry("with a journal to recover", uint16(0x1), uint32(0x244), true),
+	)
+
+	It("reports a clean xfs log", func() {
+		xfsImage(image, 1, 0x20)
+		needsFsck, err := ghw.NeedsFsck(image, "xfs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(needsFsck).To(BeFalse())
+	})
+
+	It("reports a dirty xfs log", func() {
+		xfsImage(image, 3, 0)
+		needsFsck, err := ghw.NeedsFsck(image, "xfs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(needsFsck).To(BeTrue())
+	})
+
+	It("fails on other filesystems", func() {
+		extImage(image, 0, 0)
+		_, err := ghw.NeedsFsck(image, "vfat")
+		Expect(err).To(MatchError(ghw.ErrFsckUnsupported))
+		_, err = ghw.NeedsFsck(image, "xfs")
+		Expect(err).To(MatchError("no xfs superblock found"))
+	})
+
+	It("fills the state of the unmounted partitions", func() {
+		logger := types.NewNullLogger()
+		extImage(image, 0, 0)
+		partitions := types.PartitionList{
+			{Name: "disk1", FS: "ext4", Path: image},
+			{Name: "disk2", FS: "ext4", Path: image, MountPoint: "/oem"},
+			{Name: "disk3", FS: "vfat", Path: image},
+		}
+		ghw.AddFilesystemState(partitions, &logger)
+		Expect(partitions[0].NeedsFsck).To(BeTrue())
+		Expect(partitions[1].NeedsFsck).To(BeFalse())
+		Expect(partitions[2].NeedsFsck).To(BeFalse())
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/kairos-io/kairos-sdk/types"
 )
@@ -15,12 +16,55 @@ import (
 const (
 	sectorSize = 512
 	UNKNOWN    = "unknown"
+	// PartitionAlignment is the boundary partitions are expected to start at
+	PartitionAlignment = 1024 * 1024
 )
 
 type Paths struct {
-	SysBlock    string
-	RunUdevData string
-	ProcMounts  string
+	SysBlock    string `json:"sys_block"`
+	RunUdevData string `json:"run_udev_data"`
+	ProcMounts  string `json:"proc_mounts"`
+	// ReadError is an optional hook called with the path of every file or
+	// directory before reading it. If it returns an error, the read fails with
+	// that error instead. Used in tests to exercise the error handling paths.
+	ReadError func(path string) error `json:"-"`
+
+	udev *udevCache
+}
+
+func (p *Paths) readFile(path string) ([]byte, error) {
+	if err := p.injectedError(path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (p *Paths) readDir(path string) ([]os.DirEntry, error) {
+	if err := p.injectedError(path); err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+func (p *Paths) open(path string) (*os.File, error) {
+	if err := p.injectedError(path); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (p *Paths) readLink(path string) (string, error) {
+	if err := p.injectedError(path); err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+func (p *Paths) injectedError(path string) error {
+	if p.ReadError == nil {
+		return nil
+	}
+	return p.ReadError(path)
 }
 
 func NewPaths(withOptionalPrefix string) *Paths {
@@ -54,12 +98,35 @@ func GetDisks(paths *Paths, logger *types.KairosLogger) []*types.Disk {
 		newLogger := types.NewKairosLogger("ghw", "info", false)
 		logger = &newLogger
 	}
-	disks := make([]*types.Disk, 0)
-	logger.Logger.Debug().Str("path", paths.SysBlock).Msg("Scanning for disks")
-	files, err := os.ReadDir(paths.SysBlock)
+	disks, _, err := scanDisks(paths, logger)
 	if err != nil {
 		return nil
 	}
+
+	return disks
+}
+
+// scanWorkers is the number of disks read at the same time by scanDisks
+const scanWorkers = 8
+
+// scanDisks returns the disks found and the block devices skipped. The disks
+// are read concurrently, but returned in the order of the block devices.
+func scanDisks(paths *Paths, logger *types.KairosLogger) ([]*types.Disk, []SkippedDevice, error) {
+	paths = paths.withCache()
+	skipped := []SkippedDevice{}
+	logger.Logger.Debug().Str("path", paths.SysBlock).Msg("Scanning for disks")
+	files, err := paths.readDir(paths.SysBlock)
+	if err != nil {
+		logger.Logger.Error().Str("path", paths.SysBlock).Err(err).Msg("failed to read block devices")
+		return nil, nil, err
+	}
+
+	type pending struct {
+		name string
+		size uint64
+	}
+	toRead := []pending{}
+	vgs := volumeGroups{}
 	for _, file := range files {
 		logger.Logger.Debug().Str("file", file.Name()).Msg("Reading file")
 		dname := file.Name()
@@ -67,21 +134,90 @@ func GetDisks(paths *Paths, logger *types.KairosLogger) []*types.Disk {
 
 		if strings.HasPrefix(dname, "loop") && size == 0 {
 			// We don't care about unused loop devices...
+			skipped = append(skipped, SkippedDevice{Name: dname, Reason: "unused loop device"})
 			continue
 		}
-		d := &types.Disk{
-			Name:      dname,
-			SizeBytes: size,
-			UUID:      diskUUID(paths, dname, "", logger),
+		if strings.HasPrefix(dname, "dm-") {
+			// LVM logical volumes are reported as partitions of their volume group
+			if vg, ok := vgs.add(paths, dname, logger); ok {
+				skipped = append(skipped, SkippedDevice{Name: dname, Reason: "logical volume of " + vg})
+				continue
+			}
 		}
+		toRead = append(toRead, pending{name: dname, size: size})
+	}
 
-		parts := diskPartitions(paths, dname, logger)
-		d.Partitions = parts
+	disks := make([]*types.Disk, len(toRead))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(scanWorkers, len(toRead)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				disks[i] = newDisk(paths, toRead[i].name, toRead[i].size, logger)
+			}
+		}()
+	}
+	for i := range toRead {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		disks = append(disks, d)
+	return append(disks, vgs.list()...), skipped, nil
+}
+
+// GetDisk returns the given disk with its partitions, reading only the data
+// of that device instead of scanning all of them. The name can be either the
+// device name (e.g. "sda") or its path (e.g. "/dev/sda").
+func GetDisk(paths *Paths, name string, logger *types.KairosLogger) (*types.Disk, error) {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+	dname := strings.TrimPrefix(name, "/dev/")
+	if dname == "" || strings.Contains(dname, "/") {
+		return nil, fmt.Errorf("invalid disk name %q", name)
 	}
 
-	return disks
+	path := filepath.Join(paths.SysBlock, dname)
+	logger.Logger.Debug().Str("path", path).Msg("Reading disk")
+	if _, err := paths.readDir(path); err != nil {
+		return nil, fmt.Errorf("disk %s not found: %w", name, err)
+	}
+
+	paths = paths.withCache()
+	return newDisk(paths, dname, diskSizeBytes(paths, dname, logger), logger), nil
+}
+
+func newDisk(paths *Paths, dname string, size uint64, logger *types.KairosLogger) *types.Disk {
+	disk := &types.Disk{
+		Name:       dname,
+		SizeBytes:  size,
+		UUID:       diskUUID(paths, dname, "", logger),
+		Partitions: diskPartitions(paths, dname, logger),
+	}
+	setTopology(paths, disk, logger)
+	disk.Raid = raidInfo(paths, dname, logger)
+	disk.RaidMember = raidMember(paths, dname, disk.Partitions)
+	disk.Removable = diskFlag(paths, dname, "removable", logger)
+	disk.Rotational = diskFlag(paths, dname, filepath.Join("queue", "rotational"), logger)
+	disk.ReadOnly = diskFlag(paths, dname, "ro", logger)
+
+	return disk
+}
+
+// diskFlag reads a boolean sysfs attribute of the disk, e.g. removable. It's
+// false if it can't be read.
+func diskFlag(paths *Paths, disk string, attribute string, logger *types.KairosLogger) bool {
+	path := filepath.Join(paths.SysBlock, disk, attribute)
+	contents, err := paths.readFile(path)
+	if err != nil {
+		logger.Logger.Debug().Str("file", path).Err(err).Msg("failed to read disk attribute")
+		return false
+	}
+	return strings.TrimSpace(string(contents)) == "1"
 }
 
 func diskSizeBytes(paths *Paths, disk string, logger *types.KairosLogger) uint64 {
@@ -89,7 +225,7 @@ func diskSizeBytes(paths *Paths, disk string, logger *types.KairosLogger) uint64
 	// /sys/block/$DEVICE/size and calculate the physical bytes accordingly.
 	path := filepath.Join(paths.SysBlock, disk, "size")
 	logger.Logger.Debug().Str("path", path).Msg("Reading disk size")
-	contents, err := os.ReadFile(path)
+	contents, err := paths.readFile(path)
 	if err != nil {
 		logger.Logger.Error().Str("path", path).Err(err).Msg("Failed to read file")
 		return 0
@@ -111,14 +247,14 @@ func diskPartitions(paths *Paths, disk string, logger *types.KairosLogger) types
 	out := make(types.PartitionList, 0)
 	path := filepath.Join(paths.SysBlock, disk)
 	logger.Logger.Debug().Str("file", path).Msg("Reading disk file")
-	files, err := os.ReadDir(path)
+	files, err := paths.readDir(path)
 	if err != nil {
 		logger.Logger.Error().Err(err).Msg("failed to read disk partitions")
 		return out
 	}
 	for _, file := range files {
 		fname := file.Name()
-		if !strings.HasPrefix(fname, disk) {
+		if !strings.HasPrefix(fname, disk) || isHardwarePartitionOf(disk, fname) {
 			continue
 		}
 		logger.Logger.Debug().Str("file", fname).Msg("Reading partition file")
@@ -129,15 +265,23 @@ func diskPartitions(paths *Paths, disk string, logger *types.KairosLogger) types
 			pt = diskPartTypeUdev(paths, disk, fname, logger)
 		}
 		fsLabel := diskFSLabel(paths, disk, fname, logger)
+		partLabel := diskPartLabel(paths, disk, fname, logger)
+		start, startErr := partitionStartSector(paths, disk, fname, logger)
 		p := &types.Partition{
 			Name:            fname,
-			Size:            uint(size / (1024 * 1024)),
+			Size:            uint(types.ByteSize(size).MiB()),
+			SizeBytes:       size,
 			MountPoint:      mp,
 			UUID:            du,
 			FilesystemLabel: fsLabel,
+			PartitionLabel:  partLabel,
 			FS:              pt,
 			Path:            filepath.Join("/dev", fname),
 			Disk:            filepath.Join("/dev", disk),
+			StartSector:     start,
+			StartBytes:      start * sectorSize,
+			AlignmentOK:     startErr == nil && (start*sectorSize)%PartitionAlignment == 0,
+			MappedBy:        partitionHolder(paths, disk, fname, logger),
 		}
 		out = append(out, p)
 	}
@@ -147,7 +291,7 @@ func diskPartitions(paths *Paths, disk string, logger *types.KairosLogger) types
 func partitionSizeBytes(paths *Paths, disk string, part string, logger *types.KairosLogger) uint64 {
 	path := filepath.Join(paths.SysBlock, disk, part, "size")
 	logger.Logger.Debug().Str("file", path).Msg("Reading size file")
-	contents, err := os.ReadFile(path)
+	contents, err := paths.readFile(path)
 	if err != nil {
 		logger.Logger.Error().Str("file", path).Err(err).Msg("failed to read disk partition size")
 		return 0
@@ -161,6 +305,26 @@ func partitionSizeBytes(paths *Paths, disk string, part string, logger *types.Ka
 	return size * sectorSize
 }
 
+// partitionStartSector returns the first sector of the partition. The start
+// file in sysfs is always expressed in 512-byte sectors, regardless of the
+// logical block size of the disk.
+func partitionStartSector(paths *Paths, disk string, part string, logger *types.KairosLogger) (uint64, error) {
+	path := filepath.Join(paths.SysBlock, disk, part, "start")
+	logger.Logger.Debug().Str("file", path).Msg("Reading start file")
+	contents, err := paths.readFile(path)
+	if err != nil {
+		logger.Logger.Error().Str("file", path).Err(err).Msg("failed to read disk partition start")
+		return 0, err
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 64)
+	if err != nil {
+		logger.Logger.Error().Str("contents", string(contents)).Err(err).Msg("failed to parse disk partition start")
+		return 0, err
+	}
+	logger.Logger.Trace().Str("disk", disk).Str("partition", part).Uint64("start", start).Msg("Got partition start")
+	return start, nil
+}
+
 func partitionInfo(paths *Paths, part string, logger *types.KairosLogger) (string, string) {
 	// Allow calling PartitionInfo with either the full partition name
 	// "/dev/sda1" or just "sda1"
@@ -172,7 +336,7 @@ func partitionInfo(paths *Paths, part string, logger *types.KairosLogger) (strin
 	// /dev/sda6 / ext4 rw,relatime,errors=remount-ro,data=ordered 0 0
 	var r io.ReadCloser
 	logger.Logger.Debug().Str("file", paths.ProcMounts).Msg("Reading mounts file")
-	r, err := os.Open(paths.ProcMounts)
+	r, err := paths.open(paths.ProcMounts)
 	if err != nil {
 		logger.Logger.Error().Str("file", paths.ProcMounts).Err(err).Msg("failed to open mounts")
 		return "", ""
@@ -202,10 +366,14 @@ type mountEntry struct {
 func parseMountEntry(line string, logger *types.KairosLogger) *mountEntry {
 	// mount entries for mounted partitions look like this:
 	// /dev/sda6 / ext4 rw,relatime,errors=remount-ro,data=ordered 0 0
-	if line[0] != '/' {
+	// but there are also entries with sources not backed by a device, e.g.:
+	// overlay / overlay rw,lowerdir=/run/rootfsbase,upperdir=/run/overlay/upper 0 0
+	// tmpfs /run tmpfs rw,nosuid,nodev,size=1599616k,mode=755 0 0
+	// Those are parsed as well, callers match on the Partition field.
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
 		return nil
 	}
-	fields := strings.Fields(line)
 
 	if len(fields) < 4 {
 		logger.Logger.Debug().Interface("fields", fields).Msg("Mount line has less than 4 fields")
@@ -298,9 +466,31 @@ func diskFSLabel(paths *Paths, disk string, partition string, logger *types.Kair
 	return UNKNOWN
 }
 
+// diskPartLabel gets the GPT partition name from the udev database
+func diskPartLabel(paths *Paths, disk string, partition string, logger *types.KairosLogger) string {
+	info, err := udevInfoPartition(paths, disk, partition, logger)
+	logger.Logger.Trace().Interface("info", info).Msg("Disk Part label")
+	if err != nil {
+		logger.Logger.Error().Str("disk", disk).Str("partition", partition).Interface("info", info).Err(err).Msg("Disk Part label")
+		return UNKNOWN
+	}
+
+	if label, ok := info["ID_PART_ENTRY_NAME"]; ok {
+		logger.Logger.Trace().Str("disk", disk).Str("partition", partition).Str("label", label).Msg("Got partition name")
+		return label
+	}
+	return UNKNOWN
+}
+
 func udevInfoPartition(paths *Paths, disk string, partition string, logger *types.KairosLogger) (map[string]string, error) {
+	return paths.udev.udevInfo(disk, partition, func() (map[string]string, error) {
+		return readUdevInfoPartition(paths, disk, partition, logger)
+	})
+}
+
+func readUdevInfoPartition(paths *Paths, disk string, partition string, logger *types.KairosLogger) (map[string]string, error) {
 	// Get device major:minor numbers
-	devNo, err := os.ReadFile(filepath.Join(paths.SysBlock, disk, partition, "dev"))
+	devNo, err := paths.readFile(filepath.Join(paths.SysBlock, disk, partition, "dev"))
 	if err != nil {
 		logger.Logger.Error().Err(err).Str("path", filepath.Join(paths.SysBlock, disk, partition, "dev")).Msg("failed to read udev info")
 		return nil, err
@@ -312,7 +502,7 @@ func udevInfoPartition(paths *Paths, disk string, partition string, logger *type
 func UdevInfo(paths *Paths, devNo string, logger *types.KairosLogger) (map[string]string, error) {
 	// Look up block device in udev runtime database
 	udevID := "b" + strings.TrimSpace(devNo)
-	udevBytes, err := os.ReadFile(filepath.Join(paths.RunUdevData, udevID))
+	udevBytes, err := paths.readFile(filepath.Join(paths.RunUdevData, udevID))
 	if err != nil {
 		logger.Logger.Error().Err(err).Str("path", filepath.Join(paths.RunUdevData, udevID)).Msg("failed to read udev info for device")
 		return nil, err
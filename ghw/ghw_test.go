@@ -1,7 +1,17 @@
 package ghw_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kairos-io/kairos-sdk/ghw"
 	"github.com/kairos-io/kairos-sdk/ghw/mocks"
@@ -60,6 +70,306 @@ var _ = Describe("GHW functions tests", func() {
 			Expect(disks[0].Partitions[0].MountPoint).To(Equal("/efi"), disks)
 			Expect(disks[0].Partitions[0].UUID).To(Equal("666"), disks)
 		})
+
+		It("Finds a single disk by name or path", func() {
+			for _, name := range []string{"disk", "/dev/disk"} {
+				disk, err := ghw.GetDisk(ghw.NewPaths(ghwMock.Chroot), name, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(disk.Name).To(Equal("disk"))
+				Expect(disk.UUID).To(Equal("555"))
+				Expect(disk.SizeBytes).To(Equal(uint64(1 * 1024 * 512)))
+				Expect(disk.Partitions).To(HaveLen(1))
+				Expect(disk.Partitions[0].FilesystemLabel).To(Equal("COS_GRUB"))
+			}
+		})
+
+		It("Fails to find a missing disk", func() {
+			_, err := ghw.GetDisk(ghw.NewPaths(ghwMock.Chroot), "sdz", nil)
+			Expect(err).To(HaveOccurred())
+			_, err = ghw.GetDisk(ghw.NewPaths(ghwMock.Chroot), "../disk", nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Reports the partition start and alignment", func() {
+			ghwMock.AddPartitionToDisk("disk", &types.Partition{Name: "disk2", StartSector: 4096})
+			ghwMock.AddPartitionToDisk("disk", &types.Partition{Name: "disk3", StartSector: 4097})
+			disks := ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil)
+			Expect(len(disks)).To(Equal(1), disks)
+			Expect(disks[0].Partitions).To(HaveLen(3), disks)
+
+			byName := map[string]*types.Partition{}
+			for _, p := range disks[0].Partitions {
+				byName[p.Name] = p
+			}
+			Expect(byName["disk1"].StartSector).To(Equal(uint64(0)))
+			Expect(byName["disk2"].StartSector).To(Equal(uint64(4096)))
+			Expect(byName["disk2"].StartBytes).To(Equal(uint64(4096 * 512)))
+			Expect(byName["disk2"].AlignmentOK).To(BeTrue())
+			Expect(byName["disk3"].AlignmentOK).To(BeFalse())
+		})
+
+		It("Finds the partition next to overlay, tmpfs and squashfs mounts", func() {
+			ghwMock.AddOverlayMount("/", []string{"/run/rootfsbase"}, "/run/overlay/upper", "/run/overlay/work")
+			ghwMock.AddTmpfsMount("/run/overlay", "25%")
+			ghwMock.AddSquashfsMount("/dev/loop0", "/run/rootfs base")
+			disks := ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil)
+			Expect(len(disks)).To(Equal(1), disks)
+			Expect(disks[0].Partitions[0].MountPoint).To(Equal("/efi"), disks)
+			Expect(disks[0].Partitions[0].FS).To(Equal("ext4"), disks)
+		})
+
+		Describe("with read errors", func() {
+			var paths *ghw.Paths
+			var buf *bytes.Buffer
+			var logger types.KairosLogger
+
+			BeforeEach(func() {
+				paths = ghw.NewPaths(ghwMock.Chroot)
+				buf = &bytes.Buffer{}
+				logger = types.NewBufferLogger(buf)
+			})
+
+			It("reports zero size when the size file can't be read", func() {
+				paths.ReadError = mocks.ReadErrorOn(errors.New("injected"), "disk/size", "disk1/size")
+				disks := ghw.GetDisks(paths, &logger)
+				Expect(disks).To(HaveLen(1))
+				Expect(disks[0].SizeBytes).To(Equal(uint64(0)))
+				Expect(disks[0].Partitions[0].Size).To(Equal(uint(0)))
+				Expect(buf.String()).To(ContainSubstring("injected"))
+			})
+
+			It("reports unknown values when the udev data can't be read", func() {
+				paths.ReadError = mocks.ReadErrorOn(errors.New("injected"), "b0:0", "b0:60")
+				disks := ghw.GetDisks(paths, &logger)
+				Expect(disks).To(HaveLen(1))
+				Expect(disks[0].UUID).To(Equal(ghw.UNKNOWN))
+				Expect(disks[0].Partitions[0].UUID).To(Equal(ghw.UNKNOWN))
+				Expect(disks[0].Partitions[0].FilesystemLabel).To(Equal(ghw.UNKNOWN))
+				// The fs type is still read from the mounts file
+				Expect(disks[0].Partitions[0].FS).To(Equal("ext4"))
+			})
+
+			It("returns no disks when the block devices can't be listed", func() {
+				paths.ReadError = mocks.ReadErrorOn(errors.New("injected"), "/sys/block/")
+				Expect(ghw.GetDisks(paths, &logger)).To(BeNil())
+				Expect(buf.String()).To(ContainSubstring("failed to read block devices"))
+			})
+		})
+	})
+	Describe("With filesystem usage", func() {
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{
+				Name: "disk",
+				Partitions: []*types.Partition{
+					{Name: "disk1", FS: "ext4", MountPoint: GinkgoT().TempDir()},
+					{Name: "disk2", FS: "ext4"},
+				},
+			})
+			ghwMock.CreateDevices()
+		})
+
+		It("reports the usage of mounted partitions when enabled", func() {
+			disks := ghw.GetDisksWithOptions(ghw.NewPaths(ghwMock.Chroot), ghw.Options{FilesystemUsage: true}, nil)
+			Expect(disks).To(HaveLen(1))
+			Expect(disks[0].Partitions).To(HaveLen(2))
+			for _, p := range disks[0].Partitions {
+				if p.Name == "disk1" {
+					Expect(p.AvailableBytes).ToNot(BeZero())
+				} else {
+					Expect(p.UsedBytes).To(BeZero())
+					Expect(p.AvailableBytes).To(BeZero())
+				}
+			}
+		})
+
+		It("doesn't read the usage by default", func() {
+			disks := ghw.GetDisksWithOptions(ghw.NewPaths(ghwMock.Chroot), ghw.Options{}, nil)
+			Expect(disks).To(HaveLen(1))
+			for _, p := range disks[0].Partitions {
+				Expect(p.AvailableBytes).To(BeZero())
+			}
+		})
+	})
+
+	Describe("With partition sizes", func() {
+		It("reports the exact size in bytes along the MiB one", func() {
+			// The mock writes the size in 512-byte sectors
+			ghwMock.AddDisk(types.Disk{
+				Name: "disk",
+				Partitions: []*types.Partition{
+					{Name: "disk1", FS: "ext4", Size: 3 * 1024},
+					{Name: "disk2", FS: "crypto_LUKS", Size: 4096},
+				},
+			})
+			ghwMock.CreateDevices()
+			ghwMock.AddMapper("disk2", types.Partition{Name: "luks-1", FS: "ext4", Size: 4095})
+
+			paths := ghw.NewPaths(ghwMock.Chroot)
+			p, err := ghw.FindPartition(paths, ghw.Selector{Name: "disk1"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.SizeBytes).To(Equal(uint64(3 * 1024 * 512)))
+			Expect(p.Size).To(Equal(uint(1)))
+			Expect(types.ByteSize(p.SizeBytes).HumanReadable()).To(Equal("1.5MiB"))
+
+			p, err = ghw.FindPartition(paths, ghw.Selector{Name: "luks-1"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.SizeBytes).To(Equal(uint64(4095 * 512)))
+			Expect(p.Size).To(Equal(uint(1)))
+		})
+	})
+	Describe("With NVMe and eMMC disks", func() {
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{
+				Name:       "nvme0n1",
+				SizeBytes:  1024,
+				Partitions: []*types.Partition{{Name: "nvme0n1p1", FS: "ext4"}},
+			})
+			ghwMock.AddDisk(types.Disk{
+				Name:      "mmcblk0",
+				SizeBytes: 1024,
+				// sysfs lists the hardware partitions under the device
+				Partitions: []*types.Partition{{Name: "mmcblk0p1", FS: "vfat"}, {Name: "mmcblk0boot0"}},
+			})
+			ghwMock.AddDisk(types.Disk{Name: "mmcblk0boot0", SizeBytes: 1024})
+			ghwMock.AddDisk(types.Disk{Name: "sda", SizeBytes: 1024, Transport: types.TransportUSB})
+			ghwMock.AddDisk(types.Disk{Name: "vda", SizeBytes: 1024})
+			ghwMock.CreateDevices()
+		})
+
+		It("reports the topology and transport of each disk", func() {
+			disks := map[string]*types.Disk{}
+			for _, d := range ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil) {
+				disks[d.Name] = d
+			}
+			Expect(disks).To(HaveLen(5))
+
+			Expect(disks["nvme0n1"].Transport).To(Equal(types.TransportNVMe))
+			Expect(disks["nvme0n1"].Parent).To(Equal("nvme0"))
+			Expect(disks["nvme0n1"].Namespace).To(Equal(1))
+			Expect(disks["nvme0n1"].Partitions).To(HaveLen(1))
+
+			Expect(disks["mmcblk0"].Transport).To(Equal(types.TransportMMC))
+			Expect(disks["mmcblk0"].HardwarePartition).To(BeFalse())
+			Expect(disks["mmcblk0"].Partitions).To(HaveLen(1))
+			Expect(disks["mmcblk0"].Partitions[0].Name).To(Equal("mmcblk0p1"))
+
+			Expect(disks["mmcblk0boot0"].Transport).To(Equal(types.TransportMMC))
+			Expect(disks["mmcblk0boot0"].HardwarePartition).To(BeTrue())
+			Expect(disks["mmcblk0boot0"].Parent).To(Equal("mmcblk0"))
+
+			Expect(disks["sda"].Transport).To(Equal(types.TransportUSB))
+			Expect(disks["vda"].Transport).To(Equal(types.TransportVirtio))
+		})
+
+		It("reports the removable, rotational and read-only flags", func() {
+			ghwMock.AddDisk(types.Disk{Name: "sdb", SizeBytes: 1024, Removable: true, ReadOnly: true})
+			ghwMock.AddDisk(types.Disk{Name: "sdc", SizeBytes: 1024, Rotational: true})
+			ghwMock.Clean()
+			ghwMock.CreateDevices()
+
+			disks := map[string]*types.Disk{}
+			for _, d := range ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil) {
+				disks[d.Name] = d
+			}
+			Expect(disks["sdb"].Removable).To(BeTrue())
+			Expect(disks["sdb"].ReadOnly).To(BeTrue())
+			Expect(disks["sdb"].Rotational).To(BeFalse())
+			Expect(disks["sdc"].Rotational).To(BeTrue())
+			Expect(disks["sdc"].Removable).To(BeFalse())
+			Expect(disks["nvme0n1"].Removable).To(BeFalse())
+		})
+	})
+	Describe("With many disks", func() {
+		BeforeEach(func() {
+			for i := 0; i < 20; i++ {
+				ghwMock.AddDisk(types.Disk{
+					Name:       fmt.Sprintf("disk%02d", i),
+					SizeBytes:  1024,
+					Partitions: []*types.Partition{{Name: fmt.Sprintf("disk%02dp1", i), FilesystemLabel: fmt.Sprintf("LABEL%02d", i), FS: "ext4"}},
+				})
+			}
+			ghwMock.CreateDevices()
+		})
+
+		It("returns the disks in order and reads each udev entry once", func() {
+			var mu sync.Mutex
+			reads := map[string]int{}
+			paths := ghw.NewPaths(ghwMock.Chroot)
+			paths.ReadError = func(path string) error {
+				if strings.Contains(path, "/run/udev/data/") {
+					mu.Lock()
+					reads[path]++
+					mu.Unlock()
+				}
+				return nil
+			}
+
+			disks := ghw.GetDisks(paths, nil)
+			Expect(disks).To(HaveLen(20))
+			for i, d := range disks {
+				Expect(d.Name).To(Equal(fmt.Sprintf("disk%02d", i)))
+				Expect(d.Partitions).To(HaveLen(1))
+				Expect(d.Partitions[0].FilesystemLabel).To(Equal(fmt.Sprintf("LABEL%02d", i)))
+			}
+			Expect(reads).To(HaveLen(40))
+			for path, n := range reads {
+				Expect(n).To(Equal(1), path)
+			}
+		})
+	})
+	Describe("Watch", func() {
+		var paths *ghw.Paths
+
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{
+				Name:       "disk",
+				Partitions: []*types.Partition{{Name: "disk1", FilesystemLabel: "COS_OEM", FS: "ext4"}},
+			})
+			ghwMock.CreateDevices()
+			paths = ghw.NewPaths(ghwMock.Chroot)
+		})
+
+		It("reports the disks added, removed and changed", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := ghw.Watch(ctx, paths, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Plug a new disk
+			Expect(os.MkdirAll(filepath.Join(paths.SysBlock, "usb"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(paths.SysBlock, "usb", "dev"), []byte("8:0\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(paths.SysBlock, "usb", "size"), []byte("1024\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(paths.RunUdevData, "b8:0"), []byte("E:ID_BUS=usb\n"), 0644)).To(Succeed())
+
+			var ev ghw.DeviceEvent
+			Eventually(events, "5s").Should(Receive(&ev))
+			Expect(ev.Type).To(Equal(ghw.DiskAdded))
+			Expect(ev.Disk.Name).To(Equal("usb"))
+			Expect(ev.Disk.Transport).To(Equal(types.TransportUSB))
+
+			// Relabel a partition
+			Expect(os.WriteFile(filepath.Join(paths.RunUdevData, "b0:60"), []byte("E:ID_FS_LABEL=COS_PERSISTENT\nE:ID_FS_TYPE=ext4\n"), 0644)).To(Succeed())
+			Eventually(events, "5s").Should(Receive(&ev))
+			Expect(ev.Type).To(Equal(ghw.PartitionChanged))
+			Expect(ev.Disk.Name).To(Equal("disk"))
+			Expect(ev.Disk.Partitions[0].FilesystemLabel).To(Equal("COS_PERSISTENT"))
+
+			// Unplug it
+			Expect(os.RemoveAll(filepath.Join(paths.SysBlock, "usb"))).To(Succeed())
+			Expect(os.Remove(filepath.Join(paths.RunUdevData, "b8:0"))).To(Succeed())
+			Eventually(events, "5s").Should(Receive(&ev))
+			Expect(ev.Type).To(Equal(ghw.DiskRemoved))
+			Expect(ev.Disk.Name).To(Equal("usb"))
+
+			cancel()
+			Eventually(events).Should(BeClosed())
+		})
+
+		It("fails without a udev database", func() {
+			paths.RunUdevData = filepath.Join(ghwMock.Chroot, "missing")
+			_, err := ghw.Watch(context.Background(), paths, nil)
+			Expect(err).To(HaveOccurred())
+		})
 	})
 	Describe("With no disks", func() {
 		It("Finds nothing", func() {
@@ -68,5 +378,482 @@ var _ = Describe("GHW functions tests", func() {
 			Expect(len(disks)).To(Equal(0), disks)
 		})
 	})
+	Describe("With an open LUKS partition", func() {
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{
+				Name: "disk",
+				Partitions: []*types.Partition{
+					{Name: "disk1", FilesystemLabel: "COS_OEM", FS: "ext4"},
+					{Name: "disk2", FilesystemLabel: "COS_PERSISTENT", FS: "crypto_LUKS"},
+				},
+			})
+			ghwMock.CreateDevices()
+			ghwMock.AddMapper("disk2", types.Partition{
+				Name:            "luks-1234",
+				FilesystemLabel: "COS_PERSISTENT",
+				FS:              "ext4",
+				MountPoint:      "/usr/local",
+			})
+		})
+
+		It("links the backing partition and the mapper", func() {
+			paths := ghw.NewPaths(ghwMock.Chroot)
+			mappers := ghw.MapperPartitions(paths, nil)
+			Expect(mappers).To(HaveLen(1))
+			Expect(mappers[0].Path).To(Equal("/dev/mapper/luks-1234"))
+			Expect(mappers[0].BackingDevice).To(Equal("/dev/disk2"))
+			Expect(mappers[0].FS).To(Equal("ext4"))
+			Expect(mappers[0].MountPoint).To(Equal("/usr/local"))
+
+			for _, d := range ghw.GetDisks(paths, nil) {
+				for _, p := range d.Partitions {
+					if p.Name == "disk2" {
+						Expect(p.MappedBy).To(Equal("/dev/mapper/luks-1234"))
+					} else {
+						Expect(p.MappedBy).To(BeEmpty())
+					}
+				}
+			}
+		})
+
+		It("prefers the mapper when finding partitions by label", func() {
+			paths := ghw.NewPaths(ghwMock.Chroot)
+			p, err := ghw.FindPartitionByFilesystemLabel(paths, "COS_PERSISTENT", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/mapper/luks-1234"))
+
+			p, err = ghw.FindPartitionByFilesystemLabel(paths, "COS_OEM", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/disk1"))
+
+			_, err = ghw.FindPartitionByFilesystemLabel(paths, "COS_STATE", nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("With a software RAID", func() {
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{Name: "sda", SizeBytes: 1024, Partitions: []*types.Partition{{Name: "sda1", FS: "linux_raid_member"}}})
+			ghwMock.AddDisk(types.Disk{Name: "sdb", SizeBytes: 1024})
+			ghwMock.AddDisk(types.Disk{Name: "sdc", SizeBytes: 1024})
+			ghwMock.AddDisk(types.Disk{
+				Name:       "md0",
+				SizeBytes:  1024,
+				Partitions: []*types.Partition{{Name: "md0p1", FilesystemLabel: "COS_STATE", FS: "ext4"}},
+				Raid:       &types.RaidInfo{Level: "raid1", Members: []string{"/dev/sda1", "/dev/sdb"}, Degraded: true},
+			})
+			ghwMock.CreateDevices()
+		})
+
+		It("reports the RAID device and its members", func() {
+			disks := map[string]*types.Disk{}
+			for _, d := range ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil) {
+				disks[d.Name] = d
+			}
+			Expect(disks).To(HaveLen(4))
+
+			md := disks["md0"]
+			Expect(md.Raid).ToNot(BeNil())
+			Expect(md.Raid.Level).To(Equal("raid1"))
+			Expect(md.Raid.Members).To(ConsistOf("/dev/sda1", "/dev/sdb"))
+			Expect(md.Raid.Degraded).To(BeTrue())
+			Expect(md.RaidMember).To(BeEmpty())
+			Expect(md.Partitions).To(HaveLen(1))
+			Expect(md.Partitions[0].FilesystemLabel).To(Equal("COS_STATE"))
+
+			Expect(disks["sda"].RaidMember).To(Equal("/dev/md0"))
+			Expect(disks["sdb"].RaidMember).To(Equal("/dev/md0"))
+			Expect(disks["sdc"].RaidMember).To(BeEmpty())
+			Expect(disks["sdc"].Raid).To(BeNil())
+		})
+	})
+	Describe("With LVM logical volumes", func() {
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{
+				Name: "disk",
+				Partitions: []*types.Partition{
+					{Name: "disk1", FilesystemLabel: "COS_GRUB", FS: "vfat"},
+					{Name: "disk2", FS: "LVM2_member"},
+				},
+			})
+			ghwMock.CreateDevices()
+			ghwMock.AddLVM("kairos-vg", "disk2",
+				types.Partition{Name: "state", FilesystemLabel: "COS_STATE", FS: "ext4", Size: 2048, MountPoint: "/run/initramfs/cos-state"},
+				types.Partition{Name: "persistent", FilesystemLabel: "COS_PERSISTENT", FS: "ext4", Size: 4096},
+			)
+		})
+
+		It("reports the logical volumes under their volume group", func() {
+			disks := ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil)
+			Expect(disks).To(HaveLen(2))
+			Expect(disks[0].Name).To(Equal("disk"))
+			Expect(disks[0].VolumeGroup).To(BeFalse())
+
+			vg := disks[1]
+			Expect(vg.Name).To(Equal("kairos-vg"))
+			Expect(vg.VolumeGroup).To(BeTrue())
+			Expect(vg.SizeBytes).To(Equal(uint64(6144 * 512)))
+			Expect(vg.Partitions).To(HaveLen(2))
+			Expect(vg.Partitions[0].Path).To(Equal("/dev/mapper/kairos--vg-state"))
+			Expect(vg.Partitions[0].Disk).To(Equal("/dev/kairos-vg"))
+			Expect(vg.Partitions[0].FilesystemLabel).To(Equal("COS_STATE"))
+			Expect(vg.Partitions[0].MountPoint).To(Equal("/run/initramfs/cos-state"))
+			Expect(vg.Partitions[0].BackingDevice).To(Equal("/dev/disk2"))
+			Expect(vg.Partitions[1].FilesystemLabel).To(Equal("COS_PERSISTENT"))
+		})
+
+		It("reports the logical volumes as skipped devices", func() {
+			report := ghw.Debug(ghw.NewPaths(ghwMock.Chroot), nil)
+			Expect(report.Disks).To(Equal([]string{"disk", "kairos-vg"}))
+			Expect(report.Skipped).To(ConsistOf(
+				ghw.SkippedDevice{Name: "dm-0", Reason: "logical volume of kairos-vg"},
+				ghw.SkippedDevice{Name: "dm-1", Reason: "logical volume of kairos-vg"},
+			))
+		})
+
+		It("finds the logical volumes once", func() {
+			p, err := ghw.FindPartition(ghw.NewPaths(ghwMock.Chroot), ghw.Selector{Label: "COS_PERSISTENT"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/mapper/kairos--vg-persistent"))
+		})
+	})
+	Describe("FindPartition", func() {
+		var paths *ghw.Paths
+
+		BeforeEach(func() {
+			ghwMock.AddDisk(types.Disk{
+				Name: "disk",
+				Partitions: []*types.Partition{
+					{Name: "disk1", FilesystemLabel: "COS_GRUB", FS: "vfat", UUID: "ABCD-1234", MountPoint: "/efi"},
+					{Name: "disk2", FilesystemLabel: "COS_PERSISTENT", FS: "crypto_LUKS"},
+					{Name: "disk3", FilesystemLabel: "COS_STATE", FS: "ext4", UUID: "state-1"},
+					{Name: "disk4", FilesystemLabel: "COS_STATE", FS: "ext4", UUID: "state-2"},
+				},
+			})
+			ghwMock.CreateDevices()
+			ghwMock.AddMapper("disk2", types.Partition{
+				Name:            "luks-1234",
+				FilesystemLabel: "COS_PERSISTENT",
+				FS:              "ext4",
+				MountPoint:      "/usr/local",
+			})
+			paths = ghw.NewPaths(ghwMock.Chroot)
+		})
+
+		It("finds a partition by label, UUID, mountpoint or name", func() {
+			for _, sel := range []ghw.Selector{
+				{Label: "COS_GRUB"},
+				{UUID: "abcd-1234"},
+				{MountPoint: "/efi/"},
+				{Name: "disk1"},
+				{Name: "/dev/disk1"},
+				{Label: "COS_GRUB", MountPoint: "/efi"},
+			} {
+				p, err := ghw.FindPartition(paths, sel, nil)
+				Expect(err).ToNot(HaveOccurred(), sel.String())
+				Expect(p.Path).To(Equal("/dev/disk1"), sel.String())
+			}
+		})
+
+		It("prefers the mapper over the partition backing it", func() {
+			p, err := ghw.FindPartition(paths, ghw.Selector{Label: "COS_PERSISTENT"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/mapper/luks-1234"))
+
+			p, err = ghw.FindPartition(paths, ghw.Selector{Name: "luks-1234"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.MountPoint).To(Equal("/usr/local"))
+		})
+
+		It("reports ambiguous selectors", func() {
+			_, err := ghw.FindPartition(paths, ghw.Selector{Label: "COS_STATE"}, nil)
+			var ambiguous *ghw.AmbiguousError
+			Expect(errors.As(err, &ambiguous)).To(BeTrue(), err)
+			Expect(ambiguous.Partitions).To(HaveLen(2))
+
+			p, err := ghw.FindPartition(paths, ghw.Selector{Label: "COS_STATE", UUID: "state-2"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/disk4"))
+		})
+
+		It("backs the deprecated label lookups", func() {
+			p, err := ghw.FindPartitionByFilesystemLabel(paths, "COS_PERSISTENT", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/mapper/luks-1234"))
+
+			// Duplicated labels aren't an error for them, they return the first one
+			p, err = ghw.FindPartitionByFilesystemLabel(paths, "COS_STATE", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/disk3"))
+
+			_, err = ghw.LookupFilesystemLabel(paths, "COS_RECOVERY", false, nil)
+			var notFound *ghw.NotFoundError
+			Expect(errors.As(err, &notFound)).To(BeTrue(), err)
+		})
+
+		It("refreshes udev up to the retries when nothing is found, backing off between them", func() {
+			refreshes := []time.Time{}
+			original, originalBackoff := ghw.UdevRefresh, ghw.RetryBackoff
+			ghw.UdevRefresh = func() error {
+				refreshes = append(refreshes, time.Now())
+				return nil
+			}
+			ghw.RetryBackoff = 20 * time.Millisecond
+			DeferCleanup(func() { ghw.UdevRefresh, ghw.RetryBackoff = original, originalBackoff })
+
+			start := time.Now()
+			_, err := ghw.FindPartition(paths, ghw.Selector{Label: "COS_RECOVERY", Retries: 2}, nil)
+			var notFound *ghw.NotFoundError
+			Expect(errors.As(err, &notFound)).To(BeTrue(), err)
+			Expect(notFound.Selector.Label).To(Equal("COS_RECOVERY"))
+			Expect(refreshes).To(HaveLen(2))
+			Expect(refreshes[0].Sub(start)).To(BeNumerically(">=", 20*time.Millisecond))
+			Expect(refreshes[1].Sub(refreshes[0])).To(BeNumerically(">=", 40*time.Millisecond))
+		})
+
+		It("fails with an empty selector", func() {
+			_, err := ghw.FindPartition(paths, ghw.Selector{}, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("LookupFilesystemLabel", func() {
+		var refreshes int
+		var paths *ghw.Paths
+
+		BeforeEach(func() {
+			refreshes = 0
+			ghwMock.AddDisk(types.Disk{
+				Name:       "disk",
+				Partitions: []*types.Partition{{Name: "disk1", FilesystemLabel: "COS_OEM", FS: "ext4"}},
+			})
+			ghwMock.CreateDevices()
+			paths = ghw.NewPaths(ghwMock.Chroot)
+			original := ghw.UdevRefresh
+			ghw.UdevRefresh = func() error {
+				refreshes++
+				// The mock is recreated in a new chroot
+				ghwMock.AddPartitionToDisk("disk", &types.Partition{Name: "disk2", FilesystemLabel: "COS_PERSISTENT", FS: "ext4"})
+				*paths = *ghw.NewPaths(ghwMock.Chroot)
+				return nil
+			}
+			originalBackoff := ghw.RetryBackoff
+			ghw.RetryBackoff = 0
+			DeferCleanup(func() { ghw.UdevRefresh, ghw.RetryBackoff = original, originalBackoff })
+		})
+
+		It("doesn't refresh udev when the label is found", func() {
+			p, err := ghw.LookupFilesystemLabel(paths, "COS_OEM", true, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/disk1"))
+			Expect(refreshes).To(BeZero())
+		})
+
+		It("doesn't refresh udev when refresh is disabled", func() {
+			_, err := ghw.LookupFilesystemLabel(paths, "COS_PERSISTENT", false, nil)
+			var notFound *ghw.NotFoundError
+			Expect(errors.As(err, &notFound)).To(BeTrue(), err)
+			Expect(refreshes).To(BeZero())
+		})
+
+		It("refreshes udev and retries when the label is missing", func() {
+			p, err := ghw.LookupFilesystemLabel(paths, "COS_PERSISTENT", true, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/disk2"))
+			Expect(refreshes).To(Equal(1))
+		})
+	})
+	Describe("Debug", func() {
+		It("reports the disks found and skipped", func() {
+			ghwMock.AddDisk(types.Disk{
+				Name:      "disk",
+				SizeBytes: 1024,
+				Partitions: []*types.Partition{
+					{Name: "disk1", FilesystemLabel: "COS_GRUB", FS: "vfat"},
+					{Name: "disk2", FilesystemLabel: "COS_STATE", FS: "ext4"},
+				},
+			})
+			ghwMock.AddDisk(types.Disk{Name: "loop0"})
+			ghwMock.CreateDevices()
+			paths := ghw.NewPaths(ghwMock.Chroot)
+
+			report := ghw.Debug(paths, nil)
+			Expect(report.Paths.SysBlock).To(Equal(paths.SysBlock))
+			Expect(report.GHWChroot).To(Equal(ghwMock.Chroot))
+			Expect(report.Disks).To(Equal([]string{"disk"}))
+			Expect(report.Partitions).To(Equal(2))
+			Expect(report.Skipped).To(Equal([]ghw.SkippedDevice{{Name: "loop0", Reason: "unused loop device"}}))
+			Expect(report.String()).To(HavePrefix(`{"paths":{"sys_block":`))
+		})
+	})
+	Describe("KairosInstallPresence", func() {
+		It("finds the Kairos partitions, including encrypted ones", func() {
+			ghwMock.AddDisk(types.Disk{
+				Name: "disk",
+				Partitions: []*types.Partition{
+					{Name: "disk1", FilesystemLabel: "COS_GRUB", FS: "vfat", PartitionLabel: "efi"},
+					{Name: "disk2", FilesystemLabel: "COS_STATE", FS: "ext4", PartitionLabel: "state"},
+					{Name: "disk3", FS: "crypto_LUKS", PartitionLabel: "persistent"},
+					{Name: "disk4", FilesystemLabel: "DATA", FS: "ext4", PartitionLabel: "data"},
+				},
+			})
+			ghwMock.CreateDevices()
+			disks := ghw.GetDisks(ghw.NewPaths(ghwMock.Chroot), nil)
+			Expect(disks).To(HaveLen(1))
+
+			presence := ghw.KairosInstallPresence(disks[0])
+			Expect(presence.Disk).To(Equal("disk"))
+			Expect(presence.Installed()).To(BeTrue())
+			Expect(presence.Encrypted()).To(BeTrue())
+			Expect(presence.Labels()).To(ConsistOf("COS_GRUB", "COS_STATE", "COS_PERSISTENT"))
+		})
+
+		It("does not report an install for a disk with only a persistent partition", func() {
+			presence := ghw.KairosInstallPresence(&types.Disk{
+				Name: "disk",
+				Partitions: types.PartitionList{
+					{Name: "disk1", FilesystemLabel: "COS_PERSISTENT", FS: "ext4"},
+				},
+			})
+			Expect(presence.Installed()).To(BeFalse())
+			Expect(presence.Encrypted()).To(BeFalse())
+			Expect(presence.Labels()).To(Equal([]string{"COS_PERSISTENT"}))
+		})
+
+		It("ignores GPT names of unencrypted partitions", func() {
+			presence := ghw.KairosInstallPresence(&types.Disk{
+				Name: "disk",
+				Partitions: types.PartitionList{
+					{Name: "disk1", FilesystemLabel: "OTHER", FS: "ext4", PartitionLabel: "state"},
+				},
+			})
+			Expect(presence.Installed()).To(BeFalse())
+			Expect(presence.Labels()).To(BeEmpty())
+		})
+	})
 
+	Describe("GhwMock builder", func() {
+		It("creates the devices once", func() {
+			mock, err := mocks.NewGhwMock().
+				WithDisk(types.Disk{Name: "sda", Partitions: types.PartitionList{{Name: "sda1", FilesystemLabel: "COS_OEM"}}}).
+				WithMapper("sda1", types.Partition{Name: "luks-1", FilesystemLabel: "COS_PERSISTENT"}).
+				WithTmpfsMount("/run/overlay", "").
+				WithCleanup(GinkgoT()).
+				Build()
+			Expect(err).ToNot(HaveOccurred())
+
+			paths := ghw.NewPaths(mock.Chroot)
+			// The mapper is listed as a disk too, like in /sys/block
+			Expect(ghw.GetDisks(paths, nil)).To(HaveLen(2))
+			Expect(ghw.MapperPartitions(paths, nil)).To(HaveLen(1))
+			mounts, err := os.ReadFile(paths.ProcMounts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(mounts)).To(ContainSubstring("tmpfs /run/overlay tmpfs"))
+		})
+
+		It("loads a fixture file", func() {
+			mock, err := mocks.LoadFixture(filepath.Join("testdata", "luks-lvm.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(mock.Clean)
+
+			paths := ghw.NewPaths(mock.Chroot)
+			disks := map[string]*types.Disk{}
+			for _, d := range ghw.GetDisks(paths, nil) {
+				disks[d.Name] = d
+			}
+			Expect(disks).To(HaveLen(4))
+			Expect(disks).To(HaveKey("dm-0"))
+			Expect(disks["sda"].Transport).To(Equal(types.TransportSATA))
+			Expect(disks["sda"].Partitions).To(HaveLen(3))
+			Expect(disks["sda"].Partitions[0].MountPoint).To(Equal("/efi"))
+			Expect(disks["sdb"].Rotational).To(BeTrue())
+			Expect(disks["data"].VolumeGroup).To(BeTrue())
+
+			p, err := ghw.FindPartition(paths, ghw.Selector{Label: "COS_PERSISTENT"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Path).To(Equal("/dev/mapper/luks-1"))
+			Expect(p.MountPoint).To(Equal("/usr/local"))
+			p, err = ghw.FindPartition(paths, ghw.Selector{Label: "DATA"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Disk).To(Equal("/dev/data"))
+		})
+
+		It("fails on unknown fixture fields", func() {
+			fixture := filepath.Join(GinkgoT().TempDir(), "fixture.yaml")
+			Expect(os.WriteFile(fixture, []byte("disks:\n  - name: sda\n    sise_bytes: 1\n"), 0644)).To(Succeed())
+			_, err := mocks.NewGhwMock().WithFixture(fixture).Build()
+			Expect(err).To(MatchError(ContainSubstring("sise_bytes")))
+		})
+	})
+	Describe("GhwMock validation", func() {
+		It("accepts consistent devices", func() {
+			mock, err := mocks.LoadFixture(filepath.Join("testdata", "luks-lvm.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			defer mock.Clean()
+			Expect(mock.Validate()).To(Succeed())
+		})
+
+		It("reports every inconsistency", func() {
+			mock := &mocks.GhwMock{}
+			mock.AddDisk(types.Disk{Name: "sda", SizeBytes: 4096, Partitions: types.PartitionList{
+				{Name: "sda1", Size: 8192, StartSector: 2048, MountPoint: "/oem"},
+			}})
+			mock.CreateDevices()
+			defer mock.Clean()
+			mock.AddMapper("sdz1", types.Partition{Name: "luks-1", MountPoint: "/usr/local"})
+			mock.AddSquashfsMount("/dev/sdq", "/run/rootfs")
+			Expect(os.WriteFile(filepath.Join(mock.Chroot, "run", "udev", "data", "b8:1"), nil, 0644)).To(Succeed())
+
+			err := mock.Validate()
+			var validationErr *mocks.ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Problems).To(ConsistOf(
+				"udev data b8:1 doesn't belong to any device",
+				"dm-0 is backed by sdz1, which doesn't exist",
+				"sda1 ends at sector 10240, past the end of sda (4096 sectors)",
+				"/dev/sdq is mounted on /run/rootfs, but there is no such device",
+			))
+		})
+
+		It("fails to build inconsistent mocks", func() {
+			_, err := mocks.NewGhwMock().
+				WithDisk(types.Disk{Name: "sda", Partitions: types.PartitionList{{Name: "sda1"}}}).
+				WithMapper("sdb1", types.Partition{Name: "luks-1"}).
+				Build()
+			Expect(err).To(MatchError(ContainSubstring("dm-0 is backed by sdb1, which doesn't exist")))
+		})
+	})
+
+	Describe("Snapshot", func() {
+		It("round-trips through JSON and replays in the mock", func() {
+			mock, err := mocks.LoadFixture(filepath.Join("testdata", "luks-lvm.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			snapshot := ghw.Snapshot(ghw.NewPaths(mock.Chroot), nil)
+			// Only one mock can be active, as they set GHW_CHROOT
+			mock.Clean()
+			Expect(snapshot.Version).To(Equal(ghw.SnapshotVersion))
+			Expect(snapshot.Disks).To(HaveLen(4))
+			Expect(snapshot.Mappers).To(HaveLen(2))
+
+			b, err := json.Marshal(snapshot)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(HavePrefix(`{"version":1,"disks":[{"name":"dm-0"`))
+			loaded, err := ghw.LoadSnapshot(bytes.NewReader(b))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*loaded).To(Equal(snapshot))
+
+			replay, err := mocks.NewGhwMock().WithSnapshot(loaded).WithCleanup(GinkgoT()).Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ghw.Snapshot(ghw.NewPaths(replay.Chroot), nil)).To(Equal(snapshot))
+		})
+
+		It("loads YAML documents and rejects unknown versions", func() {
+			loaded, err := ghw.LoadSnapshot(strings.NewReader("version: 1\ndisks:\n  - name: sda\n    size_bytes: 1024\n    partitions:\n      - name: sda1\n        size_bytes: 2097152\n"))
+			Expect(err).ToNot(HaveOccurred())
+			disks := loaded.DiskList()
+			Expect(disks).To(HaveLen(1))
+			Expect(disks[0].Partitions[0].Size).To(Equal(uint(2)))
+
+			_, err = ghw.LoadSnapshot(strings.NewReader(`{"version": 2, "disks": []}`))
+			Expect(err).To(MatchError(ContainSubstring("unsupported snapshot version 2")))
+		})
+	})
 })
@@ -0,0 +1,72 @@
+package ghw
+
+import (
+	"fmt"
+
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/disk"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// GrowLastPartition extends the given partition of the disk up to the end of
+// the disk, without relying on growpart or parted. device is the path of a
+// block device or a disk image with a GPT and partition is the 1-based index
+// of the partition, which must be the last one on the disk. The backup GPT
+// header is moved to the end of the disk and, for block devices, the kernel
+// is made aware of the new size. The filesystem is not resized. It returns
+// the number of bytes the partition grew.
+func GrowLastPartition(device string, partition int, logger *types.KairosLogger) (uint64, error) {
+	d, err := diskfs.Open(device, diskfs.WithOpenMode(diskfs.ReadWrite))
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	table, err := d.GetPartitionTable()
+	if err != nil {
+		return 0, fmt.Errorf("reading the partition table of %s: %w", device, err)
+	}
+	gptTable, ok := table.(*gpt.Table)
+	if !ok {
+		return 0, fmt.Errorf("%s has a %s partition table, only gpt is supported", device, table.Type())
+	}
+	if partition < 1 || partition > len(gptTable.Partitions) || gptTable.Partitions[partition-1].Type == gpt.Unused {
+		return 0, fmt.Errorf("partition %d not found in %s", partition, device)
+	}
+
+	p := gptTable.Partitions[partition-1]
+	for i, other := range gptTable.Partitions {
+		if other.Type != gpt.Unused && other.Start > p.Start {
+			return 0, fmt.Errorf("partition %d is not the last one in %s, partition %d is after it", partition, device, i+1)
+		}
+	}
+
+	gptTable.Resize(uint64(d.Size))
+	end := gptTable.LastDataSector()
+	if end <= p.End {
+		logger.Logger.Debug().Str("disk", device).Int("partition", partition).Msg("Partition already fills the disk")
+		return 0, nil
+	}
+
+	sector := uint64(gptTable.LogicalSectorSize)
+	grown := (end - p.End) * sector
+	p.End = end
+	p.Size = (p.End - p.Start + 1) * sector
+
+	if err := gptTable.Write(d.File, d.Size); err != nil {
+		return 0, fmt.Errorf("writing the partition table of %s: %w", device, err)
+	}
+	if err := d.File.Sync(); err != nil {
+		return 0, err
+	}
+	logger.Logger.Info().Str("disk", device).Int("partition", partition).Uint64("size", p.Size).Msg("Grown partition")
+
+	if d.Type == disk.Device {
+		if err := rescanPartition(d, partition, p.Start*sector, p.Size); err != nil {
+			return grown, fmt.Errorf("partition table written, but the kernel still uses the old one: %w", err)
+		}
+	}
+
+	return grown, nil
+}
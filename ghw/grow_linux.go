@@ -0,0 +1,40 @@
+package ghw
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/diskfs/go-diskfs/disk"
+	"golang.org/x/sys/unix"
+)
+
+// blkpg is BLKPG, _IO(0x12, 105), which x/sys doesn't define. It's derived
+// from BLKRRPART, _IO(0x12, 95), so the direction bits match every arch.
+const blkpg = unix.BLKRRPART + 105 - 95
+
+// rescanPartition makes the kernel aware of the new partition size. Re-reading
+// the whole table fails when any partition of the disk is in use, so the
+// partition is resized on its own in that case, like partx does.
+func rescanPartition(d *disk.Disk, partition int, start, size uint64) error {
+	if err := d.ReReadPartitionTable(); err == nil {
+		return nil
+	}
+
+	p := unix.BlkpgPartition{
+		Start:  int64(start),
+		Length: int64(size),
+		Pno:    int32(partition),
+	}
+	arg := unix.BlkpgIoctlArg{
+		Op:      unix.BLKPG_RESIZE_PARTITION,
+		Datalen: int32(unsafe.Sizeof(p)),
+		Data:    (*byte)(unsafe.Pointer(&p)),
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, d.File.Fd(), blkpg, uintptr(unsafe.Pointer(&arg)))
+	runtime.KeepAlive(&p)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ghw
+
+import "github.com/diskfs/go-diskfs/disk"
+
+func rescanPartition(d *disk.Disk, _ int, _, _ uint64) error {
+	return d.ReReadPartitionTable()
+}
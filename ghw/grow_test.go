@@ -0,0 +1,85 @@
+package ghw_test
+
+import (
+	"os"
+	"path/filepath"
+
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/kairos-io/kairos-sdk/ghw"
+	"github.com/kairos-io/kairos-sdk/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GrowLastPartition", func() {
+	const mib = 1024 * 1024
+	var image string
+	var logger types.KairosLogger
+
+	BeforeEach(func() {
+		logger = types.NewNullLogger()
+		image = filepath.Join(GinkgoT().TempDir(), "disk.img")
+
+		d, err := diskfs.Create(image, 10*mib, diskfs.Raw, diskfs.SectorSizeDefault)
+		Expect(err).ToNot(HaveOccurred())
+		err = d.Partition(&gpt.Table{
+			LogicalSectorSize:  512,
+			PhysicalSectorSize: 512,
+			ProtectiveMBR:      true,
+			Partitions: []*gpt.Partition{
+				{Start: 2048, End: 4095, Type: gpt.EFISystemPartition, Name: "efi"},
+				{Start: 4096, End: 8191, Type: gpt.LinuxFilesystem, Name: "persistent"},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.Close()).To(Succeed())
+	})
+
+	readTable := func() *gpt.Table {
+		d, err := diskfs.Open(image, diskfs.WithOpenMode(diskfs.ReadOnly))
+		Expect(err).ToNot(HaveOccurred())
+		defer d.Close()
+		table, err := d.GetPartitionTable()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(table.(*gpt.Table).Verify(d.File, uint64(d.Size))).To(Succeed())
+		return table.(*gpt.Table)
+	}
+
+	It("grows the last partition up to the end of the disk", func() {
+		Expect(os.Truncate(image, 20*mib)).To(Succeed())
+
+		grown, err := ghw.GrowLastPartition(image, 2, &logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		table := readTable()
+		// The backup GPT uses the last 33 sectors
+		last := uint64(20*mib/512 - 34)
+		Expect(table.Partitions[1].End).To(Equal(last))
+		Expect(table.Partitions[1].Name).To(Equal("persistent"))
+		Expect(table.Partitions[0].End).To(Equal(uint64(4095)))
+		Expect(grown).To(Equal((last - 8191) * 512))
+	})
+
+	It("does nothing if the partition already fills the disk", func() {
+		_, err := ghw.GrowLastPartition(image, 2, &logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		grown, err := ghw.GrowLastPartition(image, 2, &logger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(grown).To(BeZero())
+	})
+
+	It("refuses to grow a partition that is not the last one", func() {
+		Expect(os.Truncate(image, 20*mib)).To(Succeed())
+
+		_, err := ghw.GrowLastPartition(image, 1, &logger)
+		Expect(err).To(MatchError(ContainSubstring("not the last one")))
+	})
+
+	It("fails for missing partitions", func() {
+		_, err := ghw.GrowLastPartition(image, 3, &logger)
+		Expect(err).To(HaveOccurred())
+	})
+})
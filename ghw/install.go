@@ -0,0 +1,118 @@
+package ghw
+
+import (
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+const (
+	// LUKSFilesystem is the filesystem type reported for encrypted partitions
+	LUKSFilesystem = "crypto_LUKS"
+
+	EfiLabel        = "COS_GRUB"
+	OEMLabel        = "COS_OEM"
+	RecoveryLabel   = "COS_RECOVERY"
+	StateLabel      = "COS_STATE"
+	PersistentLabel = "COS_PERSISTENT"
+)
+
+// KairosLabels maps the filesystem labels of the Kairos partitions to the GPT
+// partition names used by the installer. The GPT names are used to identify
+// encrypted partitions, as their filesystem label is not readable.
+var KairosLabels = map[string]string{
+	EfiLabel:        "efi",
+	OEMLabel:        "oem",
+	RecoveryLabel:   "recovery",
+	StateLabel:      "state",
+	PersistentLabel: "persistent",
+}
+
+// KairosPartition is a partition of a disk identified as one of the Kairos
+// partitions.
+type KairosPartition struct {
+	Label     string
+	Encrypted bool
+	Partition *types.Partition
+}
+
+// InstallPresence reports the Kairos partitions found in a disk.
+type InstallPresence struct {
+	Disk       string
+	Partitions []KairosPartition
+}
+
+// Installed returns true when the disk holds one of the partitions used to
+// boot Kairos (state, recovery or efi). A disk with only a persistent or oem
+// partition is not considered an install.
+func (ip InstallPresence) Installed() bool {
+	for _, p := range ip.Partitions {
+		switch p.Label {
+		case StateLabel, RecoveryLabel, EfiLabel:
+			return true
+		}
+	}
+
+	return false
+}
+
+// Labels returns the labels of the Kairos partitions found in the disk.
+func (ip InstallPresence) Labels() []string {
+	result := []string{}
+	for _, p := range ip.Partitions {
+		result = append(result, p.Label)
+	}
+
+	return result
+}
+
+// Encrypted returns true if any of the Kairos partitions found is encrypted.
+func (ip InstallPresence) Encrypted() bool {
+	for _, p := range ip.Partitions {
+		if p.Encrypted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KairosInstallPresence inspects the partitions of the disk looking for the
+// canonical Kairos labels. Encrypted partitions are identified by their LUKS
+// label if set, or by their GPT partition name otherwise.
+func KairosInstallPresence(disk *types.Disk) InstallPresence {
+	result := InstallPresence{Partitions: []KairosPartition{}}
+	if disk == nil {
+		return result
+	}
+	result.Disk = disk.Name
+
+	for _, p := range disk.Partitions {
+		if p == nil {
+			continue
+		}
+		if label := kairosLabel(p); label != "" {
+			result.Partitions = append(result.Partitions, KairosPartition{
+				Label:     label,
+				Encrypted: p.FS == LUKSFilesystem,
+				Partition: p,
+			})
+		}
+	}
+
+	return result
+}
+
+func kairosLabel(p *types.Partition) string {
+	if _, ok := KairosLabels[p.FilesystemLabel]; ok {
+		return p.FilesystemLabel
+	}
+	if p.FS != LUKSFilesystem {
+		return ""
+	}
+	for label, name := range KairosLabels {
+		if p.PartitionLabel == name {
+			return label
+		}
+	}
+
+	return ""
+}
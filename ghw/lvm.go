@@ -0,0 +1,98 @@
+package ghw
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// lvmUUIDPrefix is the prefix of the device-mapper UUID of LVM logical volumes
+const lvmUUIDPrefix = "LVM-"
+
+// logicalVolume returns the volume group and the name of the device-mapper
+// device if it's an LVM logical volume. The names are read from the udev
+// database, falling back to splitting the device-mapper name.
+func logicalVolume(paths *Paths, dm string, info map[string]string, logger *types.KairosLogger) (string, string, bool) {
+	uuid := info["DM_UUID"]
+	if uuid == "" {
+		contents, err := paths.readFile(filepath.Join(paths.SysBlock, dm, "dm", "uuid"))
+		if err != nil {
+			return "", "", false
+		}
+		uuid = strings.TrimSpace(string(contents))
+	}
+	if !strings.HasPrefix(uuid, lvmUUIDPrefix) {
+		return "", "", false
+	}
+
+	vg, lv := info["DM_VG_NAME"], info["DM_LV_NAME"]
+	if vg == "" || lv == "" {
+		vg, lv = splitLVMName(filepath.Base(mapperPath(paths, dm, logger)))
+	}
+	logger.Logger.Trace().Str("device", dm).Str("vg", vg).Str("lv", lv).Msg("Got LVM logical volume")
+
+	return vg, lv, vg != ""
+}
+
+// splitLVMName splits the device-mapper name of a logical volume, e.g.
+// "vg-lv", into the volume group and logical volume names. Dashes in the
+// names are escaped as "--".
+func splitLVMName(name string) (string, string) {
+	for i := 0; i < len(name); i++ {
+		if name[i] != '-' {
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '-' {
+			i++
+			continue
+		}
+		unescape := func(s string) string { return strings.ReplaceAll(s, "--", "-") }
+		return unescape(name[:i]), unescape(name[i+1:])
+	}
+
+	return "", ""
+}
+
+// volumeGroups groups the LVM logical volumes found in scanDisks by volume
+// group, keeping the order they were found in.
+type volumeGroups struct {
+	names []string
+	disks map[string]*types.Disk
+}
+
+// add adds the device-mapper device if it's a logical volume and returns its
+// volume group.
+func (v *volumeGroups) add(paths *Paths, dm string, logger *types.KairosLogger) (string, bool) {
+	info, err := udevInfoPartition(paths, dm, "", logger)
+	if err != nil {
+		info = map[string]string{}
+	}
+	vg, _, ok := logicalVolume(paths, dm, info, logger)
+	if !ok {
+		return "", false
+	}
+
+	if v.disks == nil {
+		v.disks = map[string]*types.Disk{}
+	}
+	disk, found := v.disks[vg]
+	if !found {
+		disk = &types.Disk{Name: vg, VolumeGroup: true, Partitions: types.PartitionList{}}
+		v.disks[vg] = disk
+		v.names = append(v.names, vg)
+	}
+	p := mapperPartition(paths, dm, logger)
+	disk.SizeBytes += p.SizeBytes
+	disk.Partitions = append(disk.Partitions, p)
+
+	return vg, true
+}
+
+func (v *volumeGroups) list() []*types.Disk {
+	result := make([]*types.Disk, 0, len(v.names))
+	for _, name := range v.names {
+		result = append(result, v.disks[name])
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package ghw
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// MapperPartitions returns the device-mapper devices (e.g. open LUKS
+// partitions or LVM logical volumes) as partitions. Their Path is the /dev/mapper one and
+// BackingDevice points to the partition holding their data.
+func MapperPartitions(paths *Paths, logger *types.KairosLogger) types.PartitionList {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+	paths = paths.withCache()
+	out := make(types.PartitionList, 0)
+	files, err := paths.readDir(paths.SysBlock)
+	if err != nil {
+		logger.Logger.Error().Str("path", paths.SysBlock).Err(err).Msg("failed to read block devices")
+		return out
+	}
+
+	for _, file := range files {
+		dm := file.Name()
+		if !strings.HasPrefix(dm, "dm-") {
+			continue
+		}
+		out = append(out, mapperPartition(paths, dm, logger))
+	}
+
+	return out
+}
+
+// mapperPartition returns the given device-mapper device as a partition. LVM
+// logical volumes get their volume group as Disk.
+func mapperPartition(paths *Paths, dm string, logger *types.KairosLogger) *types.Partition {
+	path := mapperPath(paths, dm, logger)
+	info, err := udevInfoPartition(paths, dm, "", logger)
+	if err != nil {
+		info = map[string]string{}
+	}
+	mp, fs := partitionInfo(paths, path, logger)
+	if fs == "" {
+		fs = valueOrUnknown(info, "ID_FS_TYPE")
+	}
+	size := diskSizeBytes(paths, dm, logger)
+	p := &types.Partition{
+		Name:            dm,
+		Size:            uint(types.ByteSize(size).MiB()),
+		SizeBytes:       size,
+		MountPoint:      mp,
+		FilesystemLabel: valueOrUnknown(info, "ID_FS_LABEL"),
+		FS:              fs,
+		UUID:            valueOrUnknown(info, "ID_FS_UUID"),
+		Path:            path,
+	}
+	if vg, _, ok := logicalVolume(paths, dm, info, logger); ok {
+		p.Disk = filepath.Join("/dev", vg)
+	}
+
+	slaves, err := paths.readDir(filepath.Join(paths.SysBlock, dm, "slaves"))
+	if err == nil && len(slaves) > 0 {
+		p.BackingDevice = filepath.Join("/dev", slaves[0].Name())
+	}
+
+	return p
+}
+
+// FindPartitionByFilesystemLabel returns the partition with the given
+// filesystem label. Device-mapper devices are preferred over the partitions
+// backing them, so when a LUKS partition is open and the filesystem inside
+// shares its label, the mapper device is returned. If several partitions
+// share the label, the first one found is returned.
+//
+// Deprecated: use FindPartition with a Selector{Label: label}, which reports
+// duplicated labels as an *AmbiguousError.
+func FindPartitionByFilesystemLabel(paths *Paths, label string, logger *types.KairosLogger) (*types.Partition, error) {
+	return findByLabel(paths, Selector{Label: label}, logger)
+}
+
+// UdevRefresh makes udev re-probe the block devices and waits until it's
+// done, so the labels of just created filesystems are known. It's used by
+// FindPartition and can be replaced in tests.
+var UdevRefresh = func() error {
+	if out, err := exec.Command("udevadm", "trigger", "--subsystem-match=block").CombinedOutput(); err != nil {
+		return fmt.Errorf("udevadm trigger: %s: %w", out, err)
+	}
+	if out, err := exec.Command("udevadm", "settle").CombinedOutput(); err != nil {
+		return fmt.Errorf("udevadm settle: %s: %w", out, err)
+	}
+	return nil
+}
+
+// LookupFilesystemLabel is like FindPartitionByFilesystemLabel but, if no
+// partition is found and refresh is true, it refreshes the udev database with
+// UdevRefresh and tries again.
+//
+// Deprecated: use FindPartition with a Selector{Label: label, Retries: 1}.
+func LookupFilesystemLabel(paths *Paths, label string, refresh bool, logger *types.KairosLogger) (*types.Partition, error) {
+	sel := Selector{Label: label}
+	if refresh {
+		sel.Retries = 1
+	}
+	return findByLabel(paths, sel, logger)
+}
+
+// findByLabel is FindPartition returning the first partition found instead of
+// an *AmbiguousError, as the deprecated label lookups always did.
+func findByLabel(paths *Paths, sel Selector, logger *types.KairosLogger) (*types.Partition, error) {
+	p, err := FindPartition(paths, sel, logger)
+	var ambiguous *AmbiguousError
+	if errors.As(err, &ambiguous) {
+		return ambiguous.Partitions[0], nil
+	}
+	return p, err
+}
+
+// partitionHolder returns the path of the device-mapper device holding the
+// partition, if any.
+func partitionHolder(paths *Paths, disk string, part string, logger *types.KairosLogger) string {
+	holders, err := paths.readDir(filepath.Join(paths.SysBlock, disk, part, "holders"))
+	if err != nil {
+		return ""
+	}
+	for _, h := range holders {
+		if strings.HasPrefix(h.Name(), "dm-") {
+			return mapperPath(paths, h.Name(), logger)
+		}
+	}
+
+	return ""
+}
+
+// mapperPath returns the /dev/mapper path of the given dm device, falling back
+// to /dev/dm-N when its name can't be read.
+func mapperPath(paths *Paths, dm string, logger *types.KairosLogger) string {
+	name, err := paths.readFile(filepath.Join(paths.SysBlock, dm, "dm", "name"))
+	if err != nil || strings.TrimSpace(string(name)) == "" {
+		logger.Logger.Debug().Str("device", dm).Err(err).Msg("failed to read device-mapper name")
+		return filepath.Join("/dev", dm)
+	}
+
+	return filepath.Join("/dev/mapper", strings.TrimSpace(string(name)))
+}
+
+func valueOrUnknown(info map[string]string, key string) string {
+	if v, ok := info[key]; ok {
+		return v
+	}
+	return UNKNOWN
+}
@@ -0,0 +1,153 @@
+package mocks
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/ghw"
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// Builder builds a GhwMock with a fluent API, e.g.
+//
+//	mock, err := mocks.NewGhwMock().
+//		WithDisk(types.Disk{Name: "sda", Partitions: ...}).
+//		WithMapper("sda2", types.Partition{Name: "luks-1"}).
+//		WithCleanup(GinkgoT()).
+//		Build()
+//
+// The devices are created once, when calling Build.
+type Builder struct {
+	mock    *GhwMock
+	cleaner cleaner
+	err     error
+}
+
+// cleaner is implemented by testing.T and GinkgoT()
+type cleaner interface {
+	Cleanup(func())
+}
+
+// NewGhwMock returns a Builder for a GhwMock without disks.
+func NewGhwMock() *Builder {
+	return &Builder{mock: &GhwMock{}}
+}
+
+// WithDisk adds a disk with its partitions.
+func (b *Builder) WithDisk(disk types.Disk) *Builder {
+	b.mock.AddDisk(disk)
+	return b
+}
+
+// WithMapper adds a device-mapper device backed by the partition with the
+// given name. See GhwMock.AddMapper.
+func (b *Builder) WithMapper(backingPartition string, partition types.Partition) *Builder {
+	b.mock.mappers = append(b.mock.mappers, mapper{backing: backingPartition, partition: partition})
+	return b
+}
+
+// WithLVM adds an LVM volume group on the physical volume with the given
+// partition name. See GhwMock.AddLVM.
+func (b *Builder) WithLVM(vg string, physicalVolume string, logicalVolumes ...types.Partition) *Builder {
+	for _, lv := range logicalVolumes {
+		b.mock.mappers = append(b.mock.mappers, mapper{backing: physicalVolume, partition: lv, vg: vg})
+	}
+	return b
+}
+
+// WithOverlayMount adds an overlayfs mount. See GhwMock.AddOverlayMount.
+func (b *Builder) WithOverlayMount(mountpoint string, lowerDirs []string, upperDir, workDir string) *Builder {
+	b.mock.AddOverlayMount(mountpoint, lowerDirs, upperDir, workDir)
+	return b
+}
+
+// WithTmpfsMount adds a tmpfs mount. See GhwMock.AddTmpfsMount.
+func (b *Builder) WithTmpfsMount(mountpoint string, size string) *Builder {
+	b.mock.AddTmpfsMount(mountpoint, size)
+	return b
+}
+
+// WithSquashfsMount adds a squashfs mount. See GhwMock.AddSquashfsMount.
+func (b *Builder) WithSquashfsMount(source, mountpoint string) *Builder {
+	b.mock.AddSquashfsMount(source, mountpoint)
+	return b
+}
+
+// WithFixture adds the disks, mappers, volume groups and mounts of a YAML
+// fixture file. See Fixture for its format.
+func (b *Builder) WithFixture(path string) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	f, err := ReadFixture(path)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	f.apply(b)
+
+	return b
+}
+
+// WithSnapshot adds the disks and device-mapper devices of a snapshot taken
+// with ghw.Snapshot, to replay the topology of a real machine. The disks
+// created for the device-mapper devices and the LVM volume groups are not
+// added, as the mock creates them from the mappers.
+func (b *Builder) WithSnapshot(s *ghw.SnapshotDocument) *Builder {
+	for _, d := range s.DiskList() {
+		if strings.HasPrefix(d.Name, "dm-") || d.VolumeGroup {
+			continue
+		}
+		// The mock writes the sizes in 512-byte sectors
+		d.SizeBytes /= 512
+		for _, p := range d.Partitions {
+			p.Size = uint(p.SizeBytes / 512)
+		}
+		b.WithDisk(*d)
+	}
+	for _, p := range s.MapperList() {
+		backing := filepath.Base(p.BackingDevice)
+		name := filepath.Base(p.Path)
+		p.Size = uint(p.SizeBytes / 512)
+		if p.Disk == "" {
+			p.Name = name
+			b.WithMapper(backing, *p)
+			continue
+		}
+		vg := filepath.Base(p.Disk)
+		escape := func(s string) string { return strings.ReplaceAll(s, "-", "--") }
+		p.Name = strings.ReplaceAll(strings.TrimPrefix(name, escape(vg)+"-"), "--", "-")
+		b.WithLVM(vg, backing, *p)
+	}
+
+	return b
+}
+
+// WithCleanup registers GhwMock.Clean to be called when the test finishes, so
+// there is no need to call it in an AfterEach.
+func (b *Builder) WithCleanup(c cleaner) *Builder {
+	b.cleaner = c
+	return b
+}
+
+// Build creates the devices of the mock. It fails if a fixture couldn't be
+// read, or if the devices are not consistent, see GhwMock.Validate.
+func (b *Builder) Build() (*GhwMock, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	b.mock.CreateDevices()
+	if b.cleaner != nil {
+		b.cleaner.Cleanup(b.mock.Clean)
+	}
+	if err := b.mock.Validate(); err != nil {
+		if b.cleaner == nil {
+			b.mock.Clean()
+		}
+		return nil, err
+	}
+
+	return b.mock, nil
+}
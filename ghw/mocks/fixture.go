@@ -0,0 +1,183 @@
+package mocks
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is a fake disk topology that can be shared between projects as a
+// YAML file and loaded with LoadFixture or Builder.WithFixture, e.g.
+//
+//	disks:
+//	  - name: sda
+//	    size_bytes: 4096
+//	    transport: sata
+//	    partitions:
+//	      - name: sda1
+//	        label: COS_GRUB
+//	        fs: vfat
+//	        mountpoint: /efi
+//	      - name: sda2
+//	        label: COS_PERSISTENT
+//	        size: 2048
+//	mappers:
+//	  - backing: sda2
+//	    name: luks-1
+//	    fs: ext4
+//	lvm:
+//	  - vg: vg0
+//	    pv: sda3
+//	    lvs:
+//	      - name: root
+//	        fs: ext4
+//	mounts:
+//	  - type: tmpfs
+//	    mountpoint: /run/overlay
+//	    size: 25%
+//
+// Partition sizes are in 512-byte sectors, like in sysfs.
+type Fixture struct {
+	Disks   []FixtureDisk   `yaml:"disks,omitempty"`
+	Mappers []FixtureMapper `yaml:"mappers,omitempty"`
+	LVM     []FixtureLVM    `yaml:"lvm,omitempty"`
+	Mounts  []FixtureMount  `yaml:"mounts,omitempty"`
+}
+
+// FixtureDisk is a disk of a Fixture.
+type FixtureDisk struct {
+	Name       string             `yaml:"name"`
+	SizeBytes  uint64             `yaml:"size_bytes,omitempty"`
+	UUID       string             `yaml:"uuid,omitempty"`
+	Transport  string             `yaml:"transport,omitempty"`
+	Removable  bool               `yaml:"removable,omitempty"`
+	Rotational bool               `yaml:"rotational,omitempty"`
+	ReadOnly   bool               `yaml:"read_only,omitempty"`
+	Raid       *types.RaidInfo    `yaml:"raid,omitempty"`
+	Partitions []FixturePartition `yaml:"partitions,omitempty"`
+}
+
+// FixturePartition is a partition, mapper device or logical volume of a
+// Fixture.
+type FixturePartition struct {
+	Name            string `yaml:"name"`
+	FilesystemLabel string `yaml:"label,omitempty"`
+	PartitionLabel  string `yaml:"partition_label,omitempty"`
+	Size            uint   `yaml:"size,omitempty"`
+	StartSector     uint64 `yaml:"start_sector,omitempty"`
+	FS              string `yaml:"fs,omitempty"`
+	UUID            string `yaml:"uuid,omitempty"`
+	MountPoint      string `yaml:"mountpoint,omitempty"`
+}
+
+// FixtureMapper is a device-mapper device backed by the Backing partition.
+type FixtureMapper struct {
+	Backing          string `yaml:"backing"`
+	FixturePartition `yaml:",inline"`
+}
+
+// FixtureLVM is an LVM volume group on the PV partition.
+type FixtureLVM struct {
+	VG  string             `yaml:"vg"`
+	PV  string             `yaml:"pv"`
+	LVs []FixturePartition `yaml:"lvs"`
+}
+
+// FixtureMount is a mount not backed by a partition. Type is overlay, tmpfs
+// or squashfs.
+type FixtureMount struct {
+	Type       string   `yaml:"type"`
+	MountPoint string   `yaml:"mountpoint"`
+	Source     string   `yaml:"source,omitempty"`
+	Size       string   `yaml:"size,omitempty"`
+	LowerDirs  []string `yaml:"lower_dirs,omitempty"`
+	UpperDir   string   `yaml:"upper_dir,omitempty"`
+	WorkDir    string   `yaml:"work_dir,omitempty"`
+}
+
+// ReadFixture reads a YAML fixture file. Unknown fields are an error, so
+// typos don't go unnoticed.
+func ReadFixture(path string) (*Fixture, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil {
+		return nil, fmt.Errorf("parsing fixture %s: %w", path, err)
+	}
+	for _, m := range f.Mounts {
+		switch m.Type {
+		case "overlay", "tmpfs", "squashfs":
+		default:
+			return nil, fmt.Errorf("parsing fixture %s: unknown mount type %q", path, m.Type)
+		}
+	}
+
+	return f, nil
+}
+
+// LoadFixture returns a GhwMock with the devices of a YAML fixture file
+// already created.
+func LoadFixture(path string) (*GhwMock, error) {
+	return NewGhwMock().WithFixture(path).Build()
+}
+
+func (f *Fixture) apply(b *Builder) {
+	for _, d := range f.Disks {
+		disk := types.Disk{
+			Name:       d.Name,
+			SizeBytes:  d.SizeBytes,
+			UUID:       d.UUID,
+			Transport:  d.Transport,
+			Removable:  d.Removable,
+			Rotational: d.Rotational,
+			ReadOnly:   d.ReadOnly,
+			Raid:       d.Raid,
+		}
+		for _, p := range d.Partitions {
+			partition := p.partition()
+			disk.Partitions = append(disk.Partitions, &partition)
+		}
+		b.WithDisk(disk)
+	}
+	for _, m := range f.Mappers {
+		b.WithMapper(m.Backing, m.partition())
+	}
+	for _, l := range f.LVM {
+		lvs := []types.Partition{}
+		for _, lv := range l.LVs {
+			lvs = append(lvs, lv.partition())
+		}
+		b.WithLVM(l.VG, l.PV, lvs...)
+	}
+	for _, m := range f.Mounts {
+		switch m.Type {
+		case "overlay":
+			b.WithOverlayMount(m.MountPoint, m.LowerDirs, m.UpperDir, m.WorkDir)
+		case "tmpfs":
+			b.WithTmpfsMount(m.MountPoint, m.Size)
+		case "squashfs":
+			b.WithSquashfsMount(m.Source, m.MountPoint)
+		}
+	}
+}
+
+func (p FixturePartition) partition() types.Partition {
+	return types.Partition{
+		Name:            p.Name,
+		FilesystemLabel: p.FilesystemLabel,
+		PartitionLabel:  p.PartitionLabel,
+		Size:            p.Size,
+		StartSector:     p.StartSector,
+		FS:              p.FS,
+		UUID:            p.UUID,
+		MountPoint:      p.MountPoint,
+	}
+}
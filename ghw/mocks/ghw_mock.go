@@ -23,6 +23,32 @@ type GhwMock struct {
 	paths  *ghw.Paths
 	disks  []types.Disk
 	mounts []string
+	// extraMounts are the mounts not backed by a partition (overlay, tmpfs...)
+	extraMounts []string
+	mappers     []mapper
+}
+
+// udevBus maps the disk transports to the ID_BUS udev reports for them
+var udevBus = map[string]string{
+	types.TransportSATA: "ata",
+	types.TransportUSB:  "usb",
+	types.TransportSCSI: "scsi",
+}
+
+type mapper struct {
+	backing   string
+	partition types.Partition
+	// vg is the volume group of LVM logical volumes
+	vg string
+}
+
+// name returns the device-mapper name, vg-lv for logical volumes
+func (m mapper) name() string {
+	if m.vg == "" {
+		return m.partition.Name
+	}
+	escape := func(s string) string { return strings.ReplaceAll(s, "-", "--") }
+	return escape(m.vg) + "-" + escape(m.partition.Name)
 }
 
 // AddDisk adds a disk to GhwMock
@@ -33,9 +59,9 @@ func (g *GhwMock) AddDisk(disk types.Disk) {
 // AddPartitionToDisk will add a partition to the given disk and call Clean+CreateDevices, so we recreate all files
 // It makes no effort checking if the disk exists
 func (g *GhwMock) AddPartitionToDisk(diskName string, partition *types.Partition) {
-	for _, disk := range g.disks {
+	for index, disk := range g.disks {
 		if disk.Name == diskName {
-			disk.Partitions = append(disk.Partitions, partition)
+			g.disks[index].Partitions = append(disk.Partitions, partition)
 			g.Clean()
 			g.CreateDevices()
 		}
@@ -57,6 +83,8 @@ func (g *GhwMock) CreateDevices() {
 	// Create only the /proc/ dir, we add the mounts file afterwards
 	procDir, _ := filepath.Split(g.paths.ProcMounts)
 	_ = os.MkdirAll(procDir, 0755)
+	// Start from scratch, the partition mounts are added below
+	g.mounts = append([]string{}, g.extraMounts...)
 	for indexDisk, disk := range g.disks {
 		// For each dir we create the /sys/block/DISK_NAME
 		diskPath := filepath.Join(g.paths.SysBlock, disk.Name)
@@ -65,14 +93,24 @@ func (g *GhwMock) CreateDevices() {
 		_ = os.WriteFile(filepath.Join(g.paths.SysBlock, disk.Name, "dev"), []byte(fmt.Sprintf("%d:0\n", indexDisk)), 0644)
 		// Also write the size
 		_ = os.WriteFile(filepath.Join(g.paths.SysBlock, disk.Name, "size"), []byte(strconv.FormatUint(disk.SizeBytes, 10)), 0644)
+		// And the removable, rotational and read-only flags
+		_ = os.MkdirAll(filepath.Join(diskPath, "queue"), 0755)
+		_ = os.WriteFile(filepath.Join(diskPath, "removable"), []byte(flag(disk.Removable)), 0644)
+		_ = os.WriteFile(filepath.Join(diskPath, "queue", "rotational"), []byte(flag(disk.Rotational)), 0644)
+		_ = os.WriteFile(filepath.Join(diskPath, "ro"), []byte(flag(disk.ReadOnly)), 0644)
 		// Create the udevdata for this disk
-		_ = os.WriteFile(filepath.Join(g.paths.RunUdevData, fmt.Sprintf("b%d:0", indexDisk)), []byte(fmt.Sprintf("E:ID_PART_TABLE_UUID=%s\n", disk.UUID)), 0644)
+		diskData := fmt.Sprintf("E:ID_PART_TABLE_UUID=%s\n", disk.UUID)
+		if bus, ok := udevBus[disk.Transport]; ok {
+			diskData += fmt.Sprintf("E:ID_BUS=%s\n", bus)
+		}
+		_ = os.WriteFile(filepath.Join(g.paths.RunUdevData, fmt.Sprintf("b%d:0", indexDisk)), []byte(diskData), 0644)
 		for indexPart, partition := range disk.Partitions {
 			// For each partition we create the /sys/block/DISK_NAME/PARTITION_NAME
 			_ = os.Mkdir(filepath.Join(diskPath, partition.Name), 0755)
 			// Create the /sys/block/DISK_NAME/PARTITION_NAME/dev file which contains the major:minor of the partition
 			_ = os.WriteFile(filepath.Join(diskPath, partition.Name, "dev"), []byte(fmt.Sprintf("%d:6%d\n", indexDisk, indexPart)), 0644)
 			_ = os.WriteFile(filepath.Join(diskPath, partition.Name, "size"), []byte(fmt.Sprintf("%d\n", partition.Size)), 0644)
+			_ = os.WriteFile(filepath.Join(diskPath, partition.Name, "start"), []byte(fmt.Sprintf("%d\n", partition.StartSector)), 0644)
 			// Create the /run/udev/data/bMAJOR:MINOR file with the data inside to mimic the udev database
 			data := []string{fmt.Sprintf("E:ID_FS_LABEL=%s\n", partition.FilesystemLabel)}
 			if partition.FS != "" {
@@ -81,6 +119,9 @@ func (g *GhwMock) CreateDevices() {
 			if partition.UUID != "" {
 				data = append(data, fmt.Sprintf("E:ID_PART_ENTRY_UUID=%s\n", partition.UUID))
 			}
+			if partition.PartitionLabel != "" {
+				data = append(data, fmt.Sprintf("E:ID_PART_ENTRY_NAME=%s\n", partition.PartitionLabel))
+			}
 			_ = os.WriteFile(filepath.Join(g.paths.RunUdevData, fmt.Sprintf("b%d:6%d", indexDisk, indexPart)), []byte(strings.Join(data, "")), 0644)
 			// If we got a mountpoint, add it to our fake /proc/self/mounts
 			if partition.MountPoint != "" {
@@ -95,10 +136,152 @@ func (g *GhwMock) CreateDevices() {
 			}
 		}
 	}
+	for _, disk := range g.disks {
+		if disk.Raid != nil {
+			g.createRaid(disk)
+		}
+	}
+	for index, m := range g.mappers {
+		g.createMapper(index, m)
+	}
 	// Finally, write all the mounts
 	_ = os.WriteFile(g.paths.ProcMounts, []byte(strings.Join(g.mounts, "")), 0644)
 }
 
+// AddMapper adds a device-mapper device (like an open LUKS partition) named as the given partition, and backed by the
+// partition with the given name, then calls Clean+CreateDevices so we recreate all files.
+// It makes no effort checking if the backing partition exists
+func (g *GhwMock) AddMapper(backingPartition string, partition types.Partition) {
+	g.mappers = append(g.mappers, mapper{backing: backingPartition, partition: partition})
+	g.Clean()
+	g.CreateDevices()
+}
+
+// createRaid creates the /sys/block/mdN/md files of a disk with Raid set and links it with its member disks or
+// partitions, which must be added as disks too
+func (g *GhwMock) createRaid(disk types.Disk) {
+	mdPath := filepath.Join(g.paths.SysBlock, disk.Name)
+	_ = os.MkdirAll(filepath.Join(mdPath, "md"), 0755)
+	_ = os.WriteFile(filepath.Join(mdPath, "md", "level"), []byte(disk.Raid.Level+"\n"), 0644)
+	degraded := 0
+	if disk.Raid.Degraded {
+		degraded = 1
+	}
+	_ = os.WriteFile(filepath.Join(mdPath, "md", "degraded"), []byte(fmt.Sprintf("%d\n", degraded)), 0644)
+	for _, member := range disk.Raid.Members {
+		member = filepath.Base(member)
+		_ = os.MkdirAll(filepath.Join(mdPath, "slaves", member), 0755)
+		for _, d := range g.disks {
+			if d.Name == member {
+				_ = os.MkdirAll(filepath.Join(g.paths.SysBlock, d.Name, "holders", disk.Name), 0755)
+			}
+			for _, partition := range d.Partitions {
+				if partition.Name == member {
+					_ = os.MkdirAll(filepath.Join(g.paths.SysBlock, d.Name, partition.Name, "holders", disk.Name), 0755)
+				}
+			}
+		}
+	}
+}
+
+// AddLVM adds an LVM volume group on the physical volume with the given partition name, with the given partitions as
+// logical volumes, then calls Clean+CreateDevices so we recreate all files.
+// It makes no effort checking if the physical volume exists
+func (g *GhwMock) AddLVM(vg string, physicalVolume string, logicalVolumes ...types.Partition) {
+	for _, lv := range logicalVolumes {
+		g.mappers = append(g.mappers, mapper{backing: physicalVolume, partition: lv, vg: vg})
+	}
+	g.Clean()
+	g.CreateDevices()
+}
+
+// createMapper creates the /sys/block/dm-N files for the mapper and links it with its backing partition
+func (g *GhwMock) createMapper(index int, m mapper) {
+	dm := fmt.Sprintf("dm-%d", index)
+	dmPath := filepath.Join(g.paths.SysBlock, dm)
+	_ = os.MkdirAll(filepath.Join(dmPath, "dm"), 0755)
+	_ = os.MkdirAll(filepath.Join(dmPath, "slaves", m.backing), 0755)
+	_ = os.WriteFile(filepath.Join(dmPath, "dm", "name"), []byte(m.name()+"\n"), 0644)
+	_ = os.WriteFile(filepath.Join(dmPath, "dev"), []byte(fmt.Sprintf("253:%d\n", index)), 0644)
+	_ = os.WriteFile(filepath.Join(dmPath, "size"), []byte(fmt.Sprintf("%d\n", m.partition.Size)), 0644)
+	data := []string{fmt.Sprintf("E:ID_FS_LABEL=%s\n", m.partition.FilesystemLabel)}
+	if m.partition.FS != "" {
+		data = append(data, fmt.Sprintf("E:ID_FS_TYPE=%s\n", m.partition.FS))
+	}
+	if m.partition.UUID != "" {
+		data = append(data, fmt.Sprintf("E:ID_FS_UUID=%s\n", m.partition.UUID))
+	}
+	if m.vg != "" {
+		uuid := fmt.Sprintf("LVM-%032d", index)
+		_ = os.WriteFile(filepath.Join(dmPath, "dm", "uuid"), []byte(uuid+"\n"), 0644)
+		data = append(data, fmt.Sprintf("E:DM_UUID=%s\nE:DM_VG_NAME=%s\nE:DM_LV_NAME=%s\n", uuid, m.vg, m.partition.Name))
+	}
+	_ = os.WriteFile(filepath.Join(g.paths.RunUdevData, fmt.Sprintf("b253:%d", index)), []byte(strings.Join(data, "")), 0644)
+	// Mark the backing partition as held by the mapper
+	for _, disk := range g.disks {
+		for _, partition := range disk.Partitions {
+			if partition.Name == m.backing {
+				_ = os.MkdirAll(filepath.Join(g.paths.SysBlock, disk.Name, partition.Name, "holders", dm), 0755)
+			}
+		}
+	}
+	if m.partition.MountPoint != "" {
+		fs := m.partition.FS
+		if fs == "" {
+			fs = "ext4"
+		}
+		g.mounts = append(g.mounts, fmt.Sprintf("%s %s %s rw,relatime 0 0\n", filepath.Join("/dev/mapper", m.name()), m.partition.MountPoint, fs))
+	}
+}
+
+// AddOverlayMount adds an overlayfs entry, like the ones used for the Kairos
+// rootfs, to the fake mounts file.
+func (g *GhwMock) AddOverlayMount(mountpoint string, lowerDirs []string, upperDir, workDir string) {
+	options := []string{"rw", "relatime", fmt.Sprintf("lowerdir=%s", strings.Join(lowerDirs, ":"))}
+	if upperDir != "" {
+		options = append(options, fmt.Sprintf("upperdir=%s", upperDir), fmt.Sprintf("workdir=%s", workDir))
+	}
+	g.addMount(fmt.Sprintf("overlay %s overlay %s 0 0\n", escapeMountPath(mountpoint), strings.Join(options, ",")))
+}
+
+// AddTmpfsMount adds a tmpfs entry to the fake mounts file. size can be empty.
+func (g *GhwMock) AddTmpfsMount(mountpoint string, size string) {
+	options := "rw,nosuid,nodev,mode=755"
+	if size != "" {
+		options = fmt.Sprintf("rw,nosuid,nodev,size=%s,mode=755", size)
+	}
+	g.addMount(fmt.Sprintf("tmpfs %s tmpfs %s 0 0\n", escapeMountPath(mountpoint), options))
+}
+
+// AddSquashfsMount adds a squashfs entry to the fake mounts file. The source
+// is usually a loop device, e.g. /dev/loop0.
+func (g *GhwMock) AddSquashfsMount(source, mountpoint string) {
+	g.addMount(fmt.Sprintf("%s %s squashfs ro,relatime,errors=continue 0 0\n", source, escapeMountPath(mountpoint)))
+}
+
+// addMount adds a line to the fake mounts file. If the devices were already
+// created, the mounts file is written again.
+func (g *GhwMock) addMount(line string) {
+	g.extraMounts = append(g.extraMounts, line)
+	g.mounts = append(g.mounts, line)
+	if g.paths != nil {
+		_ = os.WriteFile(g.paths.ProcMounts, []byte(strings.Join(g.mounts, "")), 0644)
+	}
+}
+
+// flag returns the contents of a boolean sysfs attribute
+func flag(b bool) string {
+	if b {
+		return "1\n"
+	}
+	return "0\n"
+}
+
+// escapeMountPath encodes the characters that are escaped in /proc/mounts
+func escapeMountPath(p string) string {
+	return strings.NewReplacer("\\", "\\\\", " ", "\\040", "\t", "\\011", "\n", "\\012").Replace(p)
+}
+
 // RemoveDisk will remove the files for a disk. It makes no effort to check if the disk exists or not
 func (g *GhwMock) RemoveDisk(disk string) {
 	// This could be simpler I think, just removing the /sys/block/DEVICE should make ghw not find anything and not search
@@ -163,3 +346,17 @@ func (g *GhwMock) Clean() {
 	_ = os.Unsetenv("GHW_CHROOT")
 	_ = os.RemoveAll(g.Chroot)
 }
+
+// ReadErrorOn returns a hook for ghw.Paths.ReadError that fails with the given
+// error when reading any path ending in one of the given suffixes
+// (e.g. "disk1/size" or "b0:60").
+func ReadErrorOn(err error, suffixes ...string) func(path string) error {
+	return func(path string) error {
+		for _, s := range suffixes {
+			if strings.HasSuffix(path, s) {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,232 @@
+package mocks
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists the inconsistencies found by GhwMock.Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("inconsistent ghw mock:\n- %s", strings.Join(e.Problems, "\n- "))
+}
+
+// blockDevice is a disk, partition or mapper found in the fake /sys/block
+type blockDevice struct {
+	name string
+	// path is the sysfs directory of the device
+	path string
+	// parent is the disk of a partition
+	parent string
+	dev    string
+	size   uint64
+	start  uint64
+}
+
+// Validate cross-checks the files created by CreateDevices: device numbers
+// must be unique and have udev data, holders and slaves must link back to
+// each other, partitions and mappers must fit in the devices backing them and
+// the mounted /dev devices must exist. It returns a *ValidationError listing
+// every problem found.
+func (g *GhwMock) Validate() error {
+	if g.paths == nil {
+		return &ValidationError{Problems: []string{"the devices were not created, call CreateDevices first"}}
+	}
+
+	devices, problems := g.readBlockDevices()
+	byName := map[string]blockDevice{}
+	byDev := map[string]string{}
+	for _, d := range devices {
+		byName[d.name] = d
+		if d.dev == "" {
+			continue
+		}
+		if other, ok := byDev[d.dev]; ok {
+			problems = append(problems, fmt.Sprintf("%s and %s have the same device number %s", other, d.name, d.dev))
+		}
+		byDev[d.dev] = d.name
+		if _, err := os.Stat(filepath.Join(g.paths.RunUdevData, "b"+d.dev)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s) has no udev data", d.name, d.dev))
+		}
+	}
+
+	entries, _ := os.ReadDir(g.paths.RunUdevData)
+	for _, e := range entries {
+		if _, ok := byDev[strings.TrimPrefix(e.Name(), "b")]; !ok {
+			problems = append(problems, fmt.Sprintf("udev data %s doesn't belong to any device", e.Name()))
+		}
+	}
+
+	for _, d := range devices {
+		problems = append(problems, checkLinks(d, byName)...)
+		if d.parent != "" {
+			disk := byName[d.parent]
+			if disk.size > 0 && d.start+d.size > disk.size {
+				problems = append(problems, fmt.Sprintf("%s ends at sector %d, past the end of %s (%d sectors)", d.name, d.start+d.size, disk.name, disk.size))
+			}
+		}
+		if held := heldSize(d, byName); d.size > 0 && held > d.size {
+			problems = append(problems, fmt.Sprintf("the mappers on %s need %d sectors, it only has %d", d.name, held, d.size))
+		}
+	}
+
+	problems = append(problems, g.checkMountSources(byName)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// readBlockDevices returns the disks, partitions and mappers in the fake
+// /sys/block, sorted by name.
+func (g *GhwMock) readBlockDevices() ([]blockDevice, []string) {
+	devices := []blockDevice{}
+	problems := []string{}
+	disks, err := os.ReadDir(g.paths.SysBlock)
+	if err != nil {
+		return devices, []string{fmt.Sprintf("reading %s: %s", g.paths.SysBlock, err)}
+	}
+
+	read := func(d *blockDevice) {
+		dev, err := os.ReadFile(filepath.Join(d.path, "dev"))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s has no device number", d.name))
+		} else if d.dev = strings.TrimSpace(string(dev)); !validDevNumber(d.dev) {
+			problems = append(problems, fmt.Sprintf("%s has an invalid device number %q", d.name, d.dev))
+		}
+		d.size = readSectors(filepath.Join(d.path, "size"))
+		d.start = readSectors(filepath.Join(d.path, "start"))
+	}
+
+	for _, disk := range disks {
+		d := blockDevice{name: disk.Name(), path: filepath.Join(g.paths.SysBlock, disk.Name())}
+		read(&d)
+		devices = append(devices, d)
+
+		children, _ := os.ReadDir(d.path)
+		for _, c := range children {
+			// Partitions are the subdirectories with a device number
+			if _, err := os.Stat(filepath.Join(d.path, c.Name(), "dev")); err != nil {
+				continue
+			}
+			p := blockDevice{name: c.Name(), path: filepath.Join(d.path, c.Name()), parent: d.name}
+			read(&p)
+			devices = append(devices, p)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].name < devices[j].name })
+
+	return devices, problems
+}
+
+// checkLinks checks the holders of the device have it as slave, and the other
+// way around.
+func checkLinks(d blockDevice, byName map[string]blockDevice) []string {
+	problems := []string{}
+	holders, _ := os.ReadDir(filepath.Join(d.path, "holders"))
+	for _, h := range holders {
+		holder, ok := byName[h.Name()]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is held by %s, which doesn't exist", d.name, h.Name()))
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(holder.path, "slaves", d.name)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is held by %s, which doesn't list it as slave", d.name, holder.name))
+		}
+	}
+
+	slaves, _ := os.ReadDir(filepath.Join(d.path, "slaves"))
+	for _, s := range slaves {
+		slave, ok := byName[s.Name()]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is backed by %s, which doesn't exist", d.name, s.Name()))
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(slave.path, "holders", d.name)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is backed by %s, which doesn't list it as holder", d.name, slave.name))
+		}
+	}
+
+	return problems
+}
+
+// heldSize returns the sectors needed by the mappers holding the device. RAID
+// arrays are not counted, their size depends on the level.
+func heldSize(d blockDevice, byName map[string]blockDevice) uint64 {
+	var total uint64
+	holders, _ := os.ReadDir(filepath.Join(d.path, "holders"))
+	for _, h := range holders {
+		if holder, ok := byName[h.Name()]; ok && strings.HasPrefix(holder.name, "dm-") {
+			total += holder.size
+		}
+	}
+	return total
+}
+
+// checkMountSources checks the devices of the mounts exist. Sources that are
+// not devices, like overlay or tmpfs, and loop devices, which are not
+// modeled, are not checked.
+func (g *GhwMock) checkMountSources(byName map[string]blockDevice) []string {
+	problems := []string{}
+	mappers := map[string]bool{}
+	for _, d := range byName {
+		if name, err := os.ReadFile(filepath.Join(d.path, "dm", "name")); err == nil {
+			mappers[strings.TrimSpace(string(name))] = true
+		}
+	}
+
+	f, err := os.Open(g.paths.ProcMounts)
+	if err != nil {
+		return []string{fmt.Sprintf("reading %s: %s", g.paths.ProcMounts, err)}
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") || strings.HasPrefix(fields[0], "/dev/loop") {
+			continue
+		}
+		source := fields[0]
+		if name, ok := strings.CutPrefix(source, "/dev/mapper/"); ok {
+			if !mappers[name] {
+				problems = append(problems, fmt.Sprintf("%s is mounted on %s, but there is no such mapper", source, fields[1]))
+			}
+			continue
+		}
+		if _, ok := byName[strings.TrimPrefix(source, "/dev/")]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is mounted on %s, but there is no such device", source, fields[1]))
+		}
+	}
+
+	return problems
+}
+
+func validDevNumber(dev string) bool {
+	major, minor, found := strings.Cut(dev, ":")
+	if !found {
+		return false
+	}
+	_, errMajor := strconv.ParseUint(major, 10, 32)
+	_, errMinor := strconv.ParseUint(minor, 10, 32)
+	return errMajor == nil && errMinor == nil
+}
+
+// readSectors returns the number in a size or start sysfs file, 0 if missing
+func readSectors(path string) uint64 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return n
+}
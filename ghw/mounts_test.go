@@ -0,0 +1,30 @@
+package ghw
+
+import (
+	"github.com/kairos-io/kairos-sdk/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parseMountEntry", func() {
+	logger := types.NewNullLogger()
+
+	DescribeTable("parses mount lines",
+		func(line string, expected *mountEntry) {
+			Expect(parseMountEntry(line, &logger)).To(Equal(expected))
+		},
+		Entry("device backed", "/dev/sda6 / ext4 rw,relatime,errors=remount-ro,data=ordered 0 0",
+			&mountEntry{Partition: "/dev/sda6", Mountpoint: "/", FilesystemType: "ext4"}),
+		Entry("escaped mountpoint", `/dev/sda2 /mnt/my\040disk ext4 rw 0 0`,
+			&mountEntry{Partition: "/dev/sda2", Mountpoint: "/mnt/my disk", FilesystemType: "ext4"}),
+		Entry("overlay", "overlay / overlay rw,relatime,lowerdir=/run/rootfsbase,upperdir=/run/overlay/upper,workdir=/run/overlay/work 0 0",
+			&mountEntry{Partition: "overlay", Mountpoint: "/", FilesystemType: "overlay"}),
+		Entry("tmpfs", "tmpfs /run tmpfs rw,nosuid,nodev,size=1599616k,mode=755 0 0",
+			&mountEntry{Partition: "tmpfs", Mountpoint: "/run", FilesystemType: "tmpfs"}),
+		Entry("squashfs on a loop device", "/dev/loop0 /run/rootfsbase squashfs ro,relatime 0 0",
+			&mountEntry{Partition: "/dev/loop0", Mountpoint: "/run/rootfsbase", FilesystemType: "squashfs"}),
+		Entry("empty line", "", nil),
+		Entry("not enough fields", "tmpfs /run tmpfs", nil),
+	)
+})
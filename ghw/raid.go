@@ -0,0 +1,59 @@
+package ghw
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// raidInfo returns the RAID data of md devices, or nil for any other disk.
+func raidInfo(paths *Paths, disk string, logger *types.KairosLogger) *types.RaidInfo {
+	if !strings.HasPrefix(disk, "md") {
+		return nil
+	}
+	level, err := paths.readFile(filepath.Join(paths.SysBlock, disk, "md", "level"))
+	if err != nil {
+		logger.Logger.Debug().Str("disk", disk).Err(err).Msg("failed to read RAID level")
+		return nil
+	}
+
+	info := &types.RaidInfo{Level: strings.TrimSpace(string(level)), Members: []string{}}
+	if slaves, err := paths.readDir(filepath.Join(paths.SysBlock, disk, "slaves")); err == nil {
+		for _, s := range slaves {
+			info.Members = append(info.Members, filepath.Join("/dev", s.Name()))
+		}
+	}
+	// Only redundant levels have the degraded file, with the number of
+	// missing members
+	if degraded, err := paths.readFile(filepath.Join(paths.SysBlock, disk, "md", "degraded")); err == nil {
+		n, _ := strconv.Atoi(strings.TrimSpace(string(degraded)))
+		info.Degraded = n > 0
+	}
+	logger.Logger.Trace().Str("disk", disk).Str("level", info.Level).Strs("members", info.Members).Bool("degraded", info.Degraded).Msg("Got RAID info")
+
+	return info
+}
+
+// raidMember returns the path of the md device holding the disk or any of its
+// partitions, if any.
+func raidMember(paths *Paths, disk string, partitions types.PartitionList) string {
+	dirs := []string{filepath.Join(paths.SysBlock, disk, "holders")}
+	for _, p := range partitions {
+		dirs = append(dirs, filepath.Join(paths.SysBlock, disk, p.Name, "holders"))
+	}
+	for _, dir := range dirs {
+		holders, err := paths.readDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, h := range holders {
+			if strings.HasPrefix(h.Name(), "md") {
+				return filepath.Join("/dev", h.Name())
+			}
+		}
+	}
+
+	return ""
+}
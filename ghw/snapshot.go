@@ -0,0 +1,227 @@
+package ghw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotVersion is the version of the SnapshotDocument schema. It's only
+// increased on incompatible changes: new fields can be added without it.
+const SnapshotVersion = 1
+
+// SnapshotDocument is a serializable view of the block devices of a machine,
+// as seen by GetDisks and MapperPartitions. Its schema is independent of the
+// types package, so snapshots attached to bug reports can be loaded by later
+// versions, e.g. to replay them in tests with mocks.Builder.WithSnapshot.
+type SnapshotDocument struct {
+	Version int                 `json:"version" yaml:"version"`
+	Disks   []SnapshotDisk      `json:"disks" yaml:"disks"`
+	Mappers []SnapshotPartition `json:"mappers,omitempty" yaml:"mappers,omitempty"`
+	Skipped []SkippedDevice     `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+}
+
+// SnapshotDisk is a disk of a SnapshotDocument.
+type SnapshotDisk struct {
+	Name              string              `json:"name" yaml:"name"`
+	SizeBytes         uint64              `json:"size_bytes" yaml:"size_bytes"`
+	UUID              string              `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	Transport         string              `json:"transport,omitempty" yaml:"transport,omitempty"`
+	Parent            string              `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Namespace         int                 `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	HardwarePartition bool                `json:"hardware_partition,omitempty" yaml:"hardware_partition,omitempty"`
+	VolumeGroup       bool                `json:"volume_group,omitempty" yaml:"volume_group,omitempty"`
+	Raid              *types.RaidInfo     `json:"raid,omitempty" yaml:"raid,omitempty"`
+	RaidMember        string              `json:"raid_member,omitempty" yaml:"raid_member,omitempty"`
+	Removable         bool                `json:"removable,omitempty" yaml:"removable,omitempty"`
+	Rotational        bool                `json:"rotational,omitempty" yaml:"rotational,omitempty"`
+	ReadOnly          bool                `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+	Partitions        []SnapshotPartition `json:"partitions,omitempty" yaml:"partitions,omitempty"`
+}
+
+// SnapshotPartition is a partition or device-mapper device of a
+// SnapshotDocument.
+type SnapshotPartition struct {
+	Name            string `json:"name" yaml:"name"`
+	Path            string `json:"path,omitempty" yaml:"path,omitempty"`
+	Disk            string `json:"disk,omitempty" yaml:"disk,omitempty"`
+	SizeBytes       uint64 `json:"size_bytes" yaml:"size_bytes"`
+	StartSector     uint64 `json:"start_sector,omitempty" yaml:"start_sector,omitempty"`
+	AlignmentOK     bool   `json:"alignment_ok,omitempty" yaml:"alignment_ok,omitempty"`
+	FS              string `json:"fs,omitempty" yaml:"fs,omitempty"`
+	FilesystemLabel string `json:"label,omitempty" yaml:"label,omitempty"`
+	PartitionLabel  string `json:"partition_label,omitempty" yaml:"partition_label,omitempty"`
+	UUID            string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	MountPoint      string `json:"mountpoint,omitempty" yaml:"mountpoint,omitempty"`
+	MappedBy        string `json:"mapped_by,omitempty" yaml:"mapped_by,omitempty"`
+	BackingDevice   string `json:"backing_device,omitempty" yaml:"backing_device,omitempty"`
+	UsedBytes       uint64 `json:"used_bytes,omitempty" yaml:"used_bytes,omitempty"`
+	AvailableBytes  uint64 `json:"available_bytes,omitempty" yaml:"available_bytes,omitempty"`
+	NeedsFsck       bool   `json:"needs_fsck,omitempty" yaml:"needs_fsck,omitempty"`
+}
+
+// Snapshot scans the disks and the device-mapper devices and returns them as
+// a SnapshotDocument.
+func Snapshot(paths *Paths, logger *types.KairosLogger) SnapshotDocument {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+
+	disks, skipped, err := scanDisks(paths, logger)
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to scan the disks for the snapshot")
+	}
+
+	return NewSnapshot(disks, MapperPartitions(paths, logger), skipped)
+}
+
+// NewSnapshot returns a SnapshotDocument with the given disks and
+// device-mapper devices, e.g. the ones returned by GetDisksWithOptions.
+func NewSnapshot(disks []*types.Disk, mappers types.PartitionList, skipped []SkippedDevice) SnapshotDocument {
+	s := SnapshotDocument{
+		Version: SnapshotVersion,
+		Disks:   []SnapshotDisk{},
+		Skipped: skipped,
+	}
+	for _, d := range disks {
+		disk := SnapshotDisk{
+			Name:              d.Name,
+			SizeBytes:         d.SizeBytes,
+			UUID:              d.UUID,
+			Transport:         d.Transport,
+			Parent:            d.Parent,
+			Namespace:         d.Namespace,
+			HardwarePartition: d.HardwarePartition,
+			VolumeGroup:       d.VolumeGroup,
+			Raid:              d.Raid,
+			RaidMember:        d.RaidMember,
+			Removable:         d.Removable,
+			Rotational:        d.Rotational,
+			ReadOnly:          d.ReadOnly,
+		}
+		for _, p := range d.Partitions {
+			disk.Partitions = append(disk.Partitions, snapshotPartition(p))
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+	for _, p := range mappers {
+		s.Mappers = append(s.Mappers, snapshotPartition(p))
+	}
+
+	return s
+}
+
+// MarshalJSON always sets the version of the document.
+func (s SnapshotDocument) MarshalJSON() ([]byte, error) {
+	type document SnapshotDocument
+	if s.Version == 0 {
+		s.Version = SnapshotVersion
+	}
+	if s.Disks == nil {
+		s.Disks = []SnapshotDisk{}
+	}
+	return json.Marshal(document(s))
+}
+
+// LoadSnapshot reads a SnapshotDocument in JSON or YAML. Documents of newer,
+// incompatible, versions are rejected.
+func LoadSnapshot(r io.Reader) (*SnapshotDocument, error) {
+	s := &SnapshotDocument{}
+	// JSON documents are valid YAML too
+	if err := yaml.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("parsing the snapshot: %w", err)
+	}
+	if s.Version == 0 || s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected up to %d", s.Version, SnapshotVersion)
+	}
+
+	return s, nil
+}
+
+// DiskList returns the disks of the snapshot, like GetDisks would.
+func (s SnapshotDocument) DiskList() []*types.Disk {
+	result := make([]*types.Disk, 0, len(s.Disks))
+	for _, d := range s.Disks {
+		disk := &types.Disk{
+			Name:              d.Name,
+			SizeBytes:         d.SizeBytes,
+			UUID:              d.UUID,
+			Partitions:        types.PartitionList{},
+			Transport:         d.Transport,
+			Parent:            d.Parent,
+			Namespace:         d.Namespace,
+			HardwarePartition: d.HardwarePartition,
+			VolumeGroup:       d.VolumeGroup,
+			Raid:              d.Raid,
+			RaidMember:        d.RaidMember,
+			Removable:         d.Removable,
+			Rotational:        d.Rotational,
+			ReadOnly:          d.ReadOnly,
+		}
+		for _, p := range d.Partitions {
+			disk.Partitions = append(disk.Partitions, p.partition())
+		}
+		result = append(result, disk)
+	}
+
+	return result
+}
+
+// MapperList returns the device-mapper devices of the snapshot, like
+// MapperPartitions would.
+func (s SnapshotDocument) MapperList() types.PartitionList {
+	result := make(types.PartitionList, 0, len(s.Mappers))
+	for _, p := range s.Mappers {
+		result = append(result, p.partition())
+	}
+
+	return result
+}
+
+func snapshotPartition(p *types.Partition) SnapshotPartition {
+	return SnapshotPartition{
+		Name:            p.Name,
+		Path:            p.Path,
+		Disk:            p.Disk,
+		SizeBytes:       p.SizeBytes,
+		StartSector:     p.StartSector,
+		AlignmentOK:     p.AlignmentOK,
+		FS:              p.FS,
+		FilesystemLabel: p.FilesystemLabel,
+		PartitionLabel:  p.PartitionLabel,
+		UUID:            p.UUID,
+		MountPoint:      p.MountPoint,
+		MappedBy:        p.MappedBy,
+		BackingDevice:   p.BackingDevice,
+		UsedBytes:       p.UsedBytes,
+		AvailableBytes:  p.AvailableBytes,
+		NeedsFsck:       p.NeedsFsck,
+	}
+}
+
+func (p SnapshotPartition) partition() *types.Partition {
+	return &types.Partition{
+		Name:            p.Name,
+		Path:            p.Path,
+		Disk:            p.Disk,
+		Size:            uint(types.ByteSize(p.SizeBytes).MiB()),
+		SizeBytes:       p.SizeBytes,
+		StartSector:     p.StartSector,
+		StartBytes:      p.StartSector * sectorSize,
+		AlignmentOK:     p.AlignmentOK,
+		FS:              p.FS,
+		FilesystemLabel: p.FilesystemLabel,
+		PartitionLabel:  p.PartitionLabel,
+		UUID:            p.UUID,
+		MountPoint:      p.MountPoint,
+		MappedBy:        p.MappedBy,
+		BackingDevice:   p.BackingDevice,
+		UsedBytes:       p.UsedBytes,
+		AvailableBytes:  p.AvailableBytes,
+		NeedsFsck:       p.NeedsFsck,
+	}
+}
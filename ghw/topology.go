@@ -0,0 +1,87 @@
+package ghw
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+var (
+	// nvmeNamespace matches NVMe namespaces, e.g. nvme0n1, and the per-path
+	// devices of multipath namespaces, e.g. nvme0c1n1
+	nvmeNamespace = regexp.MustCompile(`^(nvme\d+)(?:c\d+)?n(\d+)$`)
+	// emmcHardwarePartition matches the eMMC boot and RPMB areas, which the
+	// kernel exposes as block devices next to the user area, e.g. mmcblk0boot0
+	emmcHardwarePartition = regexp.MustCompile(`^(mmcblk\d+)(?:boot\d+|rpmb)$`)
+)
+
+// udevBusTransports maps the ID_BUS values of the udev database to the
+// transports.
+var udevBusTransports = map[string]string{
+	"ata":  types.TransportSATA,
+	"usb":  types.TransportUSB,
+	"scsi": types.TransportSCSI,
+	"nvme": types.TransportNVMe,
+}
+
+// setTopology fills the transport, the NVMe namespace and the eMMC hardware
+// partition data of the disk.
+func setTopology(paths *Paths, disk *types.Disk, logger *types.KairosLogger) {
+	if m := nvmeNamespace.FindStringSubmatch(disk.Name); m != nil {
+		disk.Parent = m[1]
+		disk.Namespace, _ = strconv.Atoi(m[2])
+	}
+	if m := emmcHardwarePartition.FindStringSubmatch(disk.Name); m != nil {
+		disk.Parent = m[1]
+		disk.HardwarePartition = true
+	}
+	disk.Transport = diskTransport(paths, disk.Name, logger)
+	logger.Logger.Trace().Str("disk", disk.Name).Str("transport", disk.Transport).Str("parent", disk.Parent).Msg("Got disk topology")
+}
+
+// diskTransport returns the bus the disk is attached to, from its name, the
+// udev database or the sysfs device path, or an empty string when unknown.
+func diskTransport(paths *Paths, disk string, logger *types.KairosLogger) string {
+	switch {
+	case strings.HasPrefix(disk, "nvme"):
+		return types.TransportNVMe
+	case strings.HasPrefix(disk, "mmcblk"):
+		return types.TransportMMC
+	}
+
+	if info, err := udevInfoPartition(paths, disk, "", logger); err == nil {
+		if t, ok := udevBusTransports[info["ID_BUS"]]; ok {
+			return t
+		}
+	}
+
+	// /sys/block/DISK links to the device, e.g.
+	// ../devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda
+	if link, err := paths.readLink(filepath.Join(paths.SysBlock, disk)); err == nil {
+		for _, dir := range strings.Split(link, "/") {
+			switch {
+			case strings.HasPrefix(dir, "usb"):
+				return types.TransportUSB
+			case strings.HasPrefix(dir, "ata"):
+				return types.TransportSATA
+			case strings.HasPrefix(dir, "virtio"):
+				return types.TransportVirtio
+			}
+		}
+	}
+
+	if strings.HasPrefix(disk, "vd") {
+		return types.TransportVirtio
+	}
+	return ""
+}
+
+// isHardwarePartitionOf returns whether the block device is an eMMC hardware
+// partition of the disk, which sysfs lists under the disk like its partitions.
+func isHardwarePartitionOf(disk, name string) bool {
+	m := emmcHardwarePartition.FindStringSubmatch(name)
+	return m != nil && m[1] == disk
+}
@@ -0,0 +1,57 @@
+package ghw
+
+import (
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// Options enables the data that is not read by default when getting the
+// disks, usually because it's more expensive to gather.
+type Options struct {
+	// FilesystemUsage fills the UsedBytes and AvailableBytes of the mounted
+	// partitions, with a statfs call on their mountpoint
+	FilesystemUsage bool
+	// FilesystemState fills the NeedsFsck of the unmounted partitions, by
+	// reading their superblock
+	FilesystemState bool
+}
+
+// GetDisksWithOptions returns the disks like GetDisks, with the optional data
+// enabled in opts.
+func GetDisksWithOptions(paths *Paths, opts Options, logger *types.KairosLogger) []*types.Disk {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+	disks := GetDisks(paths, logger)
+	if opts.FilesystemUsage {
+		for _, d := range disks {
+			AddFilesystemUsage(d.Partitions, logger)
+		}
+	}
+	if opts.FilesystemState {
+		for _, d := range disks {
+			AddFilesystemState(d.Partitions, logger)
+		}
+	}
+
+	return disks
+}
+
+// AddFilesystemUsage fills the UsedBytes and AvailableBytes of the mounted
+// partitions. Partitions that are not mounted, or whose usage can't be read,
+// are left untouched.
+func AddFilesystemUsage(partitions types.PartitionList, logger *types.KairosLogger) {
+	for _, p := range partitions {
+		if p.MountPoint == "" {
+			continue
+		}
+		used, available, err := filesystemUsage(p.MountPoint)
+		if err != nil {
+			logger.Logger.Warn().Str("partition", p.Name).Str("mountpoint", p.MountPoint).Err(err).Msg("failed to read filesystem usage")
+			continue
+		}
+		logger.Logger.Trace().Str("partition", p.Name).Uint64("used", used).Uint64("available", available).Msg("Got filesystem usage")
+		p.UsedBytes = used
+		p.AvailableBytes = available
+	}
+}
@@ -0,0 +1,18 @@
+package ghw
+
+import "golang.org/x/sys/unix"
+
+// filesystemUsage returns the bytes used and the ones available to
+// unprivileged users, like df, so the blocks reserved for root are neither.
+func filesystemUsage(mountpoint string) (uint64, uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(mountpoint, &st); err != nil {
+		return 0, 0, err
+	}
+	blockSize := uint64(st.Frsize)
+	if blockSize == 0 {
+		blockSize = uint64(st.Bsize)
+	}
+
+	return (st.Blocks - st.Bfree) * blockSize, st.Bavail * blockSize, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ghw
+
+import "errors"
+
+func filesystemUsage(_ string) (uint64, uint64, error) {
+	return 0, 0, errors.New("filesystem usage is only supported on Linux")
+}
@@ -0,0 +1,143 @@
+package ghw
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+// DeviceEventType is the kind of change reported by Watch.
+type DeviceEventType string
+
+const (
+	DiskAdded        DeviceEventType = "disk-added"
+	DiskRemoved      DeviceEventType = "disk-removed"
+	PartitionChanged DeviceEventType = "partition-changed"
+)
+
+// DeviceEvent is a change in the block devices. Disk is the disk after the
+// change, or before it for DiskRemoved.
+type DeviceEvent struct {
+	Type DeviceEventType
+	Disk *types.Disk
+}
+
+// watchSettle is how long Watch waits for the udev database to settle after
+// a change before scanning the disks.
+const watchSettle = 250 * time.Millisecond
+
+// Watch reports the disks added and removed, and the disks whose partitions
+// changed, until the context is done. The changes are detected by watching
+// the udev database, which is updated once udev has processed the kernel
+// uevents, and scanning the disks again. The disks present when Watch is
+// called are not reported. The channel is closed when the context is done.
+func Watch(ctx context.Context, paths *Paths, logger *types.KairosLogger) (<-chan DeviceEvent, error) {
+	if logger == nil {
+		newLogger := types.NewKairosLogger("ghw", "info", false)
+		logger = &newLogger
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(paths.RunUdevData); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("watching %s: %w", paths.RunUdevData, err)
+	}
+
+	events := make(chan DeviceEvent)
+	known := diskSnapshot(GetDisks(paths, logger))
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+
+		settle := time.NewTimer(watchSettle)
+		settle.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Logger.Warn().Err(err).Msg("failed to watch the udev database")
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				logger.Logger.Trace().Str("file", e.Name).Str("op", e.Op.String()).Msg("udev database changed")
+				settle.Reset(watchSettle)
+			case <-settle.C:
+				current := diskSnapshot(GetDisks(paths, logger))
+				for _, ev := range diffDisks(known, current) {
+					logger.Logger.Debug().Str("event", string(ev.Type)).Str("disk", ev.Disk.Name).Msg("Block device changed")
+					select {
+					case events <- ev:
+					case <-ctx.Done():
+						return
+					}
+				}
+				known = current
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// snapshot keeps the disks found in a scan, in order, by name.
+type snapshot struct {
+	names []string
+	disks map[string]*types.Disk
+}
+
+func diskSnapshot(disks []*types.Disk) snapshot {
+	s := snapshot{disks: map[string]*types.Disk{}}
+	for _, d := range disks {
+		s.names = append(s.names, d.Name)
+		s.disks[d.Name] = d
+	}
+	return s
+}
+
+// diffDisks returns the events that turn the before snapshot into the after
+// one: the removed disks first, then the added and changed ones.
+func diffDisks(before, after snapshot) []DeviceEvent {
+	result := []DeviceEvent{}
+	for _, name := range before.names {
+		if _, ok := after.disks[name]; !ok {
+			result = append(result, DeviceEvent{Type: DiskRemoved, Disk: before.disks[name]})
+		}
+	}
+	for _, name := range after.names {
+		old, ok := before.disks[name]
+		switch {
+		case !ok:
+			result = append(result, DeviceEvent{Type: DiskAdded, Disk: after.disks[name]})
+		case partitionsChanged(old.Partitions, after.disks[name].Partitions):
+			result = append(result, DeviceEvent{Type: PartitionChanged, Disk: after.disks[name]})
+		}
+	}
+	return result
+}
+
+// partitionsChanged compares the partitions udev reports on, ignoring the
+// mountpoints and filesystem usage.
+func partitionsChanged(a, b types.PartitionList) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	key := func(p *types.Partition) string {
+		return fmt.Sprintf("%s|%s|%s|%s|%s|%d", p.Name, p.FilesystemLabel, p.PartitionLabel, p.FS, p.UUID, p.SizeBytes)
+	}
+	for i := range a {
+		if key(a[i]) != key(b[i]) {
+			return true
+		}
+	}
+	return false
+}
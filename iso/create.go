@@ -0,0 +1,527 @@
+package iso
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/filesystem/fat32"
+	"github.com/diskfs/go-diskfs/filesystem/iso9660"
+	"github.com/kairos-io/kairos-sdk/types"
+)
+
+const (
+	// DefaultEFIImage is the path of the generated EFI FAT image inside the ISO
+	DefaultEFIImage = "boot/uefi.img"
+	// DefaultBootCatalog is the path of the El Torito boot catalog inside the ISO
+	DefaultBootCatalog = "boot.catalog"
+
+	// efiImageMinSize keeps the EFI image above 65525 clusters, otherwise
+	// firmwares detect the FAT32 filesystem created by go-diskfs as FAT16.
+	efiImageMinSize = 40 * 1024 * 1024
+	isoBlockSize    = 2048
+	mbrSize         = 512
+	maxLabelLength  = 32
+)
+
+// CreateISOOptions configures CreateISO. Paths are relative to the source
+// directory, which is also the root of the ISO.
+type CreateISOOptions struct {
+	// BIOSBootImage is the El Torito no emulation boot image used to boot on
+	// BIOS systems, e.g. boot/grub2/i386-pc/eltorito.img. BIOS boot is
+	// disabled if empty.
+	BIOSBootImage string
+	// EFIDir is the directory copied as /EFI into a FAT image used to boot on
+	// EFI systems, e.g. EFI. EFI boot is disabled if empty.
+	EFIDir string
+	// EFIImage is the path of the generated FAT image. Defaults to
+	// DefaultEFIImage.
+	EFIImage string
+	// BootCatalog is the path of the El Torito boot catalog. Defaults to
+	// DefaultBootCatalog.
+	BootCatalog string
+	// MBR is the boot code written into the protective MBR of the hybrid
+	// image, so it can boot on BIOS systems from a USB stick. It is meant to be
+	// GRUB's boot_hybrid.img, which gets the location of the BIOS boot image
+	// patched in. Only the partition table is written if empty.
+	MBR []byte
+	// Logger defaults to a null logger
+	Logger *types.KairosLogger
+}
+
+// CreateISO creates a hybrid ISO at output from the contents of dir. The
+// image can be booted as a CD (El Torito) on BIOS and EFI systems and, thanks
+// to the MBR partition table pointing to the EFI image, also when written to
+// a disk. The source directory is left untouched.
+func CreateISO(dir, label, output string, opts CreateISOOptions) (err error) {
+	logger := opts.Logger
+	if logger == nil {
+		l := types.NewNullLogger()
+		logger = &l
+	}
+	log := logger.Logger.With().Str("dir", dir).Str("label", label).Str("output", output).Logger()
+
+	if label == "" || len(label) > maxLabelLength {
+		return fmt.Errorf("invalid label %q, it must be between 1 and %d characters", label, maxLabelLength)
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("error checking on %s: %s", dir, err.Error())
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if opts.EFIImage == "" {
+		opts.EFIImage = DefaultEFIImage
+	}
+	if opts.BootCatalog == "" {
+		opts.BootCatalog = DefaultBootCatalog
+	}
+	if len(opts.MBR) > mbrSize {
+		return fmt.Errorf("mbr boot code is %d bytes, it can't be bigger than %d", len(opts.MBR), mbrSize)
+	}
+
+	// The ISO is built from a workspace which go-diskfs removes when done, so
+	// the tree is linked (or copied) into a temporary one.
+	workspace, err := os.MkdirTemp(filepath.Dir(output), ".iso-workspace")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workspace)
+
+	log.Debug().Str("workspace", workspace).Msg("Preparing workspace")
+	if err := linkTree(dir, workspace); err != nil {
+		log.Error().Err(err).Msg("preparing workspace")
+		return err
+	}
+
+	et := &iso9660.ElTorito{
+		BootCatalog: "/" + strings.TrimPrefix(opts.BootCatalog, "/"),
+		Platform:    iso9660.BIOS,
+	}
+	if opts.BIOSBootImage != "" {
+		if _, err := os.Stat(filepath.Join(dir, opts.BIOSBootImage)); err != nil {
+			return fmt.Errorf("bios boot image: %w", err)
+		}
+		et.Entries = append(et.Entries, &iso9660.ElToritoEntry{
+			Platform:  iso9660.BIOS,
+			Emulation: iso9660.NoEmulation,
+			BootFile:  "/" + strings.TrimPrefix(opts.BIOSBootImage, "/"),
+			BootTable: true,
+			LoadSize:  4,
+		})
+	}
+	var efiSize int64
+	if opts.EFIDir != "" {
+		log.Debug().Str("efi", opts.EFIDir).Msg("Creating EFI image")
+		efiSize, err = createEFIImage(filepath.Join(dir, opts.EFIDir), filepath.Join(workspace, opts.EFIImage))
+		if err != nil {
+			log.Error().Err(err).Msg("creating EFI image")
+			return err
+		}
+		if len(et.Entries) == 0 {
+			et.Platform = iso9660.EFI
+		}
+		et.Entries = append(et.Entries, &iso9660.ElToritoEntry{
+			Platform:  iso9660.EFI,
+			Emulation: iso9660.NoEmulation,
+			BootFile:  "/" + strings.TrimPrefix(opts.EFIImage, "/"),
+			LoadSize:  loadSize(efiSize),
+		})
+	}
+
+	f, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	isoFS, err := iso9660.Create(f, 0, 0, isoBlockSize, workspace)
+	if err != nil {
+		return err
+	}
+	finalize := iso9660.FinalizeOptions{
+		RockRidge:       true,
+		DeepDirectories: true,
+		// go-diskfs pads the identifier with NULs, but it's an a-characters
+		// field which has to be padded with spaces
+		VolumeIdentifier: label + strings.Repeat(" ", maxLabelLength-len(label)),
+	}
+	if len(et.Entries) > 0 {
+		finalize.ElTorito = et
+	}
+	log.Debug().Msg("Writing ISO")
+	if err := isoFS.Finalize(finalize); err != nil {
+		log.Error().Err(err).Msg("finalizing ISO")
+		return err
+	}
+
+	blocks, err := volumeBlocks(f)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(blocks) * isoBlockSize); err != nil {
+		return err
+	}
+
+	if len(et.Entries) == 0 {
+		log.Debug().Msg("ISO created without boot entries")
+		return nil
+	}
+
+	// the location of each boot image is taken from its own directory
+	// record, the catalog entries and boot tables are rewritten with it
+	locations := map[string]uint32{}
+	for i, e := range et.Entries {
+		location, err := fileLocation(f, e.BootFile)
+		if err != nil {
+			return err
+		}
+		if err := patchBootEntry(f, i, e.BootTable, location); err != nil {
+			return err
+		}
+		locations[e.BootFile] = location
+	}
+	mbr := hybridMBR{boot: opts.MBR, blocks: blocks}
+	if opts.BIOSBootImage != "" {
+		mbr.biosImage = locations["/"+strings.TrimPrefix(opts.BIOSBootImage, "/")]
+	}
+	if opts.EFIDir != "" {
+		mbr.efiImage = locations["/"+strings.TrimPrefix(opts.EFIImage, "/")]
+		mbr.efiSize = efiSize
+	}
+	b, err := mbr.toBytes()
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return err
+	}
+
+	log.Debug().Msg("ISO created")
+	return nil
+}
+
+// linkTree recreates src into dst hard linking the files.
+func linkTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			// go-diskfs can't write symlinks, so links to files are stored as
+			// copies of their targets
+			resolved, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return fmt.Errorf("resolving symlink %s: %w", p, err)
+			}
+			if info, err = os.Stat(resolved); err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				return linkOrCopy(resolved, target, info.Mode().Perm())
+			}
+		case info.Mode().IsRegular():
+			return linkOrCopy(p, target, info.Mode().Perm())
+		}
+
+		// devices, sockets, pipes and links to directories are not stored in
+		// the ISO
+		return nil
+	})
+}
+
+// linkOrCopy hard links src to dst, or copies it if they are on different
+// filesystems.
+func linkOrCopy(src, dst string, mode os.FileMode) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// createEFIImage creates a FAT32 image at output with the contents of src
+// under /EFI. It returns the size of the image.
+func createEFIImage(src, output string) (int64, error) {
+	var contents int64
+	err := filepath.WalkDir(src, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// every file and directory takes at least a cluster
+		contents += info.Size() + 4096
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", src, err)
+	}
+
+	size := contents + contents/5 + 1024*1024
+	if size < efiImageMinSize {
+		size = efiImageMinSize
+	}
+	size = (size + isoBlockSize - 1) / isoBlockSize * isoBlockSize
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	fat, err := fat32.Create(f, size, 0, 512, "EFIBOOT")
+	if err != nil {
+		return 0, err
+	}
+
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join("/EFI", filepath.ToSlash(rel))
+		if d.IsDir() {
+			return fat.Mkdir(target)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rw, err := fat.OpenFile(target, os.O_CREATE|os.O_RDWR)
+		if err != nil {
+			return fmt.Errorf("creating %s in the EFI image: %w", target, err)
+		}
+		_, err = rw.Write(content)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// loadSize returns the number of 512 bytes sectors loaded from an El Torito
+// boot image. It doesn't fit in the boot catalog for big EFI images, firmwares
+// read those as a FAT filesystem anyway.
+func loadSize(size int64) uint16 {
+	sectors := size / 512
+	if sectors > 0xffff {
+		return 0xffff
+	}
+	return uint16(sectors)
+}
+
+// volumeBlocks returns the size of the ISO in blocks, as written in the
+// primary volume descriptor.
+func volumeBlocks(f *os.File) (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := f.ReadAt(b, 16*isoBlockSize+80); err != nil {
+		return 0, fmt.Errorf("reading the primary volume descriptor: %w", err)
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// fileLocation returns the block where the file at p starts, walking the
+// directory records from the root one in the primary volume descriptor. Names
+// are matched against the Rock Ridge name if there is one, and against the
+// ISO 9660 name without the version otherwise.
+func fileLocation(f *os.File, p string) (uint32, error) {
+	record := make([]byte, 34)
+	if _, err := f.ReadAt(record, 16*isoBlockSize+156); err != nil {
+		return 0, fmt.Errorf("reading the primary volume descriptor: %w", err)
+	}
+	location := binary.LittleEndian.Uint32(record[2:6])
+	size := binary.LittleEndian.Uint32(record[10:14])
+
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		dir := make([]byte, size)
+		if _, err := f.ReadAt(dir, int64(location)*isoBlockSize); err != nil {
+			return 0, fmt.Errorf("reading directory records for %s: %w", p, err)
+		}
+		found := false
+		for off := 0; off < len(dir); {
+			length := int(dir[off])
+			if length == 0 {
+				// records don't cross block boundaries, the rest of the
+				// block is padding
+				off = (off/isoBlockSize + 1) * isoBlockSize
+				continue
+			}
+			if off+length > len(dir) || length < 34 {
+				return 0, fmt.Errorf("invalid directory record looking up %s", p)
+			}
+			if recordName(dir[off:off+length]) == name {
+				location = binary.LittleEndian.Uint32(dir[off+2 : off+6])
+				size = binary.LittleEndian.Uint32(dir[off+10 : off+14])
+				found = true
+				break
+			}
+			off += length
+		}
+		if !found {
+			return 0, fmt.Errorf("%s not found in the ISO", p)
+		}
+	}
+
+	return location, nil
+}
+
+// recordName returns the name of a directory record, which is empty for the
+// current and parent directory ones.
+func recordName(record []byte) string {
+	nameLength := int(record[32])
+	if 33+nameLength > len(record) {
+		return ""
+	}
+	name := string(record[33 : 33+nameLength])
+	if name == "\x00" || name == "\x01" {
+		return ""
+	}
+
+	// the system use area follows the name, padded to an even offset
+	su := 33 + nameLength
+	if nameLength%2 == 0 {
+		su++
+	}
+	for su+4 <= len(record) {
+		length := int(record[su+2])
+		if length < 4 || su+length > len(record) {
+			break
+		}
+		if string(record[su:su+2]) == "NM" && length > 5 {
+			return string(record[su+5 : su+length])
+		}
+		su += length
+	}
+
+	name, _, _ = strings.Cut(name, ";")
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// patchBootEntry writes the location of the boot image into the i-th entry of
+// the El Torito catalog and, if it has one, into its boot table.
+func patchBootEntry(f *os.File, i int, bootTable bool, location uint32) error {
+	b := make([]byte, 4)
+	// the boot record volume descriptor follows the primary one
+	if _, err := f.ReadAt(b, 17*isoBlockSize+0x47); err != nil {
+		return fmt.Errorf("reading the boot record: %w", err)
+	}
+	catalog := int64(binary.LittleEndian.Uint32(b)) * isoBlockSize
+
+	binary.LittleEndian.PutUint32(b, location)
+	// validation entry, then the default entry and a section header
+	// followed by its entry for each of the others
+	if _, err := f.WriteAt(b, catalog+32+int64(64*i)+8); err != nil {
+		return fmt.Errorf("writing the boot catalog: %w", err)
+	}
+	if bootTable {
+		// the boot table starts at byte 8 of the image, after the location
+		// of the primary volume descriptor
+		if _, err := f.WriteAt(b, int64(location)*isoBlockSize+12); err != nil {
+			return fmt.Errorf("writing the boot table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// hybridMBR is the MBR written in the system area of the ISO, so it can be
+// used as a disk image. The first partition covers the whole image and the
+// second one the EFI image, so firmwares find the EFI system partition.
+type hybridMBR struct {
+	boot      []byte
+	blocks    uint32
+	biosImage uint32
+	efiImage  uint32
+	efiSize   int64
+}
+
+func (m hybridMBR) toBytes() ([]byte, error) {
+	if m.blocks == 0 {
+		return nil, errors.New("empty iso")
+	}
+	b := make([]byte, mbrSize)
+	copy(b[:440], m.boot)
+	if len(m.boot) > 0 && m.biosImage != 0 {
+		// GRUB's boot_hybrid.img loads the BIOS boot image from here, in
+		// 512 bytes sectors skipping the first one
+		binary.LittleEndian.PutUint64(b[0x1b0:0x1b8], uint64(m.biosImage)*4+4)
+	}
+	if _, err := rand.Read(b[440:444]); err != nil {
+		return nil, err
+	}
+
+	writePartition(b[446:462], 0x80, 0x17, 0, m.blocks*4)
+	if m.efiSize > 0 {
+		writePartition(b[462:478], 0x00, 0xef, m.efiImage*4, uint32(m.efiSize/512))
+	}
+	b[510] = 0x55
+	b[511] = 0xaa
+
+	return b, nil
+}
+
+// writePartition writes an MBR partition entry using LBA addressing only.
+func writePartition(b []byte, status, partitionType byte, start, sectors uint32) {
+	b[0] = status
+	copy(b[1:4], []byte{0xfe, 0xff, 0xff})
+	b[4] = partitionType
+	copy(b[5:8], []byte{0xfe, 0xff, 0xff})
+	binary.LittleEndian.PutUint32(b[8:12], start)
+	binary.LittleEndian.PutUint32(b[12:16], sectors)
+}
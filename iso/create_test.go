@@ -0,0 +1,151 @@
+package iso_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/iso"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const blockSize = 2048
+
+// bootEntry is an entry of the El Torito boot catalog
+type bootEntry struct {
+	platform byte
+	sectors  uint16
+	location uint32
+}
+
+// bootCatalog parses the El Torito boot catalog pointed to by the boot record
+// volume descriptor.
+func bootCatalog(image []byte) []bootEntry {
+	brvd := image[17*blockSize : 18*blockSize]
+	ExpectWithOffset(1, brvd[0]).To(Equal(byte(0)))
+	ExpectWithOffset(1, string(brvd[1:6])).To(Equal("CD001"))
+	ExpectWithOffset(1, string(bytes.TrimRight(brvd[7:39], "\x00"))).To(Equal("EL TORITO SPECIFICATION"))
+
+	catalog := image[int(binary.LittleEndian.Uint32(brvd[0x47:0x4b]))*blockSize:]
+	ExpectWithOffset(1, catalog[0]).To(Equal(byte(1)))
+	ExpectWithOffset(1, catalog[0x1e:0x20]).To(Equal([]byte{0x55, 0xaa}))
+
+	entries := []bootEntry{}
+	platform := catalog[1]
+	for off := 32; ; off += 32 {
+		switch catalog[off] {
+		case 0x88:
+			entries = append(entries, bootEntry{
+				platform: platform,
+				sectors:  binary.LittleEndian.Uint16(catalog[off+6 : off+8]),
+				location: binary.LittleEndian.Uint32(catalog[off+8 : off+12]),
+			})
+		case 0x90, 0x91:
+			platform = catalog[off+1]
+		default:
+			return entries
+		}
+	}
+}
+
+var _ = Describe("CreateISO", func() {
+	var dir, output string
+	var bios, efi []byte
+
+	BeforeEach(func() {
+		tmp := GinkgoT().TempDir()
+		dir = filepath.Join(tmp, "root")
+		output = filepath.Join(tmp, "kairos.iso")
+
+		bios = bytes.Repeat([]byte("eltorito"), 1024)
+		efi = []byte("bootx64")
+		Expect(os.MkdirAll(filepath.Join(dir, "boot", "grub2", "i386-pc"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "EFI", "BOOT"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "boot", "grub2", "i386-pc", "eltorito.img"), bios, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "EFI", "BOOT", "bootx64.efi"), efi, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "boot", "kernel"), []byte("kernel"), 0644)).To(Succeed())
+	})
+
+	It("space pads the volume identifier", func() {
+		Expect(iso.CreateISO(dir, "KAIROS", output, iso.CreateISOOptions{})).To(Succeed())
+
+		image, err := os.ReadFile(output)
+		Expect(err).ToNot(HaveOccurred())
+		pvd := image[16*blockSize : 17*blockSize]
+		Expect(pvd[0]).To(Equal(byte(1)))
+		Expect(string(pvd[1:6])).To(Equal("CD001"))
+		Expect(string(pvd[40:72])).To(Equal("KAIROS                          "))
+		Expect(len(image) % blockSize).To(Equal(0))
+		Expect(binary.LittleEndian.Uint32(pvd[80:84])).To(BeEquivalentTo(len(image) / blockSize))
+	})
+
+	It("rejects invalid labels", func() {
+		Expect(iso.CreateISO(dir, "", output, iso.CreateISOOptions{})).ToNot(Succeed())
+		Expect(iso.CreateISO(dir, string(bytes.Repeat([]byte("K"), 33)), output, iso.CreateISOOptions{})).ToNot(Succeed())
+	})
+
+	It("points each boot entry and the MBR to its own image", func() {
+		mbr := bytes.Repeat([]byte{0xfa}, 440)
+		err := iso.CreateISO(dir, "KAIROS", output, iso.CreateISOOptions{
+			BIOSBootImage: "boot/grub2/i386-pc/eltorito.img",
+			EFIDir:        "EFI",
+			MBR:           mbr,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		image, err := os.ReadFile(output)
+		Expect(err).ToNot(HaveOccurred())
+
+		entries := bootCatalog(image)
+		Expect(entries).To(HaveLen(2))
+
+		// BIOS entry, the boot table is written over bytes 8 to 64
+		Expect(entries[0].platform).To(Equal(byte(0)))
+		Expect(entries[0].sectors).To(BeEquivalentTo(4))
+		biosImage := image[int(entries[0].location)*blockSize:]
+		Expect(biosImage[:8]).To(Equal(bios[:8]))
+		Expect(biosImage[64:len(bios)]).To(Equal(bios[64:]))
+		Expect(binary.LittleEndian.Uint32(biosImage[8:12])).To(BeEquivalentTo(16))
+		Expect(binary.LittleEndian.Uint32(biosImage[12:16])).To(Equal(entries[0].location))
+		Expect(binary.LittleEndian.Uint32(biosImage[16:20])).To(BeEquivalentTo(len(bios)))
+
+		// EFI entry, a FAT32 image
+		Expect(entries[1].platform).To(Equal(byte(0xef)))
+		esp := image[462:478]
+		efiStart := int(entries[1].location) * blockSize
+		efiImage := image[efiStart : efiStart+int(binary.LittleEndian.Uint32(esp[12:16]))*512]
+		Expect(efiImage[510:512]).To(Equal([]byte{0x55, 0xaa}))
+		Expect(string(efiImage[82:90])).To(Equal("FAT32   "))
+		Expect(bytes.Contains(efiImage, efi)).To(BeTrue())
+
+		// MBR, with the location of the BIOS image patched in the boot code
+		Expect(image[:0x1b0]).To(Equal(mbr[:0x1b0]))
+		Expect(image[0x1b8:440]).To(Equal(mbr[0x1b8:]))
+		Expect(binary.LittleEndian.Uint64(image[0x1b0:0x1b8])).To(BeEquivalentTo(uint64(entries[0].location)*4 + 4))
+		Expect(image[510:512]).To(Equal([]byte{0x55, 0xaa}))
+		whole := image[446:462]
+		Expect(whole[0]).To(Equal(byte(0x80)))
+		Expect(whole[4]).To(Equal(byte(0x17)))
+		Expect(binary.LittleEndian.Uint32(whole[8:12])).To(BeEquivalentTo(0))
+		Expect(binary.LittleEndian.Uint32(whole[12:16])).To(BeEquivalentTo(len(image) / 512))
+		Expect(esp[4]).To(Equal(byte(0xef)))
+		Expect(binary.LittleEndian.Uint32(esp[8:12])).To(Equal(entries[1].location * 4))
+		Expect(len(efiImage)).To(BeNumerically(">=", 40*1024*1024))
+	})
+
+	It("only adds the EFI entry without a BIOS boot image", func() {
+		Expect(iso.CreateISO(dir, "KAIROS", output, iso.CreateISOOptions{EFIDir: "EFI"})).To(Succeed())
+
+		image, err := os.ReadFile(output)
+		Expect(err).ToNot(HaveOccurred())
+		entries := bootCatalog(image)
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].platform).To(Equal(byte(0xef)))
+		Expect(string(image[int(entries[0].location)*blockSize+82:][:8])).To(Equal("FAT32   "))
+
+		Expect(binary.LittleEndian.Uint64(image[0x1b0:0x1b8])).To(BeEquivalentTo(0))
+		Expect(binary.LittleEndian.Uint32(image[462+8 : 462+12])).To(Equal(entries[0].location * 4))
+	})
+})
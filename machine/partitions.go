@@ -1,10 +1,12 @@
 package machine
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 
+	"github.com/kairos-io/kairos-sdk/ghw"
+	"github.com/kairos-io/kairos-sdk/types"
 	"github.com/kairos-io/kairos-sdk/utils"
 )
 
@@ -25,13 +27,34 @@ func Remount(opt, path string) error {
 }
 
 func Mount(label, mountpoint string) error {
-	part, _ := utils.SH(fmt.Sprintf("blkid -L %s", label))
-	if part == "" {
+	return mount(label, mountpoint, false)
+}
+
+// MountWithUdevRefresh is like Mount, but if the label is not found it
+// refreshes the udev database and looks again. It's meant for filesystems
+// that were just created.
+func MountWithUdevRefresh(label, mountpoint string) error {
+	return mount(label, mountpoint, true)
+}
+
+func mount(label, mountpoint string, refresh bool) error {
+	logger := types.NewNullLogger()
+	sel := ghw.Selector{Label: label}
+	if refresh {
+		sel.Retries = 1
+	}
+	partition, err := ghw.FindPartition(ghw.NewPaths(""), sel, &logger)
+	// Like blkid -L, use the first partition when several share the label,
+	// e.g. the install media and the target disk
+	var ambiguous *ghw.AmbiguousError
+	if errors.As(err, &ambiguous) {
+		partition, err = ambiguous.Partitions[0], nil
+	}
+	if err != nil {
 		fmt.Printf("%s partition not found\n", label)
-		return fmt.Errorf("partition not found")
+		return fmt.Errorf("partition not found: %w", err)
 	}
-
-	part = strings.TrimSuffix(part, "\n")
+	part := partition.Path
 
 	if !utils.Exists(mountpoint) {
 		err := os.MkdirAll(mountpoint, 0755)
@@ -0,0 +1,59 @@
+package machine_test
+
+import (
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/ghw"
+	"github.com/kairos-io/kairos-sdk/ghw/mocks"
+	"github.com/kairos-io/kairos-sdk/machine"
+	"github.com/kairos-io/kairos-sdk/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mount", func() {
+	var refreshes int
+	var mountpoint string
+
+	BeforeEach(func() {
+		mock, err := mocks.NewGhwMock().
+			// Fake device names, so nothing real gets mounted
+			WithDisk(types.Disk{Name: "kairosmock", Partitions: types.PartitionList{
+				{Name: "kairosmock1", FilesystemLabel: "COS_OEM"},
+				{Name: "kairosmock2", FilesystemLabel: "COS_OEM"},
+			}}).
+			WithCleanup(GinkgoT()).
+			Build()
+		Expect(err).ToNot(HaveOccurred())
+		GinkgoT().Setenv("GHW_CHROOT", mock.Chroot)
+		mountpoint = filepath.Join(GinkgoT().TempDir(), "mnt")
+
+		refreshes = 0
+		original := ghw.UdevRefresh
+		ghw.UdevRefresh = func() error {
+			refreshes++
+			return nil
+		}
+		DeferCleanup(func() { ghw.UdevRefresh = original })
+	})
+
+	It("doesn't refresh udev when the label is missing", func() {
+		Expect(machine.Mount("COS_PERSISTENT", mountpoint)).To(MatchError(ContainSubstring("partition not found")))
+		Expect(refreshes).To(BeZero())
+		Expect(mountpoint).ToNot(BeADirectory())
+	})
+
+	It("uses the first partition when several share the label, like blkid -L", func() {
+		// The label is found, so it gets to create the mountpoint and only
+		// fails mounting the fake device
+		err := machine.Mount("COS_OEM", mountpoint)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("partition not found"))
+		Expect(mountpoint).To(BeADirectory())
+	})
+
+	It("refreshes udev when asked to", func() {
+		Expect(machine.MountWithUdevRefresh("COS_PERSISTENT", mountpoint)).To(MatchError(ContainSubstring("partition not found")))
+		Expect(refreshes).To(Equal(1))
+	})
+})
@@ -0,0 +1,142 @@
+package machine
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"github.com/kairos-io/kairos-sdk/utils"
+)
+
+// WatchdogDevice is the hardware watchdog armed by WithWatchdog.
+const WatchdogDevice = "/dev/watchdog"
+
+const (
+	powerReboot   = "reboot"
+	powerPoweroff = "poweroff"
+)
+
+type powerAction struct {
+	logger   *types.KairosLogger
+	root     string
+	watchdog time.Duration
+	shell    func(stdin, command string) (string, error)
+}
+
+// PowerOpts configures Reboot and Poweroff.
+type PowerOpts func(*powerAction) error
+
+// WithPowerLogger sets the logger used to report the power action.
+func WithPowerLogger(l *types.KairosLogger) PowerOpts {
+	return func(p *powerAction) error {
+		p.logger = l
+		return nil
+	}
+}
+
+// WithWatchdog arms the hardware watchdog with the given timeout right before
+// rebooting or powering off, so the machine is reset if the shutdown hangs.
+func WithWatchdog(timeout time.Duration) PowerOpts {
+	return func(p *powerAction) error {
+		if timeout < time.Second {
+			return fmt.Errorf("watchdog timeout must be at least 1s, got %s", timeout)
+		}
+		p.watchdog = timeout
+		return nil
+	}
+}
+
+// WithPowerRoot sets the root directory used to detect the init system and
+// to find the watchdog device (for testing reasons).
+func WithPowerRoot(root string) PowerOpts {
+	return func(p *powerAction) error {
+		p.root = root
+		return nil
+	}
+}
+
+// WithPowerShell replaces the function used to run the commands, which
+// defaults to utils.ShellSTDIN (for testing reasons).
+func WithPowerShell(f func(stdin, command string) (string, error)) PowerOpts {
+	return func(p *powerAction) error {
+		p.shell = f
+		return nil
+	}
+}
+
+// Reboot reboots the machine after the given delay, blocking until then.
+// Logged-in users are notified with wall, including the reason. The command
+// used depends on the init system: systemctl on systemd, openrc-shutdown on
+// OpenRC and reboot otherwise.
+func Reboot(delay time.Duration, reason string, opts ...PowerOpts) error {
+	return power(powerReboot, delay, reason, opts...)
+}
+
+// Poweroff powers the machine off after the given delay, blocking until then.
+// It behaves like Reboot.
+func Poweroff(delay time.Duration, reason string, opts ...PowerOpts) error {
+	return power(powerPoweroff, delay, reason, opts...)
+}
+
+func power(action string, delay time.Duration, reason string, opts ...PowerOpts) error {
+	p := &powerAction{
+		root:  "/",
+		shell: utils.ShellSTDIN,
+	}
+	for _, o := range opts {
+		if err := o(p); err != nil {
+			return err
+		}
+	}
+	if p.logger == nil {
+		l := types.NewKairosLogger("machine", "info", false)
+		p.logger = &l
+	}
+
+	msg := fmt.Sprintf("The system is going down for %s", action)
+	if delay > 0 {
+		msg += fmt.Sprintf(" in %s", delay)
+	}
+	if reason != "" {
+		msg += ": " + reason
+	}
+
+	p.logger.Logger.Info().Str("action", action).Dur("delay", delay).Str("reason", reason).Msg(msg)
+	if out, err := p.shell(msg+"\n", "wall"); err != nil {
+		p.logger.Logger.Warn().Err(err).Str("output", out).Msg("failed to notify logged-in users")
+	}
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if p.watchdog > 0 {
+		if err := armWatchdog(filepath.Join(p.root, WatchdogDevice), p.watchdog); err != nil {
+			p.logger.Logger.Warn().Err(err).Msg("failed to arm the hardware watchdog")
+		} else {
+			p.logger.Logger.Info().Dur("timeout", p.watchdog).Msg("hardware watchdog armed")
+		}
+	}
+
+	cmd := powerCommand(action, detectInit(p.root))
+	if out, err := p.shell("", cmd); err != nil {
+		return fmt.Errorf("running %q: %w: %s", cmd, err, out)
+	}
+
+	return nil
+}
+
+func powerCommand(action, init string) string {
+	switch init {
+	case InitSystemd:
+		return fmt.Sprintf("systemctl %s", action)
+	case InitOpenRC:
+		if action == powerReboot {
+			return "openrc-shutdown -r now"
+		}
+		return "openrc-shutdown -p now"
+	}
+
+	return action
+}
@@ -0,0 +1,93 @@
+package machine_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/kairos-io/kairos-sdk/machine"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reboot and Poweroff", func() {
+	var root string
+	var commands []string
+	var stdins []string
+	var failOn string
+
+	shell := func(stdin, command string) (string, error) {
+		commands = append(commands, command)
+		stdins = append(stdins, stdin)
+		if command == failOn {
+			return "boom", errors.New("failed")
+		}
+		return "", nil
+	}
+
+	mkdir := func(path string) {
+		Expect(os.MkdirAll(filepath.Join(root, path), os.ModePerm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = os.MkdirTemp("", "power")
+		Expect(err).ToNot(HaveOccurred())
+		commands = []string{}
+		stdins = []string{}
+		failOn = ""
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("notifies the users and reboots with systemctl on systemd", func() {
+		mkdir("/run/systemd/system")
+		Expect(Reboot(0, "upgrade", WithPowerRoot(root), WithPowerShell(shell))).To(Succeed())
+		Expect(commands).To(Equal([]string{"wall", "systemctl reboot"}))
+		Expect(stdins[0]).To(Equal("The system is going down for reboot: upgrade\n"))
+	})
+
+	It("uses openrc-shutdown on OpenRC", func() {
+		mkdir("/sbin/openrc")
+		Expect(Poweroff(0, "", WithPowerRoot(root), WithPowerShell(shell))).To(Succeed())
+		Expect(commands).To(Equal([]string{"wall", "openrc-shutdown -p now"}))
+	})
+
+	It("falls back to the plain commands and waits for the delay", func() {
+		start := time.Now()
+		Expect(Poweroff(50*time.Millisecond, "reset", WithPowerRoot(root), WithPowerShell(shell))).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(commands).To(Equal([]string{"wall", "poweroff"}))
+		Expect(stdins[0]).To(Equal("The system is going down for poweroff in 50ms: reset\n"))
+	})
+
+	It("carries on when wall fails and reports command failures", func() {
+		failOn = "wall"
+		Expect(Reboot(0, "", WithPowerRoot(root), WithPowerShell(shell))).To(Succeed())
+
+		failOn = "reboot"
+		err := Reboot(0, "", WithPowerRoot(root), WithPowerShell(shell))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("boom"))
+	})
+
+	It("feeds the watchdog before rebooting", func() {
+		mkdir("/dev")
+		device := filepath.Join(root, WatchdogDevice)
+		Expect(os.WriteFile(device, []byte{}, 0600)).To(Succeed())
+
+		Expect(Reboot(0, "", WithPowerRoot(root), WithPowerShell(shell), WithWatchdog(30*time.Second))).To(Succeed())
+		content, err := os.ReadFile(device)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal([]byte{0}))
+		Expect(commands).To(ContainElement("reboot"))
+	})
+
+	It("rejects too short watchdog timeouts", func() {
+		Expect(Reboot(0, "", WithPowerShell(shell), WithWatchdog(time.Millisecond))).ToNot(Succeed())
+		Expect(commands).To(BeEmpty())
+	})
+})
@@ -0,0 +1,233 @@
+package machine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	InitSystemd = "systemd"
+	InitOpenRC  = "openrc"
+	InitS6      = "s6"
+	InitUnknown = "unknown"
+
+	SELinuxEnforcing  = "enforcing"
+	SELinuxPermissive = "permissive"
+	SELinuxDisabled   = "disabled"
+)
+
+// KairosKernelModules are the kernel features Kairos relies on: dm_crypt for
+// encrypted partitions, overlay for the rootfs overlay and squashfs for the
+// recovery and passive images.
+var KairosKernelModules = []string{"dm_crypt", "overlay", "squashfs"}
+
+// KernelModule reports the state of a kernel module on the running system.
+type KernelModule struct {
+	Name string `json:"name" yaml:"name"`
+	// Loaded is true when the module is loaded or built into the kernel
+	Loaded bool `json:"loaded" yaml:"loaded"`
+	// Builtin is true when the module is built into the kernel
+	Builtin bool `json:"builtin" yaml:"builtin"`
+	// Available is true when the module can be loaded from /lib/modules
+	Available bool `json:"available" yaml:"available"`
+}
+
+// SystemInformation holds details about the running system that are useful
+// for preflight checks and bug reports.
+type SystemInformation struct {
+	Init          string         `json:"init" yaml:"init"`
+	CgroupVersion string         `json:"cgroup_version" yaml:"cgroup_version"` // v1, v2 or hybrid
+	SELinux       string         `json:"selinux" yaml:"selinux"`
+	AppArmor      bool           `json:"apparmor" yaml:"apparmor"`
+	KernelVersion string         `json:"kernel_version" yaml:"kernel_version"`
+	KernelModules []KernelModule `json:"kernel_modules" yaml:"kernel_modules"`
+}
+
+// String returns a human readable summary to be included in bug reports.
+func (s SystemInformation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "init: %s\n", s.Init)
+	fmt.Fprintf(&b, "cgroup: %s\n", s.CgroupVersion)
+	fmt.Fprintf(&b, "selinux: %s\n", s.SELinux)
+	fmt.Fprintf(&b, "apparmor: %t\n", s.AppArmor)
+	fmt.Fprintf(&b, "kernel: %s\n", s.KernelVersion)
+	for _, m := range s.KernelModules {
+		fmt.Fprintf(&b, "module %s: loaded=%t builtin=%t available=%t\n", m.Name, m.Loaded, m.Builtin, m.Available)
+	}
+
+	return b.String()
+}
+
+// MissingModules returns the names of the modules that are neither loaded nor
+// available to be loaded.
+func (s SystemInformation) MissingModules() []string {
+	missing := []string{}
+	for _, m := range s.KernelModules {
+		if !m.Loaded && !m.Available {
+			missing = append(missing, m.Name)
+		}
+	}
+
+	return missing
+}
+
+// SystemInfo collects information about the init system, cgroups, security
+// modules and the kernel features needed by Kairos. The function optionally
+// takes a root directory to read the information from (for testing reasons).
+func SystemInfo(root ...string) SystemInformation {
+	r := "/"
+	if len(root) > 0 && root[0] != "" {
+		r = root[0]
+	}
+
+	info := SystemInformation{
+		Init:          detectInit(r),
+		CgroupVersion: detectCgroupVersion(r),
+		SELinux:       detectSELinux(r),
+		AppArmor:      strings.TrimSpace(readFile(r, "/sys/module/apparmor/parameters/enabled")) == "Y",
+		KernelVersion: strings.TrimSpace(readFile(r, "/proc/sys/kernel/osrelease")),
+	}
+
+	for _, m := range KairosKernelModules {
+		info.KernelModules = append(info.KernelModules, detectKernelModule(r, info.KernelVersion, m))
+	}
+
+	return info
+}
+
+func detectInit(root string) string {
+	checks := []struct {
+		init  string
+		files []string
+	}{
+		{InitSystemd, []string{"/run/systemd/system", "/sbin/systemctl", "/usr/bin/systemctl", "/usr/sbin/systemctl"}},
+		{InitOpenRC, []string{"/sbin/openrc", "/usr/sbin/openrc", "/bin/openrc", "/usr/bin/openrc"}},
+		{InitS6, []string{"/run/s6", "/etc/s6-overlay", "/command/s6-svscan", "/bin/s6-svscan", "/usr/bin/s6-svscan"}},
+	}
+
+	for _, c := range checks {
+		for _, f := range c.files {
+			if exists(root, f) {
+				return c.init
+			}
+		}
+	}
+
+	return InitUnknown
+}
+
+func detectCgroupVersion(root string) string {
+	switch {
+	case exists(root, "/sys/fs/cgroup/cgroup.controllers"):
+		return "v2"
+	case exists(root, "/sys/fs/cgroup/unified/cgroup.controllers"):
+		return "hybrid"
+	case exists(root, "/sys/fs/cgroup"):
+		return "v1"
+	}
+
+	return "unknown"
+}
+
+func detectSELinux(root string) string {
+	switch strings.TrimSpace(readFile(root, "/sys/fs/selinux/enforce")) {
+	case "1":
+		return SELinuxEnforcing
+	case "0":
+		return SELinuxPermissive
+	}
+
+	return SELinuxDisabled
+}
+
+func detectKernelModule(root, kernelVersion, name string) KernelModule {
+	m := KernelModule{Name: name}
+
+	// Modules show up in /sys/module when loaded, and also when they are
+	// built-in and have parameters. Filesystems are listed in /proc/filesystems
+	// no matter how they were loaded.
+	if exists(root, filepath.Join("/sys/module", name)) || hasLine(root, "/proc/modules", name+" ") {
+		m.Loaded = true
+	}
+	if hasFilesystem(root, name) {
+		m.Loaded = true
+	}
+
+	if kernelVersion == "" {
+		return m
+	}
+
+	modulesDir := filepath.Join("/lib/modules", kernelVersion)
+	// module names use either "-" or "_" in the file names
+	fileNames := []string{
+		fmt.Sprintf("/%s.ko", name),
+		fmt.Sprintf("/%s.ko", strings.ReplaceAll(name, "_", "-")),
+	}
+	for _, f := range fileNames {
+		if hasSubstring(root, filepath.Join(modulesDir, "modules.builtin"), f) {
+			m.Builtin = true
+			m.Loaded = true
+		}
+		if hasSubstring(root, filepath.Join(modulesDir, "modules.dep"), f) {
+			m.Available = true
+		}
+	}
+
+	return m
+}
+
+func exists(root, path string) bool {
+	_, err := os.Stat(filepath.Join(root, path))
+	return err == nil
+}
+
+func readFile(root, path string) string {
+	b, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+// hasLine checks if any line in the file starts with the given prefix.
+func hasLine(root, path, prefix string) bool {
+	return scanLines(root, path, func(line string) bool {
+		return strings.HasPrefix(line, prefix)
+	})
+}
+
+// hasFilesystem checks if the filesystem is listed in /proc/filesystems.
+// Lines look like "nodev	overlay" or "	squashfs".
+func hasFilesystem(root, name string) bool {
+	return scanLines(root, "/proc/filesystems", func(line string) bool {
+		fields := strings.Fields(line)
+		return len(fields) > 0 && fields[len(fields)-1] == name
+	})
+}
+
+func hasSubstring(root, path, s string) bool {
+	return scanLines(root, path, func(line string) bool {
+		return strings.Contains(line, s)
+	})
+}
+
+func scanLines(root, path string, match func(line string) bool) bool {
+	f, err := os.Open(filepath.Join(root, path))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if match(scanner.Text()) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package machine_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/kairos-io/kairos-sdk/machine"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SystemInfo", func() {
+	var root string
+
+	writeFile := func(path, content string) {
+		full := filepath.Join(root, path)
+		Expect(os.MkdirAll(filepath.Dir(full), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(full, []byte(content), os.ModePerm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = os.MkdirTemp("", "sysinfo")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("reports unknown values on an empty root", func() {
+		info := SystemInfo(root)
+		Expect(info.Init).To(Equal(InitUnknown))
+		Expect(info.CgroupVersion).To(Equal("unknown"))
+		Expect(info.SELinux).To(Equal(SELinuxDisabled))
+		Expect(info.AppArmor).To(BeFalse())
+		Expect(info.MissingModules()).To(Equal(KairosKernelModules))
+	})
+
+	It("detects the system details", func() {
+		Expect(os.MkdirAll(filepath.Join(root, "run/systemd/system"), os.ModePerm)).To(Succeed())
+		writeFile("sys/fs/cgroup/cgroup.controllers", "cpu memory")
+		writeFile("sys/fs/selinux/enforce", "0")
+		writeFile("sys/module/apparmor/parameters/enabled", "Y\n")
+		writeFile("proc/sys/kernel/osrelease", "6.4.0-kairos\n")
+		writeFile("proc/filesystems", "nodev\toverlay\n\text4\n")
+		writeFile("lib/modules/6.4.0-kairos/modules.builtin", "kernel/fs/squashfs/squashfs.ko\n")
+		writeFile("lib/modules/6.4.0-kairos/modules.dep", "kernel/drivers/md/dm-crypt.ko.zst: kernel/drivers/md/dm-mod.ko.zst\n")
+
+		info := SystemInfo(root)
+		Expect(info.Init).To(Equal(InitSystemd))
+		Expect(info.CgroupVersion).To(Equal("v2"))
+		Expect(info.SELinux).To(Equal(SELinuxPermissive))
+		Expect(info.AppArmor).To(BeTrue())
+		Expect(info.KernelVersion).To(Equal("6.4.0-kairos"))
+		Expect(info.KernelModules).To(Equal([]KernelModule{
+			{Name: "dm_crypt", Available: true},
+			{Name: "overlay", Loaded: true},
+			{Name: "squashfs", Loaded: true, Builtin: true},
+		}))
+		Expect(info.MissingModules()).To(BeEmpty())
+	})
+
+	It("detects s6", func() {
+		Expect(os.MkdirAll(filepath.Join(root, "run/s6"), os.ModePerm)).To(Succeed())
+		Expect(SystemInfo(root).Init).To(Equal(InitS6))
+	})
+})
@@ -0,0 +1,66 @@
+package terminal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spinner shows that a long operation is running. Create it with
+// Terminal.Spinner and call Stop once the operation is done.
+type Spinner struct {
+	t       *Terminal
+	message string
+	done    chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// Spinner starts a spinner with the given message. Without a terminal, the
+// message is written once instead.
+func (t *Terminal) Spinner(message string) *Spinner {
+	s := &Spinner{t: t, message: message, done: make(chan struct{})}
+	if !t.tty {
+		fmt.Fprintf(t.out, "%s...\n", message)
+		return s
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(t.out, "\r%s %s", spinnerFrames[i%len(spinnerFrames)], message)
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return s
+}
+
+// Stop stops the spinner and writes the result of the operation. It's safe
+// to call it more than once, only the first call has effect.
+func (s *Spinner) Stop(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		status := "done"
+		if err != nil {
+			status = "failed: " + err.Error()
+		}
+		if s.t.tty {
+			fmt.Fprintf(s.t.out, "\r%s: %s\n", s.message, status)
+		} else {
+			fmt.Fprintf(s.t.out, "%s: %s\n", s.message, status)
+		}
+		s.t.transcript(s.message, status)
+	})
+}
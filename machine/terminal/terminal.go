@@ -0,0 +1,216 @@
+// Package terminal provides the prompts used by interactive installs. When
+// the input or the output is not a terminal, e.g. in scripts or over a serial
+// console without a tty, they fall back to reading plain lines, and to the
+// default answer at the end of the input.
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	"golang.org/x/term"
+)
+
+// Terminal reads answers from an input and writes prompts to an output.
+type Terminal struct {
+	in     *bufio.Reader
+	inFd   int
+	out    io.Writer
+	tty    bool
+	logger *types.KairosLogger
+}
+
+type Option func(*Terminal)
+
+// WithInput reads answers from r instead of stdin. r is never treated as a
+// terminal.
+func WithInput(r io.Reader) Option {
+	return func(t *Terminal) {
+		t.in = bufio.NewReader(r)
+		t.inFd = -1
+	}
+}
+
+// WithOutput writes prompts to w instead of stdout.
+func WithOutput(w io.Writer) Option {
+	return func(t *Terminal) {
+		t.out = w
+	}
+}
+
+// WithLogger logs every question and answer at info level, so the logs have a
+// transcript of the install. Passwords are never logged.
+func WithLogger(l *types.KairosLogger) Option {
+	return func(t *Terminal) {
+		t.logger = l
+	}
+}
+
+// New returns a Terminal for stdin and stdout.
+func New(opts ...Option) *Terminal {
+	t := &Terminal{
+		in:   bufio.NewReader(os.Stdin),
+		inFd: int(os.Stdin.Fd()),
+		out:  os.Stdout,
+	}
+	for _, o := range opts {
+		o(t)
+	}
+
+	f, ok := t.out.(*os.File)
+	t.tty = ok && t.inFd >= 0 && term.IsTerminal(t.inFd) && term.IsTerminal(int(f.Fd()))
+
+	return t
+}
+
+// IsTTY returns true if both the input and the output are terminals.
+func (t *Terminal) IsTTY() bool {
+	return t.tty
+}
+
+// Prompt asks for a value. The default is returned if the answer is empty or
+// the input ended.
+func (t *Terminal) Prompt(message, def string) (string, error) {
+	question := message
+	if def != "" {
+		question = fmt.Sprintf("%s [%s]", message, def)
+	}
+	answer, err := t.ask(question)
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		answer = def
+	}
+	t.transcript(message, answer)
+
+	return answer, nil
+}
+
+// Confirm asks a yes or no question. The default is returned if the answer is
+// empty or the input ended. Invalid answers are asked again on a terminal and
+// are an error otherwise.
+func (t *Terminal) Confirm(message string, def bool) (bool, error) {
+	options := "y/N"
+	if def {
+		options = "Y/n"
+	}
+	for {
+		answer, err := t.ask(fmt.Sprintf("%s [%s]", message, options))
+		if err != nil {
+			return false, err
+		}
+		result := def
+		switch strings.ToLower(answer) {
+		case "":
+		case "y", "yes":
+			result = true
+		case "n", "no":
+			result = false
+		default:
+			if err := t.invalid(answer); err != nil {
+				return false, err
+			}
+			continue
+		}
+		t.transcript(message, strconv.FormatBool(result))
+		return result, nil
+	}
+}
+
+// Select asks to choose one of the options, by number, and returns its index.
+// The def index is returned if the answer is empty or the input ended.
+func (t *Terminal) Select(message string, options []string, def int) (int, error) {
+	if len(options) == 0 {
+		return 0, errors.New("no options to select from")
+	}
+	if def < 0 || def >= len(options) {
+		def = 0
+	}
+	for i, o := range options {
+		fmt.Fprintf(t.out, "  %d) %s\n", i+1, o)
+	}
+	for {
+		answer, err := t.ask(fmt.Sprintf("%s [%d]", message, def+1))
+		if err != nil {
+			return 0, err
+		}
+		result := def
+		if answer != "" {
+			n, err := strconv.Atoi(answer)
+			if err != nil || n < 1 || n > len(options) {
+				if err := t.invalid(answer); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			result = n - 1
+		}
+		t.transcript(message, options[result])
+		return result, nil
+	}
+}
+
+// Password asks for a secret, without echoing it on a terminal.
+func (t *Terminal) Password(message string) (string, error) {
+	fmt.Fprintf(t.out, "%s: ", message)
+	if t.tty {
+		b, err := term.ReadPassword(t.inFd)
+		fmt.Fprintln(t.out)
+		if err != nil {
+			return "", err
+		}
+		t.transcript(message, "<hidden>")
+		return string(b), nil
+	}
+
+	answer, err := t.readLine()
+	if err == io.EOF && answer == "" {
+		return "", fmt.Errorf("no answer for %q: %w", message, err)
+	}
+	t.transcript(message, "<hidden>")
+
+	return answer, nil
+}
+
+// ask writes the question and reads the answer. The end of the input is an
+// empty answer.
+func (t *Terminal) ask(question string) (string, error) {
+	fmt.Fprintf(t.out, "%s: ", question)
+	answer, err := t.readLine()
+	if err == io.EOF {
+		if !t.tty {
+			fmt.Fprintln(t.out)
+		}
+		return answer, nil
+	}
+
+	return answer, err
+}
+
+func (t *Terminal) readLine() (string, error) {
+	line, err := t.in.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+// invalid reports an invalid answer. It's an error when not on a terminal,
+// since there's nobody to ask again.
+func (t *Terminal) invalid(answer string) error {
+	if !t.tty {
+		return fmt.Errorf("invalid answer %q", answer)
+	}
+	fmt.Fprintf(t.out, "Invalid answer %q, try again\n", answer)
+	return nil
+}
+
+func (t *Terminal) transcript(question, answer string) {
+	if t.logger != nil {
+		t.logger.Logger.Info().Str("question", question).Str("answer", answer).Msg("Terminal answer")
+	}
+}
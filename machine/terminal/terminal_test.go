@@ -0,0 +1,86 @@
+package terminal_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	. "github.com/kairos-io/kairos-sdk/machine/terminal"
+	"github.com/kairos-io/kairos-sdk/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Terminal", func() {
+	var out *bytes.Buffer
+
+	newTerminal := func(input string, opts ...Option) *Terminal {
+		return New(append([]Option{WithInput(strings.NewReader(input)), WithOutput(out)}, opts...)...)
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+	})
+
+	It("is not a TTY with other inputs and outputs", func() {
+		Expect(newTerminal("").IsTTY()).To(BeFalse())
+	})
+
+	It("prompts for values, with defaults", func() {
+		t := newTerminal("node1\n\n")
+		Expect(t.Prompt("Hostname", "kairos")).To(Equal("node1"))
+		Expect(t.Prompt("Hostname", "kairos")).To(Equal("kairos"))
+		// The input ended
+		Expect(t.Prompt("Hostname", "kairos")).To(Equal("kairos"))
+		Expect(out.String()).To(ContainSubstring("Hostname [kairos]: "))
+	})
+
+	It("confirms", func() {
+		t := newTerminal("y\nNO\n\n")
+		Expect(t.Confirm("Install?", false)).To(BeTrue())
+		Expect(t.Confirm("Install?", true)).To(BeFalse())
+		Expect(t.Confirm("Install?", true)).To(BeTrue())
+		Expect(out.String()).To(ContainSubstring("Install? [Y/n]: "))
+	})
+
+	It("fails on invalid answers without a TTY", func() {
+		_, err := newTerminal("maybe\n").Confirm("Install?", false)
+		Expect(err).To(HaveOccurred())
+		_, err = newTerminal("4\n").Select("Disk", []string{"sda", "sdb"}, 0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("selects options by number", func() {
+		t := newTerminal("2\n\n")
+		Expect(t.Select("Disk", []string{"sda", "sdb"}, 0)).To(Equal(1))
+		Expect(t.Select("Disk", []string{"sda", "sdb"}, 0)).To(Equal(0))
+		Expect(out.String()).To(ContainSubstring("  2) sdb\n"))
+	})
+
+	It("reads passwords and never logs them", func() {
+		logs := &bytes.Buffer{}
+		logger := types.NewBufferLogger(logs)
+		t := newTerminal("secret\n", WithLogger(&logger))
+		Expect(t.Password("Password")).To(Equal("secret"))
+		Expect(logs.String()).ToNot(ContainSubstring("secret"))
+
+		_, err := t.Password("Password")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keeps a transcript in the logs", func() {
+		logs := &bytes.Buffer{}
+		logger := types.NewBufferLogger(logs)
+		t := newTerminal("node1\n", WithLogger(&logger))
+		_, err := t.Prompt("Hostname", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logs.String()).To(ContainSubstring(`"question":"Hostname","answer":"node1"`))
+	})
+
+	It("writes the spinner message once without a TTY", func() {
+		s := newTerminal("").Spinner("Installing")
+		s.Stop(errors.New("no space left"))
+		s.Stop(nil)
+		Expect(out.String()).To(Equal("Installing...\nInstalling: failed: no space left\n"))
+	})
+})
@@ -0,0 +1,31 @@
+package machine
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// armWatchdog sets the watchdog timeout and feeds it once. The device is
+// closed without the magic close character, so the watchdog stays armed and
+// resets the machine if nothing feeds it again before the timeout.
+func armWatchdog(device string, timeout time.Duration) error {
+	f, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := unix.IoctlSetPointerInt(int(f.Fd()), unix.WDIOC_SETTIMEOUT, int(timeout.Seconds())); err != nil {
+		// Not every driver allows changing the timeout, the default one is used
+		// then.
+		if err != unix.ENOTTY && err != unix.EINVAL && err != unix.EOPNOTSUPP {
+			return fmt.Errorf("setting the watchdog timeout: %w", err)
+		}
+	}
+
+	_, err = f.Write([]byte{0})
+	return err
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package machine
+
+import (
+	"errors"
+	"time"
+)
+
+func armWatchdog(_ string, _ time.Duration) error {
+	return errors.New("hardware watchdog is only supported on Linux")
+}
@@ -1,11 +1,13 @@
 package mounts
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 
+	"github.com/kairos-io/kairos-sdk/ghw"
 	"github.com/kairos-io/kairos-sdk/state"
+	"github.com/kairos-io/kairos-sdk/types"
 	"github.com/kairos-io/kairos-sdk/utils"
 )
 
@@ -52,13 +54,19 @@ func remount(opt, path string) error {
 }
 
 func mount(label, mountpoint string) error {
-	part, _ := utils.SH(fmt.Sprintf("blkid -L %s", label))
-	if part == "" {
+	logger := types.NewNullLogger()
+	// The partitions come from the detected state, no need to refresh udev
+	partition, err := ghw.FindPartition(ghw.NewPaths(""), ghw.Selector{Label: label}, &logger)
+	// Like blkid -L, use the first partition when several share the label
+	var ambiguous *ghw.AmbiguousError
+	if errors.As(err, &ambiguous) {
+		partition, err = ambiguous.Partitions[0], nil
+	}
+	if err != nil {
 		fmt.Printf("%s partition not found\n", label)
-		return fmt.Errorf("partition not found")
+		return fmt.Errorf("partition not found: %w", err)
 	}
-
-	part = strings.TrimSuffix(part, "\n")
+	part := partition.Path
 
 	if !utils.Exists(mountpoint) {
 		err := os.MkdirAll(mountpoint, 0755)
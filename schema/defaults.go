@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// maxDefaultsDepth guards against recursive definitions.
+const maxDefaultsDepth = 32
+
+// Defaults returns the default values declared in the JSON Schema of the given
+// schema type, e.g. RootSchema{}, in a map following the configuration
+// structure. Defaults declared in oneOf and anyOf alternatives or in array
+// items are left out, as they don't apply to every configuration.
+func Defaults(schemaType interface{}) (map[string]interface{}, error) {
+	generatedSchemaJSON, err := GenerateSchema(schemaType, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(generatedSchemaJSON), &root); err != nil {
+		return nil, err
+	}
+	definitions, _ := root["definitions"].(map[string]interface{})
+
+	return objectDefaults(root, definitions, 0), nil
+}
+
+func objectDefaults(s, definitions map[string]interface{}, depth int) map[string]interface{} {
+	result := map[string]interface{}{}
+	if depth > maxDefaultsDepth {
+		return result
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	for name, p := range properties {
+		property := resolveRef(p, definitions)
+		if property == nil {
+			continue
+		}
+		if d, ok := property["default"]; ok {
+			result[name] = d
+			continue
+		}
+		if nested := objectDefaults(property, definitions, depth+1); len(nested) > 0 {
+			result[name] = nested
+		}
+	}
+
+	return result
+}
+
+// resolveRef returns the definition referenced by the schema, if any.
+func resolveRef(s interface{}, definitions map[string]interface{}) map[string]interface{} {
+	m, ok := s.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m
+	}
+	definition, _ := definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+
+	return definition
+}
@@ -0,0 +1,28 @@
+package schema_test
+
+import (
+	. "github.com/kairos-io/kairos-sdk/schema"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Defaults", func() {
+	It("returns the defaults of the root schema", func() {
+		defaults, err := Defaults(RootSchema{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(defaults).To(HaveKey("p2p"))
+		p2p := defaults["p2p"].(map[string]interface{})
+		Expect(p2p).To(HaveKeyWithValue("role", "none"))
+		Expect(p2p).To(HaveKeyWithValue("disable_dht", true))
+		Expect(p2p).To(HaveKeyWithValue("vpn", map[string]interface{}{"vpn": true, "use": true}))
+	})
+
+	It("skips the defaults of oneOf alternatives", func() {
+		defaults, err := Defaults(InstallSchema{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(defaults).ToNot(HaveKey("reboot"))
+		Expect(defaults).ToNot(HaveKey("poweroff"))
+	})
+})
@@ -1,6 +1,9 @@
 package schema
 
 import (
+	"net/url"
+
+	"github.com/rs/zerolog"
 	jsonschemago "github.com/swaggest/jsonschema-go"
 )
 
@@ -34,6 +37,15 @@ type Image struct {
 	Source string `json:"uri,omitempty" mapstructure:"uri"`
 }
 
+// MarshalZerologObject implements zerolog.LogObjectMarshaler. Credentials in the source URI are redacted.
+func (i Image) MarshalZerologObject(e *zerolog.Event) {
+	source := i.Source
+	if u, err := url.Parse(source); err == nil && u.User != nil {
+		source = u.Redacted()
+	}
+	e.Uint("size", i.Size).Str("uri", source)
+}
+
 type Partition struct {
 	Name string `json:"name,omitempty"`
 	Size uint   `json:"size,omitempty" mapstructure:"size"`
@@ -49,11 +61,12 @@ type ElementalPartitions struct {
 
 // BundleSchema represents the bundle block which can be used in different places of the Kairos configuration. It is used to reference a bundle and its confguration.
 type BundleSchema struct {
+	_          struct{} `title:"Kairos Schema: Bundle" description:"A bundle to install, e.g. run://quay.io/kairos/community-bundles:kubevirt_latest" additionalProperties:"false"`
 	DB         string   `json:"db_path,omitempty"`
 	LocalFile  bool     `json:"local_file,omitempty"`
 	Repository string   `json:"repository,omitempty"`
 	Rootfs     string   `json:"rootfs_path,omitempty"`
-	Targets    []string `json:"targets,omitempty"`
+	Targets    []string `json:"targets,omitempty" minItems:"1" required:"true" examples:"[\"run://quay.io/kairos/community-bundles:system-upgrade-controller_latest\"]"`
 }
 
 // GrubOptionsSchema represents the grub options block which can be used in different places of the Kairos configuration. It is used to configure grub.
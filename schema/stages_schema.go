@@ -0,0 +1,198 @@
+package schema
+
+// StageSchema represents a single step of a stage in the Kairos configuration, e.g. one of the items under stages.boot. It follows the yip stage format.
+type StageSchema struct {
+	_                struct{}                   `title:"Kairos Schema: Stage step" description:"A stage step runs commands and applies system configuration during one of the boot or installation stages." additionalProperties:"false"`
+	Name             string                     `json:"name,omitempty" description:"Name of the step, shown in the logs" example:"Setup hostname"`
+	If               string                     `json:"if,omitempty" description:"Shell condition which needs to succeed for the step to run" example:"[ -e /run/cos/recovery_mode ]"`
+	OnlyOs           string                     `json:"only_os,omitempty" description:"Regular expression matched against the OS name to decide if the step runs"`
+	OnlyOsVersion    string                     `json:"only_os_version,omitempty" description:"Regular expression matched against the OS version to decide if the step runs"`
+	OnlyArch         string                     `json:"only_arch,omitempty" description:"Regular expression matched against the architecture to decide if the step runs" example:"amd64"`
+	OnlyServiceMgr   string                     `json:"only_service_manager,omitempty" description:"Regular expression matched against the service manager to decide if the step runs" example:"systemd"`
+	Node             string                     `json:"node,omitempty" description:"Hostname of the node the step runs on, other nodes skip it"`
+	After            []StageDependencySchema    `json:"after,omitempty" description:"Steps that need to run before this one"`
+	Commands         []string                   `json:"commands,omitempty" description:"Commands to run" examples:"[\"echo hello\"]"`
+	Files            []StageFileSchema          `json:"files,omitempty" description:"Files to create"`
+	Directories      []StageDirectorySchema     `json:"directories,omitempty" description:"Directories to create"`
+	Downloads        []StageDownloadSchema      `json:"downloads,omitempty" description:"Files to download"`
+	Users            map[string]StageUserSchema `json:"users,omitempty" description:"Users to create, by user name"`
+	EnsureEntities   []StageEntitySchema        `json:"ensure_entities,omitempty" description:"Entities (users, groups, shadow entries) to create or update"`
+	DeleteEntities   []StageEntitySchema        `json:"delete_entities,omitempty" description:"Entities (users, groups, shadow entries) to delete"`
+	SSHKeys          map[string][]string        `json:"authorized_keys,omitempty" description:"SSH authorized keys to add, by user name"`
+	Packages         StagePackagesSchema        `json:"packages,omitempty"`
+	Hostname         string                     `json:"hostname,omitempty" description:"Hostname to set. Supports templating, e.g. kairos-{{ trunc 4 .Random }}"`
+	DNS              StageDNSSchema             `json:"dns,omitempty"`
+	Modules          []string                   `json:"modules,omitempty" description:"Kernel modules to load" examples:"[\"dm_crypt\"]"`
+	Sysctl           map[string]string          `json:"sysctl,omitempty" description:"Kernel parameters to set"`
+	Environment      map[string]string          `json:"environment,omitempty" description:"Environment variables to write to the environment file"`
+	EnvironmentFile  string                     `json:"environment_file,omitempty" description:"File where to write the environment variables"`
+	Systemctl        StageSystemctlSchema       `json:"systemctl,omitempty"`
+	SystemdFirstBoot map[string]string          `json:"systemd_firstboot,omitempty" description:"Options passed to systemd-firstboot"`
+	TimeSyncd        map[string]string          `json:"timesyncd,omitempty" description:"Options written to the timesyncd configuration"`
+	Datasource       StageDatasourceSchema      `json:"datasource,omitempty"`
+	Layout           StageLayoutSchema          `json:"layout,omitempty"`
+	Git              StageGitSchema             `json:"git,omitempty"`
+	UnpackImages     []StageUnpackImageSchema   `json:"unpack_images,omitempty" description:"Container images to unpack in the filesystem"`
+}
+
+// StagePackagesSchema represents the packages installed or removed by a stage step, with the package manager of the OS.
+type StagePackagesSchema struct {
+	_       struct{} `additionalProperties:"false"`
+	Install []string `json:"install,omitempty" examples:"[\"vim\"]"`
+	Remove  []string `json:"remove,omitempty"`
+	Refresh bool     `json:"refresh,omitempty" description:"Refresh the package lists before installing"`
+	Upgrade bool     `json:"upgrade,omitempty" description:"Upgrade the installed packages"`
+}
+
+// StageDependencySchema references a step which needs to run before the current one.
+type StageDependencySchema struct {
+	_    struct{} `additionalProperties:"false"`
+	Name string   `json:"name" required:"true"`
+}
+
+// StageFileSchema represents a file created by a stage step.
+type StageFileSchema struct {
+	_           struct{} `additionalProperties:"false"`
+	Path        string   `json:"path" required:"true" example:"/etc/motd"`
+	Permissions uint32   `json:"permissions,omitempty" description:"File mode, in decimal (e.g. 420 for 0644)" example:"420"`
+	Owner       int      `json:"owner,omitempty" description:"Owner UID"`
+	Group       int      `json:"group,omitempty" description:"Owner GID"`
+	Content     string   `json:"content,omitempty"`
+	Encoding    string   `json:"encoding,omitempty" enum:"[\"\",\"b64\",\"base64\",\"gz\",\"gzip\",\"gz+base64\",\"gzip+base64\",\"gz+b64\",\"gzip+b64\"]"`
+	OwnerString string   `json:"ownerstring,omitempty" description:"Owner in the user:group format, takes precedence over owner and group"`
+}
+
+// StageDirectorySchema represents a directory created by a stage step.
+type StageDirectorySchema struct {
+	_           struct{} `additionalProperties:"false"`
+	Path        string   `json:"path" required:"true" example:"/usr/local/bin"`
+	Permissions uint32   `json:"permissions,omitempty" description:"Directory mode, in decimal (e.g. 493 for 0755)" example:"493"`
+	Owner       int      `json:"owner,omitempty" description:"Owner UID"`
+	Group       int      `json:"group,omitempty" description:"Owner GID"`
+}
+
+// StageDownloadSchema represents a file downloaded by a stage step.
+type StageDownloadSchema struct {
+	_           struct{} `additionalProperties:"false"`
+	Path        string   `json:"path" required:"true"`
+	URL         string   `json:"url" required:"true"`
+	Permissions uint32   `json:"permissions,omitempty"`
+	Owner       int      `json:"owner,omitempty"`
+	Group       int      `json:"group,omitempty"`
+	Timeout     int      `json:"timeout,omitempty" description:"Timeout in seconds"`
+	OwnerString string   `json:"ownerstring,omitempty" description:"Owner in the user:group format, takes precedence over owner and group"`
+}
+
+// StageUserSchema represents a user created by a stage step. Unlike the top level users block, stage users are keyed by name.
+type StageUserSchema struct {
+	_                 struct{} `additionalProperties:"false"`
+	Name              string   `json:"name,omitempty" pattern:"([a-z_][a-z0-9_]{0,30})"`
+	PasswordHash      string   `json:"passwd,omitempty"`
+	LockPasswd        bool     `json:"lock_passwd,omitempty"`
+	Groups            []string `json:"groups,omitempty" examples:"[\"admin\"]"`
+	PrimaryGroup      string   `json:"primary_group,omitempty"`
+	SSHAuthorizedKeys []string `json:"ssh_authorized_keys,omitempty" examples:"[\"github:USERNAME\",\"ssh-ed25519 AAAF00BA5\"]"`
+	Homedir           string   `json:"homedir,omitempty"`
+	Shell             string   `json:"shell,omitempty"`
+	UID               string   `json:"uid,omitempty"`
+	GECOS             string   `json:"gecos,omitempty"`
+	NoCreateHome      bool     `json:"no_create_home,omitempty"`
+	NoUserGroup       bool     `json:"no_user_group,omitempty"`
+	System            bool     `json:"system,omitempty"`
+	NoLogInit         bool     `json:"no_log_init,omitempty"`
+}
+
+// StageEntitySchema represents an entity managed by the ensure_entities and delete_entities blocks.
+type StageEntitySchema struct {
+	_      struct{} `additionalProperties:"false"`
+	Path   string   `json:"path,omitempty"`
+	Entity string   `json:"entity" required:"true" description:"YAML definition of the entity"`
+}
+
+// StageDNSSchema represents the DNS configuration written by a stage step.
+type StageDNSSchema struct {
+	_           struct{} `additionalProperties:"false"`
+	Nameservers []string `json:"nameservers,omitempty" examples:"[\"8.8.8.8\"]"`
+	DNSSearch   []string `json:"search,omitempty"`
+	DNSOptions  []string `json:"options,omitempty"`
+	Path        string   `json:"path,omitempty"`
+}
+
+// StageSystemctlSchema represents the systemd units managed by a stage step.
+type StageSystemctlSchema struct {
+	_         struct{}                       `additionalProperties:"false"`
+	Enable    []string                       `json:"enable,omitempty" examples:"[\"sshd\"]"`
+	Disable   []string                       `json:"disable,omitempty"`
+	Start     []string                       `json:"start,omitempty"`
+	Mask      []string                       `json:"mask,omitempty"`
+	Overrides []StageSystemctlOverrideSchema `json:"overrides,omitempty"`
+}
+
+// StageSystemctlOverrideSchema represents a drop-in override for a systemd unit.
+type StageSystemctlOverrideSchema struct {
+	_       struct{} `additionalProperties:"false"`
+	Service string   `json:"service" required:"true"`
+	Content string   `json:"content,omitempty"`
+	Name    string   `json:"name,omitempty" description:"Name of the override file"`
+}
+
+// StageDatasourceSchema represents the datasources queried by a stage step to fetch the userdata.
+type StageDatasourceSchema struct {
+	_         struct{} `additionalProperties:"false"`
+	Providers []string `json:"providers,omitempty" examples:"[\"cdrom\",\"aws\",\"gcp\"]"`
+	Path      string   `json:"path,omitempty"`
+}
+
+// StageLayoutSchema represents the partition layout changes done by a stage step, like growing the last partition or adding new ones.
+type StageLayoutSchema struct {
+	_      struct{}               `additionalProperties:"false"`
+	Device *StageDeviceSchema     `json:"device,omitempty"`
+	Expand *StageExpandSchema     `json:"expand_partition,omitempty"`
+	Parts  []StagePartitionSchema `json:"add_partitions,omitempty"`
+}
+
+// StageDeviceSchema selects the device to change, by label or by path.
+type StageDeviceSchema struct {
+	_     struct{} `additionalProperties:"false"`
+	Label string   `json:"label,omitempty" example:"COS_OEM"`
+	Path  string   `json:"path,omitempty" example:"/dev/sda"`
+}
+
+// StageExpandSchema defines how to expand the last partition of the device.
+type StageExpandSchema struct {
+	_    struct{} `additionalProperties:"false"`
+	Size uint     `json:"size,omitempty" description:"Size in MiB, 0 means all the available space"`
+}
+
+// StagePartitionSchema represents a partition added by the layout block.
+type StagePartitionSchema struct {
+	_          struct{} `additionalProperties:"false"`
+	FSLabel    string   `json:"fsLabel,omitempty" example:"COS_PERSISTENT"`
+	Size       uint     `json:"size,omitempty" description:"Size in MiB, 0 means all the available space"`
+	PLabel     string   `json:"pLabel,omitempty"`
+	FileSystem string   `json:"filesystem,omitempty" example:"ext4"`
+}
+
+// StageGitSchema represents a git repository cloned by a stage step.
+type StageGitSchema struct {
+	_      struct{} `additionalProperties:"false"`
+	URL    string   `json:"url,omitempty"`
+	Path   string   `json:"path,omitempty"`
+	Branch string   `json:"branch,omitempty"`
+	Auth   struct {
+		Username   string `json:"username,omitempty"`
+		Password   string `json:"password,omitempty"`
+		PrivateKey string `json:"private_key,omitempty"`
+		Insecure   bool   `json:"insecure,omitempty"`
+		PublicKey  string `json:"public_key,omitempty"`
+	} `json:"auth,omitempty"`
+	BranchOnly bool `json:"branch_only,omitempty"`
+}
+
+// StageUnpackImageSchema represents a container image unpacked by a stage step.
+type StageUnpackImageSchema struct {
+	_        struct{} `additionalProperties:"false"`
+	Source   string   `json:"source" required:"true"`
+	Target   string   `json:"target" required:"true"`
+	Platform string   `json:"platform,omitempty"`
+}
@@ -0,0 +1,198 @@
+package schema_test
+
+import (
+	. "github.com/kairos-io/kairos-sdk/schema"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stages Schema", func() {
+	var config *KConfig
+	var err error
+	var yaml string
+
+	JustBeforeEach(func() {
+		config, err = NewConfigFromYAML(yaml, RootSchema{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("With a real world configuration", func() {
+		BeforeEach(func() {
+			yaml = `#cloud-config
+users:
+- name: kairos
+  passwd: kairos
+bundles:
+- targets:
+  - run://quay.io/kairos/community-bundles:system-upgrade-controller_latest
+stages:
+  initramfs:
+  - name: "Setup users"
+    users:
+      kairos:
+        passwd: kairos
+        groups: ["admin"]
+        ssh_authorized_keys: ["github:mudler"]
+  boot:
+  - name: "Repart image"
+    layout:
+      device:
+        label: COS_OEM
+      expand_partition:
+        size: 0
+      add_partitions:
+      - fsLabel: COS_PERSISTENT
+        size: 0
+        filesystem: ext4
+  - name: "Setup k3s"
+    if: "[ ! -e /run/cos/recovery_mode ]"
+    files:
+    - path: /etc/rancher/k3s/config.yaml
+      permissions: 420
+      content: |
+        node-label: ["foo=bar"]
+    directories:
+    - path: /var/lib/rancher
+      permissions: 493
+    systemctl:
+      enable: ["k3s"]
+      start: ["k3s"]
+    commands:
+    - echo "done"
+  after-install:
+  - hostname: "kairos-{{ trunc 4 .Random }}"
+    environment:
+      FOO: bar
+    sysctl:
+      vm.max_map_count: "262144"`
+		})
+
+		It("succeeds", func() {
+			Expect(config.IsValid()).To(BeTrue(), func() string {
+				if config.ValidationError != nil {
+					return config.ValidationError.Error()
+				}
+				return ""
+			})
+		})
+	})
+
+	DescribeTable("accepts the keys supported by yip",
+		func(step string) {
+			config, err := NewConfigFromYAML(`#cloud-config
+users:
+- name: kairos
+stages:
+  boot:
+  - name: "step"
+`+step, RootSchema{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.IsValid()).To(BeTrue(), func() string {
+				if config.ValidationError != nil {
+					return config.ValidationError.Error()
+				}
+				return ""
+			})
+		},
+		Entry("packages", `    packages:
+      install: ["vim"]
+      remove: ["nano"]
+      refresh: true
+      upgrade: true`),
+		Entry("node", `    node: "node1"`),
+		Entry("only_arch", `    only_arch: "amd64"`),
+		Entry("only_service_manager", `    only_service_manager: "systemd"`),
+		Entry("users no_user_group and no_log_init", `    users:
+      kairos:
+        no_user_group: true
+        no_log_init: true`),
+		Entry("files ownerstring", `    files:
+    - path: /etc/motd
+      ownerstring: "kairos:kairos"`),
+		Entry("downloads ownerstring", `    downloads:
+    - path: /usr/local/bin/tool
+      url: https://example.com/tool
+      ownerstring: "kairos:kairos"`),
+	)
+
+	It("rejects the keys yip doesn't support", func() {
+		config, err := NewConfigFromYAML(`#cloud-config
+users:
+- name: kairos
+stages:
+  boot:
+  - files:
+    - path: /etc/motd
+      owner_string: "kairos:kairos"`, RootSchema{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.IsValid()).To(BeFalse())
+		Expect(config.ValidationError.Error()).To(MatchRegexp("additionalProperties 'owner_string' not allowed"))
+	})
+
+	Context("When a stage step has a typo", func() {
+		BeforeEach(func() {
+			yaml = `#cloud-config
+users:
+- name: kairos
+stages:
+  boot:
+  - name: "typo"
+    command:
+    - echo "hello"`
+		})
+
+		It("errors", func() {
+			Expect(config.IsValid()).NotTo(BeTrue())
+			Expect(config.ValidationError.Error()).To(MatchRegexp("additionalProperties 'command' not allowed"))
+		})
+	})
+
+	Context("When a file has no path", func() {
+		BeforeEach(func() {
+			yaml = `#cloud-config
+users:
+- name: kairos
+stages:
+  boot:
+  - files:
+    - content: "hello"`
+		})
+
+		It("errors", func() {
+			Expect(config.IsValid()).NotTo(BeTrue())
+			Expect(config.ValidationError.Error()).To(MatchRegexp("missing properties: 'path'"))
+		})
+	})
+
+	Context("When systemctl has an unknown action", func() {
+		BeforeEach(func() {
+			yaml = `#cloud-config
+users:
+- name: kairos
+stages:
+  boot:
+  - systemctl:
+      restart: ["k3s"]`
+		})
+
+		It("errors", func() {
+			Expect(config.IsValid()).NotTo(BeTrue())
+			Expect(config.ValidationError.Error()).To(MatchRegexp("additionalProperties 'restart' not allowed"))
+		})
+	})
+
+	Context("When a bundle has no targets", func() {
+		BeforeEach(func() {
+			yaml = `#cloud-config
+users:
+- name: kairos
+bundles:
+- repository: quay.io/kairos/community-bundles`
+		})
+
+		It("errors", func() {
+			Expect(config.IsValid()).NotTo(BeTrue())
+			Expect(config.ValidationError.Error()).To(MatchRegexp("missing properties: 'targets'"))
+		})
+	})
+})
@@ -70,6 +70,7 @@ type Runtime struct {
 	BootState           Boot            `yaml:"boot" json:"boot"`
 	System              sysinfo.SysInfo `yaml:"system" json:"system"`
 	Kairos              Kairos          `yaml:"kairos" json:"kairos"`
+	TrustedBoot         TrustedBoot     `yaml:"trusted_boot" json:"trusted_boot"`
 }
 
 type FndMnt struct {
@@ -383,6 +384,7 @@ func NewRuntimeWithLogger(logger zerolog.Logger) (Runtime, error) {
 
 	detectSystem(runtime)
 	detectKairos(runtime)
+	detectTrustedBoot(runtime)
 	detectEncryptedPartitions(runtime)
 	err := detectRuntimeState(runtime)
 
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/foxboron/go-uefi/efi/signature"
+	"github.com/kairos-io/kairos-sdk/signatures"
+	"github.com/kairos-io/kairos-sdk/types"
+	"github.com/twpayne/go-vfs/v4"
+)
+
+const (
+	efivarsDir = "/sys/firmware/efi/efivars"
+	// efiGlobalGUID is the vendor of the UEFI spec variables (SecureBoot...)
+	efiGlobalGUID = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	// systemdGUID is the vendor of the systemd-boot and systemd-stub variables
+	systemdGUID = "4a67b082-0a4c-41cf-b6c7-440b29bb8c4f"
+	// shimGUID is the vendor of the shim variables (MokListRT...)
+	shimGUID = "605dab50-e046-4300-abb6-3dd810dd8b23"
+	// mokVariablesDir exposes the shim MOK lists, which are too big for efivars
+	// in some firmwares, without the attributes header
+	mokVariablesDir = "/sys/firmware/efi/mok-variables"
+)
+
+// PCRSignatureFiles are the files systemd-stub ships the signed PCR 11
+// policy in: the initrd path and the one it's copied to after switching root.
+var PCRSignatureFiles = []string{
+	"/run/systemd/tpm2-pcr-signature.json",
+	"/.extra/tpm2-pcr-signature.json",
+}
+
+// TrustedBoot describes how the system was booted and what verified and
+// measured the boot.
+type TrustedBoot struct {
+	UEFI       bool `yaml:"uefi" json:"uefi"`
+	SecureBoot bool `yaml:"secureboot" json:"secureboot"`
+	SetupMode  bool `yaml:"setup_mode" json:"setup_mode"`
+	// UKI is true when booted from a Unified Kernel Image, false when booted
+	// with grub
+	UKI bool `yaml:"uki" json:"uki"`
+	// Bootloader and Stub are the ones reported by systemd-boot and
+	// systemd-stub, e.g. "systemd-boot 254"
+	Bootloader string `yaml:"bootloader,omitempty" json:"bootloader,omitempty"`
+	Stub       string `yaml:"stub,omitempty" json:"stub,omitempty"`
+	// Measured is true when the stub measured the UKI into the TPM or the
+	// signature of the expected PCR values is present
+	Measured     bool   `yaml:"measured" json:"measured"`
+	PCRSignature string `yaml:"pcr_signature,omitempty" json:"pcr_signature,omitempty"`
+	// Certs are the common names of the enrolled Secure Boot certificates
+	// and MokCerts the ones of the Machine Owner Keys enrolled in shim
+	Certs    types.EfiCerts `yaml:"certs" json:"certs"`
+	MokCerts []string       `yaml:"mok_certs,omitempty" json:"mok_certs,omitempty"`
+}
+
+// DetectTrustedBootWithVFS detects the trusted boot status using a vfs so it
+// can be used for tests as well. The Secure Boot certificates are not read,
+// see getEfiCertsCommonNames.
+func DetectTrustedBootWithVFS(fs types.KairosFS) TrustedBoot {
+	t := TrustedBoot{}
+	if _, err := fs.Stat(efivarsDir); err == nil {
+		t.UEFI = true
+	}
+	if cmdline, err := fs.ReadFile("/proc/cmdline"); err == nil {
+		t.UKI = DetectUKIboot(string(cmdline))
+	}
+
+	t.SecureBoot = efivarByte(fs, "SecureBoot", efiGlobalGUID) == 1
+	t.SetupMode = efivarByte(fs, "SetupMode", efiGlobalGUID) == 1
+	t.Bootloader = efivarString(fs, "LoaderInfo", systemdGUID)
+	t.Stub = efivarString(fs, "StubInfo", systemdGUID)
+
+	if _, _, err := readEfivar(fs, "StubPcrKernelImage", systemdGUID); err == nil {
+		t.Measured = true
+	}
+	for _, f := range PCRSignatureFiles {
+		if _, err := fs.Stat(f); err == nil {
+			t.Measured = true
+			t.PCRSignature = f
+			break
+		}
+	}
+
+	t.MokCerts = mokCertsCommonNames(fs)
+
+	return t
+}
+
+func detectTrustedBoot(r *Runtime) {
+	t := DetectTrustedBootWithVFS(vfs.OSFS)
+	t.Certs = r.Kairos.EfiCerts
+	r.TrustedBoot = t
+}
+
+// readEfivar returns the attributes and the data of an EFI variable
+func readEfivar(fs types.KairosFS, name, guid string) (uint32, []byte, error) {
+	b, err := fs.ReadFile(filepath.Join(efivarsDir, name+"-"+guid))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 4 {
+		return 0, nil, nil
+	}
+
+	return binary.LittleEndian.Uint32(b), b[4:], nil
+}
+
+func efivarByte(fs types.KairosFS, name, guid string) byte {
+	_, data, err := readEfivar(fs, name, guid)
+	if err != nil || len(data) == 0 {
+		return 0
+	}
+	return data[0]
+}
+
+// efivarString returns the value of a null-terminated UTF-16 EFI variable
+func efivarString(fs types.KairosFS, name, guid string) string {
+	_, data, err := readEfivar(fs, name, guid)
+	if err != nil {
+		return ""
+	}
+	chars := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+
+	return strings.TrimSpace(string(utf16.Decode(chars)))
+}
+
+// mokCertsCommonNames returns the common names of the certificates in the
+// shim MokListRT
+func mokCertsCommonNames(fs types.KairosFS) []string {
+	data, err := fs.ReadFile(filepath.Join(mokVariablesDir, "MokListRT"))
+	if err != nil {
+		if _, data, err = readEfivar(fs, "MokListRT", shimGUID); err != nil {
+			return nil
+		}
+	}
+
+	db, err := signature.ReadSignatureDatabase(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	var result []string
+	for _, c := range signatures.ExtractCertsFromSignatureDatabase(&db) {
+		result = append(result, c.Issuer.CommonName)
+	}
+
+	return result
+}
@@ -0,0 +1,147 @@
+package state_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"time"
+	"unicode/utf16"
+
+	"github.com/foxboron/go-uefi/efi/signature"
+	"github.com/foxboron/go-uefi/efi/util"
+	"github.com/kairos-io/kairos-sdk/state"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/twpayne/go-vfs/v4/vfst"
+)
+
+const (
+	efivars     = "/sys/firmware/efi/efivars/"
+	globalGUID  = "-8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	systemdGUID = "-4a67b082-0a4c-41cf-b6c7-440b29bb8c4f"
+	shimGUID    = "-605dab50-e046-4300-abb6-3dd810dd8b23"
+)
+
+// efivar returns the content of an efivars file: the attributes followed by
+// the data.
+func efivar(data []byte) []byte {
+	attrs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(attrs, 0x06) // boot service and runtime access
+	return append(attrs, data...)
+}
+
+// utf16Var returns s as a null-terminated UTF-16 string, like systemd-boot
+// stores its variables.
+func utf16Var(s string) []byte {
+	b := []byte{}
+	for _, c := range append(utf16.Encode([]rune(s)), 0) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+// signatureList returns an EFI signature list with self-signed certificates
+// with the given common names.
+func signatureList(names ...string) []byte {
+	db := signature.NewSignatureDatabase()
+	owner := util.EFIGUID{Data1: 0x605dab50, Data2: 0xe046, Data3: 0x4300, Data4: [8]uint8{0xab, 0xb6, 0x3d, 0xd8, 0x10, 0xdd, 0x8b, 0x23}}
+	for i, name := range names {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, db.Append(signature.CERT_X509_GUID, owner, der)).To(Succeed())
+	}
+	return db.Bytes()
+}
+
+var _ = Describe("DetectTrustedBootWithVFS", func() {
+	detect := func(files map[string]interface{}) state.TrustedBoot {
+		fs, cleanup, err := vfst.NewTestFS(files)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(cleanup)
+		return state.DetectTrustedBootWithVFS(fs)
+	}
+
+	It("reports nothing without UEFI", func() {
+		t := detect(map[string]interface{}{
+			"/proc/cmdline": "root=LABEL=COS_ACTIVE",
+		})
+		Expect(t).To(Equal(state.TrustedBoot{}))
+	})
+
+	It("reports a measured UKI boot with Secure Boot", func() {
+		t := detect(map[string]interface{}{
+			"/proc/cmdline":                              "rd.immucore.uki console=tty1",
+			efivars + "SecureBoot" + globalGUID:          efivar([]byte{1}),
+			efivars + "SetupMode" + globalGUID:           efivar([]byte{0}),
+			efivars + "LoaderInfo" + systemdGUID:         efivar(utf16Var("systemd-boot 254")),
+			efivars + "StubInfo" + systemdGUID:           efivar(utf16Var("systemd-stub 254.1 ")),
+			efivars + "StubPcrKernelImage" + systemdGUID: efivar(utf16Var("11")),
+			efivars + "MokListRT" + shimGUID:             efivar(signatureList("Kairos MOK", "Other MOK")),
+		})
+		Expect(t.UEFI).To(BeTrue())
+		Expect(t.UKI).To(BeTrue())
+		Expect(t.SecureBoot).To(BeTrue())
+		Expect(t.SetupMode).To(BeFalse())
+		Expect(t.Bootloader).To(Equal("systemd-boot 254"))
+		Expect(t.Stub).To(Equal("systemd-stub 254.1"))
+		Expect(t.Measured).To(BeTrue())
+		Expect(t.PCRSignature).To(BeEmpty())
+		Expect(t.MokCerts).To(Equal([]string{"Kairos MOK", "Other MOK"}))
+	})
+
+	It("reports a grub boot in setup mode", func() {
+		t := detect(map[string]interface{}{
+			"/proc/cmdline":                     "root=LABEL=COS_ACTIVE",
+			efivars + "SecureBoot" + globalGUID: efivar([]byte{0}),
+			efivars + "SetupMode" + globalGUID:  efivar([]byte{1}),
+		})
+		Expect(t.UEFI).To(BeTrue())
+		Expect(t.UKI).To(BeFalse())
+		Expect(t.SecureBoot).To(BeFalse())
+		Expect(t.SetupMode).To(BeTrue())
+		Expect(t.Bootloader).To(BeEmpty())
+		Expect(t.Measured).To(BeFalse())
+		Expect(t.MokCerts).To(BeEmpty())
+	})
+
+	It("considers the boot measured when the PCR signature is shipped", func() {
+		t := detect(map[string]interface{}{
+			efivars + "SecureBoot" + globalGUID:    efivar([]byte{1}),
+			"/run/systemd/tpm2-pcr-signature.json": "{}",
+		})
+		Expect(t.Measured).To(BeTrue())
+		Expect(t.PCRSignature).To(Equal("/run/systemd/tpm2-pcr-signature.json"))
+	})
+
+	It("prefers the MOK list from mok-variables, which has no attributes", func() {
+		t := detect(map[string]interface{}{
+			efivars + "MokListRT" + shimGUID:            efivar(signatureList("From efivars")),
+			"/sys/firmware/efi/mok-variables/MokListRT": signatureList("From mok-variables"),
+		})
+		Expect(t.MokCerts).To(Equal([]string{"From mok-variables"}))
+	})
+
+	It("ignores truncated variables and invalid signature lists", func() {
+		t := detect(map[string]interface{}{
+			efivars + "SecureBoot" + globalGUID:  []byte{1, 0},
+			efivars + "LoaderInfo" + systemdGUID: efivar([]byte{'s'}),
+			efivars + "MokListRT" + shimGUID:     efivar([]byte("not a signature list")),
+		})
+		Expect(t.UEFI).To(BeTrue())
+		Expect(t.SecureBoot).To(BeFalse())
+		Expect(t.Bootloader).To(BeEmpty())
+		Expect(t.MokCerts).To(BeEmpty())
+	})
+})
@@ -15,6 +15,8 @@ import (
 // NewKairosLogger creates a new logger with the given name and level.
 // The name is used to create a log file in /run/kairos/NAME-DATE.log and /var/log/kairos/NAME-DATE.log
 // The level is used to set the log level, defaulting to info
+// The level can be overridden per logger name with $KAIROS_LOG_LEVELS or SetLogLevels, see ParseLogLevels. Their default
+// level is only used if no level is given.
 // The log level can be overridden by setting the environment variable $NAME_DEBUG to any parseable value.
 // If quiet is true, the logger will not log to the console.
 func NewKairosLogger(name, level string, quiet bool) KairosLogger {
@@ -47,6 +49,11 @@ func NewKairosLogger(name, level string, quiet bool) KairosLogger {
 		l = zerolog.InfoLevel
 	}
 
+	// Per module levels have precedence over the given level
+	if moduleLevel, ok := levelForModule(name, level == ""); ok {
+		l = moduleLevel
+	}
+
 	multi := zerolog.MultiLevelWriter(loggers...)
 
 	// Set debug level if set on ENV
@@ -0,0 +1,93 @@
+package types
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// LogWriter is an io.Writer that logs every line written to it as a message
+// of the given level. Incomplete lines are kept until the rest is written or
+// the writer is flushed. It's safe for concurrent use.
+type LogWriter struct {
+	logger zerolog.Logger
+	level  zerolog.Level
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// LoggerWriter returns a writer that logs each line written to it at the given
+// level, e.g. to capture the output of external tools.
+func (m KairosLogger) LoggerWriter(level zerolog.Level) *LogWriter {
+	return &LogWriter{logger: m.Logger, level: level}
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush logs the last line if it didn't end with a newline.
+func (w *LogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.log(w.buf)
+	w.buf = nil
+}
+
+// Close flushes the writer, so it can be used as an io.WriteCloser.
+func (w *LogWriter) Close() error {
+	w.Flush()
+	return nil
+}
+
+func (w *LogWriter) log(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	w.logger.WithLevel(w.level).Msg(string(line))
+}
+
+// AttachCmd sends the stdout and stderr of the command to the logger, line by
+// line at the given level, tagged with the command name and the stream. The
+// returned function must be called once the command finished, to log the
+// last lines without a newline.
+func (m KairosLogger) AttachCmd(cmd *exec.Cmd, level zerolog.Level) func() {
+	logger := m.Logger.With().Str("command", filepath.Base(cmd.Path)).Logger()
+	stdout := &LogWriter{logger: logger.With().Str("stream", "stdout").Logger(), level: level}
+	stderr := &LogWriter{logger: logger.With().Str("stream", "stderr").Logger(), level: level}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	return func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
+
+// RunCmdLogged runs the command sending its output to the logger like
+// AttachCmd does.
+func (m KairosLogger) RunCmdLogged(cmd *exec.Cmd, level zerolog.Level) error {
+	flush := m.AttachCmd(cmd, level)
+	defer flush()
+
+	return cmd.Run()
+}
@@ -0,0 +1,131 @@
+package types_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sync"
+
+	"github.com/kairos-io/kairos-sdk/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+// logLines returns the entries logged to the buffer, one map per JSON line.
+func logLines(buf *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		ExpectWithOffset(1, json.Unmarshal(scanner.Bytes(), &line)).To(Succeed())
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func messages(buf *bytes.Buffer) []string {
+	msgs := []string{}
+	for _, l := range logLines(buf) {
+		msgs = append(msgs, l["message"].(string))
+	}
+	return msgs
+}
+
+var _ = Describe("LogWriter", func() {
+	var buf *bytes.Buffer
+	var w *types.LogWriter
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		logger := types.NewBufferLogger(buf)
+		w = logger.LoggerWriter(zerolog.WarnLevel)
+	})
+
+	It("logs every line at the given level", func() {
+		n, err := w.Write([]byte("first\nsecond\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(13))
+
+		lines := logLines(buf)
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]["message"]).To(Equal("first"))
+		Expect(lines[1]["message"]).To(Equal("second"))
+		for _, l := range lines {
+			Expect(l["level"]).To(Equal("warn"))
+		}
+	})
+
+	It("keeps partial lines until the rest is written", func() {
+		_, _ = w.Write([]byte("hel"))
+		Expect(buf.Len()).To(BeZero())
+
+		_, _ = w.Write([]byte("lo wor"))
+		Expect(buf.Len()).To(BeZero())
+
+		_, _ = w.Write([]byte("ld\nnext"))
+		Expect(messages(buf)).To(Equal([]string{"hello world"}))
+
+		_, _ = w.Write([]byte(" line\n"))
+		Expect(messages(buf)).To(Equal([]string{"hello world", "next line"}))
+	})
+
+	It("strips carriage returns and skips blank lines", func() {
+		_, _ = w.Write([]byte("windows\r\n\n  \r\nunix\n"))
+		Expect(messages(buf)).To(Equal([]string{"windows", "unix"}))
+	})
+
+	It("logs the last line without a newline when flushed or closed", func() {
+		_, _ = w.Write([]byte("done\nno newline"))
+		Expect(messages(buf)).To(Equal([]string{"done"}))
+
+		Expect(w.Close()).To(Succeed())
+		Expect(messages(buf)).To(Equal([]string{"done", "no newline"}))
+
+		// Nothing is left to log
+		w.Flush()
+		Expect(messages(buf)).To(HaveLen(2))
+	})
+
+	It("doesn't mix lines written concurrently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, _ = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+			}(i)
+		}
+		wg.Wait()
+
+		msgs := messages(buf)
+		Expect(msgs).To(HaveLen(10))
+		for i := 0; i < 10; i++ {
+			Expect(msgs).To(ContainElement(fmt.Sprintf("line %d", i)))
+		}
+	})
+
+	Describe("RunCmdLogged", func() {
+		It("logs the stdout and stderr lines of the command", func() {
+			logger := types.NewBufferLogger(buf)
+			cmd := exec.Command("/bin/sh", "-c", "echo out; printf 'err\\nlast' >&2")
+			Expect(logger.RunCmdLogged(cmd, zerolog.InfoLevel)).To(Succeed())
+
+			lines := logLines(buf)
+			Expect(lines).To(HaveLen(3))
+			streams := map[string][]string{}
+			for _, l := range lines {
+				Expect(l["command"]).To(Equal("sh"))
+				Expect(l["level"]).To(Equal("info"))
+				stream := l["stream"].(string)
+				streams[stream] = append(streams[stream], l["message"].(string))
+			}
+			Expect(streams).To(Equal(map[string][]string{
+				"stdout": {"out"},
+				"stderr": {"err", "last"},
+			}))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// EnvLogLevels is the environment variable consulted by NewKairosLogger for
+// per module log levels. E.g. KAIROS_LOG_LEVELS="kcrypt=debug,ghw=trace,default=info"
+const EnvLogLevels = "KAIROS_LOG_LEVELS"
+
+// DefaultLogLevelKey is the key used in the log levels spec to set the level
+// of the loggers not explicitly listed, which were created without a level.
+const DefaultLogLevelKey = "default"
+
+var (
+	logLevelsMu sync.RWMutex
+	// logLevels are the levels set with SetLogLevels. When nil, EnvLogLevels is used.
+	logLevels map[string]zerolog.Level
+)
+
+// ParseLogLevels parses a comma separated list of name=level pairs, where name
+// is the name given to NewKairosLogger (case insensitive) or "default".
+func ParseLogLevels(spec string) (map[string]zerolog.Level, error) {
+	result := map[string]zerolog.Level{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, level, found := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		level = strings.TrimSpace(level)
+		if !found || name == "" || level == "" {
+			return nil, fmt.Errorf("invalid log level %q, expected name=level", pair)
+		}
+
+		l, err := zerolog.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level for %s: %w", name, err)
+		}
+		result[name] = l
+	}
+
+	return result, nil
+}
+
+// SetLogLevels sets the per module log levels from a config source, taking
+// precedence over EnvLogLevels. Loggers created afterwards use these levels.
+// An empty spec restores the use of EnvLogLevels.
+func SetLogLevels(spec string) error {
+	var levels map[string]zerolog.Level
+	if spec != "" {
+		var err error
+		levels, err = ParseLogLevels(spec)
+		if err != nil {
+			return err
+		}
+	}
+
+	logLevelsMu.Lock()
+	defer logLevelsMu.Unlock()
+	logLevels = levels
+
+	return nil
+}
+
+// levelForModule returns the level configured for the given logger name, or
+// the default one if useDefault is true, if any.
+func levelForModule(name string, useDefault bool) (zerolog.Level, bool) {
+	logLevelsMu.RLock()
+	levels := logLevels
+	logLevelsMu.RUnlock()
+
+	if levels == nil {
+		var err error
+		// Invalid specs in the environment are ignored, we can't log yet
+		levels, err = ParseLogLevels(os.Getenv(EnvLogLevels))
+		if err != nil {
+			return zerolog.NoLevel, false
+		}
+	}
+
+	if l, ok := levels[strings.ToLower(name)]; ok {
+		return l, true
+	}
+	if !useDefault {
+		return zerolog.NoLevel, false
+	}
+	l, ok := levels[DefaultLogLevelKey]
+
+	return l, ok
+}
@@ -0,0 +1,75 @@
+package types_test
+
+import (
+	"github.com/kairos-io/kairos-sdk/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Log levels", func() {
+	Describe("ParseLogLevels", func() {
+		It("parses the name=level pairs", func() {
+			levels, err := types.ParseLogLevels(" Kcrypt=debug, ghw = trace,,default=warn ")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(levels).To(Equal(map[string]zerolog.Level{
+				"kcrypt":  zerolog.DebugLevel,
+				"ghw":     zerolog.TraceLevel,
+				"default": zerolog.WarnLevel,
+			}))
+		})
+
+		It("returns no levels for an empty spec", func() {
+			levels, err := types.ParseLogLevels("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(levels).To(BeEmpty())
+		})
+
+		DescribeTable("rejects invalid specs",
+			func(spec string) {
+				_, err := types.ParseLogLevels(spec)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("without level", "kcrypt"),
+			Entry("with an empty level", "kcrypt="),
+			Entry("without name", "=debug"),
+			Entry("with an unknown level", "kcrypt=verbose"),
+		)
+	})
+
+	Describe("SetLogLevels", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(types.EnvLogLevels, "")
+			DeferCleanup(func() { Expect(types.SetLogLevels("")).To(Succeed()) })
+		})
+
+		It("sets the level of the loggers by name", func() {
+			Expect(types.SetLogLevels("levels-test=debug")).To(Succeed())
+			Expect(types.NewKairosLogger("levels-test", "info", true).GetLevel()).To(Equal(zerolog.DebugLevel))
+			Expect(types.NewKairosLogger("other", "info", true).GetLevel()).To(Equal(zerolog.InfoLevel))
+		})
+
+		It("only uses the default level for loggers created without a level", func() {
+			Expect(types.SetLogLevels("default=error")).To(Succeed())
+			Expect(types.NewKairosLogger("levels-test", "", true).GetLevel()).To(Equal(zerolog.ErrorLevel))
+			Expect(types.NewKairosLogger("levels-test", "debug", true).GetLevel()).To(Equal(zerolog.DebugLevel))
+		})
+
+		It("takes precedence over the environment until cleared", func() {
+			GinkgoT().Setenv(types.EnvLogLevels, "levels-test=trace")
+			Expect(types.NewKairosLogger("levels-test", "info", true).GetLevel()).To(Equal(zerolog.TraceLevel))
+
+			Expect(types.SetLogLevels("levels-test=warn")).To(Succeed())
+			Expect(types.NewKairosLogger("levels-test", "info", true).GetLevel()).To(Equal(zerolog.WarnLevel))
+
+			Expect(types.SetLogLevels("")).To(Succeed())
+			Expect(types.NewKairosLogger("levels-test", "info", true).GetLevel()).To(Equal(zerolog.TraceLevel))
+		})
+
+		It("keeps the previous levels if the spec is invalid", func() {
+			Expect(types.SetLogLevels("levels-test=warn")).To(Succeed())
+			Expect(types.SetLogLevels("levels-test")).ToNot(Succeed())
+			Expect(types.NewKairosLogger("levels-test", "info", true).GetLevel()).To(Equal(zerolog.WarnLevel))
+		})
+	})
+})
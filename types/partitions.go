@@ -1,5 +1,13 @@
 package types
 
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog"
+)
+
 type Partition struct {
 	Name            string   `yaml:"-"`
 	FilesystemLabel string   `yaml:"label,omitempty" mapstructure:"label"`
@@ -10,13 +18,212 @@ type Partition struct {
 	MountPoint      string   `yaml:"-"`
 	Path            string   `yaml:"-"`
 	Disk            string   `yaml:"-"`
+	// PartitionLabel is the GPT partition name, which unlike the filesystem
+	// label is readable even when the partition is encrypted
+	PartitionLabel string `yaml:"-"`
+	// MappedBy is the path of the device-mapper device holding the partition
+	// (e.g. /dev/mapper/luks-xxx for an open LUKS partition)
+	MappedBy string `yaml:"-"`
+	// BackingDevice is set on device-mapper devices to the path of the
+	// partition holding their data
+	BackingDevice string `yaml:"-"`
+	// StartSector is the first 512-byte sector of the partition on the disk
+	StartSector uint64 `yaml:"-"`
+	StartBytes  uint64 `yaml:"-"`
+	// AlignmentOK is true when the partition starts on a 1MiB boundary
+	AlignmentOK bool `yaml:"-"`
+	// UsedBytes and AvailableBytes are the filesystem usage of mounted
+	// partitions. Only filled when requested, see ghw.Options
+	UsedBytes      uint64 `yaml:"-"`
+	AvailableBytes uint64 `yaml:"-"`
+	// SizeBytes is the exact size of discovered partitions, like
+	// Disk.SizeBytes. Size is in MiB, as in the partition layout of the
+	// configs, and kept for compatibility
+	SizeBytes uint64 `yaml:"-"`
+	// NeedsFsck is true when the filesystem is dirty and should be checked
+	// before mounting it. Only filled for unmounted ext and xfs partitions
+	// when requested, see ghw.Options
+	NeedsFsck bool `yaml:"-"`
 }
 
 type PartitionList []*Partition
 
+// The transports a disk can be attached through.
+const (
+	TransportNVMe   = "nvme"
+	TransportSATA   = "sata"
+	TransportUSB    = "usb"
+	TransportMMC    = "mmc"
+	TransportVirtio = "virtio"
+	TransportSCSI   = "scsi"
+)
+
 type Disk struct {
 	Name       string        `json:"name,omitempty" yaml:"name,omitempty"`
 	SizeBytes  uint64        `json:"size_bytes,omitempty" yaml:"size_bytes,omitempty"`
 	UUID       string        `json:"uuid,omitempty" yaml:"uuid,omitempty"`
 	Partitions PartitionList `json:"partitions,omitempty" yaml:"partitions,omitempty"`
+	// Transport is the bus the disk is attached through, one of the
+	// Transport constants, or empty when unknown
+	Transport string `json:"transport,omitempty" yaml:"transport,omitempty"`
+	// Parent is the NVMe controller of a namespace (nvme0 for nvme0n1) or the
+	// eMMC device of a hardware partition (mmcblk0 for mmcblk0boot0)
+	Parent string `json:"parent,omitempty" yaml:"parent,omitempty"`
+	// Namespace is the ID of an NVMe namespace
+	Namespace int `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// HardwarePartition is true for the eMMC boot and RPMB areas. They are
+	// listed as disks, but are not suitable install targets
+	HardwarePartition bool `json:"hardware_partition,omitempty" yaml:"hardware_partition,omitempty"`
+	// VolumeGroup is true for LVM volume groups, whose partitions are their
+	// logical volumes
+	VolumeGroup bool `json:"volume_group,omitempty" yaml:"volume_group,omitempty"`
+	// Raid is set on software RAID (md) devices
+	Raid *RaidInfo `json:"raid,omitempty" yaml:"raid,omitempty"`
+	// RaidMember is the path of the software RAID device the disk, or one of
+	// its partitions, is a member of. Such disks are not install candidates,
+	// the RAID device is
+	RaidMember string `json:"raid_member,omitempty" yaml:"raid_member,omitempty"`
+	// Removable is true for removable media, like USB sticks or SD cards
+	Removable bool `json:"removable,omitempty" yaml:"removable,omitempty"`
+	// Rotational is true for spinning disks
+	Rotational bool `json:"rotational,omitempty" yaml:"rotational,omitempty"`
+	// ReadOnly is true for disks that can't be written, like CD-ROMs or
+	// write-protected media
+	ReadOnly bool `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+}
+
+// RaidInfo describes a software RAID (md) device.
+type RaidInfo struct {
+	// Level is the RAID level, e.g. raid1
+	Level string `json:"level" yaml:"level"`
+	// Members are the paths of the disks or partitions in the array
+	Members []string `json:"members" yaml:"members"`
+	// Degraded is true when the array is missing members
+	Degraded bool `json:"degraded,omitempty" yaml:"degraded,omitempty"`
+}
+
+// String returns a one line human-readable summary of the partition.
+func (p Partition) String() string {
+	fields := []string{fmt.Sprintf("size: %s", p.sizeBytes())}
+	if p.FS != "" {
+		fields = append(fields, fmt.Sprintf("fs: %s", p.FS))
+	}
+	if p.FilesystemLabel != "" {
+		fields = append(fields, fmt.Sprintf("label: %s", p.FilesystemLabel))
+	}
+	if p.MountPoint != "" {
+		fields = append(fields, fmt.Sprintf("mountpoint: %s", p.MountPoint))
+	}
+
+	return fmt.Sprintf("%s (%s)", p.displayName(), strings.Join(fields, ", "))
+}
+
+// Table returns the partitions as an aligned table with one row per partition.
+func (pl PartitionList) Table() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tSIZE\tFS\tLABEL\tMOUNTPOINT")
+	for _, p := range pl {
+		if p == nil {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			p.displayName(), p.sizeBytes(),
+			orDash(p.FS), orDash(p.FilesystemLabel), orDash(p.MountPoint))
+	}
+	_ = w.Flush()
+
+	return b.String()
+}
+
+// String returns a one line human-readable summary of the disk.
+func (d Disk) String() string {
+	return fmt.Sprintf("%s (size: %s, partitions: %d)", d.Name, ByteSize(d.SizeBytes), len(d.Partitions))
+}
+
+// Table returns a human-readable summary of the disk followed by the table of
+// its partitions.
+func (d Disk) Table() string {
+	return fmt.Sprintf("%s\n%s", d.String(), d.Partitions.Table())
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler so partitions
+// can be logged as structured fields with Object().
+func (p Partition) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("name", p.Name).
+		Str("path", p.Path).
+		Str("disk", p.Disk).
+		Str("label", p.FilesystemLabel).
+		Str("fs", p.FS).
+		Uint("size_mib", p.Size).
+		Uint64("size_bytes", uint64(p.sizeBytes())).
+		Str("uuid", p.UUID)
+	if p.MountPoint != "" {
+		e.Str("mountpoint", p.MountPoint)
+	}
+	if p.MappedBy != "" {
+		e.Str("mapped_by", p.MappedBy)
+	}
+	if p.BackingDevice != "" {
+		e.Str("backing_device", p.BackingDevice)
+	}
+}
+
+// MarshalZerologArray implements zerolog.LogArrayMarshaler.
+func (pl PartitionList) MarshalZerologArray(a *zerolog.Array) {
+	for _, p := range pl {
+		if p != nil {
+			a.Object(p)
+		}
+	}
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (d Disk) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("name", d.Name).
+		Uint64("size_bytes", d.SizeBytes).
+		Str("uuid", d.UUID).
+		Array("partitions", d.Partitions)
+	if d.Transport != "" {
+		e.Str("transport", d.Transport)
+	}
+	if d.HardwarePartition {
+		e.Bool("hardware_partition", true)
+	}
+	if d.Raid != nil {
+		e.Str("raid_level", d.Raid.Level).Strs("raid_members", d.Raid.Members).Bool("raid_degraded", d.Raid.Degraded)
+	}
+	if d.RaidMember != "" {
+		e.Str("raid_member", d.RaidMember)
+	}
+	e.Bool("removable", d.Removable).Bool("rotational", d.Rotational).Bool("read_only", d.ReadOnly)
+}
+
+func (p Partition) displayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	if p.Path != "" {
+		return p.Path
+	}
+
+	return "-"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// sizeBytes returns SizeBytes, or Size converted when it's not set, as in the
+// partitions of the configs.
+func (p Partition) sizeBytes() ByteSize {
+	if p.SizeBytes != 0 {
+		return ByteSize(p.SizeBytes)
+	}
+
+	return ByteSize(p.Size) * MiB
 }
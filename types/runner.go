@@ -0,0 +1,87 @@
+package types
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Runner is our interface for methods that need to run commands, so they can
+// be faked in tests.
+type Runner interface {
+	// Run runs the command with the given arguments and returns its combined
+	// output
+	Run(command string, args ...string) ([]byte, error)
+	// RunCmd runs an already prepared command and returns its combined output
+	RunCmd(cmd *exec.Cmd) ([]byte, error)
+}
+
+// RealRunner runs the commands, logging them and their result at debug level
+// if a Logger is set.
+type RealRunner struct {
+	Logger *KairosLogger
+}
+
+func (r RealRunner) Run(command string, args ...string) ([]byte, error) {
+	return r.RunCmd(exec.Command(command, args...))
+}
+
+func (r RealRunner) RunCmd(cmd *exec.Cmd) ([]byte, error) {
+	out, err := cmd.CombinedOutput()
+	if r.Logger != nil {
+		ev := r.Logger.Logger.Debug()
+		if err != nil {
+			ev = ev.Err(err)
+		}
+		ev.Str("command", strings.Join(cmd.Args, " ")).Str("output", string(out)).Msg("Ran command")
+	}
+
+	return out, err
+}
+
+// FakeRunner records the commands instead of running them. It's meant for
+// tests and is safe for concurrent use.
+type FakeRunner struct {
+	// SideEffect, if set, is called for every command and its result is
+	// returned. Otherwise Output and Err are returned.
+	SideEffect func(command string, args ...string) ([]byte, error)
+	Output     []byte
+	Err        error
+
+	mu   sync.Mutex
+	cmds [][]string
+}
+
+func (r *FakeRunner) Run(command string, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	r.cmds = append(r.cmds, append([]string{command}, args...))
+	r.mu.Unlock()
+
+	if r.SideEffect != nil {
+		return r.SideEffect(command, args...)
+	}
+	return r.Output, r.Err
+}
+
+func (r *FakeRunner) RunCmd(cmd *exec.Cmd) ([]byte, error) {
+	return r.Run(cmd.Args[0], cmd.Args[1:]...)
+}
+
+// Cmds returns the commands run so far, each one with its arguments.
+func (r *FakeRunner) Cmds() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([][]string, len(r.cmds))
+	for i, c := range r.cmds {
+		result[i] = append([]string{}, c...)
+	}
+	return result
+}
+
+// Reset forgets the commands run so far.
+func (r *FakeRunner) Reset() {
+	r.mu.Lock()
+	r.cmds = nil
+	r.mu.Unlock()
+}
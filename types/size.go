@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ByteSize is a size in bytes, with helpers to convert it to the binary units
+// used across Kairos.
+type ByteSize uint64
+
+const (
+	KiB ByteSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+	PiB
+	EiB
+)
+
+// MiB returns the size in mebibytes.
+func (b ByteSize) MiB() float64 {
+	return float64(b) / float64(MiB)
+}
+
+// GiB returns the size in gibibytes.
+func (b ByteSize) GiB() float64 {
+	return float64(b) / float64(GiB)
+}
+
+// HumanReadable formats the size using the largest binary unit that keeps it
+// above 1 (e.g. 512MiB, 1.5GiB).
+func (b ByteSize) HumanReadable() string {
+	if b < KiB {
+		return fmt.Sprintf("%dB", uint64(b))
+	}
+
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	value := float64(b) / float64(KiB)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", value), "0"), ".") + units[i]
+}
+
+// String implements fmt.Stringer with HumanReadable.
+func (b ByteSize) String() string {
+	return b.HumanReadable()
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SyscallInterface is our interface for methods that need syscalls to mount
+// filesystems or change the root, so they can be faked in tests.
+type SyscallInterface interface {
+	Chroot(path string) error
+	Chdir(path string) error
+	Mount(source, target, fstype string, flags uintptr, data string) error
+	Unmount(target string, flags int) error
+}
+
+// RealSyscall calls the syscalls, logging them at debug level if a Logger is
+// set. Only Chdir is supported outside Linux.
+type RealSyscall struct {
+	Logger *KairosLogger
+}
+
+func (s RealSyscall) log(call string, err error, args ...interface{}) {
+	if s.Logger == nil {
+		return
+	}
+	ev := s.Logger.Logger.Debug()
+	if err != nil {
+		ev = ev.Err(err)
+	}
+	ev.Str("syscall", fmt.Sprintf("%s%v", call, args)).Msg("Called syscall")
+}
+
+// FakeSyscall records the syscalls instead of calling them. It's meant for
+// tests and is safe for concurrent use.
+type FakeSyscall struct {
+	// Err, if set, is returned by every call
+	Err error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *FakeSyscall) record(call string, args ...interface{}) error {
+	s.mu.Lock()
+	s.calls = append(s.calls, fmt.Sprintf("%s%v", call, args))
+	s.mu.Unlock()
+	return s.Err
+}
+
+func (s *FakeSyscall) Chroot(path string) error {
+	return s.record("chroot", path)
+}
+
+func (s *FakeSyscall) Chdir(path string) error {
+	return s.record("chdir", path)
+}
+
+func (s *FakeSyscall) Mount(source, target, fstype string, flags uintptr, data string) error {
+	return s.record("mount", source, target, fstype, flags, data)
+}
+
+func (s *FakeSyscall) Unmount(target string, flags int) error {
+	return s.record("unmount", target, flags)
+}
+
+// Calls returns the syscalls made so far, formatted like "mount[src dst ext4 0 ]".
+func (s *FakeSyscall) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.calls...)
+}
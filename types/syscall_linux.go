@@ -0,0 +1,27 @@
+package types
+
+import "syscall"
+
+func (s RealSyscall) Chroot(path string) error {
+	err := syscall.Chroot(path)
+	s.log("chroot", err, path)
+	return err
+}
+
+func (s RealSyscall) Chdir(path string) error {
+	err := syscall.Chdir(path)
+	s.log("chdir", err, path)
+	return err
+}
+
+func (s RealSyscall) Mount(source, target, fstype string, flags uintptr, data string) error {
+	err := syscall.Mount(source, target, fstype, flags, data)
+	s.log("mount", err, source, target, fstype, flags, data)
+	return err
+}
+
+func (s RealSyscall) Unmount(target string, flags int) error {
+	err := syscall.Unmount(target, flags)
+	s.log("unmount", err, target, flags)
+	return err
+}
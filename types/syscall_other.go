@@ -0,0 +1,31 @@
+//go:build !linux
+
+package types
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errSyscallUnsupported = errors.New("only supported on Linux")
+
+func (s RealSyscall) Chroot(path string) error {
+	s.log("chroot", errSyscallUnsupported, path)
+	return errSyscallUnsupported
+}
+
+func (s RealSyscall) Chdir(path string) error {
+	err := syscall.Chdir(path)
+	s.log("chdir", err, path)
+	return err
+}
+
+func (s RealSyscall) Mount(source, target, fstype string, flags uintptr, data string) error {
+	s.log("mount", errSyscallUnsupported, source, target, fstype, flags, data)
+	return errSyscallUnsupported
+}
+
+func (s RealSyscall) Unmount(target string, flags int) error {
+	s.log("unmount", errSyscallUnsupported, target, flags)
+	return errSyscallUnsupported
+}
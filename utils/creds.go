@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CredentialKey selects the key systemd-creds uses to encrypt a credential.
+type CredentialKey string
+
+const (
+	// CredentialKeyAuto uses the TPM2 if available and the host key otherwise
+	CredentialKeyAuto CredentialKey = "auto"
+	// CredentialKeyTPM2 binds the credential to the TPM2 of the machine
+	CredentialKeyTPM2 CredentialKey = "tpm2"
+	// CredentialKeyHostTPM2 requires both the host key and the TPM2
+	CredentialKeyHostTPM2 CredentialKey = "host+tpm2"
+)
+
+// EncryptCredential encrypts a secret with systemd-creds so it can be stored
+// on disk instead of in plain text. The name is embedded in the credential
+// and must be passed again to DecryptCredential. If key is empty,
+// CredentialKeyAuto is used.
+func EncryptCredential(name string, secret []byte, key CredentialKey) ([]byte, error) {
+	if name == "" {
+		return nil, errors.New("credential name is empty")
+	}
+	if key == "" {
+		key = CredentialKeyAuto
+	}
+
+	return systemdCreds(secret, "encrypt", fmt.Sprintf("--name=%s", name), fmt.Sprintf("--with-key=%s", key), "-", "-")
+}
+
+// DecryptCredential decrypts a credential created by EncryptCredential with
+// the same name.
+func DecryptCredential(name string, credential []byte) ([]byte, error) {
+	if name == "" {
+		return nil, errors.New("credential name is empty")
+	}
+
+	return systemdCreds(credential, "decrypt", fmt.Sprintf("--name=%s", name), "-", "-")
+}
+
+func systemdCreds(stdin []byte, args ...string) ([]byte, error) {
+	bin, err := exec.LookPath("systemd-creds")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-creds not available: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("systemd-creds %s: %s: %w", args[0], strings.TrimSpace(stderr.String()), err)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// OSReleaseBackupSuffix is appended to the release file name to store the
+// previous content when WriteOSReleaseVariables changes it.
+const OSReleaseBackupSuffix = ".bak"
+
+var osReleaseKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WriteOSReleaseVariables sets the given variables in the /etc/kairos-release file
+// or, if a second argument is passed, in the file specified by the second argument.
+// Keys are prefixed with KAIROS_ (unless they already are) so they can be read back
+// with OSRelease. Existing keys are updated in place and new keys are appended,
+// leaving the rest of the file untouched. Values are double quoted, except the
+// ones ending in a double quote, which are single quoted as godotenv can't read
+// them back otherwise. Values that can't be quoted either way, ending in a
+// backslash or ending in a double quote and containing a single quote or a
+// newline, are rejected.
+// If the file changes, the previous content is kept in a backup file next to it
+// and the new content is written atomically. Writing values that are already
+// set is a no-op.
+func WriteOSReleaseVariables(vars map[string]string, file ...string) error {
+	if len(file) > 1 {
+		return fmt.Errorf("too many arguments passed")
+	}
+	osReleaseFile := "/etc/kairos-release"
+	if len(file) > 0 {
+		osReleaseFile = file[0]
+	}
+
+	pending := map[string]string{}
+	for k, v := range vars {
+		if !strings.HasPrefix(k, "KAIROS_") {
+			k = "KAIROS_" + k
+		}
+		if !osReleaseKey.MatchString(k) {
+			return fmt.Errorf("invalid key %q", k)
+		}
+		quoted, err := quoteOSReleaseValue(v)
+		if err != nil {
+			return fmt.Errorf("value of %s: %w", k, err)
+		}
+		pending[k] = quoted
+	}
+
+	perm := os.FileMode(0644)
+	original, err := os.ReadFile(osReleaseFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info, err := os.Stat(osReleaseFile); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(original))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key := osReleaseLineKey(line)
+		if v, ok := pending[key]; ok {
+			line = fmt.Sprintf("%s=%s", key, v)
+			delete(pending, key)
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Append the new keys sorted, so the result doesn't depend on map ordering
+	keys := make([]string, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&out, "%s=%s\n", k, pending[k])
+	}
+
+	if bytes.Equal(out.Bytes(), original) {
+		return nil
+	}
+
+	if original != nil {
+		if err := os.WriteFile(osReleaseFile+OSReleaseBackupSuffix, original, perm); err != nil {
+			return fmt.Errorf("writing backup: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(osReleaseFile), filepath.Base(osReleaseFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), osReleaseFile)
+}
+
+// osReleaseLineKey returns the key defined in the given line, or an empty
+// string for comments and lines without assignments.
+func osReleaseLineKey(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+	line = strings.TrimPrefix(line, "export ")
+	key, _, found := strings.Cut(line, "=")
+	if !found {
+		return ""
+	}
+
+	return strings.TrimSpace(key)
+}
+
+// quoteOSReleaseValue double quotes the value, escaping the characters that
+// have a special meaning inside double quotes. godotenv (used by OSRelease)
+// can't read back double quoted values ending in an escaped character, so
+// those are single quoted instead when possible.
+func quoteOSReleaseValue(v string) (string, error) {
+	if strings.HasSuffix(v, `\`) {
+		return "", fmt.Errorf("can't quote %q", v)
+	}
+	if strings.HasSuffix(v, `"`) {
+		if strings.ContainsAny(v, "'\n") {
+			return "", fmt.Errorf("can't quote %q", v)
+		}
+		return "'" + v + "'", nil
+	}
+
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"$", `\$`,
+		"`", "\\`",
+		"\n", `\n`,
+	)
+
+	return `"` + r.Replace(v) + `"`, nil
+}
@@ -0,0 +1,79 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WriteOSReleaseVariables", func() {
+	var file string
+
+	BeforeEach(func() {
+		file = filepath.Join(GinkgoT().TempDir(), "kairos-release")
+		Expect(os.WriteFile(file, []byte("# comment\nKAIROS_NAME=\"kairos\"\nKAIROS_VERSION=\"v1.0.0\"\n"), 0600)).To(Succeed())
+	})
+
+	read := func() string {
+		b, err := os.ReadFile(file)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("updates the existing keys in place and appends the new ones sorted", func() {
+		Expect(utils.WriteOSReleaseVariables(map[string]string{
+			"VERSION":      "v1.1.0",
+			"KAIROS_MODEL": "rpi4",
+			"FLAVOR":       "ubuntu",
+		}, file)).To(Succeed())
+
+		Expect(read()).To(Equal("# comment\nKAIROS_NAME=\"kairos\"\nKAIROS_VERSION=\"v1.1.0\"\nKAIROS_FLAVOR=\"ubuntu\"\nKAIROS_MODEL=\"rpi4\"\n"))
+		backup, err := os.ReadFile(file + utils.OSReleaseBackupSuffix)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(backup)).To(ContainSubstring("KAIROS_VERSION=\"v1.0.0\""))
+
+		info, err := os.Stat(file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("doesn't touch the file when the values are already set", func() {
+		Expect(utils.WriteOSReleaseVariables(map[string]string{"NAME": "kairos"}, file)).To(Succeed())
+		Expect(file + utils.OSReleaseBackupSuffix).ToNot(BeAnExistingFile())
+	})
+
+	DescribeTable("quotes the values so OSRelease reads them back",
+		func(value, line string) {
+			Expect(utils.WriteOSReleaseVariables(map[string]string{"VALUE": value}, file)).To(Succeed())
+			Expect(read()).To(ContainSubstring("\n" + line + "\n"))
+
+			v, err := utils.OSRelease("VALUE", file)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(value))
+		},
+		Entry("plain", "v1.0.0", `KAIROS_VALUE="v1.0.0"`),
+		Entry("empty", "", `KAIROS_VALUE=""`),
+		Entry("with spaces", "Kairos Linux", `KAIROS_VALUE="Kairos Linux"`),
+		Entry("with shell characters", "$HOME `id`", "KAIROS_VALUE=\"\\$HOME \\`id\\`\""),
+		Entry("with inner double quotes", `say "hi" now`, `KAIROS_VALUE="say \"hi\" now"`),
+		Entry("with a backslash", `a\b`, `KAIROS_VALUE="a\\b"`),
+		Entry("ending in a double quote, single quoted", `say "hi"`, `KAIROS_VALUE='say "hi"'`),
+	)
+
+	DescribeTable("rejects the values that can't be quoted",
+		func(value string) {
+			Expect(utils.WriteOSReleaseVariables(map[string]string{"VALUE": value}, file)).ToNot(Succeed())
+			Expect(read()).ToNot(ContainSubstring("KAIROS_VALUE"))
+		},
+		Entry("ending in a backslash", `a\`),
+		Entry("ending in a double quote with a single quote", `it's "it"`),
+		Entry("ending in a double quote with a newline", "a\n\"b\""),
+	)
+
+	It("rejects invalid keys", func() {
+		Expect(utils.WriteOSReleaseVariables(map[string]string{"BAD KEY": "v"}, file)).ToNot(Succeed())
+	})
+})
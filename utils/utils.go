@@ -257,11 +257,14 @@ func PrintBanner(d []byte) {
 	fmt.Print(converter.Image2ASCIIString(img, &convertOptions))
 }
 
+// Deprecated: use machine.Reboot, which notifies the logged-in users and uses
+// the init system to reboot.
 func Reboot() {
 	pterm.Info.Println("Rebooting node")
 	SH("reboot") //nolint:errcheck
 }
 
+// Deprecated: use machine.Poweroff.
 func PowerOFF() {
 	pterm.Info.Println("Shutdown node")
 	if IsOpenRCBased() {
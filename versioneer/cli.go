@@ -1,7 +1,9 @@
 package versioneer
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/urfave/cli/v2"
 )
@@ -63,6 +65,13 @@ var (
 		EnvVars: []string{EnvVarSoftwareVersionPrefix},
 	}
 
+	softwareFlag *cli.StringFlag = &cli.StringFlag{
+		Name:    "software",
+		Value:   "",
+		Usage:   "additional software in the image, as a comma separated list of name:version (e.g. \"k0s:v1.30.1+k0s.0\")",
+		EnvVars: []string{EnvVarSoftware},
+	}
+
 	registryAndOrgFlag *cli.StringFlag = &cli.StringFlag{
 		Name:    "registry-and-org",
 		Value:   "",
@@ -104,6 +113,80 @@ var (
 		Usage:   "family of the underlying distro (rhel, ubuntu, opensuse, etc...)",
 		EnvVars: []string{EnvVarFamily},
 	}
+
+	maxTagLengthFlag *cli.IntFlag = &cli.IntFlag{
+		Name:    "max-tag-length",
+		Value:   MaxTagLength,
+		Usage:   "the maximum tag length accepted by the registry",
+		EnvVars: []string{EnvVarMaxTagLength},
+	}
+
+	tagSeparatorFlag *cli.StringFlag = &cli.StringFlag{
+		Name:    "tag-separator",
+		Value:   DefaultTagPolicy.Separator,
+		Usage:   "the string used to replace characters not allowed in tags",
+		EnvVars: []string{EnvVarTagSeparator},
+	}
+
+	keepLastFlag *cli.IntFlag = &cli.IntFlag{
+		Name:  "keep-last",
+		Value: 5,
+		Usage: "the number of newest tags to keep for each stream (tags differing only in their versions), 0 requires --older-than",
+	}
+
+	olderThanFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name:  "older-than",
+		Value: 0,
+		Usage: "only delete tags of images created before this duration ago (e.g. 720h)",
+	}
+
+	deleteFlag *cli.BoolFlag = &cli.BoolFlag{
+		Name:  "delete",
+		Value: false,
+		Usage: "delete the tags, otherwise only the tags that would be deleted are printed",
+	}
+
+	strictFlag *cli.BoolFlag = &cli.BoolFlag{
+		Name:    "strict",
+		Value:   false,
+		Usage:   "only accept the official variants, flavors and models",
+		EnvVars: []string{EnvVarStrict},
+	}
+
+	hashLongTagsFlag *cli.BoolFlag = &cli.BoolFlag{
+		Name:    "hash-long-tags",
+		Value:   false,
+		Usage:   "truncate tags longer than max-tag-length and suffix them with a short digest instead of failing",
+		EnvVars: []string{EnvVarHashLongTags},
+	}
+
+	prFlag *cli.IntFlag = &cli.IntFlag{
+		Name:    "pr",
+		Value:   0,
+		Usage:   "the pull request number of a dev build, 0 for branch builds",
+		EnvVars: []string{EnvVarDevPR},
+	}
+
+	shaFlag *cli.StringFlag = &cli.StringFlag{
+		Name:    "sha",
+		Value:   "",
+		Usage:   "the commit SHA of a dev build",
+		EnvVars: []string{EnvVarDevSHA},
+	}
+
+	keyIDFlag *cli.StringFlag = &cli.StringFlag{
+		Name:    "key-id",
+		Value:   "",
+		Usage:   "identifier of the key the trusted boot artifacts are signed with (e.g. a certificate fingerprint)",
+		EnvVars: []string{EnvVarKeyID},
+	}
+
+	certFlag *cli.StringFlag = &cli.StringFlag{
+		Name:    "cert",
+		Value:   "",
+		Usage:   "PEM encoded certificate of the key the trusted boot artifacts are signed with, used instead of --key-id",
+		EnvVars: []string{EnvVarCert},
+	}
 )
 
 func CliCommands() []*cli.Command {
@@ -112,16 +195,52 @@ func CliCommands() []*cli.Command {
 			Name:  "container-artifact-name",
 			Usage: "generates an artifact name for Kairos OCI images",
 			Flags: []cli.Flag{
-				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag,
-				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag, registryAndOrgFlag,
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag,
+				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag, softwareFlag, registryAndOrgFlag,
+				maxTagLengthFlag, tagSeparatorFlag, hashLongTagsFlag,
+			},
+			Action: func(cCtx *cli.Context) error {
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+
+				result, report, err := a.ContainerNameWithPolicy(cCtx.String(registryAndOrgFlag.Name), tagPolicyFromFlags(cCtx))
+				if err != nil {
+					return err
+				}
+				if report.Truncated {
+					fmt.Fprintf(os.Stderr, "warning: %s\n", report.String())
+				}
+				fmt.Println(result)
+
+				return nil
+			},
+		},
+		{
+			Name:  "dev-container-artifact-name",
+			Usage: "generates an artifact name for Kairos OCI images built from a pull request or branch",
+			Flags: []cli.Flag{
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag,
+				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag, softwareFlag, registryAndOrgFlag,
+				maxTagLengthFlag, tagSeparatorFlag, hashLongTagsFlag, prFlag, shaFlag,
 			},
 			Action: func(cCtx *cli.Context) error {
-				a := artifactFromFlags(cCtx)
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+				if a.Version, err = a.DevVersion(prFlag.Get(cCtx), shaFlag.Get(cCtx)); err != nil {
+					return err
+				}
 
-				result, err := a.ContainerName(cCtx.String(registryAndOrgFlag.Name))
+				result, report, err := a.ContainerNameWithPolicy(cCtx.String(registryAndOrgFlag.Name), tagPolicyFromFlags(cCtx))
 				if err != nil {
 					return err
 				}
+				if report.Truncated {
+					fmt.Fprintf(os.Stderr, "warning: %s\n", report.String())
+				}
 				fmt.Println(result)
 
 				return nil
@@ -131,11 +250,14 @@ func CliCommands() []*cli.Command {
 			Name:  "bootable-artifact-name",
 			Usage: "generates a name for bootable artifacts (e.g. iso files)",
 			Flags: []cli.Flag{
-				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag,
-				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag,
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag,
+				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag, softwareFlag,
 			},
 			Action: func(cCtx *cli.Context) error {
-				a := artifactFromFlags(cCtx)
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
 
 				result, err := a.BootableName()
 				if err != nil {
@@ -146,15 +268,72 @@ func CliCommands() []*cli.Command {
 				return nil
 			},
 		},
+		{
+			Name:  "uki-artifact-name",
+			Usage: "generates a name for trusted boot Unified Kernel Images (.efi files)",
+			Flags: []cli.Flag{
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag,
+				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag, softwareFlag,
+				keyIDFlag, certFlag,
+			},
+			Action: func(cCtx *cli.Context) error {
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+				keyID, err := keyIDFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+
+				result, err := a.UKIName(keyID)
+				if err != nil {
+					return err
+				}
+				fmt.Println(result)
+
+				return nil
+			},
+		},
+		{
+			Name:  "signed-iso-artifact-name",
+			Usage: "generates a name for trusted boot iso files",
+			Flags: []cli.Flag{
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag,
+				versionFlag, softwareVersionFlag, softwareVersionPrefixFlag, softwareFlag,
+				keyIDFlag, certFlag,
+			},
+			Action: func(cCtx *cli.Context) error {
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+				keyID, err := keyIDFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+
+				result, err := a.SignedISOName(keyID)
+				if err != nil {
+					return err
+				}
+				fmt.Println(result)
+
+				return nil
+			},
+		},
 		{
 			Name:  "base-container-artifact-name",
 			Usage: "generates a name for base (not yet Kairos) images",
 			Flags: []cli.Flag{
-				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag,
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag,
 				registryAndOrgFlag, idFlag,
 			},
 			Action: func(cCtx *cli.Context) error {
-				a := artifactFromFlags(cCtx)
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
 
 				result, err := a.BaseContainerName(
 					cCtx.String(registryAndOrgFlag.Name), cCtx.String(idFlag.Name))
@@ -170,12 +349,15 @@ func CliCommands() []*cli.Command {
 			Name:  "os-release-variables",
 			Usage: "generates a set of variables to be appended in the /etc/kairos-release file",
 			Flags: []cli.Flag{
-				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, versionFlag,
-				softwareVersionFlag, softwareVersionPrefixFlag, registryAndOrgFlag, bugReportURLFlag, projectHomeURLFlag,
+				flavorFlag, flavorReleaseFlag, variantFlag, modelFlag, archFlag, strictFlag, versionFlag,
+				softwareVersionFlag, softwareVersionPrefixFlag, softwareFlag, registryAndOrgFlag, bugReportURLFlag, projectHomeURLFlag,
 				githubRepoFlag, familyFlag,
 			},
 			Action: func(cCtx *cli.Context) error {
-				a := artifactFromFlags(cCtx)
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
 
 				result, err := a.OSReleaseVariables(
 					registryAndOrgFlag.Get(cCtx),
@@ -193,10 +375,56 @@ func CliCommands() []*cli.Command {
 				return nil
 			},
 		},
+		{
+			Name:  "prune",
+			Usage: "deletes old image tags from the registry, keeping the newest ones of each stream",
+			Flags: []cli.Flag{
+				flavorFlag, registryAndOrgFlag, keepLastFlag, olderThanFlag, deleteFlag,
+			},
+			Action: func(cCtx *cli.Context) error {
+				registryAndOrg := registryAndOrgFlag.Get(cCtx)
+				if registryAndOrg == "" {
+					return errors.New("registry-and-org must be set")
+				}
+				a, err := artifactFromFlags(cCtx)
+				if err != nil {
+					return err
+				}
+				if a.Flavor == "" {
+					return errors.New("flavor must be set")
+				}
+
+				tl, err := (&DefaultRegistryInspector{}).TagList(registryAndOrg, &a)
+				if err != nil {
+					return err
+				}
+
+				policy := RetentionPolicy{
+					KeepLast:  keepLastFlag.Get(cCtx),
+					OlderThan: olderThanFlag.Get(cCtx),
+					Delete:    deleteFlag.Get(cCtx),
+				}
+				result, err := tl.Prune(policy, nil)
+				for _, image := range result.Deleted {
+					if policy.Delete {
+						fmt.Printf("deleted %s\n", image)
+					} else {
+						fmt.Printf("would delete %s\n", image)
+					}
+				}
+
+				return err
+			},
+		},
 	}
 }
 
-func artifactFromFlags(cCtx *cli.Context) Artifact {
+func artifactFromFlags(cCtx *cli.Context) (Artifact, error) {
+	software, err := ParseSoftwareComponents(softwareFlag.Get(cCtx))
+	if err != nil {
+		return Artifact{}, err
+	}
+
 	return Artifact{
 		Flavor:                flavorFlag.Get(cCtx),
 		Family:                familyFlag.Get(cCtx),
@@ -207,5 +435,34 @@ func artifactFromFlags(cCtx *cli.Context) Artifact {
 		Version:               versionFlag.Get(cCtx),
 		SoftwareVersion:       softwareVersionFlag.Get(cCtx),
 		SoftwareVersionPrefix: softwareVersionPrefixFlag.Get(cCtx),
+		Software:              software,
+		Strict:                strictFlag.Get(cCtx),
+	}, nil
+}
+
+// keyIDFromFlags returns the key identifier given with --key-id, or the one of
+// the certificate given with --cert.
+func keyIDFromFlags(cCtx *cli.Context) (string, error) {
+	keyID, cert := keyIDFlag.Get(cCtx), certFlag.Get(cCtx)
+	if cert == "" {
+		return keyID, nil
+	}
+	if keyID != "" {
+		return "", errors.New("only one of --key-id and --cert can be set")
+	}
+
+	certPEM, err := os.ReadFile(cert)
+	if err != nil {
+		return "", err
+	}
+
+	return KeyIDFromCertificate(certPEM)
+}
+
+func tagPolicyFromFlags(cCtx *cli.Context) TagPolicy {
+	return TagPolicy{
+		MaxLength:    maxTagLengthFlag.Get(cCtx),
+		Separator:    tagSeparatorFlag.Get(cCtx),
+		HashFallback: hashLongTagsFlag.Get(cCtx),
 	}
 }
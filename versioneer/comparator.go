@@ -0,0 +1,123 @@
+package versioneer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// VersionComparator compares the versions found in tags. TagList uses it to
+// sort tags and to find newer versions.
+type VersionComparator interface {
+	// Compare returns -1, 0 or +1 depending on whether v < w, v == w or v > w
+	Compare(v, w string) int
+	// IsPrerelease returns true if v is a pre-release version
+	IsPrerelease(v string) bool
+	// Stream returns the release stream of v, e.g. "v2.4" for "v2.4.3", or
+	// an empty string if v has none. The UpgradeLTS strategy only upgrades
+	// within the same stream.
+	Stream(v string) string
+}
+
+// SemverComparator compares versions following semver strictly. It's the
+// default VersionComparator.
+type SemverComparator struct{}
+
+func (SemverComparator) Compare(v, w string) int {
+	return semver.Compare(v, w)
+}
+
+func (SemverComparator) IsPrerelease(v string) bool {
+	return semver.IsValid(v) && semver.Prerelease(v) != ""
+}
+
+// Stream returns the major and minor version of v.
+func (SemverComparator) Stream(v string) string {
+	return semver.MajorMinor(v)
+}
+
+// DefaultPrereleaseChannels are the pre-release channels known by
+// ChannelComparator, from the lowest to the highest.
+var DefaultPrereleaseChannels = []string{"nightly", "alpha", "beta", "rc"}
+
+// channelPattern splits pre-releases like "-rc10", "-beta.2" or
+// "-nightly.20240501" in the channel and the build number or date.
+var channelPattern = regexp.MustCompile(`^-([a-zA-Z]+)[.-]?(\d+)$`)
+
+// ChannelComparator compares versions like SemverComparator, except for
+// pre-releases made of a channel and a build number or date (e.g. "-rc10",
+// "-beta.2" or "-nightly.20240501"). Those are ordered by the rank of the
+// channel and then numerically, so "-rc10" is higher than "-rc9", which
+// semver orders the other way around.
+type ChannelComparator struct {
+	// Channels ranks the channels from the lowest to the highest. Defaults to
+	// DefaultPrereleaseChannels.
+	Channels []string
+}
+
+func (c ChannelComparator) Compare(v, w string) int {
+	if !semver.IsValid(v) || !semver.IsValid(w) {
+		return semver.Compare(v, w)
+	}
+
+	vPre, wPre := semver.Prerelease(v), semver.Prerelease(w)
+	if result := semver.Compare(strings.TrimSuffix(semver.Canonical(v), vPre), strings.TrimSuffix(semver.Canonical(w), wPre)); result != 0 {
+		return result
+	}
+
+	vRank, vBuild, vOK := c.channel(vPre)
+	wRank, wBuild, wOK := c.channel(wPre)
+	if !vOK || !wOK {
+		return semver.Compare(v, w)
+	}
+	if vRank != wRank {
+		return compareInts(vRank, wRank)
+	}
+	return compareInts(vBuild, wBuild)
+}
+
+func (c ChannelComparator) IsPrerelease(v string) bool {
+	return SemverComparator{}.IsPrerelease(v)
+}
+
+func (c ChannelComparator) Stream(v string) string {
+	return SemverComparator{}.Stream(v)
+}
+
+// channel returns the rank of the pre-release channel and its build number.
+// The last value is false if the pre-release doesn't follow the channel
+// format or the channel is unknown.
+func (c ChannelComparator) channel(prerelease string) (int, uint64, bool) {
+	channels := c.Channels
+	if len(channels) == 0 {
+		channels = DefaultPrereleaseChannels
+	}
+
+	matches := channelPattern.FindStringSubmatch(prerelease)
+	if len(matches) != 3 {
+		return 0, 0, false
+	}
+	build, err := strconv.ParseUint(matches[2], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	for i, ch := range channels {
+		if strings.EqualFold(ch, matches[1]) {
+			return i, build, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func compareInts[T int | uint64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package versioneer_test
+
+import (
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VersionComparator", func() {
+	// Versions from the lowest to the highest, according to ChannelComparator
+	ordered := []string{
+		"v2.4.3-nightly.20240430",
+		"v2.4.3-nightly.20240501",
+		"v2.4.3-alpha1",
+		"v2.4.3-beta.2",
+		"v2.4.3-beta.10",
+		"v2.4.3-rc2",
+		"v2.4.3-rc10",
+		"v2.4.3",
+		"v2.4.10-nightly.20240101",
+		"v2.4.10",
+	}
+
+	It("orders channels and build numbers with ChannelComparator", func() {
+		c := versioneer.ChannelComparator{}
+		for i := range ordered {
+			for j := range ordered {
+				expected := 0
+				if i < j {
+					expected = -1
+				} else if i > j {
+					expected = 1
+				}
+				Expect(c.Compare(ordered[i], ordered[j])).To(Equal(expected), "%s vs %s", ordered[i], ordered[j])
+			}
+		}
+	})
+
+	It("orders build numbers lexically with SemverComparator", func() {
+		c := versioneer.SemverComparator{}
+		Expect(c.Compare("v2.4.3-rc10", "v2.4.3-rc2")).To(Equal(-1))
+		Expect(c.Compare("v2.4.3-rc2", "v2.4.3")).To(Equal(-1))
+	})
+
+	It("uses the given channel ranks", func() {
+		c := versioneer.ChannelComparator{Channels: []string{"rc", "nightly"}}
+		Expect(c.Compare("v2.4.3-nightly.20240501", "v2.4.3-rc10")).To(Equal(1))
+		// Unknown channels fall back to semver
+		Expect(c.Compare("v2.4.3-beta2", "v2.4.3-alpha3")).To(Equal(1))
+	})
+
+	It("reports pre-releases", func() {
+		for _, c := range []versioneer.VersionComparator{versioneer.SemverComparator{}, versioneer.ChannelComparator{}} {
+			Expect(c.IsPrerelease("v2.4.3-rc1")).To(BeTrue())
+			Expect(c.IsPrerelease("v2.4.3")).To(BeFalse())
+			Expect(c.IsPrerelease("latest")).To(BeFalse())
+		}
+	})
+
+	It("reports the major and minor version as the release stream", func() {
+		for _, c := range []versioneer.VersionComparator{versioneer.SemverComparator{}, versioneer.ChannelComparator{}} {
+			Expect(c.Stream("v2.4.3-rc1")).To(Equal("v2.4"))
+			Expect(c.Stream("v1.26.9+k3s1")).To(Equal("v1.26"))
+			Expect(c.Stream("latest")).To(BeEmpty())
+		}
+	})
+
+	It("is used by the TagList operations", func() {
+		tl := versioneer.TagList{
+			Artifact: &versioneer.Artifact{
+				Flavor:        "opensuse",
+				FlavorRelease: "leap-15.5",
+				Variant:       "core",
+				Model:         "generic",
+				Arch:          "amd64",
+				Version:       "v2.4.3-rc9",
+			},
+			Tags: []string{
+				"leap-15.5-core-amd64-generic-v2.4.3-rc10",
+				"leap-15.5-core-amd64-generic-v2.4.3-rc2",
+				"leap-15.5-core-amd64-generic-v2.4.3",
+			},
+		}
+		Expect(tl.NewerVersions().Tags).To(Equal([]string{
+			"leap-15.5-core-amd64-generic-v2.4.3",
+		}))
+
+		tl.Comparator = versioneer.ChannelComparator{}
+		Expect(tl.NewerVersions().Sorted().Tags).To(Equal([]string{
+			"leap-15.5-core-amd64-generic-v2.4.3-rc10",
+			"leap-15.5-core-amd64-generic-v2.4.3",
+		}))
+	})
+})
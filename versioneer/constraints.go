@@ -0,0 +1,78 @@
+package versioneer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Variants are the Kairos variants: core images only have the OS, standard
+// ones also have the Kubernetes distribution.
+var Variants = []string{"core", "standard"}
+
+// FlavorFamilies maps the official flavors to the family of distros they
+// belong to, as set in KAIROS_FAMILY.
+var FlavorFamilies = map[string]string{
+	"alpine":     "alpine",
+	"debian":     "debian",
+	"ubuntu":     "ubuntu",
+	"fedora":     "rhel",
+	"rockylinux": "rhel",
+	"almalinux":  "rhel",
+	"rhel":       "rhel",
+	"opensuse":   "opensuse",
+	"sles":       "opensuse",
+	"hadron":     "hadron",
+}
+
+// ModelArchs maps the models to the architectures they are built for. An
+// empty list means the model is built for any architecture.
+var ModelArchs = map[string][]string{
+	"generic":                {},
+	"rpi3":                   {"arm64"},
+	"rpi4":                   {"arm64"},
+	"rpi5":                   {"arm64"},
+	"nvidia-jetson-agx-orin": {"arm64"},
+	"nvidia-jetson-orin-nx":  {"arm64"},
+}
+
+// validateVariant checks the Variant is one of Variants.
+func (a *Artifact) validateVariant() error {
+	if !slices.Contains(Variants, a.Variant) {
+		return fmt.Errorf("Variant %q is not valid, it must be one of %s", a.Variant, strings.Join(Variants, ", "))
+	}
+
+	return nil
+}
+
+// validateFamily checks the Flavor is an official one and the Family is the
+// one of the Flavor. The family is optional, as it's not part of the image
+// names.
+func (a *Artifact) validateFamily() error {
+	if a.Flavor == "" {
+		return nil
+	}
+
+	family, known := FlavorFamilies[a.Flavor]
+	if !known {
+		return fmt.Errorf("Flavor %q is unknown, disable strict validation to use a community flavor", a.Flavor)
+	}
+	if a.Family != "" && a.Family != family {
+		return fmt.Errorf("Family %q doesn't match Flavor %q, whose family is %q", a.Family, a.Flavor, family)
+	}
+
+	return nil
+}
+
+// validateModel checks the Model is an official one built for the Arch.
+func (a *Artifact) validateModel() error {
+	archs, known := ModelArchs[a.Model]
+	if !known {
+		return fmt.Errorf("Model %q is unknown, disable strict validation to use a community model", a.Model)
+	}
+	if len(archs) > 0 && !slices.Contains(archs, a.Arch) {
+		return fmt.Errorf("Model %q is not built for Arch %q, only for %s", a.Model, a.Arch, strings.Join(archs, ", "))
+	}
+
+	return nil
+}
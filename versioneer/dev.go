@@ -0,0 +1,92 @@
+package versioneer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DevSuffix separates the release version from the build information in the
+// versions of dev builds, e.g. "v3.2.0-dev-pr1234-abcdef7".
+const DevSuffix = "-dev"
+
+// ShortSHALength is the length of the commit SHAs in the dev versions.
+const ShortSHALength = 7
+
+var (
+	shaPattern        = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+	devVersionPattern = regexp.MustCompile(`-dev(-pr[0-9]+)?-[0-9a-f]{7}$`)
+)
+
+// IsDevVersion returns true if the version is the one of a dev build, as
+// returned by Artifact.DevVersion.
+func IsDevVersion(version string) bool {
+	return devVersionPattern.MatchString(version)
+}
+
+// DevVersion returns the Version of a dev build of the artifact, from the pull
+// request with the given number, or from a branch if it's 0, and the commit.
+// The commit SHA is shortened to ShortSHALength characters. E.g.
+// "v3.2.0-dev-pr1234-abcdef7". They sort before the release of the same
+// version, so they never look newer than it.
+func (a *Artifact) DevVersion(prNumber int, sha string) (string, error) {
+	if a.Version == "" {
+		return "", fmt.Errorf("Version is empty")
+	}
+	if IsDevVersion(a.Version) {
+		return "", fmt.Errorf("Version %q is already a dev version", a.Version)
+	}
+	if prNumber < 0 {
+		return "", fmt.Errorf("invalid pull request number %d", prNumber)
+	}
+	if !shaPattern.MatchString(sha) {
+		return "", fmt.Errorf("invalid commit SHA %q", sha)
+	}
+
+	result := a.Version + DevSuffix
+	if prNumber > 0 {
+		result += fmt.Sprintf("-pr%d", prNumber)
+	}
+
+	return result + "-" + strings.ToLower(sha[:ShortSHALength]), nil
+}
+
+// DevTag returns the container image tag of a dev build of the artifact,
+// with the Version returned by DevVersion.
+func (a *Artifact) DevTag(prNumber int, sha string) (string, error) {
+	version, err := a.DevVersion(prNumber, sha)
+	if err != nil {
+		return "", err
+	}
+
+	dev := *a
+	dev.Version = version
+	return dev.Tag()
+}
+
+// DevBuilds returns only the tags of dev builds.
+func (tl TagList) DevBuilds() TagList {
+	newTags := []string{}
+	for _, t := range tl.Tags {
+		if versions := extractVersions(t, *tl.Artifact); len(versions) > 0 && IsDevVersion(versions[0]) {
+			newTags = append(newTags, t)
+		}
+	}
+
+	return newTagListWithTags(tl, newTags)
+}
+
+// WithDevBuilds returns a copy of the TagList whose Newer* methods include the
+// dev builds.
+func (tl TagList) WithDevBuilds() TagList {
+	result := newTagListWithTags(tl, tl.Tags)
+	result.IncludeDev = true
+	return result
+}
+
+// skipDev returns true if the Newer* methods must skip the tag with the given
+// version: dev builds are skipped unless IncludeDev is set, or they are the
+// build of the artifact.
+func (tl TagList) skipDev(version string) bool {
+	return !tl.IncludeDev && IsDevVersion(version) && version != tl.Artifact.VersionForTag()
+}
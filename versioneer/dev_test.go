@@ -0,0 +1,83 @@
+package versioneer_test
+
+import (
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dev builds", func() {
+	var artifact versioneer.Artifact
+
+	BeforeEach(func() {
+		artifact = versioneer.Artifact{
+			Flavor:        "opensuse",
+			FlavorRelease: "leap-15.5",
+			Variant:       "standard",
+			Model:         "generic",
+			Arch:          "amd64",
+			Version:       "v2.4.2",
+		}
+	})
+
+	Describe("DevVersion", func() {
+		It("adds the pull request and the short commit SHA", func() {
+			Expect(artifact.DevVersion(1234, "ABCDEF7890abcdef")).To(Equal("v2.4.2-dev-pr1234-abcdef7"))
+		})
+
+		It("omits the pull request for branch builds", func() {
+			Expect(artifact.DevVersion(0, "abcdef7")).To(Equal("v2.4.2-dev-abcdef7"))
+		})
+
+		It("fails with invalid input", func() {
+			_, err := artifact.DevVersion(1, "xyz")
+			Expect(err).To(MatchError(`invalid commit SHA "xyz"`))
+			_, err = artifact.DevVersion(-1, "abcdef7")
+			Expect(err).To(MatchError("invalid pull request number -1"))
+			artifact.Version = "v2.4.2-dev-abcdef7"
+			_, err = artifact.DevVersion(1, "abcdef7")
+			Expect(err).To(MatchError(ContainSubstring("already a dev version")))
+		})
+	})
+
+	It("returns the dev tag", func() {
+		Expect(artifact.DevTag(1234, "abcdef7")).To(Equal("leap-15.5-standard-amd64-generic-v2.4.2-dev-pr1234-abcdef7"))
+		Expect(versioneer.IsDevVersion("v2.4.2-dev-pr1234-abcdef7")).To(BeTrue())
+		Expect(versioneer.IsDevVersion("v2.4.2-rc1")).To(BeFalse())
+	})
+
+	Describe("TagList", func() {
+		var tagList versioneer.TagList
+
+		BeforeEach(func() {
+			tagList = versioneer.TagList{
+				Artifact: &artifact,
+				Tags: []string{
+					"leap-15.5-standard-amd64-generic-v2.4.2",
+					"leap-15.5-standard-amd64-generic-v2.4.3",
+					"leap-15.5-standard-amd64-generic-v2.5.0-dev-pr12-abcdef0",
+					"leap-15.5-standard-amd64-generic-v2.4.2-dev-abcdef1",
+				},
+			}
+		})
+
+		It("excludes dev builds from the newer versions", func() {
+			Expect(tagList.NewerVersions().Tags).To(Equal([]string{"leap-15.5-standard-amd64-generic-v2.4.3"}))
+			Expect(tagList.NewerAnyVersion().Tags).To(Equal([]string{"leap-15.5-standard-amd64-generic-v2.4.3"}))
+		})
+
+		It("includes them when asked to", func() {
+			Expect(tagList.WithDevBuilds().NewerVersions().Tags).To(ConsistOf(
+				"leap-15.5-standard-amd64-generic-v2.4.3",
+				"leap-15.5-standard-amd64-generic-v2.5.0-dev-pr12-abcdef0",
+			))
+		})
+
+		It("returns only the dev builds", func() {
+			Expect(tagList.DevBuilds().Tags).To(ConsistOf(
+				"leap-15.5-standard-amd64-generic-v2.5.0-dev-pr12-abcdef0",
+				"leap-15.5-standard-amd64-generic-v2.4.2-dev-abcdef1",
+			))
+		})
+	})
+})
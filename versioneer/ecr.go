@@ -0,0 +1,68 @@
+package versioneer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// ECRTokenRefreshMargin is how long before their expiration ECR tokens are
+// refreshed.
+const ECRTokenRefreshMargin = 5 * time.Minute
+
+// ECRTokenProvider returns an authorization token for the given ECR registry,
+// as returned by the ECR GetAuthorizationToken API (the base64 encoding of
+// "AWS:<password>"), and the time it expires at.
+type ECRTokenProvider func(registry string) (token string, expiresAt time.Time, err error)
+
+type ecrCredentials struct {
+	auth      authn.Authenticator
+	expiresAt time.Time
+}
+
+// ECRAuth returns an AuthHook that exchanges the ECR authorization tokens
+// returned by the provider for registry credentials. Credentials are cached
+// per registry until they are about to expire.
+func ECRAuth(provider ECRTokenProvider) AuthHook {
+	var mu sync.Mutex
+	cache := map[string]ecrCredentials{}
+
+	return func(registry string) (authn.Authenticator, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if c, ok := cache[registry]; ok && time.Now().Add(ECRTokenRefreshMargin).Before(c.expiresAt) {
+			return c.auth, nil
+		}
+
+		token, expiresAt, err := provider(registry)
+		if err != nil {
+			return nil, fmt.Errorf("getting ECR token: %w", err)
+		}
+		auth, err := decodeECRToken(token)
+		if err != nil {
+			return nil, err
+		}
+		cache[registry] = ecrCredentials{auth: auth, expiresAt: expiresAt}
+
+		return auth, nil
+	}
+}
+
+func decodeECRToken(token string) (authn.Authenticator, error) {
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding ECR token: %w", err)
+	}
+	user, password, found := strings.Cut(string(decoded), ":")
+	if !found || user == "" || password == "" {
+		return nil, errors.New("invalid ECR token: expected user:password")
+	}
+
+	return &authn.Basic{Username: user, Password: password}, nil
+}
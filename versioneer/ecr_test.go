@@ -0,0 +1,102 @@
+package versioneer_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ECRAuth", func() {
+	var calls int
+	var expiresAt time.Time
+	var provider versioneer.ECRTokenProvider
+
+	BeforeEach(func() {
+		calls = 0
+		expiresAt = time.Now().Add(12 * time.Hour)
+		provider = func(registry string) (string, time.Time, error) {
+			calls++
+			return base64.StdEncoding.EncodeToString([]byte("AWS:password-for-" + registry)), expiresAt, nil
+		}
+	})
+
+	It("exchanges the token for basic credentials and caches them", func() {
+		hook := versioneer.ECRAuth(provider)
+		auth, err := hook("123.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).ToNot(HaveOccurred())
+		cfg, err := auth.Authorization()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg).To(Equal(&authn.AuthConfig{Username: "AWS", Password: "password-for-123.dkr.ecr.eu-west-1.amazonaws.com"}))
+
+		_, err = hook("123.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal(1))
+
+		_, err = hook("456.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal(2))
+	})
+
+	It("refreshes tokens about to expire", func() {
+		expiresAt = time.Now().Add(time.Minute)
+		hook := versioneer.ECRAuth(provider)
+		_, err := hook("123.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = hook("123.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal(2))
+	})
+
+	It("fails with invalid tokens", func() {
+		hook := versioneer.ECRAuth(func(string) (string, time.Time, error) {
+			return base64.StdEncoding.EncodeToString([]byte("nocolon")), expiresAt, nil
+		})
+		_, err := hook("123.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).To(MatchError(ContainSubstring("invalid ECR token")))
+
+		hook = versioneer.ECRAuth(func(string) (string, time.Time, error) {
+			return "", time.Time{}, errors.New("expired session")
+		})
+		_, err = hook("123.dkr.ecr.eu-west-1.amazonaws.com")
+		Expect(err).To(MatchError(ContainSubstring("expired session")))
+	})
+
+	It("is used by the DefaultRegistryInspector", func() {
+		server := httptest.NewServer(registry.New())
+		defer server.Close()
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		img, err := random.Image(1024, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(crane.Push(img, host+"/kairos/opensuse:v2.4.2")).To(Succeed())
+
+		registries := []string{}
+		inspector := &versioneer.DefaultRegistryInspector{
+			Auth: func(registry string) (authn.Authenticator, error) {
+				registries = append(registries, registry)
+				return versioneer.ECRAuth(provider)(registry)
+			},
+		}
+
+		tl, err := inspector.TagList(host+"/kairos", &versioneer.Artifact{Flavor: "opensuse"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tl.Tags).To(Equal([]string{"v2.4.2"}))
+
+		digest, err := inspector.Digest(host + "/kairos/opensuse:v2.4.2")
+		Expect(err).ToNot(HaveOccurred())
+		expected, err := img.Digest()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digest).To(Equal(expected.String()))
+		Expect(registries).To(Equal([]string{host, host}))
+	})
+})
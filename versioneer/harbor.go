@@ -0,0 +1,181 @@
+package versioneer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HarborDefaultPageSize is the page size used when listing artifacts through
+// the Harbor API, if none is set.
+const HarborDefaultPageSize = 100
+
+// HarborRegistryInspector lists tags using the Harbor project API instead of
+// the OCI registry API. Harbor only exposes tag listings of private projects
+// to project members, and the API pages through big repositories much
+// faster than the registry API.
+type HarborRegistryInspector struct {
+	// URL of the Harbor instance, e.g. https://harbor.example.com
+	URL      string
+	Username string
+	Password string
+	PageSize int
+	// HTTPClient is used for the API requests, a client with
+	// DefaultHTTPTimeout if nil
+	HTTPClient *http.Client
+}
+
+type harborArtifact struct {
+	Digest string `json:"digest"`
+	Tags   []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+}
+
+// TagList implements RegistryInspector. The project is the last element of
+// registryAndOrg (e.g. "kairos" for "harbor.example.com/kairos").
+func (h *HarborRegistryInspector) TagList(registryAndOrg string, artifact *Artifact) (TagList, error) {
+	tl := TagList{
+		Artifact:       artifact,
+		RegistryAndOrg: registryAndOrg,
+		Tags:           []string{},
+	}
+
+	project := registryAndOrg[strings.LastIndex(registryAndOrg, "/")+1:]
+	repository := fmt.Sprintf("%s/%s", project, artifact.Flavor)
+
+	token := ""
+	for {
+		tags, next, err := h.TagPage(repository, token, h.PageSize)
+		if err != nil {
+			return tl, err
+		}
+		tl.Tags = append(tl.Tags, tags...)
+		if next == "" {
+			return tl, nil
+		}
+		token = next
+	}
+}
+
+// TagPage implements PagedRegistryInspector. The repository includes the
+// project (e.g. "kairos/opensuse") and the token is the page number.
+func (h *HarborRegistryInspector) TagPage(repository, token string, pageSize int) ([]string, string, error) {
+	if pageSize <= 0 {
+		pageSize = HarborDefaultPageSize
+	}
+	page := 1
+	if token != "" {
+		var err error
+		if page, err = strconv.Atoi(token); err != nil {
+			return nil, "", fmt.Errorf("invalid page token %q", token)
+		}
+	}
+
+	endpoint, err := h.artifactsURL(repository, "")
+	if err != nil {
+		return nil, "", err
+	}
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	query.Set("with_tag", "true")
+
+	artifacts := []harborArtifact{}
+	resp, err := h.get(endpoint+"?"+query.Encode(), &artifacts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tags := []string{}
+	for _, a := range artifacts {
+		for _, t := range a.Tags {
+			tags = append(tags, t.Name)
+		}
+	}
+
+	next := ""
+	if strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+		next = strconv.Itoa(page + 1)
+	}
+
+	return tags, next, nil
+}
+
+// Digest implements DigestResolver. The image must be a full reference with
+// a tag, e.g. harbor.example.com/kairos/opensuse:v2.4.2
+func (h *HarborRegistryInspector) Digest(image string) (string, error) {
+	slash := strings.Index(image, "/")
+	colon := strings.LastIndex(image, ":")
+	if slash < 0 || colon < slash {
+		return "", fmt.Errorf("invalid image reference %q", image)
+	}
+
+	endpoint, err := h.artifactsURL(image[slash+1:colon], image[colon+1:])
+	if err != nil {
+		return "", err
+	}
+
+	a := harborArtifact{}
+	if _, err := h.get(endpoint, &a); err != nil {
+		return "", err
+	}
+
+	return a.Digest, nil
+}
+
+// artifactsURL returns the artifacts endpoint of the repository (including
+// the project), or the one of a single artifact if reference is set. Nested
+// repository names need to be encoded twice for the Harbor API.
+func (h *HarborRegistryInspector) artifactsURL(repository, reference string) (string, error) {
+	if h.URL == "" {
+		return "", errors.New("harbor url is empty")
+	}
+	project, repo, found := strings.Cut(repository, "/")
+	if !found || project == "" || repo == "" {
+		return "", fmt.Errorf("invalid repository %q, expected project/repository", repository)
+	}
+
+	result := fmt.Sprintf("%s/api/v2.0/projects/%s/repositories/%s/artifacts",
+		strings.TrimSuffix(h.URL, "/"), url.PathEscape(project), url.PathEscape(url.PathEscape(repo)))
+	if reference != "" {
+		result += "/" + url.PathEscape(reference)
+	}
+
+	return result, nil
+}
+
+func (h *HarborRegistryInspector) get(endpoint string, out interface{}) (*http.Response, error) {
+	client := h.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("harbor api: unexpected status: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp, fmt.Errorf("harbor api: %w", err)
+	}
+
+	return resp, nil
+}
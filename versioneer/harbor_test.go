@@ -0,0 +1,119 @@
+package versioneer_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HarborRegistryInspector", func() {
+	var server *httptest.Server
+	var inspector *versioneer.HarborRegistryInspector
+	var requests []string
+	tags := []string{
+		"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1",
+		"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1",
+		"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.27.6-k3s1",
+	}
+
+	BeforeEach(func() {
+		requests = []string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.RequestURI())
+			user, password, ok := r.BasicAuth()
+			if !ok || user != "robot" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch r.URL.EscapedPath() {
+			case "/api/v2.0/projects/kairos/repositories/opensuse/artifacts":
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+				artifacts := []map[string]interface{}{}
+				for i := (page - 1) * size; i < page*size && i < len(tags); i++ {
+					artifacts = append(artifacts, map[string]interface{}{
+						"digest": fmt.Sprintf("sha256:%d", i),
+						"tags":   []map[string]string{{"name": tags[i]}},
+					})
+				}
+				if page*size < len(tags) {
+					w.Header().Set("Link", fmt.Sprintf(`</api/v2.0/projects/kairos/repositories/opensuse/artifacts?page=%d&page_size=%d>; rel="next"`, page+1, size))
+				}
+				_ = json.NewEncoder(w).Encode(artifacts)
+			case "/api/v2.0/projects/kairos/repositories/team%252Fopensuse/artifacts/v2.4.3":
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"digest": "sha256:1234"})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		inspector = &versioneer.HarborRegistryInspector{
+			URL:      server.URL,
+			Username: "robot",
+			Password: "secret",
+			PageSize: 2,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists the tags of all the pages", func() {
+		artifact := versioneer.Artifact{Flavor: "opensuse"}
+		tl, err := inspector.TagList("harbor.example.com/kairos", &artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tl.Tags).To(Equal(tags))
+		Expect(tl.RegistryAndOrg).To(Equal("harbor.example.com/kairos"))
+		Expect(requests).To(HaveLen(2))
+	})
+
+	It("returns a single page", func() {
+		page, next, err := inspector.TagPage("kairos/opensuse", "", 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(page).To(Equal(tags[:2]))
+		Expect(next).To(Equal("2"))
+
+		page, next, err = inspector.TagPage("kairos/opensuse", next, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(page).To(Equal(tags[2:]))
+		Expect(next).To(BeEmpty())
+	})
+
+	It("resolves digests of nested repositories", func() {
+		digest, err := inspector.Digest("harbor.example.com/kairos/team/opensuse:v2.4.3")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digest).To(Equal("sha256:1234"))
+	})
+
+	It("fails without valid credentials", func() {
+		inspector.Password = "wrong"
+		_, err := inspector.TagList("harbor.example.com/kairos", &versioneer.Artifact{Flavor: "opensuse"})
+		Expect(err).To(MatchError("harbor api: unexpected status: 401"))
+	})
+
+	It("times out when the API doesn't answer", func() {
+		done := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer slow.Close()
+		defer close(done)
+
+		original := versioneer.DefaultHTTPTimeout
+		versioneer.DefaultHTTPTimeout = 50 * time.Millisecond
+		defer func() { versioneer.DefaultHTTPTimeout = original }()
+
+		inspector.URL = slow.URL
+		_, _, err := inspector.TagPage("kairos/opensuse", "", 2)
+		Expect(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+	})
+})
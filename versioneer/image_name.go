@@ -0,0 +1,123 @@
+package versioneer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// imageArchs are the architectures Kairos images are built for. The arch is
+// the anchor used to split the tag, since FlavorRelease can contain dashes.
+var imageArchs = []string{"amd64", "arm64", "riscv64"}
+
+// componentPattern matches the start of a software component in a tag, e.g.
+// "k3sv1.28.2" in "v2.4.2-k3sv1.28.2-k3s1".
+var componentPattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_.]*?)(v\d.*)$`)
+
+// NewArtifactFromImageName generates an artifact from a complete image
+// reference, the inverse of ContainerName. E.g.
+// "quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.28.2-k3s1".
+// It also returns the registry and organization of the image, e.g.
+// "quay.io/kairos".
+//
+// Tags don't keep the "+" of software versions, so it's restored when the
+// part after the version core starts with the software name, e.g.
+// "v1.28.2-k3s1" becomes "v1.28.2+k3s1". Software names containing "-"
+// can't be told apart from the versions and aren't supported. Family is not
+// part of the tag and is left empty.
+func NewArtifactFromImageName(image string) (*Artifact, string, error) {
+	if strings.Contains(image, "@") {
+		return nil, "", fmt.Errorf("image %q is referenced by digest, a tag is needed", image)
+	}
+
+	repository, tag, found := strings.Cut(image[strings.LastIndex(image, "/")+1:], ":")
+	if !found || tag == "" {
+		return nil, "", fmt.Errorf("image %q has no tag", image)
+	}
+	registryAndOrg := ""
+	if i := strings.LastIndex(image, "/"); i >= 0 {
+		registryAndOrg = image[:i]
+	}
+	if registryAndOrg == "" {
+		return nil, "", fmt.Errorf("image %q has no registry and organization", image)
+	}
+
+	result, err := newArtifactFromTag(tag)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing the tag of image %q: %w", image, err)
+	}
+	result.Flavor = repository
+
+	return result, registryAndOrg, nil
+}
+
+func newArtifactFromTag(tag string) (*Artifact, error) {
+	parts := strings.Split(tag, "-")
+	archIndex := slices.IndexFunc(parts, func(p string) bool {
+		return slices.Contains(imageArchs, p)
+	})
+	// FlavorRelease and Variant before the arch, Model and Version after it
+	if archIndex < 2 || len(parts) < archIndex+3 {
+		return nil, fmt.Errorf("tag %q doesn't match <flavor release>-<variant>-<arch>-<model>-<version>", tag)
+	}
+
+	result := &Artifact{
+		FlavorRelease: strings.Join(parts[:archIndex-1], "-"),
+		Variant:       parts[archIndex-1],
+		Arch:          parts[archIndex],
+		Model:         parts[archIndex+1],
+	}
+
+	versions := [][]string{}
+	names := []string{""}
+	for _, p := range parts[archIndex+2:] {
+		if len(versions) > 0 {
+			if m := componentPattern.FindStringSubmatch(p); m != nil {
+				names = append(names, m[1])
+				versions = append(versions, []string{m[2]})
+				continue
+			}
+			versions[len(versions)-1] = append(versions[len(versions)-1], p)
+			continue
+		}
+		versions = append(versions, []string{p})
+	}
+
+	result.Version = strings.Join(versions[0], "-")
+	if !strings.HasPrefix(result.Version, "v") {
+		return nil, fmt.Errorf("invalid version %q in tag %q", result.Version, tag)
+	}
+	for i := 1; i < len(versions); i++ {
+		version := restoreBuildMetadata(names[i], versions[i])
+		if i == 1 {
+			result.SoftwareVersionPrefix = names[i]
+			result.SoftwareVersion = version
+			continue
+		}
+		result.Software = append(result.Software, SoftwareComponent{Name: names[i], Version: version})
+	}
+
+	if err := result.Validate(); err != nil {
+		return nil, err
+	}
+	// Tags are built with sorted components, a different order means the
+	// tag was not built by versioneer or was not split right
+	if generated, err := result.Tag(); err != nil || generated != tag {
+		return nil, errors.New("tag was not generated by versioneer or is ambiguous")
+	}
+
+	return result, nil
+}
+
+// restoreBuildMetadata joins the version parts, restoring the "+" before the
+// build metadata when it starts with the software name.
+func restoreBuildMetadata(name string, parts []string) string {
+	for i := 1; i < len(parts); i++ {
+		if strings.HasPrefix(parts[i], name) {
+			return strings.Join(parts[:i], "-") + "+" + strings.Join(parts[i:], "-")
+		}
+	}
+	return strings.Join(parts, "-")
+}
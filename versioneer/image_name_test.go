@@ -0,0 +1,64 @@
+package versioneer_test
+
+import (
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewArtifactFromImageName", func() {
+	It("parses a standard image", func() {
+		artifact, registryAndOrg, err := versioneer.NewArtifactFromImageName("quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.28.2-k3s1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(registryAndOrg).To(Equal("quay.io/kairos"))
+		Expect(*artifact).To(Equal(versioneer.Artifact{
+			Flavor:                "opensuse",
+			FlavorRelease:         "leap-15.5",
+			Variant:               "standard",
+			Model:                 "generic",
+			Arch:                  "amd64",
+			Version:               "v2.4.2",
+			SoftwareVersion:       "v1.28.2+k3s1",
+			SoftwareVersionPrefix: "k3s",
+		}))
+
+		name, err := artifact.ContainerName(registryAndOrg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(name).To(Equal("quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.28.2-k3s1"))
+	})
+
+	It("parses a core image with a pre-release version", func() {
+		artifact, registryAndOrg, err := versioneer.NewArtifactFromImageName("localhost:5000/kairos/ubuntu:24.04-core-arm64-rpi4-v3.0.0-rc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(registryAndOrg).To(Equal("localhost:5000/kairos"))
+		Expect(artifact.Flavor).To(Equal("ubuntu"))
+		Expect(artifact.FlavorRelease).To(Equal("24.04"))
+		Expect(artifact.Variant).To(Equal("core"))
+		Expect(artifact.Arch).To(Equal("arm64"))
+		Expect(artifact.Model).To(Equal("rpi4"))
+		Expect(artifact.Version).To(Equal("v3.0.0-rc1"))
+		Expect(artifact.SoftwareVersion).To(BeEmpty())
+	})
+
+	It("parses additional software components", func() {
+		artifact, _, err := versioneer.NewArtifactFromImageName("quay.io/kairos/alpine:3.19-standard-amd64-generic-v3.1.0-k0sv1.30.1-k0s.0-spinv2.5.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(artifact.SoftwareVersionPrefix).To(Equal("k0s"))
+		Expect(artifact.SoftwareVersion).To(Equal("v1.30.1+k0s.0"))
+		Expect(artifact.Software).To(Equal([]versioneer.SoftwareComponent{{Name: "spin", Version: "v2.5.0"}}))
+	})
+
+	It("fails for images without a tag", func() {
+		_, _, err := versioneer.NewArtifactFromImageName("quay.io/kairos/opensuse")
+		Expect(err).To(HaveOccurred())
+		_, _, err = versioneer.NewArtifactFromImageName("quay.io/kairos/opensuse@sha256:abcd")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails for tags not generated by versioneer", func() {
+		_, _, err := versioneer.NewArtifactFromImageName("quay.io/kairos/opensuse:latest")
+		Expect(err).To(HaveOccurred())
+		_, _, err = versioneer.NewArtifactFromImageName("quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-2.4.2")
+		Expect(err).To(HaveOccurred())
+	})
+})
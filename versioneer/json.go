@@ -0,0 +1,106 @@
+package versioneer
+
+import "encoding/json"
+
+// ArtifactJSON is the JSON schema of an Artifact as produced by Artifact.JSON.
+// The computed fields are only set when they can be
+// computed: Tag and BootableName need a valid Artifact and ContainerName also
+// needs RegistryAndOrg.
+type ArtifactJSON struct {
+	Flavor                string              `json:"flavor"`
+	Family                string              `json:"family,omitempty"`
+	FlavorRelease         string              `json:"flavor_release"`
+	Variant               string              `json:"variant"`
+	Model                 string              `json:"model"`
+	Arch                  string              `json:"arch"`
+	Version               string              `json:"version"`
+	SoftwareVersion       string              `json:"software_version,omitempty"`
+	SoftwareVersionPrefix string              `json:"software_version_prefix,omitempty"`
+	Software              []SoftwareComponent `json:"software,omitempty"`
+
+	// Computed fields
+	RegistryAndOrg string `json:"registry_and_org,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	BootableName   string `json:"bootable_name,omitempty"`
+	ContainerName  string `json:"container_name,omitempty"`
+}
+
+// JSON encodes the Artifact using the ArtifactJSON schema, including the
+// ContainerName for the given registryAndOrg when it's not empty. Encoding the
+// Artifact with json.Marshal keeps using the Go field names.
+func (a *Artifact) JSON(registryAndOrg string) ([]byte, error) {
+	return json.Marshal(a.toJSON(registryAndOrg))
+}
+
+// UnmarshalJSON decodes both the ArtifactJSON schema and the Go field names
+// (the format NewArtifactFromJSON has always accepted). Computed fields are
+// ignored.
+func (a *Artifact) UnmarshalJSON(data []byte) error {
+	// Decoding into a type without methods avoids recursing into UnmarshalJSON
+	type plainArtifact Artifact
+	plain := plainArtifact{}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return err
+	}
+
+	schema := ArtifactJSON{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return err
+	}
+
+	result := Artifact(plain)
+	for field, value := range map[*string]string{
+		&result.Flavor:                schema.Flavor,
+		&result.Family:                schema.Family,
+		&result.FlavorRelease:         schema.FlavorRelease,
+		&result.Variant:               schema.Variant,
+		&result.Model:                 schema.Model,
+		&result.Arch:                  schema.Arch,
+		&result.Version:               schema.Version,
+		&result.SoftwareVersion:       schema.SoftwareVersion,
+		&result.SoftwareVersionPrefix: schema.SoftwareVersionPrefix,
+	} {
+		if value != "" {
+			*field = value
+		}
+	}
+	if len(schema.Software) > 0 {
+		result.Software = schema.Software
+	}
+	result.RegistryInspector = a.RegistryInspector
+	*a = result
+
+	return nil
+}
+
+func (a Artifact) toJSON(registryAndOrg string) ArtifactJSON {
+	result := ArtifactJSON{
+		Flavor:                a.Flavor,
+		Family:                a.Family,
+		FlavorRelease:         a.FlavorRelease,
+		Variant:               a.Variant,
+		Model:                 a.Model,
+		Arch:                  a.Arch,
+		Version:               a.Version,
+		SoftwareVersion:       a.SoftwareVersion,
+		SoftwareVersionPrefix: a.SoftwareVersionPrefix,
+		Software:              a.Software,
+		RegistryAndOrg:        registryAndOrg,
+	}
+
+	// Computed fields are best-effort, an incomplete artifact can still be
+	// encoded
+	if tag, err := a.Tag(); err == nil {
+		result.Tag = tag
+	}
+	if name, err := a.BootableName(); err == nil {
+		result.BootableName = name
+	}
+	if registryAndOrg != "" {
+		if name, err := a.ContainerName(registryAndOrg); err == nil {
+			result.ContainerName = name
+		}
+	}
+
+	return result
+}
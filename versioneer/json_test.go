@@ -0,0 +1,87 @@
+package versioneer_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("JSON encoding", func() {
+	var artifact versioneer.Artifact
+
+	BeforeEach(func() {
+		artifact = versioneer.Artifact{
+			Flavor:                "opensuse",
+			Family:                "opensuse",
+			FlavorRelease:         "leap-15.5",
+			Variant:               "standard",
+			Model:                 "generic",
+			Arch:                  "amd64",
+			Version:               "v2.4.2",
+			SoftwareVersion:       "v1.26.9+k3s1",
+			SoftwareVersionPrefix: "k3s",
+		}
+	})
+
+	It("uses snake_case keys and includes the computed fields", func() {
+		data, err := artifact.JSON("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`{"flavor":"opensuse","family":"opensuse","flavor_release":"leap-15.5",` +
+			`"variant":"standard","model":"generic","arch":"amd64","version":"v2.4.2",` +
+			`"software_version":"v1.26.9+k3s1","software_version_prefix":"k3s",` +
+			`"tag":"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1",` +
+			`"bootable_name":"kairos-opensuse-leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9+k3s1"}`))
+	})
+
+	It("logs as structured fields", func() {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+		artifact.Family = ""
+		logger.Info().Object("artifact", artifact).Send()
+		Expect(buf.String()).To(Equal(`{"level":"info","artifact":{"flavor":"opensuse","flavor_release":"leap-15.5",` +
+			`"variant":"standard","model":"generic","arch":"amd64","version":"v2.4.2",` +
+			`"software_version":"v1.26.9+k3s1","software_version_prefix":"k3s"}}` + "\n"))
+	})
+
+	It("includes the container name when a registry is given", func() {
+		data, err := artifact.JSON("quay.io/kairos")
+		Expect(err).ToNot(HaveOccurred())
+
+		decoded := versioneer.ArtifactJSON{}
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		Expect(decoded.RegistryAndOrg).To(Equal("quay.io/kairos"))
+		Expect(decoded.ContainerName).To(Equal("quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1"))
+	})
+
+	It("encodes incomplete artifacts without the computed fields", func() {
+		artifact.Variant = ""
+		data, err := artifact.JSON("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).ToNot(ContainSubstring("tag"))
+	})
+
+	It("keeps the Go field names in the default encoding", func() {
+		data, err := json.Marshal(artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"FlavorRelease":"leap-15.5"`))
+		Expect(string(data)).ToNot(ContainSubstring("flavor_release"))
+		Expect(string(data)).ToNot(ContainSubstring("tag"))
+
+		decoded, err := versioneer.NewArtifactFromJSON(string(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*decoded).To(Equal(artifact))
+	})
+
+	It("round trips through NewArtifactFromJSON", func() {
+		data, err := artifact.JSON("quay.io/kairos")
+		Expect(err).ToNot(HaveOccurred())
+
+		decoded, err := versioneer.NewArtifactFromJSON(string(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*decoded).To(Equal(artifact))
+	})
+})
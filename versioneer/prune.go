@@ -0,0 +1,185 @@
+package versioneer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// RetentionPolicy defines which tags Prune keeps.
+type RetentionPolicy struct {
+	// KeepLast is the number of newest tags kept per stream. A stream is the
+	// set of tags with the same flavor, flavor release, variant, model, arch
+	// and software versions, which only differ in the Kairos version. E.g.
+	// the images of each k3s version are a different stream.
+	KeepLast int
+	// OlderThan, when set, only deletes tags whose image was created before
+	// now - OlderThan, even if they are not among the newest KeepLast.
+	OlderThan time.Duration
+	// Delete deletes the tags not retained. By default Prune only reports
+	// what would be deleted.
+	Delete bool
+	// Now returns the current time, used with OlderThan. Defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+// RegistryPruner abstracts the registry calls needed by Prune.
+type RegistryPruner interface {
+	// Created returns the creation time of the given image
+	Created(image string) (time.Time, error)
+	// Delete removes the given image tag from the registry
+	Delete(image string) error
+}
+
+// DefaultRegistryPruner talks to any OCI registry. Without an Auth hook, the
+// credentials are read from the default keychain (e.g.
+// ~/.docker/config.json).
+type DefaultRegistryPruner struct {
+	Auth    AuthHook
+	Options []crane.Option
+}
+
+func (p *DefaultRegistryPruner) Created(image string) (time.Time, error) {
+	opts, err := craneOptions(p.Auth, image, p.Options)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cfg, err := crane.Config(image, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	created := struct {
+		Created time.Time `json:"created"`
+	}{}
+	if err := json.Unmarshal(cfg, &created); err != nil {
+		return time.Time{}, fmt.Errorf("parsing config of %s: %w", image, err)
+	}
+
+	return created.Created, nil
+}
+
+func (p *DefaultRegistryPruner) Delete(image string) error {
+	opts, err := craneOptions(p.Auth, image, p.Options)
+	if err != nil {
+		return err
+	}
+	return crane.Delete(image, opts...)
+}
+
+// PruneResult lists the full image names that were kept and deleted (or
+// would be deleted, unless the policy has Delete set).
+type PruneResult struct {
+	Kept    []string
+	Deleted []string
+}
+
+// Prune deletes the image tags in the TagList that are not retained by the
+// given policy, if the policy has Delete set. The policy must keep the
+// newest tags or the recent ones, with KeepLast or OlderThan. Only tags generated by
+// versioneer for images (see Images) are considered, everything else is left
+// untouched.
+func (tl TagList) Prune(policy RetentionPolicy, pruner RegistryPruner) (PruneResult, error) {
+	result := PruneResult{Kept: []string{}, Deleted: []string{}}
+
+	if tl.Artifact == nil {
+		return result, errors.New("no artifact defined")
+	}
+	if policy.KeepLast < 0 {
+		return result, errors.New("KeepLast can't be negative")
+	}
+	if policy.OlderThan < 0 {
+		return result, errors.New("OlderThan can't be negative")
+	}
+	// An empty policy would delete every tag
+	if policy.KeepLast == 0 && policy.OlderThan == 0 {
+		return result, errors.New("the policy must set KeepLast or OlderThan")
+	}
+	if pruner == nil {
+		pruner = &DefaultRegistryPruner{}
+	}
+
+	repo := tl.Artifact.Repository(tl.RegistryAndOrg)
+	now := time.Now()
+	if policy.Now != nil {
+		now = policy.Now()
+	}
+
+	for _, tags := range tl.Images().streams() {
+		for i, t := range tags {
+			image := fmt.Sprintf("%s:%s", repo, t)
+			if i < policy.KeepLast {
+				result.Kept = append(result.Kept, image)
+				continue
+			}
+
+			if policy.OlderThan > 0 {
+				created, err := pruner.Created(image)
+				if err != nil {
+					return result, fmt.Errorf("getting creation time of %s: %w", image, err)
+				}
+				if created.After(now.Add(-policy.OlderThan)) {
+					result.Kept = append(result.Kept, image)
+					continue
+				}
+			}
+
+			if policy.Delete {
+				if err := pruner.Delete(image); err != nil {
+					return result, fmt.Errorf("deleting %s: %w", image, err)
+				}
+			}
+			result.Deleted = append(result.Deleted, image)
+		}
+	}
+
+	return result, nil
+}
+
+// streams groups the tags by stream, with the newest Kairos versions first.
+// Streams are returned sorted by name to keep the output stable. Tags that
+// can't be parsed are left out.
+func (tl TagList) streams() [][]string {
+	type streamTag struct {
+		tag     string
+		version string
+	}
+	byStream := map[string][]streamTag{}
+	names := []string{}
+	for _, t := range tl.Tags {
+		a, err := newArtifactFromTag(t)
+		if err != nil {
+			continue
+		}
+		name := strings.Join([]string{tl.Artifact.Flavor, a.FlavorRelease, a.Variant, a.Model, a.Arch}, "/")
+		for _, c := range a.SoftwareComponents() {
+			name += "/" + c.String()
+		}
+		if _, ok := byStream[name]; !ok {
+			names = append(names, name)
+		}
+		byStream[name] = append(byStream[name], streamTag{tag: t, version: a.Version})
+	}
+	sort.Strings(names)
+
+	result := [][]string{}
+	for _, name := range names {
+		stream := byStream[name]
+		sort.SliceStable(stream, func(i, j int) bool {
+			return tl.comparator().Compare(stream[i].version, stream[j].version) > 0
+		})
+		tags := []string{}
+		for _, st := range stream {
+			tags = append(tags, st.tag)
+		}
+		result = append(result, tags)
+	}
+
+	return result
+}
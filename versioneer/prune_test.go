@@ -0,0 +1,200 @@
+package versioneer_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakePruner struct {
+	created map[string]time.Time
+	deleted []string
+}
+
+func (p *fakePruner) Created(image string) (time.Time, error) {
+	return p.created[image], nil
+}
+
+func (p *fakePruner) Delete(image string) error {
+	p.deleted = append(p.deleted, image)
+	return nil
+}
+
+var _ = Describe("Prune", func() {
+	var tagList versioneer.TagList
+	var pruner *fakePruner
+
+	BeforeEach(func() {
+		tagList = versioneer.TagList{
+			Artifact:       &versioneer.Artifact{Flavor: "opensuse"},
+			RegistryAndOrg: "quay.io/kairos",
+			Tags: []string{
+				"leap-15.5-standard-amd64-generic-v2.4.1-k3sv1.26.9-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1",
+				"leap-15.5-core-amd64-generic-v2.4.1",
+				"leap-15.5-core-amd64-generic-v2.4.2",
+				"sha256-0123456789abcdef.sig",
+			},
+		}
+		pruner = &fakePruner{created: map[string]time.Time{}}
+	})
+
+	It("keeps the newest tags of each stream", func() {
+		result, err := tagList.Prune(versioneer.RetentionPolicy{KeepLast: 1, Delete: true}, pruner)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.Kept).To(Equal([]string{
+			"quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.2",
+			"quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1",
+		}))
+		Expect(result.Deleted).To(Equal([]string{
+			"quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.1",
+			"quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1",
+			"quay.io/kairos/opensuse:leap-15.5-standard-amd64-generic-v2.4.1-k3sv1.26.9-k3s1",
+		}))
+		Expect(pruner.deleted).To(Equal(result.Deleted))
+	})
+
+	It("doesn't delete anything unless asked to", func() {
+		result, err := tagList.Prune(versioneer.RetentionPolicy{KeepLast: 1}, pruner)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Deleted).To(HaveLen(3))
+		Expect(pruner.deleted).To(BeEmpty())
+	})
+
+	DescribeTable("refuses the policies that would delete every tag",
+		func(policy versioneer.RetentionPolicy, msg string) {
+			policy.Delete = true
+			result, err := tagList.Prune(policy, pruner)
+			Expect(err).To(MatchError(msg))
+			Expect(result.Deleted).To(BeEmpty())
+			Expect(pruner.deleted).To(BeEmpty())
+		},
+		Entry("empty", versioneer.RetentionPolicy{}, "the policy must set KeepLast or OlderThan"),
+		Entry("negative KeepLast", versioneer.RetentionPolicy{KeepLast: -1}, "KeepLast can't be negative"),
+		Entry("negative OlderThan", versioneer.RetentionPolicy{OlderThan: -time.Hour}, "OlderThan can't be negative"),
+	)
+
+	It("keeps recent images when OlderThan is set", func() {
+		pruner.created["quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.1"] = time.Now().Add(-time.Hour)
+		pruner.created["quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.2"] = time.Now().Add(-48 * time.Hour)
+
+		result, err := tagList.Prune(versioneer.RetentionPolicy{KeepLast: 0, OlderThan: 24 * time.Hour, Delete: true}, pruner)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Kept).To(Equal([]string{"quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.1"}))
+		Expect(result.Deleted).To(ContainElement("quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.2"))
+	})
+
+	It("uses the policy clock and the TagList comparator", func() {
+		now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		tagList.Tags = []string{
+			"leap-15.5-core-amd64-generic-v2.4.3-rc10",
+			"leap-15.5-core-amd64-generic-v2.4.3-rc9",
+		}
+		tagList.Comparator = versioneer.ChannelComparator{}
+		pruner.created["quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.3-rc9"] = now.Add(-time.Hour)
+
+		result, err := tagList.Prune(versioneer.RetentionPolicy{
+			KeepLast:  1,
+			OlderThan: 24 * time.Hour,
+			Now:       func() time.Time { return now },
+		}, pruner)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Kept).To(Equal([]string{
+			"quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.3-rc10",
+			"quay.io/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.3-rc9",
+		}))
+		Expect(result.Deleted).To(BeEmpty())
+	})
+
+	It("keeps a stream for each software version", func() {
+		tagList.Tags = []string{
+			"ubuntu-24.04-standard-amd64-generic-v3.1.0-k3sv1.29.4-k3s1",
+			"ubuntu-24.04-standard-amd64-generic-v3.0.9-k3sv1.29.4-k3s1",
+			"ubuntu-24.04-standard-amd64-generic-v3.1.0-k3sv1.30.1-k3s1",
+			"ubuntu-24.04-standard-amd64-generic-v3.0.9-k3sv1.30.1-k3s1",
+			"ubuntu-24.04-standard-amd64-generic-v3.1.0-k0sv1.30.1-k0s.0",
+			"ubuntu-24.04-standard-amd64-generic-v3.0.9-k0sv1.30.1-k0s.0",
+			"ubuntu-24.04-standard-arm64-generic-v3.0.9-k3sv1.30.1-k3s1",
+			"ubuntu-24.04-core-amd64-generic-v3.1.0",
+			"ubuntu-24.04-core-amd64-generic-v3.0.9",
+			"not-a-versioneer-tag",
+		}
+
+		result, err := tagList.Prune(versioneer.RetentionPolicy{KeepLast: 1, Delete: true}, pruner)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Kept).To(ConsistOf(
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.1.0-k3sv1.29.4-k3s1",
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.1.0-k3sv1.30.1-k3s1",
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.1.0-k0sv1.30.1-k0s.0",
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-arm64-generic-v3.0.9-k3sv1.30.1-k3s1",
+			"quay.io/kairos/opensuse:ubuntu-24.04-core-amd64-generic-v3.1.0",
+		))
+		Expect(result.Deleted).To(ConsistOf(
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.0.9-k3sv1.29.4-k3s1",
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.0.9-k3sv1.30.1-k3s1",
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.0.9-k0sv1.30.1-k0s.0",
+			"quay.io/kairos/opensuse:ubuntu-24.04-core-amd64-generic-v3.0.9",
+		))
+	})
+
+	It("sorts by the Kairos version, not the software suffix", func() {
+		// semver reads "-k3sv1.30.1-k3s1" as a pre-release, so comparing the
+		// whole versions puts v3.1.0-rc1-k3s... above v3.1.0-k3s...
+		tagList.Tags = []string{
+			"ubuntu-24.04-standard-amd64-generic-v3.1.0-rc1-k3sv1.30.1-k3s1",
+			"ubuntu-24.04-standard-amd64-generic-v3.1.0-k3sv1.30.1-k3s1",
+			"ubuntu-24.04-standard-amd64-generic-v3.0.9-k3sv1.30.1-k3s1",
+		}
+
+		result, err := tagList.Prune(versioneer.RetentionPolicy{KeepLast: 2}, pruner)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Kept).To(Equal([]string{
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.1.0-k3sv1.30.1-k3s1",
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.1.0-rc1-k3sv1.30.1-k3s1",
+		}))
+		Expect(result.Deleted).To(Equal([]string{
+			"quay.io/kairos/opensuse:ubuntu-24.04-standard-amd64-generic-v3.0.9-k3sv1.30.1-k3s1",
+		}))
+		Expect(pruner.deleted).To(BeEmpty())
+	})
+
+	It("authenticates the DefaultRegistryPruner with the Auth hook", func() {
+		server := httptest.NewServer(registry.New())
+		defer server.Close()
+		host := strings.TrimPrefix(server.URL, "http://")
+		image := host + "/kairos/opensuse:leap-15.5-core-amd64-generic-v2.4.1"
+
+		img, err := random.Image(1024, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(crane.Push(img, image)).To(Succeed())
+
+		registries := []string{}
+		p := &versioneer.DefaultRegistryPruner{
+			Auth: func(registry string) (authn.Authenticator, error) {
+				registries = append(registries, registry)
+				return authn.Anonymous, nil
+			},
+		}
+		_, err = p.Created(image)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Delete(image)).To(Succeed())
+		Expect(registries).To(Equal([]string{host, host}))
+
+		p.Auth = func(string) (authn.Authenticator, error) {
+			return nil, errors.New("no credentials")
+		}
+		Expect(p.Delete(image)).To(MatchError(ContainSubstring("no credentials")))
+	})
+})
@@ -2,15 +2,55 @@ package versioneer
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 type RegistryInspector interface {
 	TagList(registryAndOrg string, artifact *Artifact) (TagList, error)
 }
 
-type DefaultRegistryInspector struct{}
+// PagedRegistryInspector is implemented by inspectors that can list the tags
+// of a repository page by page, for registries with big repositories or with
+// their own pagination.
+type PagedRegistryInspector interface {
+	RegistryInspector
+	// TagPage returns up to pageSize tags of the repository (e.g.
+	// "kairos/opensuse"). The token is empty for the first page and the next
+	// one is returned for the following pages. An empty next token means
+	// there are no more pages.
+	TagPage(repository, token string, pageSize int) (tags []string, next string, err error)
+}
+
+// DigestResolver is implemented by inspectors that can resolve an image
+// reference to its digest.
+type DigestResolver interface {
+	Digest(image string) (string, error)
+}
+
+// AuthHook returns the authenticator used to talk to the given registry
+// (e.g. "quay.io"). See ECRAuth for an example.
+type AuthHook func(registry string) (authn.Authenticator, error)
+
+// DefaultRegistryInspector talks to any OCI registry. Without an Auth hook,
+// the credentials are read from the default keychain.
+type DefaultRegistryInspector struct {
+	Auth    AuthHook
+	Options []crane.Option
+	// FilterByArch makes TagList keep only the tags with an image for the
+	// Arch of the artifact, according to the platforms of their manifest,
+	// instead of relying on the arch in the tag name. The architectures of
+	// each tag are cached, so only new tags are fetched in later calls.
+	FilterByArch bool
+
+	mu            sync.Mutex
+	architectures map[string][]string
+}
 
 func (i *DefaultRegistryInspector) TagList(registryAndOrg string, artifact *Artifact) (TagList, error) {
 	var err error
@@ -19,10 +59,137 @@ func (i *DefaultRegistryInspector) TagList(registryAndOrg string, artifact *Arti
 		RegistryAndOrg: registryAndOrg,
 	}
 
-	tl.Tags, err = crane.ListTags(fmt.Sprintf("%s/%s", registryAndOrg, artifact.Flavor))
+	repo := fmt.Sprintf("%s/%s", registryAndOrg, artifact.Flavor)
+	opts, err := i.options(repo)
+	if err != nil {
+		return tl, err
+	}
+
+	tl.Tags, err = crane.ListTags(repo, opts...)
 	if err != nil {
 		return tl, err
 	}
 
-	return tl, nil
+	if i.FilterByArch {
+		tl.Tags, err = i.filterByArch(repo, tl.Tags, artifact.Arch, opts)
+	}
+
+	return tl, err
+}
+
+// filterByArch returns the tags of the repository with an image for the given
+// arch. Signature, attestation and SBOM tags (sha256-*) are not images and
+// are dropped without fetching them.
+func (i *DefaultRegistryInspector) filterByArch(repo string, tags []string, arch string, opts []crane.Option) ([]string, error) {
+	result := []string{}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "sha256-") {
+			continue
+		}
+		archs, err := i.tagArchitectures(fmt.Sprintf("%s:%s", repo, tag), opts)
+		if err != nil {
+			return nil, fmt.Errorf("reading the platforms of %s: %w", tag, err)
+		}
+		for _, a := range archs {
+			if a == arch {
+				result = append(result, tag)
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// tagArchitectures returns the architectures of the image, from the platforms
+// of its index or from the config of a single image. Results are cached by
+// reference, as release tags are not expected to move.
+func (i *DefaultRegistryInspector) tagArchitectures(image string, opts []crane.Option) ([]string, error) {
+	i.mu.Lock()
+	archs, ok := i.architectures[image]
+	i.mu.Unlock()
+	if ok {
+		return archs, nil
+	}
+
+	o := crane.GetOptions(opts...)
+	ref, err := name.ParseReference(image, o.Name...)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := remote.Get(ref, o.Remote...)
+	if err != nil {
+		return nil, err
+	}
+
+	archs = []string{}
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range manifest.Manifests {
+			if m.Platform != nil {
+				archs = append(archs, m.Platform.Architecture)
+			}
+		}
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		config, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		archs = append(archs, config.Architecture)
+	}
+
+	i.mu.Lock()
+	if i.architectures == nil {
+		i.architectures = map[string][]string{}
+	}
+	i.architectures[image] = archs
+	i.mu.Unlock()
+
+	return archs, nil
+}
+
+// Digest implements DigestResolver.
+func (i *DefaultRegistryInspector) Digest(image string) (string, error) {
+	opts, err := i.options(image)
+	if err != nil {
+		return "", err
+	}
+
+	return crane.Digest(image, opts...)
+}
+
+func (i *DefaultRegistryInspector) options(ref string) ([]crane.Option, error) {
+	return craneOptions(i.Auth, ref, i.Options)
+}
+
+// craneOptions returns the options to talk to the registry of ref, with the
+// authenticator of the hook if there is one and then the extra options.
+func craneOptions(hook AuthHook, ref string, extra []crane.Option) ([]crane.Option, error) {
+	opts := []crane.Option{}
+	if hook != nil {
+		// Repositories without a tag are parsed as "latest"
+		r, err := name.ParseReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		repo := r.Context()
+		auth, err := hook(repo.RegistryStr())
+		if err != nil {
+			return nil, fmt.Errorf("authenticating to %s: %w", repo.RegistryStr(), err)
+		}
+		opts = append(opts, crane.WithAuth(auth))
+	}
+
+	return append(opts, extra...), nil
 }
@@ -0,0 +1,87 @@
+package versioneer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DefaultRegistryInspector", func() {
+	var host string
+	var manifestRequests int
+
+	archImage := func(arch string) v1.Image {
+		img, err := random.Image(1024, 1)
+		Expect(err).ToNot(HaveOccurred())
+		config, err := img.ConfigFile()
+		Expect(err).ToNot(HaveOccurred())
+		config.Architecture = arch
+		config.OS = "linux"
+		img, err = mutate.ConfigFile(img, config)
+		Expect(err).ToNot(HaveOccurred())
+		return img
+	}
+
+	BeforeEach(func() {
+		manifestRequests = 0
+		handler := registry.New()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodGet {
+				manifestRequests++
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(server.Close)
+		host = strings.TrimPrefix(server.URL, "http://")
+		repo := host + "/kairos/opensuse"
+
+		Expect(crane.Push(archImage("amd64"), repo+":v1-amd64")).To(Succeed())
+		Expect(crane.Push(archImage("arm64"), repo+":v1-arm64")).To(Succeed())
+		Expect(crane.Push(archImage("amd64"), repo+":sha256-abc.sig")).To(Succeed())
+
+		index := mutate.AppendManifests(empty.Index,
+			mutate.IndexAddendum{Add: archImage("amd64"), Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+			mutate.IndexAddendum{Add: archImage("arm64"), Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+		)
+		ref, err := name.ParseReference(repo + ":v2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(remote.WriteIndex(ref, index)).To(Succeed())
+		manifestRequests = 0
+	})
+
+	It("lists all the tags by default", func() {
+		tl, err := (&versioneer.DefaultRegistryInspector{}).TagList(host+"/kairos", &versioneer.Artifact{Flavor: "opensuse", Arch: "arm64"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tl.Tags).To(ConsistOf("v1-amd64", "v1-arm64", "sha256-abc.sig", "v2"))
+		Expect(manifestRequests).To(BeZero())
+	})
+
+	It("filters the tags by the platforms of their manifest", func() {
+		inspector := &versioneer.DefaultRegistryInspector{FilterByArch: true}
+		artifact := &versioneer.Artifact{Flavor: "opensuse", Arch: "arm64"}
+
+		tl, err := inspector.TagList(host+"/kairos", artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tl.Tags).To(ConsistOf("v1-arm64", "v2"))
+		Expect(manifestRequests).To(Equal(3))
+
+		// The architectures are cached
+		artifact.Arch = "amd64"
+		tl, err = inspector.TagList(host+"/kairos", artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tl.Tags).To(ConsistOf("v1-amd64", "v2"))
+		Expect(manifestRequests).To(Equal(3))
+	})
+})
@@ -0,0 +1,181 @@
+package versioneer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// ReleaseIndexEntry lists the software versions (e.g. k3s versions) published
+// for a Kairos version and flavor.
+type ReleaseIndexEntry struct {
+	Version               string   `json:"version"`
+	Flavor                string   `json:"flavor"`
+	FlavorRelease         string   `json:"flavor_release,omitempty"` // Empty means all the releases of the flavor
+	SoftwareVersionPrefix string   `json:"software_version_prefix,omitempty"`
+	SoftwareVersions      []string `json:"software_versions,omitempty"`
+}
+
+// ReleaseIndex is a published index of Kairos releases. It answers questions
+// like "which k3s versions exist for Kairos vX on flavor Y" without listing
+// all the tags in the registry.
+// ReleaseIndex implements RegistryInspector so it can be set as the
+// Artifact's RegistryInspector to compute TagLists from the index.
+type ReleaseIndex struct {
+	Releases []ReleaseIndexEntry `json:"releases"`
+}
+
+// DefaultHTTPTimeout limits the requests made when no HTTPClient is set, so an
+// unresponsive server doesn't block the caller forever.
+var DefaultHTTPTimeout = 30 * time.Second
+
+// defaultHTTPClient returns a client like http.DefaultClient but with
+// DefaultHTTPTimeout.
+func defaultHTTPClient() *http.Client {
+	return &http.Client{Timeout: DefaultHTTPTimeout}
+}
+
+// ReleaseIndexClient fetches a ReleaseIndex from a URL.
+type ReleaseIndexClient struct {
+	URL string
+	// HTTPClient is used for the requests, a client with DefaultHTTPTimeout
+	// if nil
+	HTTPClient *http.Client
+}
+
+// NewReleaseIndexFromJSON parses a ReleaseIndex from its JSON representation.
+func NewReleaseIndexFromJSON(data []byte) (*ReleaseIndex, error) {
+	result := &ReleaseIndex{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("parsing release index: %w", err)
+	}
+
+	return result, nil
+}
+
+// Fetch downloads and parses the index.
+func (c ReleaseIndexClient) Fetch() (*ReleaseIndex, error) {
+	if c.URL == "" {
+		return nil, errors.New("release index url is empty")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient()
+	}
+
+	resp, err := client.Get(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching release index: unexpected status: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReleaseIndexFromJSON(data)
+}
+
+// Versions returns the Kairos versions available for the given flavor and
+// flavor release, sorted by semver (lower versions first).
+func (ri *ReleaseIndex) Versions(flavor, flavorRelease string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, e := range ri.matching(flavor, flavorRelease, "") {
+		if !seen[e.Version] {
+			seen[e.Version] = true
+			result = append(result, e.Version)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return semver.Compare(result[i], result[j]) < 0 })
+
+	return result
+}
+
+// SoftwareVersions returns the software versions available for the given
+// Kairos version, flavor and flavor release. If prefix is not empty, only
+// entries with that SoftwareVersionPrefix are considered.
+func (ri *ReleaseIndex) SoftwareVersions(version, flavor, flavorRelease, prefix string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, e := range ri.matching(flavor, flavorRelease, prefix) {
+		if e.Version != version {
+			continue
+		}
+		for _, sv := range e.SoftwareVersions {
+			if !seen[sv] {
+				seen[sv] = true
+				result = append(result, sv)
+			}
+		}
+	}
+
+	return result
+}
+
+// TagList implements RegistryInspector. It computes the tags of all the
+// releases in the index matching the artifact's flavor, flavor release and
+// SoftwareVersionPrefix. Artifacts without a SoftwareVersion get one tag per
+// Kairos version, others get one tag per software version.
+func (ri *ReleaseIndex) TagList(registryAndOrg string, artifact *Artifact) (TagList, error) {
+	tl := TagList{
+		Artifact:       artifact,
+		RegistryAndOrg: registryAndOrg,
+		Tags:           []string{},
+	}
+
+	for _, e := range ri.matching(artifact.Flavor, artifact.FlavorRelease, artifact.SoftwareVersionPrefix) {
+		candidate := *artifact
+		candidate.Version = e.Version
+
+		if artifact.SoftwareVersion == "" {
+			tag, err := candidate.Tag()
+			if err != nil {
+				return tl, err
+			}
+			tl.Tags = append(tl.Tags, tag)
+			continue
+		}
+
+		for _, sv := range e.SoftwareVersions {
+			candidate.SoftwareVersion = sv
+			tag, err := candidate.Tag()
+			if err != nil {
+				return tl, err
+			}
+			tl.Tags = append(tl.Tags, tag)
+		}
+	}
+
+	return tl, nil
+}
+
+func (ri *ReleaseIndex) matching(flavor, flavorRelease, prefix string) []ReleaseIndexEntry {
+	result := []ReleaseIndexEntry{}
+	for _, e := range ri.Releases {
+		if e.Flavor != flavor {
+			continue
+		}
+		if e.FlavorRelease != "" && e.FlavorRelease != flavorRelease {
+			continue
+		}
+		if prefix != "" && e.SoftwareVersionPrefix != prefix {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	return result
+}
@@ -0,0 +1,104 @@
+package versioneer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const releaseIndexJSON = `{
+  "releases": [
+    {"version": "v2.4.3", "flavor": "opensuse", "software_version_prefix": "k3s",
+     "software_versions": ["v1.26.9+k3s1", "v1.27.6+k3s1"]},
+    {"version": "v2.4.2", "flavor": "opensuse", "software_version_prefix": "k3s",
+     "software_versions": ["v1.26.9+k3s1"]},
+    {"version": "v2.4.3", "flavor": "opensuse", "flavor_release": "tumbleweed", "software_version_prefix": "k3s",
+     "software_versions": ["v1.28.2+k3s1"]},
+    {"version": "v2.4.3", "flavor": "alpine", "software_version_prefix": "k3s",
+     "software_versions": ["v1.26.9+k3s1"]}
+  ]
+}`
+
+var _ = Describe("ReleaseIndex", func() {
+	var index *versioneer.ReleaseIndex
+	var artifact versioneer.Artifact
+
+	BeforeEach(func() {
+		var err error
+		index, err = versioneer.NewReleaseIndexFromJSON([]byte(releaseIndexJSON))
+		Expect(err).ToNot(HaveOccurred())
+
+		artifact = versioneer.Artifact{
+			Flavor:                "opensuse",
+			FlavorRelease:         "leap-15.5",
+			Variant:               "standard",
+			Model:                 "generic",
+			Arch:                  "amd64",
+			Version:               "v2.4.2",
+			SoftwareVersion:       "v1.26.9+k3s1",
+			SoftwareVersionPrefix: "k3s",
+		}
+	})
+
+	It("returns the versions for a flavor", func() {
+		Expect(index.Versions("opensuse", "leap-15.5")).To(Equal([]string{"v2.4.2", "v2.4.3"}))
+	})
+
+	It("returns the software versions for a version and flavor", func() {
+		Expect(index.SoftwareVersions("v2.4.3", "opensuse", "leap-15.5", "k3s")).
+			To(Equal([]string{"v1.26.9+k3s1", "v1.27.6+k3s1"}))
+		Expect(index.SoftwareVersions("v2.4.3", "opensuse", "tumbleweed", "k3s")).
+			To(ConsistOf("v1.26.9+k3s1", "v1.27.6+k3s1", "v1.28.2+k3s1"))
+		Expect(index.SoftwareVersions("v2.4.3", "opensuse", "leap-15.5", "k0s")).To(BeEmpty())
+	})
+
+	It("can be used as a RegistryInspector", func() {
+		artifact.RegistryInspector = index
+		tl, err := artifact.TagList("quay.io/kairos")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(tl.NewerAnyVersion().RSorted().Tags).To(Equal([]string{
+			"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.27.6-k3s1",
+			"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1",
+		}))
+	})
+
+	It("fetches the index with the client", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(releaseIndexJSON))
+		}))
+		defer server.Close()
+
+		fetched, err := versioneer.ReleaseIndexClient{URL: server.URL}.Fetch()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fetched).To(Equal(index))
+	})
+
+	It("fails on unexpected status codes", func() {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		_, err := versioneer.ReleaseIndexClient{URL: server.URL}.Fetch()
+		Expect(err).To(MatchError(ContainSubstring("unexpected status: 404")))
+	})
+
+	It("times out on unresponsive servers", func() {
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer server.Close()
+		defer close(done)
+
+		original := versioneer.DefaultHTTPTimeout
+		versioneer.DefaultHTTPTimeout = 50 * time.Millisecond
+		defer func() { versioneer.DefaultHTTPTimeout = original }()
+
+		_, err := versioneer.ReleaseIndexClient{URL: server.URL}.Fetch()
+		Expect(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+	})
+})
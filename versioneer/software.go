@@ -0,0 +1,104 @@
+package versioneer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EnvVarSoftware holds the Artifact's additional software components, in the
+// format produced by FormatSoftwareComponents.
+const EnvVarSoftware = "SOFTWARE"
+
+// SoftwareComponent is a piece of software bundled in an image, e.g. a
+// Kubernetes distribution.
+type SoftwareComponent struct {
+	Name    string `json:"name"`    // E.g. k0s
+	Version string `json:"version"` // E.g. v1.30.1+k0s.0
+}
+
+// VersionForTag replaces any "+" symbols with "-" because in container image
+// tags, "+" is not valid
+func (sc SoftwareComponent) VersionForTag() string {
+	return strings.ReplaceAll(sc.Version, "+", "-")
+}
+
+// String returns the component as "name:version".
+func (sc SoftwareComponent) String() string {
+	return fmt.Sprintf("%s:%s", sc.Name, sc.Version)
+}
+
+// ParseSoftwareComponents parses a comma separated list of "name:version"
+// components, e.g. "k0s:v1.30.1+k0s.0,kube-vip:v0.8.0".
+func ParseSoftwareComponents(s string) ([]SoftwareComponent, error) {
+	result := []SoftwareComponent{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		name, version, found := strings.Cut(c, ":")
+		if !found || name == "" || version == "" {
+			return nil, fmt.Errorf("invalid software component %q, expected name:version", c)
+		}
+		result = append(result, SoftwareComponent{Name: name, Version: version})
+	}
+
+	return result, nil
+}
+
+// FormatSoftwareComponents is the inverse of ParseSoftwareComponents. The
+// components are sorted by name.
+func FormatSoftwareComponents(components []SoftwareComponent) string {
+	result := []string{}
+	for _, c := range sortedComponents(components) {
+		result = append(result, c.String())
+	}
+
+	return strings.Join(result, ",")
+}
+
+// SoftwareComponents returns all the software in the Artifact: the one
+// defined by SoftwareVersionPrefix and SoftwareVersion first, followed by the
+// ones in Software sorted by name. This is the order in which they are
+// encoded in tags.
+func (a *Artifact) SoftwareComponents() []SoftwareComponent {
+	result := []SoftwareComponent{}
+	if a.SoftwareVersion != "" {
+		result = append(result, SoftwareComponent{Name: a.SoftwareVersionPrefix, Version: a.SoftwareVersion})
+	}
+
+	return append(result, sortedComponents(a.Software)...)
+}
+
+func (a *Artifact) validateSoftware() error {
+	if len(a.Software) > 0 && a.SoftwareVersion == "" {
+		return errors.New("SoftwareVersion should be defined when Software is not empty")
+	}
+
+	names := map[string]bool{a.SoftwareVersionPrefix: true}
+	for _, c := range a.Software {
+		if c.Name == "" || c.Version == "" {
+			return fmt.Errorf("software component %q needs both a name and a version", c.String())
+		}
+		if !isValidTag(c.Name) {
+			return fmt.Errorf("invalid software component name %q", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("software component %q is defined more than once", c.Name)
+		}
+		names[c.Name] = true
+	}
+
+	return nil
+}
+
+func sortedComponents(components []SoftwareComponent) []SoftwareComponent {
+	result := append([]SoftwareComponent{}, components...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
@@ -0,0 +1,120 @@
+package versioneer_test
+
+import (
+	"os"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Software components", func() {
+	var artifact versioneer.Artifact
+
+	BeforeEach(func() {
+		artifact = versioneer.Artifact{
+			Flavor:                "opensuse",
+			FlavorRelease:         "leap-15.5",
+			Variant:               "standard",
+			Model:                 "generic",
+			Arch:                  "amd64",
+			Version:               "v2.4.2",
+			SoftwareVersion:       "v1.26.9+k3s1",
+			SoftwareVersionPrefix: "k3s",
+			Software: []versioneer.SoftwareComponent{
+				{Name: "kube-vip", Version: "v0.8.0"},
+				{Name: "k0s", Version: "v1.30.1+k0s.0"},
+			},
+		}
+	})
+
+	It("encodes them in the tag sorted by name, after the main software", func() {
+		tag, err := artifact.Tag()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tag).To(Equal("leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1-k0sv1.30.1-k0s.0-kube-vipv0.8.0"))
+
+		artifact.Software = []versioneer.SoftwareComponent{artifact.Software[1], artifact.Software[0]}
+		sameTag, err := artifact.Tag()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sameTag).To(Equal(tag))
+	})
+
+	It("keeps the tags of artifacts without additional software", func() {
+		artifact.Software = nil
+		tag, err := artifact.Tag()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tag).To(Equal("leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1"))
+	})
+
+	It("lists every component", func() {
+		Expect(artifact.SoftwareComponents()).To(Equal([]versioneer.SoftwareComponent{
+			{Name: "k3s", Version: "v1.26.9+k3s1"},
+			{Name: "k0s", Version: "v1.30.1+k0s.0"},
+			{Name: "kube-vip", Version: "v0.8.0"},
+		}))
+	})
+
+	It("validates the components", func() {
+		artifact.Software = append(artifact.Software, versioneer.SoftwareComponent{Name: "k3s", Version: "v1.27.0"})
+		Expect(artifact.Validate()).To(MatchError(ContainSubstring("more than once")))
+
+		artifact.Software = []versioneer.SoftwareComponent{{Name: "k0s"}}
+		Expect(artifact.Validate()).To(MatchError(ContainSubstring("needs both a name and a version")))
+
+		artifact.Software = []versioneer.SoftwareComponent{{Name: "k0s", Version: "v1.30.1"}}
+		artifact.SoftwareVersion = ""
+		Expect(artifact.Validate()).To(MatchError(ContainSubstring("SoftwareVersion should be defined")))
+	})
+
+	It("parses and formats lists of components", func() {
+		components, err := versioneer.ParseSoftwareComponents("kube-vip:v0.8.0, k0s:v1.30.1+k0s.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(components).To(HaveLen(2))
+		Expect(versioneer.FormatSoftwareComponents(components)).To(Equal("k0s:v1.30.1+k0s.0,kube-vip:v0.8.0"))
+
+		_, err = versioneer.ParseSoftwareComponents("k0s")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("splits the versions of the tags", func() {
+		tl := versioneer.TagList{
+			Artifact: &artifact,
+			Tags: []string{
+				"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1-k0sv1.30.1-k0s.0-kube-vipv0.8.0",
+				"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.27.1-k3s1-k0sv1.30.1-k0s.0-kube-vipv0.8.0",
+				"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1-k0sv1.30.2-k0s.0-kube-vipv0.8.0",
+			},
+		}
+		Expect(tl.OtherSoftwareVersions().Tags).To(Equal([]string{
+			"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.27.1-k3s1-k0sv1.30.1-k0s.0-kube-vipv0.8.0",
+		}))
+		Expect(tl.NewerVersions().Tags).To(Equal([]string{
+			"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1-k0sv1.30.2-k0s.0-kube-vipv0.8.0",
+		}))
+	})
+
+	It("survives a JSON round trip", func() {
+		data, err := artifact.JSON("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"software":[{"name":"kube-vip","version":"v0.8.0"}`))
+
+		result, err := versioneer.NewArtifactFromJSON(string(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Software).To(Equal(artifact.Software))
+	})
+
+	It("reads them from the kairos-release file", func() {
+		vars, err := artifact.OSReleaseVariables("quay.io/kairos", "", "", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(ContainSubstring(`KAIROS_SOFTWARE="k0s:v1.30.1+k0s.0,kube-vip:v0.8.0"`))
+
+		f, err := os.CreateTemp("", "kairos-release")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(f.Name())
+		Expect(os.WriteFile(f.Name(), []byte(vars), 0644)).To(Succeed())
+
+		result, err := versioneer.NewArtifactFromOSRelease(f.Name())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.SoftwareComponents()).To(Equal(artifact.SoftwareComponents()))
+	})
+})
@@ -0,0 +1,201 @@
+package versioneer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/machine"
+	"github.com/kairos-io/kairos-sdk/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SourceOSRelease = "os-release"
+	SourceEnv       = "env"
+	SourceCmdline   = "cmdline"
+
+	// CmdlinePrefix is the prefix of the kernel cmdline parameters read by
+	// NewArtifactFromCmdline. E.g. kairos.flavor=opensuse
+	CmdlinePrefix = "kairos"
+	// EnvPrefix is the prefix of the environment variables read by
+	// NewArtifactFromEnv. E.g. KAIROS_FLAVOR=opensuse
+	EnvPrefix = "KAIROS_"
+)
+
+// Provenance maps each Artifact field (by its variable name, e.g. "FLAVOR")
+// to the source it was read from.
+type Provenance map[string]string
+
+// String returns the provenance as a sorted, comma separated list of
+// "VARIABLE=source" pairs.
+func (p Provenance) String() string {
+	result := []string{}
+	for k, v := range p {
+		result = append(result, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(result)
+
+	return strings.Join(result, ", ")
+}
+
+// ArtifactSources defines where NewArtifactFromSources looks for values.
+// Empty values mean the default locations.
+type ArtifactSources struct {
+	OSReleaseFile string
+	CmdlineFile   string
+}
+
+// NewArtifactFromEnv generates an artifact from environment variables named
+// like the kairos-release ones. E.g. KAIROS_VARIANT sets the Variant field.
+// Missing variables leave the field empty, and so does an invalid
+// KAIROS_SOFTWARE list.
+func NewArtifactFromEnv() *Artifact {
+	result := &Artifact{}
+	var software string
+	for key, field := range result.fields(&software) {
+		*field = os.Getenv(EnvPrefix + key)
+	}
+	if err := result.setSoftware(software); err != nil {
+		result.Software = nil
+	}
+
+	return result
+}
+
+// NewArtifactFromCmdline generates an artifact from the kernel cmdline. Each
+// field is read from a "kairos." prefixed parameter named like the lowercased
+// kairos-release variable. E.g. kairos.flavor_release=leap-15.5 sets the
+// FlavorRelease field. The function optionally takes an argument to specify a
+// different file path (for testing reasons).
+func NewArtifactFromCmdline(file ...string) (*Artifact, error) {
+	values, err := cmdlineValues(file...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Artifact{}
+	var software string
+	for key, field := range result.fields(&software) {
+		*field = values[strings.ToLower(key)]
+	}
+	if err := result.setSoftware(software); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NewArtifactFromSources generates an artifact by looking up every field, in
+// order, in the kairos-release file, the environment and the kernel cmdline.
+// The first non empty value wins. This is useful during early boot when
+// kairos-release may not be available yet. Sources that can't be read are
+// skipped. The returned Provenance tells where each field was read from.
+func NewArtifactFromSources(sources ArtifactSources) (*Artifact, Provenance, error) {
+	var osReleaseFile []string
+	if sources.OSReleaseFile != "" {
+		osReleaseFile = append(osReleaseFile, sources.OSReleaseFile)
+	}
+	var cmdlineFile []string
+	if sources.CmdlineFile != "" {
+		cmdlineFile = append(cmdlineFile, sources.CmdlineFile)
+	}
+
+	cmdline, err := cmdlineValues(cmdlineFile...)
+	if err != nil {
+		cmdline = map[string]string{}
+	}
+
+	result := &Artifact{}
+	provenance := Provenance{}
+	var software string
+	for key, field := range result.fields(&software) {
+		if v, err := utils.OSRelease(key, osReleaseFile...); err == nil && v != "" {
+			*field = v
+			provenance[key] = SourceOSRelease
+			continue
+		}
+		if v := os.Getenv(EnvPrefix + key); v != "" {
+			*field = v
+			provenance[key] = SourceEnv
+			continue
+		}
+		if v := cmdline[strings.ToLower(key)]; v != "" {
+			*field = v
+			provenance[key] = SourceCmdline
+		}
+	}
+
+	if err := result.setSoftware(software); err != nil {
+		return nil, provenance, fmt.Errorf("reading %s from %s: %w", EnvVarSoftware, provenance[EnvVarSoftware], err)
+	}
+
+	if len(provenance) == 0 {
+		return nil, provenance, fmt.Errorf("no artifact information found in %s, %s or %s", SourceOSRelease, SourceEnv, SourceCmdline)
+	}
+
+	return result, provenance, nil
+}
+
+// fields maps the kairos-release variable names to the Artifact fields. The
+// software components list is mapped to software as text, to be parsed with
+// setSoftware.
+func (a *Artifact) fields(software *string) map[string]*string {
+	return map[string]*string{
+		EnvVarFlavor:                &a.Flavor,
+		EnvVarFamily:                &a.Family,
+		EnvVarFlavorRelease:         &a.FlavorRelease,
+		EnvVarVariant:               &a.Variant,
+		EnvVarModel:                 &a.Model,
+		EnvVarArch:                  &a.Arch,
+		EnvVarVersion:               &a.Version,
+		EnvVarSoftwareVersion:       &a.SoftwareVersion,
+		EnvVarSoftwareVersionPrefix: &a.SoftwareVersionPrefix,
+		EnvVarSoftware:              software,
+	}
+}
+
+// setSoftware sets the Software components from their text form, see
+// ParseSoftwareComponents. Empty means no components.
+func (a *Artifact) setSoftware(software string) error {
+	if software == "" {
+		return nil
+	}
+	components, err := ParseSoftwareComponents(software)
+	if err != nil {
+		return err
+	}
+	a.Software = components
+	return nil
+}
+
+// cmdlineValues returns the "kairos." prefixed cmdline parameters without the
+// prefix.
+func cmdlineValues(file ...string) (map[string]string, error) {
+	f := ""
+	if len(file) > 0 {
+		f = file[0]
+	}
+
+	data, err := machine.DotToYAML(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmdline map[string]interface{}
+	if err := yaml.Unmarshal(data, &cmdline); err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	if kairos, ok := cmdline[CmdlinePrefix].(map[string]interface{}); ok {
+		for k, v := range kairos {
+			if v != nil {
+				result[k] = fmt.Sprint(v)
+			}
+		}
+	}
+
+	return result, nil
+}
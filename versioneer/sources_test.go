@@ -0,0 +1,141 @@
+package versioneer_test
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Artifact sources", func() {
+	var osReleaseFile, cmdlineFile *os.File
+	var err error
+
+	BeforeEach(func() {
+		osReleaseFile, err = os.CreateTemp("", "kairos-release")
+		Expect(err).ToNot(HaveOccurred())
+		cmdlineFile, err = os.CreateTemp("", "cmdline")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = os.WriteFile(cmdlineFile.Name(), []byte(
+			"console=tty1 kairos.flavor=ubuntu kairos.flavor_release=24.04 kairos.variant=core "+
+				"kairos.model=generic kairos.targetarch=arm64 kairos.release=v3.0.0\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(osReleaseFile.Name())
+		os.Remove(cmdlineFile.Name())
+	})
+
+	Describe("NewArtifactFromCmdline", func() {
+		It("reads the kairos parameters", func() {
+			artifact, err := versioneer.NewArtifactFromCmdline(cmdlineFile.Name())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(artifact.Flavor).To(Equal("ubuntu"))
+			Expect(artifact.FlavorRelease).To(Equal("24.04"))
+			Expect(artifact.Variant).To(Equal("core"))
+			Expect(artifact.Model).To(Equal("generic"))
+			Expect(artifact.Arch).To(Equal("arm64"))
+			Expect(artifact.Version).To(Equal("v3.0.0"))
+			Expect(artifact.Validate()).ToNot(HaveOccurred())
+		})
+	})
+
+	Describe("NewArtifactFromEnv", func() {
+		It("reads the KAIROS_ variables", func() {
+			GinkgoT().Setenv("KAIROS_FLAVOR", "alpine")
+			GinkgoT().Setenv("KAIROS_RELEASE", "v3.1.0")
+
+			artifact := versioneer.NewArtifactFromEnv()
+			Expect(artifact.Flavor).To(Equal("alpine"))
+			Expect(artifact.Version).To(Equal("v3.1.0"))
+			Expect(artifact.Variant).To(BeEmpty())
+		})
+
+		It("builds the same artifact as the kairos-release file", func() {
+			vars := map[string]string{
+				"FLAVOR":                  "ubuntu",
+				"FAMILY":                  "ubuntu",
+				"FLAVOR_RELEASE":          "24.04",
+				"VARIANT":                 "standard",
+				"MODEL":                   "generic",
+				"TARGETARCH":              "amd64",
+				"RELEASE":                 "v3.1.0",
+				"SOFTWARE_VERSION":        "v1.30.1+k3s1",
+				"SOFTWARE_VERSION_PREFIX": "k3s",
+				"SOFTWARE":                "kube-vip:v0.8.0,cilium:v1.15.5",
+			}
+			content := ""
+			for k, v := range vars {
+				content += fmt.Sprintf("KAIROS_%s=\"%s\"\n", k, v)
+				GinkgoT().Setenv("KAIROS_"+k, v)
+			}
+			Expect(os.WriteFile(osReleaseFile.Name(), []byte(content), 0644)).To(Succeed())
+
+			fromOSRelease, err := versioneer.NewArtifactFromOSRelease(osReleaseFile.Name())
+			Expect(err).ToNot(HaveOccurred())
+			fromEnv := versioneer.NewArtifactFromEnv()
+			Expect(fromEnv).To(Equal(fromOSRelease))
+			Expect(fromEnv.Software).To(HaveLen(2))
+		})
+
+		It("leaves Software empty if it's invalid", func() {
+			GinkgoT().Setenv("KAIROS_SOFTWARE", "kube-vip")
+			Expect(versioneer.NewArtifactFromEnv().Software).To(BeEmpty())
+		})
+	})
+
+	Describe("NewArtifactFromSources", func() {
+		It("prefers os-release, then env, then cmdline", func() {
+			err = os.WriteFile(osReleaseFile.Name(), []byte("KAIROS_FLAVOR=opensuse\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+			GinkgoT().Setenv("KAIROS_FLAVOR", "alpine")
+			GinkgoT().Setenv("KAIROS_RELEASE", "v3.1.0")
+
+			artifact, provenance, err := versioneer.NewArtifactFromSources(versioneer.ArtifactSources{
+				OSReleaseFile: osReleaseFile.Name(),
+				CmdlineFile:   cmdlineFile.Name(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(artifact.Flavor).To(Equal("opensuse"))
+			Expect(artifact.Version).To(Equal("v3.1.0"))
+			Expect(artifact.Variant).To(Equal("core"))
+
+			Expect(provenance[versioneer.EnvVarFlavor]).To(Equal(versioneer.SourceOSRelease))
+			Expect(provenance[versioneer.EnvVarVersion]).To(Equal(versioneer.SourceEnv))
+			Expect(provenance[versioneer.EnvVarVariant]).To(Equal(versioneer.SourceCmdline))
+			Expect(provenance).ToNot(HaveKey(versioneer.EnvVarSoftwareVersion))
+		})
+
+		It("falls back to the cmdline when kairos-release is missing", func() {
+			artifact, provenance, err := versioneer.NewArtifactFromSources(versioneer.ArtifactSources{
+				OSReleaseFile: "/non/existing/kairos-release",
+				CmdlineFile:   cmdlineFile.Name(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(artifact.Flavor).To(Equal("ubuntu"))
+			Expect(provenance[versioneer.EnvVarFlavor]).To(Equal(versioneer.SourceCmdline))
+		})
+
+		It("reads the software components", func() {
+			GinkgoT().Setenv("KAIROS_SOFTWARE", "kube-vip:v0.8.0")
+			artifact, provenance, err := versioneer.NewArtifactFromSources(versioneer.ArtifactSources{
+				OSReleaseFile: "/non/existing/kairos-release",
+				CmdlineFile:   cmdlineFile.Name(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(artifact.Software).To(Equal([]versioneer.SoftwareComponent{{Name: "kube-vip", Version: "v0.8.0"}}))
+			Expect(provenance[versioneer.EnvVarSoftware]).To(Equal(versioneer.SourceEnv))
+
+			GinkgoT().Setenv("KAIROS_SOFTWARE", "kube-vip")
+			_, _, err = versioneer.NewArtifactFromSources(versioneer.ArtifactSources{
+				OSReleaseFile: "/non/existing/kairos-release",
+				CmdlineFile:   cmdlineFile.Name(),
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -6,8 +6,6 @@ import (
 	"regexp"
 	"sort"
 	"strings"
-
-	"golang.org/x/mod/semver"
 )
 
 var ignoredImageSuffixes = []string{"-uki", "-img"}
@@ -16,6 +14,19 @@ type TagList struct {
 	Tags           []string
 	Artifact       *Artifact
 	RegistryAndOrg string
+	// Comparator compares the versions in the tags. Defaults to
+	// SemverComparator.
+	Comparator VersionComparator
+	// IncludeDev makes the Newer* methods return the dev builds too, see
+	// Artifact.DevTag.
+	IncludeDev bool
+}
+
+func (tl TagList) comparator() VersionComparator {
+	if tl.Comparator == nil {
+		return SemverComparator{}
+	}
+	return tl.Comparator
 }
 
 // implements sort.Interface for TagList
@@ -32,7 +43,7 @@ func (tl TagList) Less(i, j int) bool {
 		return tl.Tags[i] < tl.Tags[j]
 	}
 
-	versionResult := semver.Compare(iVersions[0], jVersions[0])
+	versionResult := tl.comparator().Compare(iVersions[0], jVersions[0])
 
 	// Versions are not equal. No need to check software version.
 	if versionResult != 0 {
@@ -43,7 +54,7 @@ func (tl TagList) Less(i, j int) bool {
 	// If there are software versions compare, otherwise return the one with
 	// no software version as lower.
 	if iLen == 2 && jLen == 2 {
-		return semver.Compare(iVersions[1], jVersions[1]) == -1
+		return tl.comparator().Compare(iVersions[1], jVersions[1]) == -1
 	}
 
 	// The one with no software version is lower
@@ -95,7 +106,8 @@ func (tl TagList) OtherVersions() TagList {
 }
 
 // NewerVersions returns OtherVersions filtered to only include tags with
-// Version higher than the given artifact's.
+// Version higher than the given artifact's. Dev builds are only included with
+// IncludeDev.
 func (tl TagList) NewerVersions() TagList {
 	tags := tl.OtherVersions()
 
@@ -199,7 +211,8 @@ func (tl TagList) PrintImages() {
 	}
 }
 
-// Sorted returns the TagList sorted by semver.
+// Sorted returns the TagList sorted by the TagList's Comparator (semver by
+// default).
 // This means lower versions come first.
 func (tl TagList) Sorted() TagList {
 	newTagList := newTagListWithTags(tl, tl.Tags)
@@ -221,7 +234,7 @@ func (tl TagList) newerVersions() TagList {
 	newTags := []string{}
 	for _, t := range tl.Tags {
 		versions := extractVersions(t, *tl.Artifact)
-		if len(versions) > 0 && semver.Compare(versions[0], tl.Artifact.VersionForTag()) == +1 {
+		if len(versions) > 0 && !tl.skipDev(versions[0]) && tl.comparator().Compare(versions[0], tl.Artifact.VersionForTag()) == +1 {
 			newTags = append(newTags, t)
 		}
 	}
@@ -233,7 +246,7 @@ func (tl TagList) newerSoftwareVersions() TagList {
 	newTags := []string{}
 	for _, t := range tl.Tags {
 		versions := extractVersions(t, *tl.Artifact)
-		if len(versions) > 1 && semver.Compare(versions[1], tl.Artifact.SoftwareVersionForTag()) == +1 {
+		if len(versions) > 1 && !tl.skipDev(versions[0]) && tl.comparator().Compare(versions[1], tl.Artifact.SoftwareVersionForTag()) == +1 {
 			newTags = append(newTags, t)
 		}
 	}
@@ -245,12 +258,12 @@ func (tl TagList) newerSomeVersions() TagList {
 	newTags := []string{}
 	for _, t := range tl.Tags {
 		versions := extractVersions(t, *tl.Artifact)
-		if len(versions) < 1 {
+		if len(versions) < 1 || tl.skipDev(versions[0]) {
 			continue
 		}
 
-		versionResult := semver.Compare(versions[0], tl.Artifact.VersionForTag())
-		sVersionResult := semver.Compare(versions[1], tl.Artifact.SoftwareVersionForTag())
+		versionResult := tl.comparator().Compare(versions[0], tl.Artifact.VersionForTag())
+		sVersionResult := tl.comparator().Compare(versions[1], tl.Artifact.SoftwareVersionForTag())
 
 		// If kairos version is higher add it (no matter what the sversion is)
 		if versionResult > 0 {
@@ -286,7 +299,7 @@ func (tl TagList) NoPrereleases() TagList {
 			continue
 		}
 
-		versionIsPrerelease := semver.IsValid(versions[0]) && semver.Prerelease(versions[0]) != ""
+		versionIsPrerelease := tl.comparator().IsPrerelease(versions[0])
 		if versionIsPrerelease {
 			continue
 		}
@@ -327,12 +340,18 @@ func extractVersions(tagToCheck string, artifact Artifact) []string {
 	strippedTag := re.ReplaceAllString(tag, "")
 
 	if artifact.SoftwareVersionPrefix != "" { // If we know how to split the versions
-		// Construct a regexp for both versions and check if there is match
-		pattern := fmt.Sprintf("%s-(.+?)-%s(.+)", regexp.QuoteMeta(strippedTag), artifact.SoftwareVersionPrefix)
+		// Construct a regexp for all the versions and check if there is match.
+		// Additional software components follow the main one, in the same
+		// order as in the artifact's tag.
+		pattern := fmt.Sprintf("%s-(.+?)-%s", regexp.QuoteMeta(strippedTag), regexp.QuoteMeta(artifact.SoftwareVersionPrefix))
+		for _, c := range sortedComponents(artifact.Software) {
+			pattern += fmt.Sprintf("(.+?)-%s", regexp.QuoteMeta(c.Name))
+		}
+		pattern += "(.+)"
 		regexpObj := regexp.MustCompile(pattern)
 		matches := regexpObj.FindStringSubmatch(tagToCheck)
 
-		if len(matches) == 3 {
+		if len(matches) == len(artifact.Software)+3 {
 			return matches[1:]
 		}
 	}
@@ -355,7 +374,7 @@ func extractVersions(tagToCheck string, artifact Artifact) []string {
 // newTagListWithTags returns a copy of the given TagList with same Artifact
 // and RegistryAndOrg fields but with the given tags as Tags.
 func newTagListWithTags(tl TagList, tags []string) TagList {
-	return TagList{Artifact: tl.Artifact, RegistryAndOrg: tl.RegistryAndOrg, Tags: tags}
+	return TagList{Artifact: tl.Artifact, RegistryAndOrg: tl.RegistryAndOrg, Tags: tags, Comparator: tl.Comparator, IncludeDev: tl.IncludeDev}
 }
 
 func ignoreSuffixedTag(tag string) bool {
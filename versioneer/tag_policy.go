@@ -0,0 +1,174 @@
+package versioneer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxTagLength is the maximum length of a container image tag as defined by
+// the OCI distribution spec: [a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}
+const MaxTagLength = 128
+
+const defaultTagHashLength = 8
+
+// TagPolicy defines how a computed tag is sanitized and validated before it's
+// used as a container image tag. Some registries have stricter rules than the
+// OCI spec (e.g. shorter tags), so all the fields can be adjusted.
+type TagPolicy struct {
+	// MaxLength is the maximum allowed tag length. Defaults to MaxTagLength.
+	MaxLength int
+	// Separator replaces any character not allowed in a tag. Defaults to "-".
+	Separator string
+	// HashFallback truncates tags longer than MaxLength and suffixes them with
+	// a short digest of the full tag, instead of returning an error.
+	HashFallback bool
+	// HashLength is the number of hex characters of the digest used when
+	// HashFallback is true. Defaults to 8.
+	HashLength int
+}
+
+// DefaultTagPolicy is the policy used by Artifact.Tag. It only replaces
+// invalid characters and fails when the tag is too long.
+var DefaultTagPolicy = TagPolicy{
+	MaxLength: MaxTagLength,
+	Separator: "-",
+}
+
+// TagReport describes the changes applied to a tag while sanitizing it.
+type TagReport struct {
+	Original     string
+	Sanitized    string
+	Replacements []string // E.g. `"+" -> "-"`
+	Truncated    bool
+}
+
+// Changed returns true if the sanitized tag differs from the original one.
+func (r TagReport) Changed() bool {
+	return r.Original != r.Sanitized
+}
+
+// String returns a human readable summary of the report.
+func (r TagReport) String() string {
+	if !r.Changed() {
+		return fmt.Sprintf("tag %q is valid", r.Original)
+	}
+
+	result := fmt.Sprintf("tag %q sanitized to %q", r.Original, r.Sanitized)
+	if len(r.Replacements) > 0 {
+		result += fmt.Sprintf(" (replaced: %s)", strings.Join(r.Replacements, ", "))
+	}
+	if r.Truncated {
+		result += " (truncated and suffixed with a digest)"
+	}
+
+	return result
+}
+
+// TagWithPolicy returns the tag of the Artifact after applying the given
+// policy, along with a report of the changes.
+func (a *Artifact) TagWithPolicy(policy TagPolicy) (string, TagReport, error) {
+	commonName, err := a.commonVersionedName()
+	if err != nil {
+		return commonName, TagReport{}, err
+	}
+
+	return policy.Sanitize(commonName)
+}
+
+// Sanitize replaces any character not valid in a tag with the policy's
+// separator and validates the length of the result. If the tag is too long
+// and HashFallback is set, the tag is truncated and suffixed with a digest of
+// the original tag, so different long tags don't collide.
+func (p TagPolicy) Sanitize(tag string) (string, TagReport, error) {
+	p = p.withDefaults()
+	report := TagReport{Original: tag}
+
+	if !isValidTag(p.Separator) {
+		return "", report, fmt.Errorf("invalid tag separator %q", p.Separator)
+	}
+
+	if tag == "" {
+		return "", report, errors.New("tag is empty")
+	}
+
+	replaced := map[rune]bool{}
+	var sb strings.Builder
+	for i, r := range tag {
+		if isValidTagChar(r, i == 0) {
+			sb.WriteRune(r)
+			continue
+		}
+		if !replaced[r] {
+			replaced[r] = true
+			report.Replacements = append(report.Replacements, fmt.Sprintf("%q -> %q", string(r), p.Separator))
+		}
+		sb.WriteString(p.Separator)
+	}
+	result := sb.String()
+	if !isValidTagChar(rune(result[0]), true) {
+		return "", report, fmt.Errorf("tag %q must start with a letter, a digit or an underscore", result)
+	}
+
+	if len(result) > p.MaxLength {
+		if !p.HashFallback {
+			report.Sanitized = result
+			return "", report, fmt.Errorf("tag %q is %d characters long, the maximum allowed is %d", result, len(result), p.MaxLength)
+		}
+
+		if p.HashLength+1 >= p.MaxLength {
+			return "", report, fmt.Errorf("hash length %d does not fit in max tag length %d", p.HashLength, p.MaxLength)
+		}
+
+		sum := sha256.Sum256([]byte(tag))
+		digest := hex.EncodeToString(sum[:])[:p.HashLength]
+		prefix := strings.TrimRight(result[:p.MaxLength-p.HashLength-1], ".-")
+		result = fmt.Sprintf("%s-%s", prefix, digest)
+		report.Truncated = true
+	}
+
+	report.Sanitized = result
+
+	return result, report, nil
+}
+
+func (p TagPolicy) withDefaults() TagPolicy {
+	if p.MaxLength <= 0 || p.MaxLength > MaxTagLength {
+		p.MaxLength = MaxTagLength
+	}
+	if p.Separator == "" {
+		p.Separator = DefaultTagPolicy.Separator
+	}
+	if p.HashLength <= 0 {
+		p.HashLength = defaultTagHashLength
+	}
+	if p.HashLength > sha256.Size*2 {
+		p.HashLength = sha256.Size * 2
+	}
+
+	return p
+}
+
+// isValidTagChar checks a rune against [a-zA-Z0-9_][a-zA-Z0-9._-]
+func isValidTagChar(r rune, first bool) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+		return true
+	case r == '.' || r == '-':
+		return !first
+	}
+
+	return false
+}
+
+func isValidTag(s string) bool {
+	for _, r := range s {
+		if !isValidTagChar(r, false) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package versioneer_test
+
+import (
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TagPolicy", func() {
+	var artifact versioneer.Artifact
+
+	BeforeEach(func() {
+		artifact = versioneer.Artifact{
+			Flavor:                "opensuse",
+			FlavorRelease:         "leap-15.5",
+			Variant:               "standard",
+			Model:                 "generic",
+			Arch:                  "amd64",
+			Version:               "v2.4.2",
+			SoftwareVersion:       "v1.26.9+k3s1",
+			SoftwareVersionPrefix: "k3s",
+		}
+	})
+
+	It("reports replaced characters", func() {
+		tag, report, err := artifact.TagWithPolicy(versioneer.DefaultTagPolicy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tag).To(Equal("leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1"))
+		Expect(report.Changed()).To(BeTrue())
+		Expect(report.Truncated).To(BeFalse())
+		Expect(report.Replacements).To(Equal([]string{`"+" -> "-"`}))
+	})
+
+	It("uses the configured separator", func() {
+		tag, _, err := artifact.TagWithPolicy(versioneer.TagPolicy{Separator: "_"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tag).To(Equal("leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9_k3s1"))
+	})
+
+	It("rejects invalid separators", func() {
+		_, _, err := artifact.TagWithPolicy(versioneer.TagPolicy{Separator: "+"})
+		Expect(err).To(MatchError(`invalid tag separator "+"`))
+	})
+
+	When("the tag is too long", func() {
+		BeforeEach(func() {
+			artifact.FlavorRelease = strings.Repeat("a", 120)
+		})
+
+		It("returns an error by default", func() {
+			_, err := artifact.Tag()
+			Expect(err).To(MatchError(ContainSubstring("the maximum allowed is 128")))
+		})
+
+		It("truncates and suffixes a digest with HashFallback", func() {
+			policy := versioneer.TagPolicy{HashFallback: true}
+			tag, report, err := artifact.TagWithPolicy(policy)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(tag)).To(BeNumerically("<=", versioneer.MaxTagLength))
+			Expect(report.Truncated).To(BeTrue())
+			Expect(tag).To(MatchRegexp(`-[0-9a-f]{8}$`))
+
+			// Different versions still produce different tags
+			artifact.Version = "v2.4.3"
+			otherTag, _, err := artifact.TagWithPolicy(policy)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(otherTag).ToNot(Equal(tag))
+		})
+
+		It("honors a custom max length", func() {
+			artifact.FlavorRelease = "leap-15.5"
+			tag, _, err := artifact.TagWithPolicy(versioneer.TagPolicy{MaxLength: 30, HashFallback: true, HashLength: 6})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(tag)).To(BeNumerically("<=", 30))
+			Expect(tag).To(MatchRegexp(`^leap-15.5-standard-amd6-[0-9a-f]{6}$`))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package versioneer
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// UKISuffix is appended to the names of trusted boot artifacts, so they can be
+// told apart from the ones of the same release booting with a regular
+// bootloader.
+const UKISuffix = "uki"
+
+// KeyIDLength is the number of hex characters of a certificate fingerprint
+// used in artifact names.
+const KeyIDLength = 16
+
+var (
+	hexRegexp   = regexp.MustCompile(`^[0-9a-f]+$`)
+	keyIDRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+)
+
+// UKIName returns the name of the Unified Kernel Image (.efi) of the
+// Artifact. The keyID identifies the key the image is signed with and can be
+// empty, e.g.
+// kairos-opensuse-leap-15.5-standard-amd64-generic-v2.4.2-uki-0123456789abcdef.efi
+func (a *Artifact) UKIName(keyID string) (string, error) {
+	name, err := a.ukiBaseName(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	return name + ".efi", nil
+}
+
+// SignedISOName returns the name of the trusted boot ISO of the Artifact,
+// holding the UKIs signed with the key identified by keyID. See UKIName.
+func (a *Artifact) SignedISOName(keyID string) (string, error) {
+	name, err := a.ukiBaseName(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	return name + ".iso", nil
+}
+
+func (a *Artifact) ukiBaseName(keyID string) (string, error) {
+	bootableName, err := a.BootableName()
+	if err != nil {
+		return "", err
+	}
+
+	keyID, err = NormalizeKeyID(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s-%s", bootableName, UKISuffix)
+	if keyID != "" {
+		name = fmt.Sprintf("%s-%s", name, keyID)
+	}
+
+	return name, nil
+}
+
+// NormalizeKeyID returns the key identifier to use in artifact names. Hex
+// fingerprints, also in the "AB:CD:..." form printed by openssl, are
+// lowercased and truncated to KeyIDLength. Other identifiers (e.g. "dev") are
+// lowercased and used as they are.
+func NormalizeKeyID(keyID string) (string, error) {
+	keyID = strings.ToLower(strings.TrimSpace(keyID))
+	if keyID == "" {
+		return "", nil
+	}
+
+	if fingerprint := strings.ReplaceAll(keyID, ":", ""); hexRegexp.MatchString(fingerprint) {
+		if len(fingerprint) > KeyIDLength {
+			fingerprint = fingerprint[:KeyIDLength]
+		}
+		return fingerprint, nil
+	}
+
+	if !keyIDRegexp.MatchString(keyID) {
+		return "", fmt.Errorf("invalid key identifier %q: only letters, digits, \".\" and \"-\" are allowed", keyID)
+	}
+
+	return keyID, nil
+}
+
+// KeyIDFromCertificate returns the key identifier of a PEM encoded
+// certificate: the start of its SHA256 fingerprint.
+func KeyIDFromCertificate(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", errors.New("no PEM encoded certificate found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("parsing the certificate: %w", err)
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+
+	return hex.EncodeToString(sum[:])[:KeyIDLength], nil
+}
@@ -0,0 +1,93 @@
+package versioneer_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UKI names", func() {
+	var artifact versioneer.Artifact
+
+	BeforeEach(func() {
+		artifact = versioneer.Artifact{
+			Flavor:                "opensuse",
+			FlavorRelease:         "leap-15.5",
+			Variant:               "standard",
+			Model:                 "generic",
+			Arch:                  "amd64",
+			Version:               "v2.4.2",
+			SoftwareVersion:       "v1.26.9+k3s1",
+			SoftwareVersionPrefix: "k3s",
+		}
+	})
+
+	Describe("UKIName", func() {
+		It("returns the name without a key identifier", func() {
+			name, err := artifact.UKIName("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(Equal("kairos-opensuse-leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9+k3s1-uki.efi"))
+		})
+
+		It("returns the name with a truncated fingerprint", func() {
+			name, err := artifact.UKIName("0A:1B:2C:3D:4E:5F:60:71:82:93:A4:B5:C6:D7:E8:F9")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(Equal("kairos-opensuse-leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9+k3s1-uki-0a1b2c3d4e5f6071.efi"))
+		})
+
+		It("returns an error when the artifact is invalid", func() {
+			artifact.Version = ""
+			_, err := artifact.UKIName("dev")
+			Expect(err).To(MatchError("Version is empty"))
+		})
+	})
+
+	Describe("SignedISOName", func() {
+		It("returns the name with the key identifier", func() {
+			name, err := artifact.SignedISOName("Dev")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(Equal("kairos-opensuse-leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9+k3s1-uki-dev.iso"))
+		})
+
+		It("returns an error when the key identifier is invalid", func() {
+			_, err := artifact.SignedISOName("my key")
+			Expect(err).To(MatchError(ContainSubstring("invalid key identifier")))
+		})
+	})
+
+	Describe("KeyIDFromCertificate", func() {
+		It("returns the start of the certificate fingerprint", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: "db"},
+				NotBefore:    time.Now(),
+				NotAfter:     time.Now().Add(time.Hour),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+			Expect(err).ToNot(HaveOccurred())
+			sum := sha256.Sum256(der)
+
+			keyID, err := versioneer.KeyIDFromCertificate(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyID).To(Equal(hex.EncodeToString(sum[:])[:versioneer.KeyIDLength]))
+		})
+
+		It("returns an error when there is no certificate", func() {
+			_, err := versioneer.KeyIDFromCertificate([]byte("not a certificate"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,157 @@
+package versioneer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UpgradeStrategy defines which tags are considered by BestUpgradeCandidate.
+type UpgradeStrategy string
+
+const (
+	// UpgradeHighest picks the highest version, upgrading the Kairos version
+	// and/or the software version.
+	UpgradeHighest UpgradeStrategy = "highest"
+	// UpgradeSameSoftware picks the highest Kairos version with the same
+	// software version as the current artifact.
+	UpgradeSameSoftware UpgradeStrategy = "same-software"
+	// UpgradeLTS picks the highest version in the same release streams as the
+	// current artifact, that is with the same major and minor Kairos version
+	// (and software version, if any), as returned by the TagList's
+	// Comparator Stream.
+	UpgradeLTS UpgradeStrategy = "lts"
+)
+
+// Reasons returned in UpgradeCandidate.Excluded
+const (
+	ExcludedNotAnImage         = "not an image"
+	ExcludedNoVersion          = "no version found"
+	ExcludedNoSoftwareVersion  = "no software version found"
+	ExcludedPrerelease         = "pre-release"
+	ExcludedNotNewer           = "not newer than the current version"
+	ExcludedDifferentSoftware  = "different software version"
+	ExcludedDifferentStream    = "different release stream"
+	ExcludedDifferentSWStream  = "different software release stream"
+	ExcludedLowerThanCandidate = "lower than the selected candidate"
+)
+
+// UpgradePolicy configures BestUpgradeCandidate.
+type UpgradePolicy struct {
+	Strategy UpgradeStrategy
+	// Prereleases allows selecting Kairos pre-release versions
+	Prereleases bool
+}
+
+// UpgradeCandidate is the result of BestUpgradeCandidate.
+type UpgradeCandidate struct {
+	// Tag is the selected tag, empty if there is no upgrade available
+	Tag string
+	// Excluded maps every other tag in the TagList to the reason it was not
+	// selected
+	Excluded map[string]string
+}
+
+// Found returns true if a tag was selected.
+func (uc UpgradeCandidate) Found() bool {
+	return uc.Tag != ""
+}
+
+// BestUpgradeCandidate picks the single tag from the TagList that the
+// TagList's Artifact should upgrade to, according to the given policy.
+// Candidates are the tags returned by NewerAnyVersion, filtered by the policy
+// strategy. The highest one (as sorted by Sorted) is selected.
+func BestUpgradeCandidate(tl TagList, policy UpgradePolicy) (UpgradeCandidate, error) {
+	result := UpgradeCandidate{Excluded: map[string]string{}}
+	if tl.Artifact == nil {
+		return result, errors.New("no artifact defined")
+	}
+
+	switch policy.Strategy {
+	case "":
+		policy.Strategy = UpgradeHighest
+	case UpgradeHighest, UpgradeSameSoftware, UpgradeLTS:
+	default:
+		return result, fmt.Errorf("unknown upgrade strategy %q", policy.Strategy)
+	}
+
+	images := map[string]bool{}
+	for _, t := range tl.Images().Tags {
+		images[t] = true
+	}
+
+	candidates := []string{}
+	for _, t := range tl.Tags {
+		if !images[t] {
+			result.Excluded[t] = ExcludedNotAnImage
+			continue
+		}
+		if reason := tl.upgradeExclusion(t, policy); reason != "" {
+			result.Excluded[t] = reason
+			continue
+		}
+		candidates = append(candidates, t)
+	}
+
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	sorted := newTagListWithTags(tl, candidates).RSorted().Tags
+	result.Tag = sorted[0]
+	for _, t := range sorted[1:] {
+		result.Excluded[t] = ExcludedLowerThanCandidate
+	}
+
+	return result, nil
+}
+
+// upgradeExclusion returns the reason why the tag is not a valid upgrade for
+// the TagList's Artifact, or an empty string if it is.
+func (tl TagList) upgradeExclusion(tag string, policy UpgradePolicy) string {
+	a := tl.Artifact
+	versions := extractVersions(tag, *a)
+	if len(versions) == 0 {
+		return ExcludedNoVersion
+	}
+	hasSoftware := a.SoftwareVersion != ""
+	if hasSoftware && len(versions) < 2 {
+		return ExcludedNoSoftwareVersion
+	}
+	if !policy.Prereleases && tl.comparator().IsPrerelease(versions[0]) {
+		return ExcludedPrerelease
+	}
+
+	// Same logic as NewerAnyVersion
+	versionResult := tl.comparator().Compare(versions[0], a.VersionForTag())
+	newer := versionResult > 0
+	if hasSoftware && versionResult == 0 {
+		newer = tl.comparator().Compare(versions[1], a.SoftwareVersionForTag()) > 0
+	}
+	if !newer {
+		return ExcludedNotNewer
+	}
+
+	switch policy.Strategy {
+	case UpgradeSameSoftware:
+		if hasSoftware && versions[1] != a.SoftwareVersionForTag() {
+			return ExcludedDifferentSoftware
+		}
+	case UpgradeLTS:
+		if !tl.sameStream(versions[0], a.VersionForTag()) {
+			return ExcludedDifferentStream
+		}
+		if hasSoftware && !tl.sameStream(versions[1], a.SoftwareVersionForTag()) {
+			return ExcludedDifferentSWStream
+		}
+	}
+
+	return ""
+}
+
+// sameStream returns true if both versions are in the same release stream
+// according to the TagList's comparator. Versions without a stream are never
+// in the same one.
+func (tl TagList) sameStream(v, w string) bool {
+	stream := tl.comparator().Stream(v)
+	return stream != "" && stream == tl.comparator().Stream(w)
+}
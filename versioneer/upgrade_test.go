@@ -0,0 +1,123 @@
+package versioneer_test
+
+import (
+	"github.com/kairos-io/kairos-sdk/versioneer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/mod/semver"
+)
+
+// majorStreams is a comparator with a release stream per major version.
+type majorStreams struct {
+	versioneer.SemverComparator
+}
+
+func (majorStreams) Stream(v string) string {
+	return semver.Major(v)
+}
+
+// noStreams is a comparator without release streams.
+type noStreams struct {
+	versioneer.SemverComparator
+}
+
+func (noStreams) Stream(string) string {
+	return ""
+}
+
+var _ = Describe("BestUpgradeCandidate", func() {
+	var tagList versioneer.TagList
+
+	BeforeEach(func() {
+		tagList = versioneer.TagList{
+			Artifact: &versioneer.Artifact{
+				Flavor:                "opensuse",
+				FlavorRelease:         "leap-15.5",
+				Variant:               "standard",
+				Model:                 "generic",
+				Arch:                  "amd64",
+				Version:               "v2.4.2",
+				SoftwareVersion:       "v1.26.9+k3s1",
+				SoftwareVersionPrefix: "k3s",
+			},
+			RegistryAndOrg: "quay.io/kairos",
+			Tags: []string{
+				"leap-15.5-standard-amd64-generic-v2.4.1-k3sv1.26.9-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.27.6-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.10-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.26.9-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.28.2-k3s1",
+				"leap-15.5-standard-amd64-generic-v2.6.0-rc1-k3sv1.28.2-k3s1",
+				"sha256-0123456789abcdef.sbom",
+				"leap-15.5-core-amd64-generic-v2.5.0",
+			},
+		}
+	})
+
+	It("picks the highest version by default", func() {
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Found()).To(BeTrue())
+		Expect(result.Tag).To(Equal("leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.28.2-k3s1"))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.4.1-k3sv1.26.9-k3s1", versioneer.ExcludedNotNewer))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.26.9-k3s1", versioneer.ExcludedNotNewer))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.6.0-rc1-k3sv1.28.2-k3s1", versioneer.ExcludedPrerelease))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.26.9-k3s1", versioneer.ExcludedLowerThanCandidate))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-core-amd64-generic-v2.5.0", versioneer.ExcludedNoVersion))
+		Expect(result.Excluded).To(HaveKeyWithValue("sha256-0123456789abcdef.sbom", versioneer.ExcludedNotAnImage))
+		// Every tag is either selected or excluded
+		Expect(result.Excluded).To(HaveLen(len(tagList.Tags) - 1))
+	})
+
+	It("allows pre-releases when asked to", func() {
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{Prereleases: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Tag).To(Equal("leap-15.5-standard-amd64-generic-v2.6.0-rc1-k3sv1.28.2-k3s1"))
+	})
+
+	It("keeps the software version with the same-software strategy", func() {
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{Strategy: versioneer.UpgradeSameSoftware})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Tag).To(Equal("leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.26.9-k3s1"))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.28.2-k3s1", versioneer.ExcludedDifferentSoftware))
+	})
+
+	It("stays in the release streams with the lts strategy", func() {
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{Strategy: versioneer.UpgradeLTS})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Tag).To(Equal("leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.10-k3s1"))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.26.9-k3s1", versioneer.ExcludedDifferentStream))
+		Expect(result.Excluded).To(HaveKeyWithValue("leap-15.5-standard-amd64-generic-v2.4.2-k3sv1.27.6-k3s1", versioneer.ExcludedDifferentSWStream))
+	})
+
+	It("uses the release streams of the comparator with the lts strategy", func() {
+		tagList.Comparator = majorStreams{}
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{Strategy: versioneer.UpgradeLTS})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Tag).To(Equal("leap-15.5-standard-amd64-generic-v2.5.0-k3sv1.28.2-k3s1"))
+	})
+
+	It("excludes versions without a release stream with the lts strategy", func() {
+		tagList.Tags = []string{"leap-15.5-standard-amd64-generic-v2.4.3-k3sv1.26.9-k3s1"}
+		tagList.Comparator = noStreams{}
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{Strategy: versioneer.UpgradeLTS})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Found()).To(BeFalse())
+		Expect(result.Excluded).To(HaveKeyWithValue(tagList.Tags[0], versioneer.ExcludedDifferentStream))
+	})
+
+	It("returns no candidate when there are no upgrades", func() {
+		tagList.Tags = tagList.Tags[:2]
+		result, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Found()).To(BeFalse())
+		Expect(result.Excluded).To(HaveLen(2))
+	})
+
+	It("rejects unknown strategies", func() {
+		_, err := versioneer.BestUpgradeCandidate(tagList, versioneer.UpgradePolicy{Strategy: "latest"})
+		Expect(err).To(MatchError(`unknown upgrade strategy "latest"`))
+	})
+})
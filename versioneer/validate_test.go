@@ -1,6 +1,8 @@
 package versioneer_test
 
 import (
+	"os"
+
 	"github.com/kairos-io/kairos-sdk/versioneer"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -51,4 +53,77 @@ var _ = Describe("Validate", func() {
 
 		Expect(artifact.Validate()).To(MatchError("SoftwareVersionPrefix should be defined when SoftwareVersion is not empty"))
 	})
+
+	When("validating strictly", func() {
+		BeforeEach(func() {
+			artifact.Strict = true
+		})
+
+		It("returns an error when Variant is not core or standard", func() {
+			artifact.Variant = "minimal"
+			Expect(artifact.Validate()).To(MatchError(`Variant "minimal" is not valid, it must be one of core, standard`))
+		})
+
+		It("returns an error when Family doesn't match Flavor", func() {
+			artifact.Family = "rhel"
+			Expect(artifact.Validate()).To(MatchError(`Family "rhel" doesn't match Flavor "opensuse", whose family is "opensuse"`))
+			artifact.Family = "opensuse"
+			Expect(artifact.Validate()).To(Succeed())
+		})
+
+		It("returns an error when Model is not built for Arch", func() {
+			artifact.Model = "rpi4"
+			Expect(artifact.Validate()).To(MatchError(`Model "rpi4" is not built for Arch "amd64", only for arm64`))
+			artifact.Arch = "arm64"
+			Expect(artifact.Validate()).To(Succeed())
+		})
+
+		It("returns an error when the flavor or model are not official", func() {
+			artifact.Flavor = "mydistro"
+			artifact.Model = "myboard"
+			Expect(artifact.Validate()).To(MatchError(ContainSubstring(`Flavor "mydistro" is unknown`)))
+			artifact.Flavor = "opensuse"
+			Expect(artifact.Validate()).To(MatchError(ContainSubstring(`Model "myboard" is unknown`)))
+		})
+
+		It("accepts the newer official flavors and models", func() {
+			artifact.Flavor = "hadron"
+			artifact.Family = "hadron"
+			artifact.Model = "nvidia-jetson-orin-nx"
+			artifact.Arch = "arm64"
+			Expect(artifact.Validate()).To(Succeed())
+		})
+	})
+
+	It("accepts flavors, families, variants and models that are not official by default", func() {
+		artifact.Flavor = "mydistro"
+		artifact.Family = "mydistro"
+		artifact.Variant = "minimal"
+		artifact.Model = "myboard"
+		Expect(artifact.Validate()).To(Succeed())
+
+		name, err := artifact.BootableName()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(name).To(Equal("kairos-mydistro-leap-15.5-minimal-amd64-myboard-v2.4.2"))
+	})
+
+	It("names artifacts read from a kairos-release with a model missing from the tables", func() {
+		f, err := os.CreateTemp("", "kairos-release")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(f.Name())
+		Expect(os.WriteFile(f.Name(), []byte(`KAIROS_FLAVOR="ubuntu"
+KAIROS_FAMILY="ubuntu"
+KAIROS_FLAVOR_RELEASE="24.04"
+KAIROS_VARIANT="core"
+KAIROS_MODEL="nvidia-jetson-orin-nano"
+KAIROS_TARGETARCH="arm64"
+KAIROS_RELEASE="v3.2.0"
+`), 0644)).To(Succeed())
+
+		a, err := versioneer.NewArtifactFromOSRelease(f.Name())
+		Expect(err).ToNot(HaveOccurred())
+		tag, err := a.Tag()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tag).To(Equal("24.04-core-arm64-nvidia-jetson-orin-nano-v3.2.0"))
+	})
 })
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/kairos-io/kairos-sdk/utils"
+	"github.com/rs/zerolog"
 )
 
 const (
@@ -27,6 +28,14 @@ const (
 	EnvVarBugReportURL          = "BUG_REPORT_URL"
 	EnvVarHomeURL               = "HOME_URL"
 	EnvVarFamily                = "FAMILY"
+	EnvVarMaxTagLength          = "MAX_TAG_LENGTH"
+	EnvVarTagSeparator          = "TAG_SEPARATOR"
+	EnvVarHashLongTags          = "HASH_LONG_TAGS"
+	EnvVarKeyID                 = "UKI_KEY_ID"
+	EnvVarCert                  = "UKI_CERT"
+	EnvVarStrict                = "STRICT_VALIDATION"
+	EnvVarDevPR                 = "DEV_PR_NUMBER"
+	EnvVarDevSHA                = "DEV_SHA"
 )
 
 type Artifact struct {
@@ -36,12 +45,44 @@ type Artifact struct {
 	Variant               string
 	Model                 string
 	Arch                  string
-	Version               string // The Kairos version. E.g. "v2.4.2"
-	SoftwareVersion       string // The k3s version. E.g. "v1.26.9+k3s1"
-	SoftwareVersionPrefix string // E.g. k3s
-	RegistryInspector     RegistryInspector
+	Version               string              // The Kairos version. E.g. "v2.4.2"
+	SoftwareVersion       string              // The k3s version. E.g. "v1.26.9+k3s1"
+	SoftwareVersionPrefix string              // E.g. k3s
+	Software              []SoftwareComponent // Additional software, encoded in the tag after SoftwareVersion
+	RegistryInspector     RegistryInspector   `json:"-"`
+	// Strict also checks the Variant, Flavor, Family and Model against the
+	// official ones (Variants, FlavorFamilies and ModelArchs) when
+	// validating. Off by default, so community flavors and models, or
+	// official ones newer than the tables, can still be named.
+	Strict bool `json:"-"`
 }
 
+// MarshalZerologObject implements zerolog.LogObjectMarshaler so artifacts can
+// be logged as structured fields with Object(). Empty fields are skipped.
+func (a Artifact) MarshalZerologObject(e *zerolog.Event) {
+	for _, f := range []struct{ key, value string }{
+		{"flavor", a.Flavor},
+		{"family", a.Family},
+		{"flavor_release", a.FlavorRelease},
+		{"variant", a.Variant},
+		{"model", a.Model},
+		{"arch", a.Arch},
+		{"version", a.Version},
+		{"software_version", a.SoftwareVersion},
+		{"software_version_prefix", a.SoftwareVersionPrefix},
+	} {
+		if f.value != "" {
+			e.Str(f.key, f.value)
+		}
+	}
+	if len(a.Software) > 0 {
+		e.Str("software", FormatSoftwareComponents(a.Software))
+	}
+}
+
+// NewArtifactFromJSON generates an artifact from its JSON representation. Both
+// the ArtifactJSON schema (snake_case keys) and the Go field names
+// (e.g. "flavorRelease") are accepted.
 func NewArtifactFromJSON(jsonStr string) (*Artifact, error) {
 	result := &Artifact{}
 	err := json.Unmarshal([]byte(jsonStr), result)
@@ -92,17 +133,36 @@ func NewArtifactFromOSRelease(file ...string) (*Artifact, error) {
 		return nil, err
 	}
 
+	// Optional, could be missing
+	software, err := utils.OSRelease(EnvVarSoftware, file...)
+	if err != nil && !errors.As(err, &utils.KeyNotFoundErr{}) {
+		return nil, err
+	}
+	if software != "" {
+		if result.Software, err = ParseSoftwareComponents(software); err != nil {
+			return nil, err
+		}
+	}
+
 	return &result, nil
 }
 
+// Validate checks the artifact has all the fields needed for its names, and
+// that they are consistent with each other.
 func (a *Artifact) Validate() error {
 	if a.Variant == "" {
 		return errors.New("Variant is empty")
 	}
+	if a.Strict {
+		if err := a.validateVariant(); err != nil {
+			return err
+		}
+	}
 
 	return a.ValidateBase()
 }
 
+// ValidateBase is like Validate but for base images, which have no Variant.
 func (a *Artifact) ValidateBase() error {
 	if a.FlavorRelease == "" {
 		return errors.New("FlavorRelease is empty")
@@ -114,10 +174,19 @@ func (a *Artifact) ValidateBase() error {
 		return errors.New("Arch is empty")
 	}
 
+	if a.Strict {
+		if err := a.validateFamily(); err != nil {
+			return err
+		}
+		if err := a.validateModel(); err != nil {
+			return err
+		}
+	}
+
 	if a.SoftwareVersion != "" && a.SoftwareVersionPrefix == "" {
 		return errors.New("SoftwareVersionPrefix should be defined when SoftwareVersion is not empty")
 	}
-	return nil
+	return a.validateSoftware()
 }
 
 func (a *Artifact) BootableName() (string, error) {
@@ -138,16 +207,25 @@ func (a *Artifact) Repository(registryAndOrg string) string {
 }
 
 func (a *Artifact) ContainerName(registryAndOrg string) (string, error) {
+	name, _, err := a.ContainerNameWithPolicy(registryAndOrg, DefaultTagPolicy)
+
+	return name, err
+}
+
+// ContainerNameWithPolicy is like ContainerName but the tag is computed with
+// the given TagPolicy. The returned TagReport describes any changes made to
+// the tag.
+func (a *Artifact) ContainerNameWithPolicy(registryAndOrg string, policy TagPolicy) (string, TagReport, error) {
 	if a.Flavor == "" {
-		return "", errors.New("Flavor is empty")
+		return "", TagReport{}, errors.New("Flavor is empty")
 	}
 
-	tag, err := a.Tag()
+	tag, report, err := a.TagWithPolicy(policy)
 	if err != nil {
-		return "", err
+		return "", report, err
 	}
 
-	return fmt.Sprintf("%s:%s", a.Repository(registryAndOrg), tag), nil
+	return fmt.Sprintf("%s:%s", a.Repository(registryAndOrg), tag), report, nil
 }
 
 func (a *Artifact) BaseContainerName(registryAndOrg, id string) (string, error) {
@@ -178,13 +256,13 @@ func (a *Artifact) BaseTag() (string, error) {
 	return result, nil
 }
 
+// Tag returns the container image tag of the Artifact. Characters not allowed
+// in tags are replaced with "-" and an error is returned if the result is
+// longer than MaxTagLength. Use TagWithPolicy for different rules.
 func (a *Artifact) Tag() (string, error) {
-	commonName, err := a.commonVersionedName()
-	if err != nil {
-		return commonName, err
-	}
+	tag, _, err := a.TagWithPolicy(DefaultTagPolicy)
 
-	return strings.ReplaceAll(commonName, "+", "-"), nil
+	return tag, err
 }
 
 // VersionForTag replaces and "+" symbols with "-" because in container image
@@ -265,6 +343,9 @@ func (a *Artifact) OSReleaseVariables(registryAndOrg, githubRepo, bugURL, homeUR
 	if a.SoftwareVersionPrefix != "" {
 		vars["KAIROS_SOFTWARE_VERSION_PREFIX"] = a.SoftwareVersionPrefix
 	}
+	if len(a.Software) > 0 {
+		vars["KAIROS_SOFTWARE"] = FormatSoftwareComponents(a.Software)
+	}
 
 	result := ""
 	for k, v := range vars {
@@ -305,8 +386,8 @@ func (a *Artifact) commonVersionedName() (string, error) {
 
 	result = fmt.Sprintf("%s-%s", result, a.Version)
 
-	if a.SoftwareVersion != "" {
-		result = fmt.Sprintf("%s-%s%s", result, a.SoftwareVersionPrefix, a.SoftwareVersion)
+	for _, c := range a.SoftwareComponents() {
+		result = fmt.Sprintf("%s-%s%s", result, c.Name, c.Version)
 	}
 
 	return result, nil